@@ -0,0 +1,55 @@
+// +build !windows
+
+package ansi
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if err != 0 {
+		return err
+	}
+	return nil
+}
+
+// Put the terminal into raw mode, in which keys are read as they are typed
+// and aren't echoed. Returns a func that puts it back the way it was.
+func MakeRaw(f *os.File) (func() error, error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), ioctlReadTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(f.Fd(), ioctlWriteTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return ioctl(f.Fd(), ioctlWriteTermios, unsafe.Pointer(&old))
+	}, nil
+}
+
+// The number of columns and rows of the terminal.
+func Size(f *os.File) (int, int, error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
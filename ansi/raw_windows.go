@@ -0,0 +1,16 @@
+package ansi
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoRawMode = errors.New("raw terminal mode is not supported on windows")
+
+func MakeRaw(f *os.File) (func() error, error) {
+	return nil, errNoRawMode
+}
+
+func Size(f *os.File) (int, int, error) {
+	return 0, 0, errNoRawMode
+}
@@ -3,3 +3,4 @@ package ansi
 import "syscall"
 
 const ioctlReadTermios = syscall.TIOCGETA
+const ioctlWriteTermios = syscall.TIOCSETA
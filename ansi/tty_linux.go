@@ -1,4 +1,4 @@
 package ansi
 
 const ioctlReadTermios = 0x5401  // syscall.TCGETS
-const ioctlWriteTermios = 0x5402 //nolint syscall.TCSETS
+const ioctlWriteTermios = 0x5402 // syscall.TCSETS
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"path"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+const (
+	defaultAggregateDepth uint = 1
+	maxAggregateDepth     uint = 10
+)
+
+// The number of files that match and the number of matching lines in them.
+type matchCount struct {
+	Files   int
+	Matches int
+}
+
+func (c *matchCount) add(matches int) {
+	c.Files++
+	c.Matches += matches
+}
+
+// The counts for a repo, along with those for each directory of the repo
+// down to the depth of the aggregation. Files at the root are counted under
+// "/".
+type repoAggregate struct {
+	matchCount
+	Directories map[string]*matchCount
+}
+
+// The response to an aggregated search, which has the counts of matches
+// rather than the matches themselves. Files without an extension are
+// counted under "".
+type searchAggregate struct {
+	matchCount
+	Repos      map[string]*repoAggregate
+	Extensions map[string]*matchCount
+
+	searchFailures
+}
+
+// The first depth directories of the file, or "/" for files at the root.
+func directoryPrefix(name string, depth int) string {
+	dirs := strings.Split(path.Dir(name), "/")
+	if dirs[0] == "." {
+		return "/"
+	}
+
+	if len(dirs) > depth {
+		dirs = dirs[:depth]
+	}
+	return strings.Join(dirs, "/") + "/"
+}
+
+// Count the matches of a search, made with CountOnly, by repo, directory
+// and extension.
+func aggregate(results map[string]*index.SearchResponse, depth int) *searchAggregate {
+	res := &searchAggregate{
+		Repos:      map[string]*repoAggregate{},
+		Extensions: map[string]*matchCount{},
+	}
+
+	for repo, sr := range results {
+		ra := &repoAggregate{Directories: map[string]*matchCount{}}
+		res.Repos[repo] = ra
+
+		for _, fm := range sr.Matches {
+			res.add(fm.Count)
+			ra.add(fm.Count)
+
+			dir := directoryPrefix(fm.Filename, depth)
+			if ra.Directories[dir] == nil {
+				ra.Directories[dir] = &matchCount{}
+			}
+			ra.Directories[dir].add(fm.Count)
+
+			ext := path.Ext(fm.Filename)
+			if res.Extensions[ext] == nil {
+				res.Extensions[ext] = &matchCount{}
+			}
+			res.Extensions[ext].add(fm.Count)
+		}
+	}
+
+	return res
+}
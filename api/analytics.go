@@ -0,0 +1,204 @@
+package api
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+)
+
+const (
+	// Searches are counted in buckets of an hour and a day of them is kept.
+	analyticsInterval = time.Hour
+	analyticsBuckets  = 24
+
+	// Bounds on each bucket, so a flood of distinct queries can't use up
+	// memory. Queries beyond the limit are counted but not listed, and
+	// latencies are sampled.
+	maxBucketQueries   = 10000
+	maxBucketLatencies = 1000
+
+	defaultTopQueries uint = 20
+	maxTopQueries     uint = 1000
+)
+
+// A query and the number of times it was searched for.
+type queryCount struct {
+	Query string
+	Count int
+}
+
+// The searches made over the last day. Latencies are in milliseconds.
+type analyticsReport struct {
+	Since             time.Time
+	Searches          int
+	ZeroResults       int
+	TopQueries        []*queryCount
+	ZeroResultQueries []*queryCount
+	Repos             map[string]int
+	LatencyP50        int
+	LatencyP95        int
+}
+
+// The searches made within an hour.
+type analyticsBucket struct {
+	start       time.Time
+	searches    int
+	zeroResults int
+	queries     map[string]int
+	zero        map[string]int
+	repos       map[string]int
+	latencies   []int
+}
+
+func newAnalyticsBucket(start time.Time) *analyticsBucket {
+	return &analyticsBucket{
+		start:   start,
+		queries: map[string]int{},
+		zero:    map[string]int{},
+		repos:   map[string]int{},
+	}
+}
+
+func countQuery(counts map[string]int, query string) {
+	if _, ok := counts[query]; ok || len(counts) < maxBucketQueries {
+		counts[query]++
+	}
+}
+
+// Rolling counts of the searches made over the last day.
+type analytics struct {
+	lck     sync.Mutex
+	buckets []*analyticsBucket
+}
+
+// The bucket for searches made now, dropping buckets that are too old.
+func (a *analytics) bucket(now time.Time) *analyticsBucket {
+	start := now.Truncate(analyticsInterval)
+	if n := len(a.buckets); n > 0 && a.buckets[n-1].start.Equal(start) {
+		return a.buckets[n-1]
+	}
+
+	b := newAnalyticsBucket(start)
+	a.buckets = append(a.buckets, b)
+
+	cutoff := start.Add(-(analyticsBuckets - 1) * analyticsInterval)
+	for len(a.buckets) > 0 && a.buckets[0].start.Before(cutoff) {
+		a.buckets = a.buckets[1:]
+	}
+	return b
+}
+
+// Count a search of the repos that matched in the given number of repos.
+func (a *analytics) record(query string, repos []string, matched, durationMs int, now time.Time) {
+	a.lck.Lock()
+	defer a.lck.Unlock()
+
+	b := a.bucket(now)
+	b.searches++
+	countQuery(b.queries, query)
+
+	if matched == 0 {
+		b.zeroResults++
+		countQuery(b.zero, query)
+	}
+
+	for _, repo := range repos {
+		b.repos[repo]++
+	}
+
+	// keep a uniform sample of the latencies.
+	if len(b.latencies) < maxBucketLatencies {
+		b.latencies = append(b.latencies, durationMs)
+	} else if i := rand.Intn(b.searches); i < maxBucketLatencies {
+		b.latencies[i] = durationMs
+	}
+}
+
+// The most counted queries, at most limit of them.
+func topQueries(counts map[string]int, limit int) []*queryCount {
+	res := make([]*queryCount, 0, len(counts))
+	for q, n := range counts {
+		res = append(res, &queryCount{Query: q, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Query < res[j].Query
+	})
+
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// The value below which the fraction p of the sorted values fall.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// Sum up the buckets of the last day.
+func (a *analytics) report(limit int, now time.Time) *analyticsReport {
+	a.lck.Lock()
+	defer a.lck.Unlock()
+
+	// drop buckets that are too old, even if nothing was searched since.
+	a.bucket(now)
+
+	res := &analyticsReport{
+		Since: a.buckets[0].start,
+		Repos: map[string]int{},
+	}
+
+	queries := map[string]int{}
+	zero := map[string]int{}
+	var latencies []int
+	for _, b := range a.buckets {
+		res.Searches += b.searches
+		res.ZeroResults += b.zeroResults
+
+		for q, n := range b.queries {
+			queries[q] += n
+		}
+
+		for q, n := range b.zero {
+			zero[q] += n
+		}
+
+		for repo, n := range b.repos {
+			res.Repos[repo] += n
+		}
+
+		latencies = append(latencies, b.latencies...)
+	}
+
+	sort.Ints(latencies)
+	res.TopQueries = topQueries(queries, limit)
+	res.ZeroResultQueries = topQueries(zero, limit)
+	res.LatencyP50 = percentile(latencies, 0.5)
+	res.LatencyP95 = percentile(latencies, 0.95)
+	return res
+}
+
+func setupAnalytics(m *http.ServeMux, a *authorizer, an *analytics) {
+	m.HandleFunc("/api/v1/admin/analytics", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		limit := parseAsUintValue(
+			r.FormValue("limit"),
+			1,
+			maxTopQueries,
+			defaultTopQueries)
+		writeResp(w, an.report(int(limit), time.Now()))
+	})
+}
@@ -6,23 +6,185 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
 	"github.com/hound-search/hound/config"
 	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/saved"
 	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/vcs"
 )
 
 const (
 	defaultLinesOfContext uint = 2
 	maxLinesOfContext     uint = 20
+	defaultCommitResults  uint = 50
+	maxCommitResults      uint = 1000
 )
 
 type Stats struct {
 	FilesOpened int
 	Duration    int
+
+	// The stats of each repo searched, by name.
+	Repos map[string]*RepoStats `json:",omitempty"`
+}
+
+// The stats of the search of one repo. Duration is the time in milliseconds
+// from the start of the search until the repo's results were in, including
+// any wait for the repo's index. Truncated is set when the repo stopped at
+// maxMatches.
+type RepoStats struct {
+	FilesOpened int
+	Duration    int
+	Truncated   bool
+}
+
+// The response to a search, keyed by repo.
+type searchResults struct {
+	Results map[string]*index.SearchResponse
+	Stats   *Stats `json:",omitempty"`
+
+	// Whether a repo's search or the results as a whole were cut short by
+	// maxMatches.
+	Truncated bool `json:",omitempty"`
+
+	// The order of the repos when the results are sorted, which is the
+	// order their first files come in when the files of every repo are
+	// merged in that order.
+	Repos []string `json:",omitempty"`
+
+	// How the search was interpreted, when asked for.
+	Explain *searchExplanation `json:",omitempty"`
+
+	searchFailures
+}
+
+// The problems of the pattern of a search, which the UI checks for as it
+// is typed. A pattern with an error isn't Valid and is refused by searches.
+type patternReport struct {
+	Valid    bool
+	Problems []*index.PatternProblem `json:",omitempty"`
+}
+
+// The report of the problems of a pattern, or of why it doesn't parse.
+func newPatternReport(problems []*index.PatternProblem, err error) *patternReport {
+	if err != nil {
+		problems = []*index.PatternProblem{{Severity: index.SeverityError, Message: err.Error()}}
+	}
+
+	res := &patternReport{Valid: true, Problems: problems}
+	for _, p := range problems {
+		if p.Severity == index.SeverityError {
+			res.Valid = false
+		}
+	}
+	return res
+}
+
+// The part of a GitHub push, delete or repository event that is used. The
+// kind of event is given by the X-GitHub-Event header.
+type githubPush struct {
+	Repository struct {
+		Name      string
+		Full_name string
+		Clone_url string
+		Ssh_url   string
+		Git_url   string
+		Html_url  string
+	}
+
+	// Set for a push that deleted a branch or tag.
+	Deleted bool
+
+	// What happened to the repository, for repository events.
+	Action string
+}
+
+// Matches scp-like ssh urls, like git@github.com:org/repo.git, which have
+// no scheme.
+var scpUrlPattern = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.*)$`)
+
+// Reduce the url of a repo to its host and path, so that the https and ssh
+// urls of a repo are the same, without the credentials, port, trailing .git
+// and case they may have.
+func normalizeUrl(u string) string {
+	u = strings.TrimSpace(u)
+	if !strings.Contains(u, "://") {
+		if m := scpUrlPattern.FindStringSubmatch(u); m != nil {
+			u = "ssh://" + m[1] + "/" + m[2]
+		}
+	}
+
+	host, path := "", u
+	if pu, err := url.Parse(u); err == nil {
+		host, path = pu.Hostname(), pu.Path
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host + "/" + path)
+}
+
+// The names of the repos a GitHub event is for, those cloned from one of
+// the urls of its repository, like the repos of the subdirectories of a
+// monorepo, or else the repo named by its full name.
+func githubRepos(idx map[string]*searcher.Searcher, h *githubPush) []string {
+	urls := map[string]bool{}
+	for _, u := range []string{h.Repository.Clone_url, h.Repository.Ssh_url, h.Repository.Git_url, h.Repository.Html_url} {
+		if u != "" {
+			urls[normalizeUrl(u)] = true
+		}
+	}
+
+	var names []string
+	for name, s := range idx {
+		// the clone url is the url with its credentials and secrets.
+		if urls[normalizeUrl(s.Repo.Url)] || urls[normalizeUrl(s.Repo.CloneUrl())] {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 && idx[h.Repository.Full_name] != nil {
+		return []string{h.Repository.Full_name}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// The part of an Azure DevOps git.push event that is used.
+type azureDevOpsPush struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		Repository struct {
+			Name    string `json:"name"`
+			Project struct {
+				Name string `json:"name"`
+			} `json:"project"`
+		} `json:"repository"`
+		RefUpdates []struct {
+			Name        string `json:"name"`
+			NewObjectId string `json:"newObjectId"`
+		} `json:"refUpdates"`
+	} `json:"resource"`
+}
+
+// Whether the push only deleted refs, whose new object is all zeros.
+func (h *azureDevOpsPush) deletesOnly() bool {
+	for _, u := range h.Resource.RefUpdates {
+		if strings.Trim(u.NewObjectId, "0") != "" {
+			return false
+		}
+	}
+	return len(h.Resource.RefUpdates) > 0
 }
 
 func writeJson(w http.ResponseWriter, data interface{}, status int) {
@@ -38,62 +200,181 @@ func writeResp(w http.ResponseWriter, data interface{}) {
 	writeJson(w, data, http.StatusOK)
 }
 
+// Write the error, along with the id of the request, logging failures of
+// the server.
 func writeError(w http.ResponseWriter, err error, status int) {
-	writeJson(w, map[string]string{
+	res := map[string]string{
 		"Error": err.Error(),
-	}, status)
+	}
+
+	id := w.Header().Get(requestIdHeader)
+	if id != "" {
+		res["RequestId"] = id
+	}
+
+	if status >= http.StatusInternalServerError {
+		log.Printf("Request %s failed: %s", id, err)
+	}
+	writeJson(w, res, status)
 }
 
 type searchResponse struct {
-	repo string
-	res  *index.SearchResponse
-	err  error
+	repo     string
+	res      *index.SearchResponse
+	err      error
+	duration time.Duration
 }
 
-/**
- * Searches all repos in parallel.
- */
+// Searches all repos in parallel. With breakers, a search of many repos leaves out the repos whose breaker
+// is open and goes on without those that fail or don't finish within the
+// timeout, reporting them in failed, unless every repo fails.
 func searchAll(
 	query string,
 	opts *index.SearchOptions,
 	repos []string,
 	idx map[string]*searcher.Searcher,
-	filesOpened *int,
-	duration *int) (map[string]*index.SearchResponse, error) {
+	stats *Stats,
+	br *breakers,
+	failed *searchFailures) (map[string]*index.SearchResponse, error) {
 
 	startedAt := time.Now()
 
+	// a repo that is searched by itself is always searched, and its
+	// errors are those of the search.
+	many := len(repos) > 1
+	tolerant := br != nil && many
+	if tolerant {
+		repos, failed.Skipped = br.split(repos, startedAt)
+	}
+
 	n := len(repos)
 
 	// use a buffered channel to avoid routine leaks on errs.
 	ch := make(chan *searchResponse, n)
+	pending := make(map[string]bool, n)
 	for _, repo := range repos {
+		pending[repo] = true
 		go func(repo string) {
 			fms, err := idx[repo].Search(query, opts)
-			ch <- &searchResponse{repo, fms, err}
+			ch <- &searchResponse{repo, fms, err, time.Since(startedAt)}
 		}(repo)
 	}
 
+	var timeout <-chan time.Time
+	if tolerant {
+		t := time.NewTimer(br.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	stats.Repos = make(map[string]*RepoStats, n)
 	res := map[string]*index.SearchResponse{}
-	for i := 0; i < n; i++ {
-		r := <-ch
+	var errs []*searchResponse
+	for len(pending) > 0 {
+		var r *searchResponse
+		select {
+		case r = <-ch:
+		case <-timeout:
+			err := &searchTimeout{br.timeout}
+			for repo := range pending {
+				failed.fail(repo, err.Error())
+				br.failed(repo, err, time.Now())
+			}
+			pending = nil
+			continue
+		}
+		delete(pending, r.repo)
+
+		// a repo that was deleted is left out of searches of more repos
+		// than itself.
+		if r.err == searcher.ErrRemoved && many {
+			continue
+		}
+
 		if r.err != nil {
-			return nil, r.err
+			if !tolerant {
+				return nil, r.err
+			}
+			errs = append(errs, r)
+			continue
 		}
 
+		if tolerant {
+			br.succeeded(r.repo)
+		}
+
+		stats.Repos[r.repo] = &RepoStats{
+			FilesOpened: r.res.FilesOpened,
+			Duration:    int(r.duration.Seconds() * 1000),
+			Truncated:   r.res.Truncated,
+		}
+		stats.FilesOpened += r.res.FilesOpened
+
 		if r.res.Matches == nil {
 			continue
 		}
 
 		res[r.repo] = r.res
-		*filesOpened += r.res.FilesOpened
 	}
 
-	*duration = int(time.Now().Sub(startedAt).Seconds() * 1000)  //nolint
+	// when no repo could be searched, the error is likely the query's.
+	if len(errs) > 0 && len(stats.Repos) == 0 && failed.Errors == nil {
+		return nil, errs[0].err
+	}
+
+	for _, r := range errs {
+		failed.fail(r.repo, r.err.Error())
+		br.failed(r.repo, r.err, time.Now())
+	}
+
+	stats.Duration = int(time.Now().Sub(startedAt).Seconds() * 1000) //nolint
 
 	return res, nil
 }
 
+// Trim the results to at most max matches in all, keeping those of the
+// repos that sort first, and report whether any were left out, either here
+// or by the search of a repo.
+func capMatches(results map[string]*index.SearchResponse, max int) bool {
+	var truncated bool
+	for _, repo := range resultRepos(results) {
+		res := results[repo]
+		truncated = truncated || res.Truncated
+
+		var kept []*index.FileMatch
+		for _, fm := range res.Matches {
+			if max == 0 {
+				truncated = true
+				break
+			}
+
+			if len(fm.Matches) > max {
+				fm.Matches = fm.Matches[:max]
+				truncated = true
+			}
+			max -= len(fm.Matches)
+			kept = append(kept, fm)
+		}
+
+		if len(kept) == 0 {
+			delete(results, repo)
+			continue
+		}
+		res.Matches = kept
+	}
+	return truncated
+}
+
+// The sorted names of the repos with results.
+func resultRepos(results map[string]*index.SearchResponse) []string {
+	repos := make([]string, 0, len(results))
+	for repo := range results {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
 // Used for parsing flags from form values.
 func parseAsBool(v string) bool {
 	v = strings.ToLower(v)
@@ -119,6 +400,59 @@ func parseAsRepoList(v string, idx map[string]*searcher.Searcher) []string {
 	return repos
 }
 
+// Parse the repo list and narrow it to the repos with any of the comma
+// separated tags. With tags but no repo list, every repo with one of the
+// tags is included.
+func parseAsTaggedRepoList(v, tags string, idx map[string]*searcher.Searcher) []string {
+	var want []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			want = append(want, tag)
+		}
+	}
+
+	if len(want) == 0 {
+		return parseAsRepoList(v, idx)
+	}
+
+	if strings.TrimSpace(v) == "" {
+		v = "*"
+	}
+
+	var repos []string
+	for _, repo := range parseAsRepoList(v, idx) {
+		if idx[repo].Repo.HasAnyTag(want) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// The longest line a search returns, in bytes: the one asked for, but no
+// longer than the limit of the server when it has one. 0 is no limit.
+func maxLineLength(asked, limit int) int {
+	if asked < 0 {
+		asked = 0
+	}
+
+	if limit > 0 && (asked == 0 || asked > limit) {
+		return limit
+	}
+	return asked
+}
+
+// Narrow the repos to those that are able to serve searches of the given
+// revision.
+func reposWithRevision(repos []string, rev string, idx map[string]*searcher.Searcher) []string {
+	var res []string
+	for _, repo := range repos {
+		if idx[repo].HasRevision(rev) {
+			res = append(res, repo)
+		}
+	}
+	return res
+}
+
 func parseAsUintValue(sv string, min, max, def uint) uint {
 	iv, err := strconv.ParseUint(sv, 10, 54)
 	if err != nil {
@@ -159,69 +493,585 @@ func parseRangeValue(rv string) (int, int) {
 	return b, e
 }
 
-func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
+// The ways the query of a search can be matched, as a regular expression or
+// as a structural template.
+const (
+	modeRegexp     = "regexp"
+	modeStructural = "structural"
+)
+
+var searchModes = []string{modeRegexp, modeStructural}
+
+// The context of each match, the lines of ctx around it or the function or
+// block it is in.
+const (
+	ctxModeLines = "lines"
+	ctxModeBlock = "block"
+)
+
+var ctxModes = []string{ctxModeLines, ctxModeBlock}
+
+// Parse the time files must have changed after to be searched, either a
+// duration back from now such as 720h, an RFC 3339 time or a date. Empty
+// means any time.
+func parseModifiedAfter(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid modifiedAfter: %q", v)
+}
+
+// The non-empty values of a parameter that may be repeated.
+func formValues(r *http.Request, name string) []string {
+	// parses the form.
+	r.FormValue(name)
+
+	var res []string
+	for _, v := range r.Form[name] {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// The globs of a parameter that may be repeated, each value a comma
+// separated list of them.
+func formGlobs(r *http.Request, name string) []string {
+	var res []string
+	for _, v := range formValues(r, name) {
+		for _, glob := range strings.Split(v, ",") {
+			if glob = strings.TrimSpace(glob); glob != "" {
+				res = append(res, glob)
+			}
+		}
+	}
+	return res
+}
+
+// A regexp that matches what any of the regexps match, empty for none.
+func anyRegexp(pats []string) string {
+	switch len(pats) {
+	case 0:
+		return ""
+	case 1:
+		return pats[0]
+	}
+	return "(?:" + strings.Join(pats, ")|(?:") + ")"
+}
+
+// The options of a search from the request. The paths must match any of
+// the files regexps and any of the paths globs, and none of the
+// excludeFiles regexps and excludePaths globs. The defaults, if any, fill
+// in the options the request leaves out.
+func parseSearchOptions(r *http.Request, d *config.SearchDefaultsConfig) *index.SearchOptions {
+	opt := &index.SearchOptions{
+		FileRegexp:    anyRegexp(formValues(r, "files")),
+		IgnoreCase:    parseAsBool(r.FormValue("i")),
+		LiteralSearch: parseAsBool(r.FormValue("literal")),
+		WholeWord:     parseAsBool(r.FormValue("w")),
+		Structural:    r.FormValue("mode") == modeStructural,
+		Owner:         r.FormValue("owner"),
+		Rev:           r.FormValue("rev"),
+	}
+
+	if globs := formGlobs(r, "paths"); len(globs) > 0 {
+		opt.FileRegexps = append(opt.FileRegexps, globsToRegexp(globs))
+	}
+
+	excludes, globs := formValues(r, "excludeFiles"), formGlobs(r, "excludePaths")
+	if d != nil && len(excludes) == 0 && len(globs) == 0 {
+		globs = d.ExcludePaths
+	}
+
+	if len(globs) > 0 {
+		excludes = append(excludes, globsToRegexp(globs))
+	}
+	opt.ExcludeFileRegexp = anyRegexp(excludes)
+
+	if d != nil && r.FormValue("i") == "" {
+		opt.IgnoreCase = d.IgnoreCase
+	}
+	return opt
+}
+
+// The lines of context and the most matching lines of searches that don't
+// ask for them, 0 for no limit.
+func searchDefaults(d *config.SearchDefaultsConfig) (context, maxMatches uint) {
+	if d == nil {
+		return defaultLinesOfContext, 0
+	}
+
+	context = defaultLinesOfContext
+	if d.Context != nil {
+		context = uint(*d.Context)
+	}
+
+	if context > maxLinesOfContext {
+		context = maxLinesOfContext
+	}
+	return context, uint(d.MaxMatches)
+}
+
+// Compile an optional pattern of the commit search, an empty pattern
+// compiles to nil.
+func compileCommitPattern(pat string, ignoreCase bool) (*regexp.Regexp, error) {
+	if pat == "" {
+		return nil, nil
+	}
+
+	if ignoreCase {
+		pat = "(?i)" + pat
+	}
+	return regexp.Compile(pat)
+}
+
+// Setup serves the API on m. It returns the filter that narrows repos to
+// those a request may search, so that pages served alongside the API only
+// show those.
+func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher, cfg *config.Config, progress *searcher.Progress) (func(*http.Request, []string) []string, error) {
+	a, err := newAuthorizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	api := http.NewServeMux()
+	m.Handle("/api/", WithRequestId(a.filter(a.identified(compress(validate(api))))))
+
+	searches, err := saved.Open(filepath.Join(cfg.DbPath, searchesFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	history := newSearchHistory(cfg.SearchHistory)
+
+	setupTokens(api, a)
+	setupSearches(api, m, a, searches)
+	setupHistory(api, a, history)
+
+	an := &analytics{}
+	setupAnalytics(api, a, an)
+
+	setupLinks(api, a, idx)
+	setupProgress(api, a, idx, progress)
+	setupLicenses(api, a, idx)
+	setupRepoAdmin(api, a, idx)
+	setupConfigExport(api, a, cfg)
+	setupTenants(api, a, cfg)
+
+	br := newBreakers(cfg.SearchBreaker)
+	setupScan(api, a, idx, br, cfg.MaxLineLength)
+
+	jobs := searcher.NewJobs()
+	setupJobs(api, a, jobs)
+
+	forks := forksOf(cfg)
+	defaultContext, defaultMaxMatches := searchDefaults(cfg.SearchDefaults)
+
+	setupDebug(m, a)
+
+	doc := openAPIDocument(cfg.Title)
+	api.HandleFunc("/api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeResp(w, doc)
+	})
+
+	api.HandleFunc("/api/v1/repos", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
 
-	m.HandleFunc("/api/v1/repos", func(w http.ResponseWriter, r *http.Request) {
 		res := map[string]*config.Repo{}
 		for name, srch := range idx {
-			res[name] = srch.Repo
+			if a.canAccess(r, name) {
+				res[name] = srch.Repo
+			}
 		}
 
 		writeResp(w, res)
 	})
 
-	m.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
-		var opt index.SearchOptions
+	api.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) || !a.chargeSearch(w, r) {
+			return
+		}
+
+		opt := parseSearchOptions(r, cfg.SearchDefaults)
+		opt.Hash = parseAsBool(r.FormValue("dedupe"))
+
+		var err error
+		if opt.ModifiedAfter, err = parseModifiedAfter(r.FormValue("modifiedAfter"), time.Now()); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		opt.MaxPerFile = int(parseAsUintValue(r.FormValue("maxPerFile"), 0, 0, 0))
+		opt.MaxMatches = int(parseAsUintValue(r.FormValue("maxMatches"), 0, 0, defaultMaxMatches))
+		opt.MaxLineLength = maxLineLength(int(parseAsUintValue(r.FormValue("maxLineLength"), 0, 0, 0)), cfg.MaxLineLength)
 
 		stats := parseAsBool(r.FormValue("stats"))
-		repos := parseAsRepoList(r.FormValue("repos"), idx)
+		repos := a.visible(r, parseAsTaggedRepoList(r.FormValue("repos"), r.FormValue("tags"), idx))
 		query := r.FormValue("q")
 		opt.Offset, opt.Limit = parseRangeValue(r.FormValue("rng"))
-		opt.FileRegexp = r.FormValue("files")
-		opt.ExcludeFileRegexp = r.FormValue("excludeFiles")
-		opt.IgnoreCase = parseAsBool(r.FormValue("i"))
-		opt.LiteralSearch = parseAsBool(r.FormValue("literal"))
 		opt.LinesOfContext = parseAsUintValue(
 			r.FormValue("ctx"),
 			0,
 			maxLinesOfContext,
-			defaultLinesOfContext)
+			defaultContext)
+		opt.BlockContext = r.FormValue("ctxMode") == ctxModeBlock
+		opt.Highlight = parseAsBool(r.FormValue("highlight"))
+
+		if opt.Rev != "" {
+			repos = reposWithRevision(repos, opt.Rev, idx)
+			if len(repos) == 0 {
+				writeError(w,
+					fmt.Errorf("Revision %s is not indexed", opt.Rev),
+					http.StatusOK)
+				return
+			}
+		}
+
+		var st Stats
+		var failed searchFailures
+
+		// qualifiers in q take precedence over the other parameters.
+		var results map[string]*index.SearchResponse
+		q := parseQuery(query, opt.LiteralSearch)
+		q.apply(opt)
+		err = index.CheckPattern(q.Pattern, opt)
+
+		if err == nil {
+			repos, err = a.filterDeps(r, q, q.filterRepos(repos), idx)
+		}
+
+		if err == nil {
+			results, err = searchAll(q.Pattern, opt, repos, idx, &st, br, &failed)
+			a.chargeFilesOpened(r, st.FilesOpened)
+		}
+
+		if err == nil && opt.Hash {
+			dedupe(results, forks)
+		}
+
+		// each repo stops at maxMatches, which bounds the work, but their
+		// results together may be many times that.
+		var truncated bool
+		if err == nil && opt.MaxMatches > 0 {
+			truncated = capMatches(results, opt.MaxMatches)
+		}
+
+		a.record(r, &audit.Event{
+			Action: "search",
+			Query:  query,
+			Repos:  resultRepos(results),
+			Error:  errString(err),
+		})
+		if err == nil {
+			if t := a.identify(r); t != nil {
+				history.record(historyName(t), query, r.FormValue("repos"), time.Now().UTC())
+			}
+			an.record(query, repos, len(results), st.Duration, time.Now())
+		}
+		format, order := r.FormValue("format"), r.FormValue("sort")
+		if format != "" && format != formatJSON {
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
 
-		var filesOpened int
-		var durationMs int
+			if err := writeMatches(w, format, order, query, results); err != nil {
+				log.Printf("Request %s: failed to write %s results: %s", requestId(r), format, err)
+			}
+			return
+		}
 
-		results, err := searchAll(query, &opt, repos, idx, &filesOpened, &durationMs)
 		if err != nil {
+			log.Printf("Request %s: search for %q failed: %s", requestId(r), query, err)
+
 			// TODO(knorton): Return ok status because the UI expects it for now.
 			writeError(w, err, http.StatusOK)
 			return
 		}
 
-		var res struct {
-			Results map[string]*index.SearchResponse
-			Stats   *Stats `json:",omitempty"`
-		}
-
+		var res searchResults
 		res.Results = results
+		res.Truncated = truncated
+		if parseAsBool(r.FormValue("explain")) {
+			res.Explain = explainSearch(a, r, q, opt, repos, idx)
+		}
+		res.searchFailures = failed
+		if order != "" {
+			res.Repos = sortResults(results, order)
+		}
 		if stats {
-			res.Stats = &Stats{
-				FilesOpened: filesOpened,
-				Duration:    durationMs,
-			}
+			res.Stats = &st
 		}
 
 		writeResp(w, &res)
 	})
 
-	m.HandleFunc("/api/v1/excludes", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/v1/search/validate", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		opt := parseSearchOptions(r, cfg.SearchDefaults)
+		q := parseQuery(r.FormValue("q"), opt.LiteralSearch)
+		q.apply(opt)
+		problems, err := index.LintPattern(q.Pattern, opt)
+
+		writeResp(w, newPatternReport(problems, err))
+	})
+
+	api.HandleFunc("/api/v1/search/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) || !a.chargeSearch(w, r) {
+			return
+		}
+
+		opt := parseSearchOptions(r, cfg.SearchDefaults)
+		opt.CountOnly = true
+
+		var err error
+		if opt.ModifiedAfter, err = parseModifiedAfter(r.FormValue("modifiedAfter"), time.Now()); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		repos := a.visible(r, parseAsTaggedRepoList(r.FormValue("repos"), r.FormValue("tags"), idx))
+		query := r.FormValue("q")
+		depth := parseAsUintValue(
+			r.FormValue("depth"),
+			1,
+			maxAggregateDepth,
+			defaultAggregateDepth)
+
+		if opt.Rev != "" {
+			repos = reposWithRevision(repos, opt.Rev, idx)
+			if len(repos) == 0 {
+				writeError(w,
+					fmt.Errorf("Revision %s is not indexed", opt.Rev),
+					http.StatusBadRequest)
+				return
+			}
+		}
+
+		var st Stats
+		var failed searchFailures
+		var results map[string]*index.SearchResponse
+		q := parseQuery(query, opt.LiteralSearch)
+		q.apply(opt)
+		err = index.CheckPattern(q.Pattern, opt)
+
+		if err == nil {
+			repos, err = a.filterDeps(r, q, q.filterRepos(repos), idx)
+		}
+
+		if err == nil {
+			results, err = searchAll(q.Pattern, opt, repos, idx, &st, br, &failed)
+			a.chargeFilesOpened(r, st.FilesOpened)
+		}
+
+		a.record(r, &audit.Event{
+			Action: "aggregate",
+			Query:  query,
+			Repos:  resultRepos(results),
+			Error:  errString(err),
+		})
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		res := aggregate(results, int(depth))
+		res.searchFailures = failed
+		writeResp(w, res)
+	})
+
+	api.HandleFunc("/api/v1/references", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) || !a.chargeSearch(w, r) {
+			return
+		}
+
+		symbol := r.FormValue("symbol")
+		lang := anyLanguage
+		if name := r.FormValue("lang"); name != "" {
+			lang = languages[name]
+		}
+
+		// editors look symbols up across every repo unless told otherwise.
+		names := r.FormValue("repos")
+		if names == "" {
+			names = "*"
+		}
+
+		repos := a.visible(r, parseAsTaggedRepoList(names, r.FormValue("tags"), idx))
+		query := `\b` + regexp.QuoteMeta(symbol) + `\b`
+
+		var st Stats
+		var failed searchFailures
+		opt := lang.searchOptions()
+		opt.MaxLineLength = cfg.MaxLineLength
+		results, err := searchAll(query, opt, repos, idx, &st, br, &failed)
+		a.chargeFilesOpened(r, st.FilesOpened)
+		a.record(r, &audit.Event{
+			Action: "references",
+			Query:  symbol,
+			Repos:  resultRepos(results),
+			Error:  errString(err),
+		})
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		res, err := findReferences(symbol, lang, results)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		res.searchFailures = failed
+		writeResp(w, res)
+	})
+
+	api.HandleFunc("/api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		repos := r.FormValue("repos")
+		if repos == "" {
+			repos = "*"
+		}
+
+		res := map[string]*searcher.Status{}
+		for _, repo := range a.visible(r, parseAsRepoList(repos, idx)) {
+			res[repo] = idx[repo].Status()
+		}
+
+		writeResp(w, res)
+	})
+
+	api.HandleFunc("/api/v1/status/disk", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		usage := searcher.DiskUsageOf(idx)
+		if usage == nil {
+			writeError(w,
+				errors.New("The disk usage is not known yet"),
+				http.StatusServiceUnavailable)
+			return
+		}
+
+		writeResp(w, usage)
+	})
+
+	api.HandleFunc("/api/v1/revisions", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		res := map[string][]string{}
+		for _, repo := range a.visible(r, parseAsRepoList(r.FormValue("repos"), idx)) {
+			res[repo] = idx[repo].Revisions()
+		}
+
+		writeResp(w, res)
+	})
+
+	api.HandleFunc("/api/v1/commits/search", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		var q searcher.CommitQuery
+		var err error
+
+		ignoreCase := parseAsBool(r.FormValue("i"))
+		if q.Message, err = compileCommitPattern(r.FormValue("q"), ignoreCase); err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		if q.Author, err = compileCommitPattern(r.FormValue("author"), ignoreCase); err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		if q.Path, err = compileCommitPattern(r.FormValue("path"), ignoreCase); err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		q.Limit = int(parseAsUintValue(
+			r.FormValue("limit"),
+			0,
+			maxCommitResults,
+			defaultCommitResults))
+
+		res := map[string][]*vcs.Commit{}
+		var found []string
+		for _, repo := range a.visible(r, parseAsTaggedRepoList(r.FormValue("repos"), r.FormValue("tags"), idx)) {
+			if commits := idx[repo].SearchCommits(&q); len(commits) > 0 {
+				res[repo] = commits
+				found = append(found, repo)
+			}
+		}
+		sort.Strings(found)
+
+		a.record(r, &audit.Event{
+			Action: "commits-search",
+			Query:  r.FormValue("q"),
+			Repos:  found,
+		})
+
+		writeResp(w, res)
+	})
+
+	api.HandleFunc("/api/v1/excludes", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
 		repo := r.FormValue("repo")
-		res := idx[repo].GetExcludedFiles()
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.Header().Set("Access-Control-Allow", "*")
-		fmt.Fprint(w, res)
+		if idx[repo] == nil || !a.canAccess(r, repo) {
+			writeError(w,
+				fmt.Errorf("No such repository: %s", repo),
+				http.StatusNotFound)
+			return
+		}
+
+		files, err := idx[repo].ExcludedFiles()
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the total is given in a header so the body stays a plain list.
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(files)))
+		offset, limit := parseRangeValue(r.FormValue("rng"))
+		if offset > len(files) {
+			offset = len(files)
+		}
+		files = files[offset:]
+		if limit > 0 && limit < len(files) {
+			files = files[:limit]
+		}
+
+		writeResp(w, files)
 	})
 
-	m.HandleFunc("/api/v1/update", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/v1/update", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			writeError(w,
 				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
@@ -229,15 +1079,47 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 			return
 		}
 
-		repos := parseAsRepoList(r.FormValue("repos"), idx)
+		if !a.allow(auth.ScopeUpdate, w, r) {
+			return
+		}
+
+		// named repos that don't exist are refused before any is updated,
+		// like those of other tenants, so a typo isn't taken for an update.
+		var repos []string
+		if v := strings.TrimSpace(r.FormValue("repos")); v == "*" {
+			repos = a.visible(r, parseAsRepoList(v, idx))
+		} else {
+			for _, repo := range strings.Split(v, ",") {
+				if repo = strings.TrimSpace(repo); repo == "" {
+					continue
+				}
+
+				if idx[repo] == nil || !a.canAccess(r, repo) {
+					writeError(w,
+						fmt.Errorf("No such repository: %s", repo),
+						http.StatusNotFound)
+					return
+				}
+				repos = append(repos, repo)
+			}
+		}
+		a.record(r, &audit.Event{Action: "update", Repos: repos})
 
+		// an asynchronous update is a job, which is only started once every
+		// repo is known to accept it.
+		async := parseAsBool(r.FormValue("async"))
+		updates := map[string]*searcher.Searcher{}
 		for _, repo := range repos {
 			searcher := idx[repo]
-			if searcher == nil {
-				writeError(w,
-					fmt.Errorf("No such repository: %s", repo),
-					http.StatusNotFound)
-				return
+			if async {
+				if !searcher.Repo.PushUpdatesEnabled() {
+					writeError(w,
+						fmt.Errorf("Push updates are not enabled for repository %s", repo),
+						http.StatusForbidden)
+					return
+				}
+				updates[repo] = searcher
+				continue
 			}
 
 			if !searcher.Update() {
@@ -249,10 +1131,20 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 			}
 		}
 
+		if async {
+			job, err := jobs.Update(updates)
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeJson(w, job, http.StatusAccepted)
+			return
+		}
+
 		writeResp(w, "ok")
 	})
 
-	m.HandleFunc("/api/v1/github-webhook", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/v1/reindex", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			writeError(w,
 				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
@@ -260,42 +1152,163 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 			return
 		}
 
-		type Webhook struct {
-			Repository struct {
-				Name string
-				Full_name string
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		repos := a.visible(r, parseAsRepoList(r.FormValue("repos"), idx))
+		a.record(r, &audit.Event{Action: "reindex", Repos: repos})
+		if len(repos) == 0 {
+			writeError(w,
+				fmt.Errorf("No such repository: %s", r.FormValue("repos")),
+				http.StatusNotFound)
+			return
+		}
+
+		for _, repo := range repos {
+			if !idx[repo].Reindex() {
+				writeError(w,
+					fmt.Errorf("Updates are not enabled for repository %s", repo),
+					http.StatusForbidden)
+				return
 			}
 		}
 
-		var h Webhook
+		writeResp(w, "ok")
+	})
+
+	api.HandleFunc("/api/v1/github-webhook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !a.allow(auth.ScopeUpdate, w, r) {
+			return
+		}
+
+		var h githubPush
 
 		err := json.NewDecoder(r.Body).Decode(&h)
 
 		if err != nil {
-		   writeError(w,
+			writeError(w,
 				errors.New(http.StatusText(http.StatusBadRequest)),
 				http.StatusBadRequest)
 			return
 		}
 
+		event := r.Header.Get("X-GitHub-Event")
+		if event == "ping" {
+			writeResp(w, "ok")
+			return
+		}
+
 		repo := h.Repository.Full_name
+		var repos []string
+		for _, name := range githubRepos(idx, &h) {
+			if a.canAccess(r, name) {
+				repos = append(repos, name)
+			}
+		}
+		if len(repos) == 0 {
+			a.record(r, &audit.Event{Action: "webhook", Repos: []string{repo}})
+			writeError(w,
+				fmt.Errorf("No such repository: %s", repo),
+				http.StatusNotFound)
+			return
+		}
+		a.record(r, &audit.Event{Action: "webhook", Repos: repos})
 
-		searcher := idx[h.Repository.Full_name]
+		for _, name := range repos {
+			if !idx[name].Repo.PushUpdatesEnabled() {
+				writeError(w,
+					fmt.Errorf("Push updates are not enabled for repository %s", name),
+					http.StatusForbidden)
+				return
+			}
+		}
+
+		for _, name := range repos {
+			searcher := idx[name]
+			switch {
+			case event == "repository":
+				switch h.Action {
+				case "archived":
+					searcher.Archive()
+				case "unarchived":
+					searcher.Unarchive()
+				case "deleted":
+					searcher.MarkDeleted(searcher.Repo.RemoveWhenDeleted)
+				}
+			case event == "delete" || h.Deleted:
+				// a deleted branch or tag brings nothing new to pull.
+			default:
+				searcher.Update()
+			}
+		}
+
+		writeResp(w, "ok")
+	})
 
-		if searcher == nil {
+	api.HandleFunc("/api/v1/azure-devops-webhook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !a.allow(auth.ScopeUpdate, w, r) {
+			return
+		}
+
+		var h azureDevOpsPush
+
+		if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusBadRequest)),
+				http.StatusBadRequest)
+			return
+		}
+
+		if h.EventType != "git.push" {
+			writeError(w,
+				fmt.Errorf("Unsupported event type: %s", h.EventType),
+				http.StatusBadRequest)
+			return
+		}
+
+		repo := config.AzureDevOpsRepoName(
+			h.Resource.Repository.Project.Name,
+			h.Resource.Repository.Name)
+		a.record(r, &audit.Event{Action: "webhook", Repos: []string{repo}})
+
+		searcher := idx[repo]
+		if searcher == nil || !a.canAccess(r, repo) {
 			writeError(w,
 				fmt.Errorf("No such repository: %s", repo),
 				http.StatusNotFound)
 			return
 		}
 
-		if !searcher.Update() {
+		if !searcher.Repo.PushUpdatesEnabled() {
 			writeError(w,
 				fmt.Errorf("Push updates are not enabled for repository %s", repo),
 				http.StatusForbidden)
 			return
 		}
 
+		// a push that only deleted branches or tags brings nothing new to
+		// pull.
+		if !h.deletesOnly() {
+			searcher.Update()
+		}
+
 		writeResp(w, "ok")
 	})
+
+	return a.searchable, nil
 }
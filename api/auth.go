@@ -0,0 +1,473 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/config"
+)
+
+// The file in the dbpath that holds the access keys.
+const tokensFilename = "tokens.json"
+
+// The token that stands for the admin-token of the config.
+var adminToken = &auth.Token{
+	Name: "admin-token",
+	Role: auth.RoleAdmin,
+}
+
+// Decides which requests are allowed based on the access key or JWT they
+// carry, or the user named by a trusted proxy, and records what they do in the
+// audit log.
+type authorizer struct {
+	cfg    *config.Config
+	tokens *auth.TokenStore
+	proxy  *auth.ProxyAuth
+	jwt    *auth.JWTAuth
+	ips    *auth.IPFilter
+	audit  *audit.Logger
+	quotas *auth.Quotas
+
+	searchQuotas *auth.SearchQuotas
+}
+
+func newAuthorizer(cfg *config.Config) (*authorizer, error) {
+	tokens, err := auth.OpenTokenStore(filepath.Join(cfg.DbPath, tokensFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	al, err := audit.New(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxy *auth.ProxyAuth
+	if cfg.ProxyAuth != nil {
+		if proxy, err = auth.NewProxyAuth(cfg.ProxyAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	var jwt *auth.JWTAuth
+	if cfg.JWTAuth != nil {
+		if jwt, err = auth.NewJWTAuth(cfg.JWTAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	var ips *auth.IPFilter
+	if cfg.IPFilter != nil {
+		if ips, err = auth.NewIPFilter(cfg.IPFilter); err != nil {
+			return nil, err
+		}
+	}
+
+	return &authorizer{
+		cfg:    cfg,
+		tokens: tokens,
+		proxy:  proxy,
+		jwt:    jwt,
+		ips:    ips,
+		audit:  al,
+		quotas: auth.NewQuotas(cfg.Tenants),
+
+		searchQuotas: auth.NewSearchQuotas(cfg.SearchQuotas, cfg.Tenants),
+	}, nil
+}
+
+// Record the event in the audit log along with who made the request.
+func (a *authorizer) record(r *http.Request, e *audit.Event) {
+	if t := a.identify(r); t != nil {
+		e.Identity = t.Name
+	}
+	e.Remote = r.RemoteAddr
+	e.RequestId = requestId(r)
+	a.audit.Record(e)
+}
+
+// Read the access key from the Authorization header of the request or,
+// for callers like webhooks that can't set headers, the access_key form
+// value.
+func accessKey(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) >= 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return r.FormValue("access_key")
+}
+
+// The token of a request that passed through identified, which is nil when
+// the request has none.
+type identity struct {
+	token *auth.Token
+}
+
+type identityKey struct{}
+
+// Find the token of the request once, before it reaches the handler, so
+// that every check of the request goes by the same token and the JWT or
+// access key is only verified once.
+func (a *authorizer) identified(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := &identity{a.authenticate(r)}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// The token of the request, nil if there is none. Requests that didn't pass
+// through identified are authenticated on each call.
+func (a *authorizer) identify(r *http.Request) *auth.Token {
+	if id, ok := r.Context().Value(identityKey{}).(*identity); ok {
+		return id.token
+	}
+	return a.authenticate(r)
+}
+
+// Find the token for the user named by a trusted proxy or, failing that,
+// the access key or JWT of the request, nil if there is none.
+func (a *authorizer) authenticate(r *http.Request) *auth.Token {
+	if a.proxy != nil {
+		if t := a.proxy.Identify(r); t != nil {
+			return t
+		}
+	}
+
+	key := accessKey(r)
+	if key == "" {
+		return nil
+	}
+
+	if adminKey := a.cfg.ResolvedAdminToken(); adminKey != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1 {
+		return adminToken
+	}
+
+	if a.jwt != nil && auth.IsJWT(key) {
+		t, err := a.jwt.Authenticate(key, time.Now())
+		if err != nil {
+			return nil
+		}
+		return t
+	}
+
+	return a.tokens.Authenticate(key, time.Now())
+}
+
+// Check that the request is allowed the scope, writing an error response
+// if it is not. Searches and updates are open to everyone unless the config
+// requires access keys or proxy authentication, admin endpoints always
+// require an admin key. The access keys and users of tenants are held to
+// their scopes and the quotas of their tenant either way.
+func (a *authorizer) allow(scope auth.Scope, w http.ResponseWriter, r *http.Request) bool {
+	open := scope != auth.ScopeAdmin && !a.cfg.RequireAccessKeys && a.proxy == nil
+	if open && len(a.cfg.Tenants) == 0 {
+		return true
+	}
+
+	t := a.identify(r)
+	if open && (t == nil || t.Tenant == "") {
+		return true
+	}
+
+	if t == nil {
+		err := errors.New(http.StatusText(http.StatusUnauthorized))
+		a.record(r, &audit.Event{Action: "denied", Query: r.URL.Path, Error: err.Error()})
+		writeError(w, err, http.StatusUnauthorized)
+		return false
+	}
+
+	if !t.HasScope(scope) {
+		err := fmt.Errorf("Access key %s does not have the %s scope", t.Name, scope)
+		a.record(r, &audit.Event{Action: "denied", Query: r.URL.Path, Error: err.Error()})
+		writeError(w, err, http.StatusForbidden)
+		return false
+	}
+
+	if !a.quotas.Allow(t.Tenant, scope, time.Now()) {
+		err := fmt.Errorf("Tenant %s has used up its quota of %s requests", t.Tenant, scope)
+		a.record(r, &audit.Event{Action: "denied", Query: r.URL.Path, Error: err.Error()})
+		writeError(w, err, http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+// Charge the request a search against the search quotas of its access key
+// or user and its tenant, setting the headers that tell how much of the
+// quota is left, and write a 429 if it is used up.
+func (a *authorizer) chargeSearch(w http.ResponseWriter, r *http.Request) bool {
+	now := time.Now()
+	s, ok := a.searchQuotas.Charge(a.identify(r), now)
+	if s != nil {
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(s.Limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(s.Remaining, 10))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(s.Reset.Unix(), 10))
+	}
+
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.Reset.Sub(now).Seconds())+1))
+		err := fmt.Errorf("The search quota is used up until %s", s.Reset.UTC().Format(time.RFC3339))
+		a.record(r, &audit.Event{Action: "denied", Query: r.URL.Path, Error: err.Error()})
+		writeError(w, err, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// Count the files opened by a search of the request against its quotas.
+func (a *authorizer) chargeFilesOpened(r *http.Request, n int) {
+	a.searchQuotas.AddFilesOpened(a.identify(r), n, time.Now())
+}
+
+// The group of API routes the path belongs to, for IP rules. Paths without
+// a route of another group are search routes.
+func routeGroup(path string) string {
+	if strings.HasPrefix(path, "/api/v1/admin/") || strings.HasPrefix(path, "/debug/") {
+		return auth.RouteAdmin
+	}
+
+	for _, rt := range routesFor(path) {
+		if rt.Group != "" {
+			return rt.Group
+		}
+	}
+	return auth.RouteSearch
+}
+
+// Reject requests from addresses the IP rules don't allow before they reach
+// the handler.
+func (a *authorizer) filter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.ips != nil && !a.ips.Allows(routeGroup(r.URL.Path), r.RemoteAddr) {
+			err := errors.New(http.StatusText(http.StatusForbidden))
+			a.record(r, &audit.Event{Action: "denied", Query: r.URL.Path, Error: err.Error()})
+			writeError(w, err, http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// The tenant of the token, empty for requests without one.
+func tenantOf(t *auth.Token) string {
+	if t == nil {
+		return ""
+	}
+	return t.Tenant
+}
+
+// The tenant the named repo belongs to, empty for repos of no tenant.
+func (a *authorizer) repoTenant(repo string) string {
+	if r := a.cfg.Repos[repo]; r != nil {
+		return r.Tenant
+	}
+	return ""
+}
+
+// Determine whether the token may access the named repo. Repos of a tenant
+// are only accessible to its access keys and users and to admins, and
+// the others only see the repos of no tenant.
+func (a *authorizer) accessible(t *auth.Token, repo string) bool {
+	if t == nil {
+		return a.repoTenant(repo) == ""
+	}
+
+	if !t.HasScope(auth.ScopeAdmin) && a.repoTenant(repo) != t.Tenant {
+		return false
+	}
+	return t.CanAccess(repo)
+}
+
+// Determine whether the request may access the named repo.
+func (a *authorizer) canAccess(r *http.Request, repo string) bool {
+	return a.accessible(a.identify(r), repo)
+}
+
+// Narrow the repos to those the request may access.
+func (a *authorizer) visible(r *http.Request, repos []string) []string {
+	t := a.identify(r)
+
+	var res []string
+	for _, repo := range repos {
+		if a.accessible(t, repo) {
+			res = append(res, repo)
+		}
+	}
+	return res
+}
+
+// Narrow the repos to those the request may search, none when it may not
+// search at all, as allow and visible would.
+func (a *authorizer) searchable(r *http.Request, repos []string) []string {
+	t := a.identify(r)
+	open := !a.cfg.RequireAccessKeys && a.proxy == nil
+	if open && (t == nil || t.Tenant == "") {
+		return a.visible(r, repos)
+	}
+
+	if t == nil || !t.HasScope(auth.ScopeSearch) {
+		return nil
+	}
+	return a.visible(r, repos)
+}
+
+// Parse the comma separated scopes of a token.
+func parseScopes(v string) ([]auth.Scope, error) {
+	var scopes []auth.Scope
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		scope, err := auth.ParseScope(s)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// Parse the expiry of a token, either an RFC 3339 time or a duration from
+// now such as 720h. Empty means the token never expires.
+func parseExpiry(v string, now time.Time) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		t := now.Add(d).UTC()
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry: %q", v)
+	}
+	return &t, nil
+}
+
+// The response to creating a token, the only time its key is shown.
+type createdToken struct {
+	*auth.Token
+	Key string
+}
+
+func setupTokens(m *http.ServeMux, a *authorizer) {
+	m.HandleFunc("/api/v1/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			a.record(r, &audit.Event{Action: "list-tokens"})
+			writeResp(w, a.tokens.List())
+		case "POST":
+			scopes, err := parseScopes(r.FormValue("scopes"))
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			expires, err := parseExpiry(r.FormValue("expires"), time.Now())
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			var role auth.Role
+			if v := r.FormValue("role"); v != "" {
+				if role, err = auth.ParseRole(v); err != nil {
+					writeError(w, err, http.StatusBadRequest)
+					return
+				}
+			}
+
+			tenant := r.FormValue("tenant")
+			if _, ok := a.cfg.Tenants[tenant]; tenant != "" && !ok {
+				writeError(w, fmt.Errorf("unknown tenant: %q", tenant), http.StatusBadRequest)
+				return
+			}
+
+			key, t, err := a.tokens.Create(r.FormValue("name"), role, scopes, expires, tenant)
+			a.record(r, &audit.Event{Action: "create-token", Query: r.FormValue("name"), Error: errString(err)})
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			var res createdToken
+			res.Token = t
+			res.Key = key
+			writeJson(w, &res, http.StatusCreated)
+		case "DELETE":
+			name := r.FormValue("name")
+			ok, err := a.tokens.Delete(name)
+			a.record(r, &audit.Event{Action: "delete-token", Query: name, Error: errString(err)})
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			if !ok {
+				writeError(w,
+					fmt.Errorf("No such token: %s", name),
+					http.StatusNotFound)
+				return
+			}
+
+			writeResp(w, "ok")
+		default:
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// The message of the error, empty for a nil error.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Check the access control options of the config, returning every problem
+// found.
+func Validate(cfg *config.Config) []error {
+	var errs []error
+
+	if cfg.ProxyAuth != nil {
+		if _, err := auth.NewProxyAuth(cfg.ProxyAuth); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.JWTAuth != nil {
+		if _, err := auth.NewJWTAuth(cfg.JWTAuth); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.IPFilter != nil {
+		if _, err := auth.NewIPFilter(cfg.IPFilter); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestIdentified(t *testing.T) {
+	a := &authorizer{cfg: &config.Config{AdminToken: "s3cret"}}
+
+	var calls int
+	h := a.identified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if a.identify(r) != adminToken {
+			t.Error("expected the admin token")
+		}
+
+		// the token was found before the handler, so it outlives the key.
+		a.cfg.AdminToken = "rotated"
+		if a.identify(r) != adminToken {
+			t.Error("expected the token found before the handler")
+		}
+	}))
+
+	r := httptest.NewRequest("GET", "/api/v1/search", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if calls != 1 {
+		t.Fatalf("expected the handler to be called once, got %d", calls)
+	}
+
+	// requests without a key have no token.
+	h = a.identified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.identify(r) != nil {
+			t.Error("expected no token")
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/search", nil))
+}
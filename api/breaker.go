@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The repos a search of many repos went on without: those that failed or
+// timed out, with their errors, and those left out because their breaker
+// was open.
+type searchFailures struct {
+	Errors  map[string]string `json:",omitempty"`
+	Skipped []string          `json:",omitempty"`
+}
+
+func (f *searchFailures) fail(repo string, err string) {
+	if f.Errors == nil {
+		f.Errors = map[string]string{}
+	}
+	f.Errors[repo] = err
+}
+
+// The failures in a row of the searches of a repo, and until when it is
+// left out of searches once it had too many.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Trips for repos whose searches keep failing, so a bad index doesn't fail
+// every search of many repos. Only failures of the index count: a search
+// that times out or whose query fails, like one with too many matches,
+// says nothing of the health of the repo, and counting it would let a few
+// broad queries leave the largest repos out of everyone's searches. Once
+// the cooldown is over the repo is searched again, and its breaker trips
+// again at the next failure unless a search of it succeeds first.
+type breakers struct {
+	failures int
+	timeout  time.Duration
+	cooldown time.Duration
+
+	lck   sync.Mutex
+	repos map[string]*breaker
+}
+
+// The breakers of the config, nil if it has none.
+func newBreakers(cfg *config.SearchBreakerConfig) *breakers {
+	if cfg == nil {
+		return nil
+	}
+
+	return &breakers{
+		failures: cfg.Failures,
+		timeout:  time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		cooldown: time.Duration(cfg.CooldownMs) * time.Millisecond,
+		repos:    map[string]*breaker{},
+	}
+}
+
+// Split the repos into those that can be searched and those whose breaker
+// is open, which are sorted.
+func (b *breakers) split(repos []string, now time.Time) ([]string, []string) {
+	b.lck.Lock()
+	defer b.lck.Unlock()
+
+	var closed, open []string
+	for _, repo := range repos {
+		if br := b.repos[repo]; br != nil && now.Before(br.openUntil) {
+			open = append(open, repo)
+		} else {
+			closed = append(closed, repo)
+		}
+	}
+
+	sort.Strings(open)
+	return closed, open
+}
+
+// The error of the repos a search of many repos went on without because
+// they took too long.
+type searchTimeout struct {
+	timeout time.Duration
+}
+
+func (e *searchTimeout) Error() string {
+	return fmt.Sprintf("the search took longer than %s", e.timeout)
+}
+
+// Whether the error of a search of a repo is a failure of its index, such
+// as a corrupt index or a file of it that can't be read, rather than of the
+// query or a search that took too long.
+func indexFailure(err error) bool {
+	var pathErr *os.PathError
+	var errno syscall.Errno
+	return errors.As(err, &pathErr) ||
+		errors.As(err, &errno) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, searcher.ErrCorrupt)
+}
+
+// Count a search of the repo that failed with err, tripping its breaker
+// when its index failed too many times in a row.
+func (b *breakers) failed(repo string, err error, now time.Time) {
+	if !indexFailure(err) {
+		return
+	}
+
+	b.lck.Lock()
+	defer b.lck.Unlock()
+
+	br := b.repos[repo]
+	if br == nil {
+		br = &breaker{}
+		b.repos[repo] = br
+	}
+
+	br.failures++
+	if br.failures >= b.failures {
+		br.openUntil = now.Add(b.cooldown)
+		log.Printf("Leaving %s out of searches of many repos for %s after %d failed searches",
+			repo, b.cooldown, br.failures)
+	}
+}
+
+// Reset the breaker of the repo after a search of it succeeded.
+func (b *breakers) succeeded(repo string) {
+	b.lck.Lock()
+	defer b.lck.Unlock()
+	delete(b.repos, repo)
+}
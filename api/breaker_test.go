@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+func newTestBreakers() *breakers {
+	return newBreakers(&config.SearchBreakerConfig{
+		Failures:   2,
+		TimeoutMs:  100,
+		CooldownMs: 1000,
+	})
+}
+
+func TestBreakerTrips(t *testing.T) {
+	br := newTestBreakers()
+	now := time.Now()
+	err := &os.PathError{Op: "open", Path: "raw/a.go", Err: syscall.ENOENT}
+
+	br.failed("a", err, now)
+	if closed, open := br.split([]string{"a", "b"}, now); len(open) != 0 {
+		t.Fatalf("expected a single failure not to trip the breaker, got %v and %v", closed, open)
+	}
+
+	// open once it failed too many times in a row.
+	br.failed("a", err, now)
+	closed, open := br.split([]string{"a", "b"}, now)
+	if !reflect.DeepEqual(closed, []string{"b"}) || !reflect.DeepEqual(open, []string{"a"}) {
+		t.Fatalf("expected a to be left out, got %v and %v", closed, open)
+	}
+
+	// half open after the cooldown, when the next failure trips it again.
+	later := now.Add(time.Second)
+	if _, open := br.split([]string{"a"}, later); len(open) != 0 {
+		t.Fatalf("expected a to be searched after the cooldown, got %v", open)
+	}
+
+	br.failed("a", err, later)
+	if _, open := br.split([]string{"a"}, later); !reflect.DeepEqual(open, []string{"a"}) {
+		t.Fatalf("expected a failure after the cooldown to trip the breaker again, got %v", open)
+	}
+
+	// closed again once a search succeeds.
+	br.succeeded("a")
+	br.failed("a", err, later)
+	if _, open := br.split([]string{"a"}, later); len(open) != 0 {
+		t.Fatalf("expected a success to close the breaker, got %v", open)
+	}
+}
+
+func TestBreakerIgnoresQueryErrors(t *testing.T) {
+	testCases := []struct {
+		err   error
+		trips bool
+	}{
+		{&os.PathError{Op: "read", Path: "tri", Err: syscall.EIO}, true},
+		{fmt.Errorf("%w: checksum mismatch", searcher.ErrCorrupt), true},
+		{&searchTimeout{100 * time.Millisecond}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("search exceeds limit on matches: 5000"), false},
+		{errors.New("error parsing regexp: missing closing ): `(`"), false},
+	}
+	for _, testCase := range testCases {
+		br := newTestBreakers()
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			br.failed("a", testCase.err, now)
+		}
+
+		_, open := br.split([]string{"a"}, now)
+		if trips := len(open) > 0; trips != testCase.trips {
+			t.Errorf("%s: expected the breaker to trip %t, got %t", testCase.err, testCase.trips, trips)
+		}
+	}
+}
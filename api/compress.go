@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The content encodings responses can be compressed with, in order of
+// preference.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// The compressors are large enough that allocating one per response adds
+// up, so they are reused.
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}
+	deflateWriters = sync.Pool{New: func() interface{} {
+		// the deflate content encoding is zlib's format, not raw deflate.
+		return zlib.NewWriter(nil)
+	}}
+)
+
+// The part of the compressors that is used, so gzip and deflate can be
+// handled alike.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Pick the encoding to use for a request from its Accept-Encoding header,
+// empty if the client accepts neither gzip nor deflate.
+func acceptedEncoding(r *http.Request) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, q := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			name = part[:i]
+			if v := strings.TrimSpace(part[i+1:]); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+
+	for _, enc := range []string{encodingGzip, encodingDeflate} {
+		if ok, listed := accepted[enc]; ok || (!listed && accepted["*"]) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// A ResponseWriter that compresses the body once the handler has set the
+// status and headers. Flushing it sends what has been compressed so far, so
+// line based formats still arrive as they are written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	pool        *sync.Pool
+	cw          compressor
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if status != http.StatusNoContent && status != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.cw = w.pool.Get().(compressor)
+		w.cw.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.cw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.cw.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if w.cw != nil {
+		w.cw.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hand the connection over to the handler, which then writes to it as it
+// is, without compression.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the connection can't be hijacked")
+	}
+	return h.Hijack()
+}
+
+// Tell the handler when the client goes away, never if the underlying
+// writer can't tell.
+func (w *compressWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Finish the compressed stream and return the compressor to its pool.
+func (w *compressWriter) close() {
+	if w.cw == nil {
+		return
+	}
+	w.cw.Close()
+	w.cw.Reset(nil)
+	w.pool.Put(w.cw)
+	w.cw = nil
+}
+
+// Compress the responses of h with gzip or deflate, whichever the client
+// accepts.
+func compress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		enc := acceptedEncoding(r)
+		if enc == "" || r.Method == "HEAD" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		pool := &gzipWriters
+		if enc == encodingDeflate {
+			pool = &deflateWriters
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       enc,
+			pool:           pool,
+		}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
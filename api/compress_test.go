@@ -0,0 +1,130 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	testCases := []struct {
+		header, encoding string
+	}{
+		{"", ""},
+		{"gzip", encodingGzip},
+		{"deflate, gzip", encodingGzip},
+		{"deflate", encodingDeflate},
+		{"gzip;q=0, deflate;q=0.5", encodingDeflate},
+		{"GZIP ; q=0.8", encodingGzip},
+		{"*", encodingGzip},
+		{"gzip;q=0, *", encodingDeflate},
+		{"br, identity", ""},
+	}
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("GET", "/api/v1/search", nil)
+		r.Header.Set("Accept-Encoding", testCase.header)
+		if got := acceptedEncoding(r); got != testCase.encoding {
+			t.Errorf("%q: expected %q, got %q", testCase.header, testCase.encoding, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	const body = `{"Results":{}}`
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		io.WriteString(w, body) //nolint
+	}))
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		encodingGzip: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		encodingDeflate: func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+	}
+	for enc, reader := range readers {
+		r := httptest.NewRequest("GET", "/api/v1/search", nil)
+		r.Header.Set("Accept-Encoding", enc)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != enc {
+			t.Fatalf("expected the %s encoding, got %q", enc, got)
+		}
+
+		zr, err := reader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != body {
+			t.Errorf("%s: expected %s, got %s", enc, body, b)
+		}
+	}
+
+	// responses without a body aren't encoded.
+	r := httptest.NewRequest("GET", "/empty", nil)
+	r.Header.Set("Accept-Encoding", encodingGzip)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Encoding"); got != "" || w.Code != http.StatusNoContent {
+		t.Errorf("expected a 204 without an encoding, got %d and %q", w.Code, got)
+	}
+
+	r = httptest.NewRequest("GET", "/api/v1/search", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Body.String(); got != body || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected the body as it is, got %q", got)
+	}
+}
+
+func TestCompressHijack(t *testing.T) {
+	const res = "HTTP/1.1 200 OK\r\nContent-Length: 3\r\nConnection: close\r\n\r\nraw"
+	srv := httptest.NewServer(compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.CloseNotifier); !ok {
+			t.Error("expected the writer to be a CloseNotifier")
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString(res) //nolint
+		buf.Flush()          //nolint
+	})))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", encodingGzip)
+
+	r, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil || string(b) != "raw" {
+		t.Errorf("expected the hijacked response, got %q, %v", b, err)
+	}
+}
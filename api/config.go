@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/config"
+)
+
+// Serve the config the server loaded, with the defaults applied and the
+// secrets redacted, so operators can tell it apart from the one on disk.
+func setupConfigExport(m *http.ServeMux, a *authorizer, cfg *config.Config) {
+	m.HandleFunc("/api/v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		a.record(r, &audit.Event{Action: "get-config"})
+		res, err := cfg.Redacted()
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		writeResp(w, res)
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+)
+
+// The runtime state of the process, for diagnosing memory use without a
+// profiler.
+type debugStats struct {
+	Time       time.Time
+	Goroutines int
+	NumCPU     int
+	GOMAXPROCS int
+	Memory     runtime.MemStats
+}
+
+// DebugHandler serves the pprof profiles under /debug/pprof/, along with
+// the memory stats and goroutine count at /debug/stats. It does no access
+// checks of its own, so it should only be served where admins can reach it.
+func DebugHandler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	m.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		s := &debugStats{
+			Time:       time.Now(),
+			Goroutines: runtime.NumGoroutine(),
+			NumCPU:     runtime.NumCPU(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+		}
+		runtime.ReadMemStats(&s.Memory)
+		writeResp(w, s)
+	})
+
+	return m
+}
+
+// Serve the debug endpoints to admins only.
+func setupDebug(m *http.ServeMux, a *authorizer) {
+	h := DebugHandler()
+	m.Handle("/debug/", a.filter(a.identified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// The repo each fork or mirror in the config is a fork of.
+func forksOf(cfg *config.Config) map[string]string {
+	forks := map[string]string{}
+	for name, repo := range cfg.Repos {
+		if repo.ForkOf != "" {
+			forks[name] = repo.ForkOf
+		}
+	}
+	return forks
+}
+
+// Collapse the file matches of forks into the matches of the repo they are
+// a fork of, when that repo has a match for a file with the same path and
+// contents. The matches need their hashes. Forks that are left without
+// matches are dropped from the results.
+func dedupe(results map[string]*index.SearchResponse, forks map[string]string) {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		canonical, ok := results[forks[name]]
+		if !ok {
+			continue
+		}
+
+		byFile := map[string]*index.FileMatch{}
+		for _, fm := range canonical.Matches {
+			byFile[fm.Filename+"\x00"+fm.Hash] = fm
+		}
+
+		res := results[name]
+		var kept []*index.FileMatch
+		for _, fm := range res.Matches {
+			if c := byFile[fm.Filename+"\x00"+fm.Hash]; c != nil {
+				c.Forks = append(c.Forks, name)
+				res.FilesWithMatch--
+				continue
+			}
+			kept = append(kept, fm)
+		}
+
+		if len(kept) == 0 {
+			delete(results, name)
+			continue
+		}
+		res.Matches = kept
+	}
+}
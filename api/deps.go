@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/vcs"
+)
+
+// An indexed version of a package, a repo of the package vcs.
+type indexedPackage struct {
+	repo    string
+	version string
+}
+
+// Narrow the repos to the packages the repo of the deps-of qualifier
+// depends on. A dependency is searched at the version the repo requires
+// when that version is indexed and at every indexed version otherwise, as
+// package.json often gives a range.
+func (a *authorizer) filterDeps(r *http.Request, q *query, repos []string, idx map[string]*searcher.Searcher) ([]string, error) {
+	if q.DepsOf == "" {
+		return repos, nil
+	}
+
+	s := idx[q.DepsOf]
+	if s == nil || !a.canAccess(r, q.DepsOf) {
+		return nil, fmt.Errorf("unknown deps-of repo: %q", q.DepsOf)
+	}
+
+	deps, err := s.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	return dependencyRepos(deps, repos, idx), nil
+}
+
+// The repos that are indexed versions of the dependencies.
+func dependencyRepos(deps []*index.Dependency, repos []string, idx map[string]*searcher.Searcher) []string {
+	packages := map[string][]indexedPackage{}
+	for _, repo := range repos {
+		if idx[repo].Repo.Vcs != "package" {
+			continue
+		}
+
+		registry, name, version, err := vcs.ParsePackage(idx[repo].Repo.Url)
+		if err != nil {
+			continue
+		}
+
+		key := registry + ":" + name
+		packages[key] = append(packages[key], indexedPackage{repo, version})
+	}
+
+	var res []string
+	seen := map[string]bool{}
+	for _, dep := range deps {
+		versions := packages[dep.Registry+":"+dep.Name]
+
+		var found []string
+		for _, p := range versions {
+			if p.version == dep.Version {
+				found = append(found, p.repo)
+			}
+		}
+
+		if len(found) == 0 {
+			for _, p := range versions {
+				found = append(found, p.repo)
+			}
+		}
+
+		for _, repo := range found {
+			if !seen[repo] {
+				seen[repo] = true
+				res = append(res, repo)
+			}
+		}
+	}
+	return res
+}
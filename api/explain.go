@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+// How a search was interpreted, returned with explain=true to tell why it
+// matched what it did, or didn't.
+type searchExplanation struct {
+	// The pattern once the qualifiers were taken out of the query, and the
+	// options it was searched for with, the qualifiers applied.
+	Pattern    string
+	Structural bool `json:",omitempty"`
+	Literal    bool
+	IgnoreCase bool
+	WholeWord  bool
+
+	// The regular expression lines were matched with and the trigrams
+	// files had to contain to be read.
+	*index.PatternExplanation
+
+	// The regexps file paths had to match, all of them, the one they
+	// must not match and the other limits on the files searched.
+	Files         []string   `json:",omitempty"`
+	ExcludeFiles  string     `json:",omitempty"`
+	Owner         string     `json:",omitempty"`
+	ModifiedAfter *time.Time `json:",omitempty"`
+	Rev           string     `json:",omitempty"`
+
+	// The repos searched, those named by the request that don't exist or
+	// may not be accessed, and those the tags, qualifiers and revision
+	// left out. The repos left out by their breakers are the Skipped of
+	// the results.
+	Repos       []string
+	Unavailable []string `json:",omitempty"`
+	LeftOut     []string `json:",omitempty"`
+}
+
+// Explain the search of the request, which searched the repos.
+func explainSearch(a *authorizer, r *http.Request, q *query, opt *index.SearchOptions,
+	repos []string, idx map[string]*searcher.Searcher) *searchExplanation {
+	res := &searchExplanation{
+		Pattern:      q.Pattern,
+		Structural:   opt.Structural,
+		Literal:      opt.LiteralSearch,
+		IgnoreCase:   opt.IgnoreCase,
+		WholeWord:    opt.WholeWord,
+		ExcludeFiles: opt.ExcludeFileRegexp,
+		Owner:        opt.Owner,
+		Rev:          opt.Rev,
+		Repos:        append([]string{}, repos...),
+	}
+
+	// the pattern was checked before it was searched for, so it parses.
+	res.PatternExplanation, _ = index.ExplainPattern(q.Pattern, opt)
+
+	for _, pat := range append([]string{opt.FileRegexp}, opt.FileRegexps...) {
+		if pat != "" {
+			res.Files = append(res.Files, pat)
+		}
+	}
+
+	if !opt.ModifiedAfter.IsZero() {
+		res.ModifiedAfter = &opt.ModifiedAfter
+	}
+
+	names := strings.TrimSpace(r.FormValue("repos"))
+	if names != "*" {
+		for _, name := range strings.Split(names, ",") {
+			if name != "" && (idx[name] == nil || !a.canAccess(r, name)) {
+				res.Unavailable = append(res.Unavailable, name)
+			}
+		}
+	}
+
+	searched := map[string]bool{}
+	for _, repo := range repos {
+		searched[repo] = true
+	}
+
+	// tags without repos select from every repo.
+	if names == "" && r.FormValue("tags") != "" {
+		names = "*"
+	}
+
+	for _, repo := range a.visible(r, parseAsRepoList(names, idx)) {
+		if !searched[repo] {
+			res.LeftOut = append(res.LeftOut, repo)
+		}
+	}
+
+	sort.Strings(res.Repos)
+	sort.Strings(res.Unavailable)
+	sort.Strings(res.LeftOut)
+	return res
+}
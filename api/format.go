@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The formats search results can be written in.
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatGrep   = "grep"
+	formatSARIF  = "sarif"
+)
+
+var searchFormats = []string{formatJSON, formatNDJSON, formatCSV, formatGrep, formatSARIF}
+
+// A single matching line, as written by the line based formats.
+type matchLine struct {
+	Repo       string
+	Filename   string
+	LineNumber int
+	Line       string
+}
+
+// Call fn for every match, with the files in the given sort order or
+// ordered by repo and then by path when there is none.
+func eachMatch(results map[string]*index.SearchResponse, order string, fn func(*matchLine) error) error {
+	for _, f := range sortedFiles(results, order) {
+		for _, m := range f.fm.Matches {
+			if err := fn(&matchLine{
+				Repo:       f.repo,
+				Filename:   f.fm.Filename,
+				LineNumber: m.LineNumber,
+				Line:       m.Line,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Write the search results with one match per line, either as JSON objects,
+// as CSV with a header row or as repo:path:line:match like grep -n, or as
+// SARIF with a result for each match of the query.
+func writeMatches(w http.ResponseWriter, format, order, query string, results map[string]*index.SearchResponse) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	switch format {
+	case formatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson;charset=utf-8")
+		enc := json.NewEncoder(w)
+		f, _ := w.(http.Flusher)
+		var repo string
+		return eachMatch(results, order, func(m *matchLine) error {
+			// send each repo's matches as soon as they are written, rather
+			// than when a compressed block fills up.
+			if f != nil && repo != "" && m.Repo != repo {
+				f.Flush()
+			}
+			repo = m.Repo
+			return enc.Encode(m)
+		})
+	case formatCSV:
+		w.Header().Set("Content-Type", "text/csv;charset=utf-8")
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"repo", "path", "line", "match"}); err != nil {
+			return err
+		}
+
+		if err := eachMatch(results, order, func(m *matchLine) error {
+			return cw.Write([]string{m.Repo, m.Filename, strconv.Itoa(m.LineNumber), m.Line})
+		}); err != nil {
+			return err
+		}
+
+		cw.Flush()
+		return cw.Error()
+	case formatGrep:
+		w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+		bw := bufio.NewWriter(w)
+		if err := eachMatch(results, order, func(m *matchLine) error {
+			_, err := fmt.Fprintf(bw, "%s:%s:%d:%s\n", m.Repo, m.Filename, m.LineNumber, m.Line)
+			return err
+		}); err != nil {
+			return err
+		}
+		return bw.Flush()
+	case formatSARIF:
+		run := newSarifRun()
+		run.addRule("search", "note", fmt.Sprintf("Matches %s", query), results, order, nil)
+		return writeSarif(w, run)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/config"
+)
+
+const (
+	// The most access keys or users whose searches are kept, beyond that
+	// the one that searched least recently is forgotten.
+	maxHistoryIdentities = 10000
+
+	defaultPopularQueries uint = 20
+	maxPopularQueries     uint = 1000
+)
+
+// A query in the search history of an access key or user. Searching for
+// it again moves it to the front and counts it again.
+type historyEntry struct {
+	Query string
+	Repos string `json:",omitempty"`
+	Count int
+	Time  time.Time
+}
+
+// A query from the search histories with the number of times it was
+// searched for and by how many access keys or users.
+type popularQuery struct {
+	Query string
+	Count int
+	Users int
+}
+
+// The recent searches of each access key or user, kept in memory. A nil
+// searchHistory keeps nothing.
+type searchHistory struct {
+	size   int
+	lck    sync.Mutex
+	byName map[string][]*historyEntry
+}
+
+func newSearchHistory(cfg *config.SearchHistoryConfig) *searchHistory {
+	if cfg == nil {
+		return nil
+	}
+
+	return &searchHistory{
+		size:   cfg.Size,
+		byName: map[string][]*historyEntry{},
+	}
+}
+
+// Add the search to the front of the history of name.
+func (h *searchHistory) record(name, query, repos string, now time.Time) {
+	if h == nil {
+		return
+	}
+
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	entries, ok := h.byName[name]
+	if !ok && len(h.byName) >= maxHistoryIdentities {
+		h.forgetOldest()
+	}
+
+	e := &historyEntry{Query: query, Repos: repos, Count: 1, Time: now}
+	for i, prev := range entries {
+		if prev.Query == query && prev.Repos == repos {
+			e.Count += prev.Count
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+
+	// the newest entry is the last one.
+	entries = append(entries, e)
+	if len(entries) > h.size {
+		entries = entries[len(entries)-h.size:]
+	}
+	h.byName[name] = entries
+}
+
+// Forget the history whose last search is the oldest.
+func (h *searchHistory) forgetOldest() {
+	var oldest string
+	var at time.Time
+	for name, entries := range h.byName {
+		if t := entries[len(entries)-1].Time; oldest == "" || t.Before(at) {
+			oldest, at = name, t
+		}
+	}
+	delete(h.byName, oldest)
+}
+
+// The history of name, newest first.
+func (h *searchHistory) recent(name string) []*historyEntry {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	entries := h.byName[name]
+	res := make([]*historyEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := *entries[i]
+		res = append(res, &e)
+	}
+	return res
+}
+
+func (h *searchHistory) clear(name string) {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+	delete(h.byName, name)
+}
+
+// The queries searched for most often across every history.
+func (h *searchHistory) popular(limit int) []*popularQuery {
+	h.lck.Lock()
+	byQuery := map[string]*popularQuery{}
+	for _, entries := range h.byName {
+		seen := map[string]bool{}
+		for _, e := range entries {
+			p := byQuery[e.Query]
+			if p == nil {
+				p = &popularQuery{Query: e.Query}
+				byQuery[e.Query] = p
+			}
+
+			p.Count += e.Count
+			if !seen[e.Query] {
+				seen[e.Query] = true
+				p.Users++
+			}
+		}
+	}
+	h.lck.Unlock()
+
+	res := make([]*popularQuery, 0, len(byQuery))
+	for _, p := range byQuery {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Query < res[j].Query
+	})
+
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// The name the history of the token is kept under, which is qualified by
+// its tenant so the same names in different tenants don't share one.
+func historyName(t *auth.Token) string {
+	if t.Tenant == "" {
+		return t.Name
+	}
+	return t.Tenant + "/" + t.Name
+}
+
+func setupHistory(m *http.ServeMux, a *authorizer, h *searchHistory) {
+	m.HandleFunc("/api/v1/history", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		if h == nil {
+			writeError(w,
+				errors.New("Search history is not enabled"),
+				http.StatusNotFound)
+			return
+		}
+
+		t := a.identify(r)
+		if t == nil {
+			writeError(w,
+				errors.New("Search history is only kept for access keys and users"),
+				http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeResp(w, h.recent(historyName(t)))
+		case "DELETE":
+			h.clear(historyName(t))
+			writeResp(w, "ok")
+		}
+	})
+
+	m.HandleFunc("/api/v1/admin/history", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		if h == nil {
+			writeError(w,
+				errors.New("Search history is not enabled"),
+				http.StatusNotFound)
+			return
+		}
+
+		limit := parseAsUintValue(
+			r.FormValue("limit"),
+			1,
+			maxPopularQueries,
+			defaultPopularQueries)
+		writeResp(w, h.popular(int(limit)))
+	})
+}
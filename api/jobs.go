@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/searcher"
+)
+
+const jobsPath = "/api/v1/jobs/"
+
+// Serve the state of the jobs of asynchronous updates, so that a CI
+// pipeline can wait until the index has its push. Only the repos of a job
+// the caller may access are reported.
+func setupJobs(m *http.ServeMux, a *authorizer, jobs *searcher.Jobs) {
+	m.HandleFunc(jobsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !a.allow(auth.ScopeUpdate, w, r) {
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, jobsPath)
+		job := jobs.Get(id)
+		if job == nil {
+			writeError(w,
+				fmt.Errorf("No such job: %s", id),
+				http.StatusNotFound)
+			return
+		}
+
+		for name := range job.Repos {
+			if !a.canAccess(r, name) {
+				delete(job.Repos, name)
+			}
+		}
+
+		writeResp(w, job)
+	})
+}
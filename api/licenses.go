@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The licenses found in a repo.
+type repoLicenses struct {
+	// The directories each license appears in, by its SPDX identifier.
+	Licenses map[string][]string
+
+	Directories []*index.DirLicenses
+}
+
+// The SPDX identifiers of an SPDX license expression, like MIT and
+// Apache-2.0 of "(MIT OR Apache-2.0)".
+func licenseIds(expr string) []string {
+	var res []string
+	for _, f := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expr)) {
+		switch strings.ToUpper(f) {
+		case "AND", "OR", "WITH":
+		default:
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// The licenses of the license files and SPDX headers of the directory.
+func dirLicenseIds(d *index.DirLicenses) []string {
+	var res []string
+	for _, id := range d.Files {
+		res = append(res, licenseIds(id)...)
+	}
+
+	for expr := range d.Headers {
+		res = append(res, licenseIds(expr)...)
+	}
+	return res
+}
+
+// Summarize the licenses of the directories, keeping only the directories
+// with the license when one is given.
+func summarizeLicenses(dirs []*index.DirLicenses, license string) *repoLicenses {
+	res := &repoLicenses{Licenses: map[string][]string{}}
+	for _, d := range dirs {
+		found := map[string]bool{}
+		for _, id := range dirLicenseIds(d) {
+			if license == "" || strings.EqualFold(id, license) {
+				found[id] = true
+			}
+		}
+
+		if len(found) == 0 {
+			continue
+		}
+
+		for id := range found {
+			res.Licenses[id] = append(res.Licenses[id], d.Dir)
+		}
+		res.Directories = append(res.Directories, d)
+	}
+	return res
+}
+
+// Serve the licenses and copyrights found in the repos as they were
+// indexed, for compliance reviews of what is indexed.
+func setupLicenses(m *http.ServeMux, a *authorizer, idx map[string]*searcher.Searcher) {
+	m.HandleFunc("/api/v1/licenses", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		license := strings.TrimSpace(r.FormValue("license"))
+		repos := a.visible(r, parseAsTaggedRepoList(r.FormValue("repos"), r.FormValue("tags"), idx))
+		sort.Strings(repos)
+
+		res := map[string]*repoLicenses{}
+		for _, repo := range repos {
+			dirs, err := idx[repo].Licenses()
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			if l := summarizeLicenses(dirs, license); len(l.Directories) > 0 {
+				res[repo] = l
+			}
+		}
+
+		writeResp(w, res)
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The url of a file on the site hosting its repo.
+type link struct {
+	Url string
+	Rev string
+}
+
+// Serve the urls of files as the UI links to them, so that tools don't have
+// to expand the url-pattern of each repo themselves.
+func setupLinks(m *http.ServeMux, a *authorizer, idx map[string]*searcher.Searcher) {
+	m.HandleFunc("/api/v1/link", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		repo := r.FormValue("repo")
+		if idx[repo] == nil || !a.canAccess(r, repo) {
+			writeError(w,
+				fmt.Errorf("No such repository: %s", repo),
+				http.StatusNotFound)
+			return
+		}
+
+		rev := r.FormValue("rev")
+		if rev == "" {
+			rev = idx[repo].Status().Rev
+		}
+
+		line := int(parseAsUintValue(r.FormValue("line"), 0, math.MaxInt32, 0))
+		res := &link{
+			Url: idx[repo].Repo.LinkTo(r.FormValue("path"), line, rev),
+			Rev: rev,
+		}
+
+		if parseAsBool(r.FormValue("redirect")) {
+			http.Redirect(w, r, res.Url, http.StatusFound)
+			return
+		}
+		writeResp(w, res)
+	})
+}
@@ -0,0 +1,771 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/saved"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/strs"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The types of route parameters.
+const (
+	paramString  = "string"
+	paramInteger = "integer"
+	paramBoolean = "boolean"
+)
+
+// A query or form parameter of a route, or a {segment} of its path.
+type param struct {
+	Name     string
+	Desc     string
+	Type     string
+	Pattern  *regexp.Regexp
+	Enum     []string
+	Required bool
+	InPath   bool
+}
+
+// A route of the API. The routes are described in the OpenAPI document and
+// requests to them are checked against their methods and parameters before
+// they reach the handler.
+type route struct {
+	Path    string
+	Methods []string
+	Group   string
+	Summary string
+	Params  []*param
+	Body    reflect.Type
+	Result  reflect.Type
+	Status  int
+}
+
+// The response of a route that reports an error.
+type errorResult struct {
+	Error string
+}
+
+// The offset:limit of a range of files.
+var rangePattern = regexp.MustCompile(`^\d*:\d*$`)
+
+var (
+	reposParam = &param{Name: "repos", Desc: "Comma separated repo names or * for every repo"}
+	tagsParam  = &param{Name: "tags", Desc: "Comma separated tags, limits the repos to those with any of them"}
+	caseParam  = &param{Name: "i", Type: paramBoolean, Desc: "Ignore case"}
+	wordParam  = &param{Name: "w", Type: paramBoolean, Desc: "Only match q as a whole word"}
+	modeParam  = &param{Name: "mode", Enum: searchModes, Desc: "regexp, the default, or structural to match q as a template with :[holes]"}
+
+	modifiedAfterParam = &param{Name: "modifiedAfter", Desc: "Only search files that last changed after this RFC 3339 time or date, or this long ago such as 720h"}
+	ownerParam         = &param{Name: "owner", Desc: "Only search files the CODEOWNERS file of the repo gives to this user or team"}
+	filesParam         = &param{Name: "files", Desc: "A regular expression the file paths must match, repeated for paths that match any of them"}
+	excludeFilesParam  = &param{Name: "excludeFiles", Desc: "A regular expression the file paths must not match, repeated for paths that match none of them"}
+	pathsParam         = &param{Name: "paths", Desc: "Comma separated globs such as *.go or src/**/*.proto, the file paths must match any of them, may be repeated"}
+	excludePathsParam  = &param{Name: "excludePaths", Desc: "Comma separated globs the file paths must not match, may be repeated"}
+	repoNameParam      = &param{Name: "name", InPath: true, Desc: "The name of the repo"}
+
+	// The options of a saved search, by the names the UI uses.
+	savedSearchParams = []*param{
+		{Name: "q", Required: true, Desc: "The regular expression to search for"},
+		caseParam,
+		{Name: "literal", Type: paramBoolean, Desc: "Search for q as a literal string"},
+		wordParam,
+		modeParam,
+		modifiedAfterParam,
+		ownerParam,
+		{Name: "files", Desc: "A regular expression the file paths must match"},
+		{Name: "excludeFiles", Desc: "A regular expression the file paths must not match"},
+		reposParam,
+	}
+
+	okResult = reflect.TypeOf("")
+)
+
+var routes = []*route{
+	{
+		Path:    "/api/v1/repos",
+		Methods: []string{"GET"},
+		Summary: "List the repos",
+		Result:  reflect.TypeOf(map[string]*config.Repo{}),
+	},
+	{
+		Path:    "/api/v1/search",
+		Methods: []string{"GET"},
+		Summary: "Search the repos",
+		Params: []*param{
+			{Name: "q", Required: true, Desc: "The regular expression to search for, which may include repo:, path:, -path:, lang:, owner:, deps-of:, case:, literal: and word: qualifiers"},
+			reposParam,
+			tagsParam,
+			{Name: "rng", Pattern: rangePattern, Desc: "The range of files to return as offset:limit"},
+			filesParam,
+			excludeFilesParam,
+			pathsParam,
+			excludePathsParam,
+			caseParam,
+			{Name: "literal", Type: paramBoolean, Desc: "Search for q as a literal string"},
+			wordParam,
+			modeParam,
+			modifiedAfterParam,
+			ownerParam,
+			{Name: "rev", Desc: "A revision from the history of the repos to search"},
+			{Name: "ctx", Type: paramInteger, Desc: "Lines of context around each match"},
+			{Name: "ctxMode", Enum: ctxModes, Desc: "lines, the default, or block for the function or block around each match as its context, in the languages whose blocks are recognized"},
+			{Name: "explain", Type: paramBoolean, Desc: "Include how the query was interpreted: the pattern, its regexp and trigrams, the file filters and the repos searched and left out"},
+			{Name: "highlight", Type: paramBoolean, Desc: "Classify the keywords, strings, comments and numbers of the lines of each match, in the languages that are known"},
+			{Name: "stats", Type: paramBoolean, Desc: "Include the number of files opened and the duration, in all and for each repo"},
+			{Name: "maxPerFile", Type: paramInteger, Desc: "The most matching lines to return from each file"},
+			{Name: "maxMatches", Type: paramInteger, Desc: "The most matching lines to return in all, the search stops once it has them"},
+			{Name: "maxLineLength", Type: paramInteger, Desc: "The longest line to return, in bytes, longer ones are cut down around their match"},
+			{Name: "dedupe", Type: paramBoolean, Desc: "Collapse identical files in forks into the matches of the repo they are a fork of"},
+			{Name: "sort", Enum: sortOrders, Desc: "Order the files by path, by repo and then path, by the number of matches or by when they last changed"},
+			{Name: "format", Enum: searchFormats, Desc: "json, or ndjson, csv or grep for one match per line, or sarif for code scanning tools"},
+		},
+		Result: reflect.TypeOf(searchResults{}),
+	},
+	{
+		Path:    "/api/v1/scan",
+		Methods: []string{"POST"},
+		Summary: "Search for a batch of named rules, each in its own repos and files",
+		Params: []*param{
+			{Name: "format", Enum: []string{formatJSON, formatSARIF}, Desc: "json, or sarif for code scanning tools"},
+		},
+		Body:   reflect.TypeOf(scanRequest{}),
+		Result: reflect.TypeOf(scanResults{}),
+	},
+	{
+		Path:    "/api/v1/search/validate",
+		Methods: []string{"GET"},
+		Summary: "Check the pattern of a search for problems before searching for it",
+		Params: []*param{
+			{Name: "q", Required: true, Desc: "The regular expression to check, which may include the qualifiers of a search"},
+			caseParam,
+			{Name: "literal", Type: paramBoolean, Desc: "Check q as a literal string"},
+			wordParam,
+			modeParam,
+		},
+		Result: reflect.TypeOf(patternReport{}),
+	},
+	{
+		Path:    "/api/v1/search/aggregate",
+		Methods: []string{"GET"},
+		Summary: "Count the matches of a search by repo, directory and extension",
+		Params: []*param{
+			{Name: "q", Required: true, Desc: "The regular expression to search for, which may include the qualifiers of a search"},
+			reposParam,
+			tagsParam,
+			filesParam,
+			excludeFilesParam,
+			pathsParam,
+			excludePathsParam,
+			caseParam,
+			{Name: "literal", Type: paramBoolean, Desc: "Search for q as a literal string"},
+			wordParam,
+			modeParam,
+			modifiedAfterParam,
+			ownerParam,
+			{Name: "rev", Desc: "A revision from the history of the repos to search"},
+			{Name: "depth", Type: paramInteger, Desc: "The number of directories to group matches by, 1 by default"},
+		},
+		Result: reflect.TypeOf(searchAggregate{}),
+	},
+	{
+		Path:    "/api/v1/references",
+		Methods: []string{"GET"},
+		Summary: "Find where a symbol is defined and referenced",
+		Params: []*param{
+			{Name: "symbol", Required: true, Pattern: regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`), Desc: "The identifier to look up"},
+			{Name: "lang", Enum: languageNames(), Desc: "The language of the files to search, all files when it is left out"},
+			reposParam,
+			tagsParam,
+		},
+		Result: reflect.TypeOf(symbolReferences{}),
+	},
+	{
+		Path:    "/api/v1/status",
+		Methods: []string{"GET"},
+		Summary: "Report the index status of the repos",
+		Params:  []*param{reposParam},
+		Result:  reflect.TypeOf(map[string]*searcher.Status{}),
+	},
+	{
+		Path:    "/api/v1/status/disk",
+		Methods: []string{"GET"},
+		Summary: "Report the space the dbpath takes and what was last collected from it",
+		Result:  reflect.TypeOf(searcher.DiskUsage{}),
+	},
+	{
+		Path:    "/api/v1/indexing-progress",
+		Methods: []string{"GET"},
+		Summary: "Report how many repos are updating, indexing or ready while they are first indexed, with an estimate of the time left",
+		Result:  reflect.TypeOf(searcher.ProgressReport{}),
+	},
+	{
+		Path:    "/api/v1/licenses",
+		Methods: []string{"GET"},
+		Summary: "Summarize the license files, SPDX headers and copyrights found in the directories of the repos",
+		Params: []*param{
+			{Name: "license", Desc: "An SPDX license identifier, limits the directories to those with the license"},
+			reposParam,
+			tagsParam,
+		},
+		Result: reflect.TypeOf(map[string]*repoLicenses{}),
+	},
+	{
+		Path:    "/api/v1/revisions",
+		Methods: []string{"GET"},
+		Summary: "List the indexed revisions from the history of the repos",
+		Params:  []*param{reposParam},
+		Result:  reflect.TypeOf(map[string][]string{}),
+	},
+	{
+		Path:    "/api/v1/commits/search",
+		Methods: []string{"GET"},
+		Summary: "Search the indexed commits of the repos",
+		Params: []*param{
+			{Name: "q", Desc: "A regular expression for the commit message"},
+			{Name: "author", Desc: "A regular expression for the author"},
+			{Name: "path", Desc: "A regular expression for the touched paths"},
+			caseParam,
+			reposParam,
+			tagsParam,
+			{Name: "limit", Type: paramInteger, Desc: "The most commits to return for each repo"},
+		},
+		Result: reflect.TypeOf(map[string][]*vcs.Commit{}),
+	},
+	{
+		Path:    "/api/v1/excludes",
+		Methods: []string{"GET"},
+		Summary: "List the files of a repo that were left out of its index, with the total in X-Total-Count",
+		Params: []*param{
+			{Name: "repo", Required: true},
+			{Name: "rng", Pattern: rangePattern, Desc: "The range of files to return as offset:limit"},
+		},
+		Result: reflect.TypeOf([]*index.ExcludedFile{}),
+	},
+	{
+		Path:    "/api/v1/link",
+		Methods: []string{"GET"},
+		Summary: "Give the url of a file, or a line of it, on the site hosting the repo",
+		Params: []*param{
+			{Name: "repo", Required: true},
+			{Name: "path", Required: true, Desc: "The path of the file in the repo"},
+			{Name: "line", Type: paramInteger, Desc: "The line to link to"},
+			{Name: "rev", Desc: "The revision to link to, the indexed revision by default"},
+			{Name: "redirect", Type: paramBoolean, Desc: "Redirect to the url rather than returning it"},
+		},
+		Result: reflect.TypeOf(link{}),
+	},
+	{
+		Path:    "/api/v1/update",
+		Methods: []string{"POST"},
+		Group:   auth.RouteUpdate,
+		Summary: "Update the repos from their remotes",
+		Params: []*param{
+			reposParam,
+			{Name: "async", Type: paramBoolean, Desc: "Respond with a job, with status 202, that tells when the repos are updated and indexed"},
+		},
+		Result: okResult,
+	},
+	{
+		Path:    "/api/v1/jobs/{id}",
+		Methods: []string{"GET"},
+		Group:   auth.RouteUpdate,
+		Summary: "Get the state of the job of an asynchronous update, queued, running, done or failed, and the revision indexed for each repo",
+		Params:  []*param{{Name: "id", InPath: true, Desc: "The id of the job"}},
+		Result:  reflect.TypeOf(searcher.Job{}),
+	},
+	{
+		Path:    "/api/v1/reindex",
+		Methods: []string{"POST"},
+		Group:   auth.RouteAdmin,
+		Summary: "Discard the indexes of the repos and build them from fresh clones",
+		Params:  []*param{reposParam},
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/github-webhook",
+		Methods: []string{"POST"},
+		Group:   auth.RouteWebhooks,
+		Summary: "Update a repo for a GitHub push event, or mark it archived or deleted for a repository event",
+		Body:    reflect.TypeOf(githubPush{}),
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/azure-devops-webhook",
+		Methods: []string{"POST"},
+		Group:   auth.RouteWebhooks,
+		Summary: "Update a repo for an Azure DevOps git.push event",
+		Body:    reflect.TypeOf(azureDevOpsPush{}),
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/searches",
+		Methods: []string{"GET"},
+		Summary: "List the saved searches, or get the one with the id",
+		Params:  []*param{{Name: "id"}},
+		Result:  reflect.TypeOf([]*saved.Search{}),
+	},
+	{
+		Path:    "/api/v1/searches",
+		Methods: []string{"POST"},
+		Summary: "Save a search, which can be opened at /s/{id}",
+		Params:  append([]*param{{Name: "name", Required: true}}, savedSearchParams...),
+		Result:  reflect.TypeOf(saved.Search{}),
+		Status:  http.StatusCreated,
+	},
+	{
+		Path:    "/api/v1/searches",
+		Methods: []string{"PUT"},
+		Summary: "Replace the options of a saved search",
+		Params:  append([]*param{{Name: "id", Required: true}, {Name: "name"}}, savedSearchParams...),
+		Result:  reflect.TypeOf(saved.Search{}),
+	},
+	{
+		Path:    "/api/v1/searches",
+		Methods: []string{"DELETE"},
+		Summary: "Delete a saved search",
+		Params:  []*param{{Name: "id", Required: true}},
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/history",
+		Methods: []string{"GET"},
+		Summary: "List the recent searches of the access key or user, newest first",
+		Result:  reflect.TypeOf([]*historyEntry{}),
+	},
+	{
+		Path:    "/api/v1/history",
+		Methods: []string{"DELETE"},
+		Summary: "Forget the recent searches of the access key or user",
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/admin/history",
+		Methods: []string{"GET"},
+		Group:   auth.RouteAdmin,
+		Summary: "List the queries searched for most often",
+		Params:  []*param{{Name: "limit", Type: paramInteger, Desc: "The most queries to return"}},
+		Result:  reflect.TypeOf([]*popularQuery{}),
+	},
+	{
+		Path:    "/api/v1/admin/analytics",
+		Methods: []string{"GET"},
+		Group:   auth.RouteAdmin,
+		Summary: "Report on the searches made over the last day",
+		Params:  []*param{{Name: "limit", Type: paramInteger, Desc: "The most queries to list"}},
+		Result:  reflect.TypeOf(analyticsReport{}),
+	},
+	{
+		Path:    "/api/v1/admin/tokens",
+		Methods: []string{"GET"},
+		Group:   auth.RouteAdmin,
+		Summary: "List the access keys",
+		Result:  reflect.TypeOf([]*auth.Token{}),
+	},
+	{
+		Path:    "/api/v1/admin/tokens",
+		Methods: []string{"POST"},
+		Group:   auth.RouteAdmin,
+		Summary: "Create an access key",
+		Params: []*param{
+			{Name: "name", Required: true},
+			{Name: "role", Desc: "reader, updater or admin"},
+			{Name: "scopes", Desc: "Comma separated scopes: search, update or admin"},
+			{Name: "expires", Desc: "An RFC 3339 time or a duration such as 720h"},
+			{Name: "tenant", Desc: "The tenant the key is bound to, it can't be an admin key"},
+		},
+		Result: reflect.TypeOf(createdToken{}),
+		Status: http.StatusCreated,
+	},
+	{
+		Path:    "/api/v1/admin/tokens",
+		Methods: []string{"DELETE"},
+		Group:   auth.RouteAdmin,
+		Summary: "Delete an access key",
+		Params:  []*param{{Name: "name", Required: true}},
+		Result:  okResult,
+	},
+	{
+		Path:    "/api/v1/admin/config",
+		Methods: []string{"GET"},
+		Group:   auth.RouteAdmin,
+		Summary: "Get the config the server loaded, with the defaults applied and the secrets redacted",
+		Result:  reflect.TypeOf(map[string]interface{}{}),
+	},
+	{
+		Path:    "/api/v1/admin/tenants",
+		Methods: []string{"GET"},
+		Group:   auth.RouteAdmin,
+		Summary: "List the tenants with their repos and their usage of their quotas",
+		Result:  reflect.TypeOf(map[string]*tenantReport{}),
+	},
+	{
+		Path:    "/api/v1/admin/repos",
+		Methods: []string{"POST"},
+		Group:   auth.RouteAdmin,
+		Summary: "Pause, resume, update or reindex many repos at once, reporting the outcome for each",
+		Body:    reflect.TypeOf(bulkRepoRequest{}),
+		Result:  reflect.TypeOf(bulkRepoResults{}),
+	},
+	{
+		Path:    "/api/v1/admin/repos/{name}/pause",
+		Methods: []string{"POST"},
+		Group:   auth.RouteAdmin,
+		Summary: "Stop pulling a repo, by polls and requested updates alike, until it is resumed",
+		Params:  []*param{repoNameParam},
+		Result:  reflect.TypeOf(searcher.Status{}),
+	},
+	{
+		Path:    "/api/v1/admin/repos/{name}/resume",
+		Methods: []string{"POST"},
+		Group:   auth.RouteAdmin,
+		Summary: "Resume pulling a paused repo, pulling it right away",
+		Params:  []*param{repoNameParam},
+		Result:  reflect.TypeOf(searcher.Status{}),
+	},
+	{
+		Path:    "/api/v1/openapi.json",
+		Methods: []string{"GET"},
+		Summary: "This document",
+	},
+}
+
+// Find the routes for the path.
+func routesFor(p string) []*route {
+	var res []*route
+	for _, rt := range routes {
+		if matchPath(rt.Path, p) {
+			res = append(res, rt)
+		}
+	}
+	return res
+}
+
+// Determine whether the path matches the path of a route, in which each
+// {segment} matches any one segment.
+func matchPath(pattern, p string) bool {
+	if !strings.Contains(pattern, "{") {
+		return pattern == p
+	}
+
+	want, got := strings.Split(pattern, "/"), strings.Split(p, "/")
+	if len(want) != len(got) {
+		return false
+	}
+
+	for i, seg := range want {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+
+		if seg != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check a parameter value against its type. Any value is accepted for a
+// boolean, since the UI sends "nope" for false and every value other than
+// true, 1 and fosho is taken as false.
+func (p *param) check(v string) error {
+	if p.Type == paramInteger {
+		if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+			return fmt.Errorf("%s must be a non-negative integer", p.Name)
+		}
+	}
+
+	if len(p.Enum) > 0 && !strs.Contains(p.Enum, v) {
+		return fmt.Errorf("%s must be one of %s", p.Name, strings.Join(p.Enum, ", "))
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(v) {
+		return fmt.Errorf("%s must match %s", p.Name, p.Pattern)
+	}
+
+	return nil
+}
+
+// Check the request against the route. Parameters that aren't described
+// are allowed so that older clients keep working.
+func (rt *route) check(r *http.Request) error {
+	for _, p := range rt.Params {
+		if p.InPath {
+			continue
+		}
+
+		// the parameters of routes with a body are only in the query, as
+		// reading a form would consume the body.
+		var v string
+		if rt.Body != nil {
+			v = r.URL.Query().Get(p.Name)
+		} else {
+			v = r.FormValue(p.Name)
+		}
+
+		if v == "" {
+			if p.Required {
+				return fmt.Errorf("%s is required", p.Name)
+			}
+			continue
+		}
+
+		if err := p.check(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reject requests that don't match the route of their path before they
+// reach the handler. Paths without a route are left to the handler.
+func validate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rts := routesFor(r.URL.Path)
+		if len(rts) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var methods []string
+		for _, rt := range rts {
+			for _, m := range rt.Methods {
+				if m != r.Method {
+					methods = append(methods, m)
+					continue
+				}
+
+				if err := rt.check(r); err != nil {
+					writeError(w, err, http.StatusBadRequest)
+					return
+				}
+
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w,
+			errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+			http.StatusMethodNotAllowed)
+	})
+}
+
+// Builds JSON schemas for Go types, following the rules of encoding/json.
+// Named struct types are added to the components and referenced.
+type schemaGen struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		return g.schema(t.Elem())
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	// types with their own encoding, like config.SecretMessage, can't be
+	// described.
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first so recursive types terminate.
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// Describe the fields of a struct the way encoding/json encodes them.
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	g.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+// Build the OpenAPI document that describes the routes.
+func openAPIDocument(title string) map[string]interface{} {
+	g := &schemaGen{components: map[string]interface{}{}}
+	errSchema := g.schema(reflect.TypeOf(errorResult{}))
+
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range routes {
+		var params []interface{}
+		for _, p := range rt.Params {
+			typ := p.Type
+			if typ == "" {
+				typ = paramString
+			}
+
+			schema := map[string]interface{}{"type": typ}
+			if p.Pattern != nil {
+				schema["pattern"] = p.Pattern.String()
+			}
+
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+
+			in := "query"
+			if p.InPath {
+				in = "path"
+			}
+
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          in,
+				"description": p.Desc,
+				"required":    p.Required || p.InPath,
+				"schema":      schema,
+			})
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		result := map[string]interface{}{"description": http.StatusText(status)}
+		if rt.Result != nil {
+			result["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.schema(rt.Result)},
+			}
+		}
+
+		op := map[string]interface{}{
+			"summary": rt.Summary,
+			"responses": map[string]interface{}{
+				strconv.Itoa(status): result,
+				"default": map[string]interface{}{
+					"description": "An error",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": errSchema},
+					},
+				},
+			},
+		}
+
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(rt.Body)},
+				},
+			}
+		}
+
+		if paths[rt.Path] == nil {
+			paths[rt.Path] = map[string]interface{}{}
+		}
+
+		for _, m := range rt.Methods {
+			paths[rt.Path][strings.ToLower(m)] = op
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer":    map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"accessKey": map[string]interface{}{"type": "apiKey", "in": "query", "name": "access_key"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"accessKey": []string{}},
+		},
+	}
+}
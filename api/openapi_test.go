@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	testCases := []struct {
+		pattern, path string
+		matches       bool
+	}{
+		{"/api/v1/search", "/api/v1/search", true},
+		{"/api/v1/search", "/api/v1/search/", false},
+		{"/api/v1/jobs/{id}", "/api/v1/jobs/42", true},
+		{"/api/v1/jobs/{id}", "/api/v1/jobs/", false},
+		{"/api/v1/jobs/{id}", "/api/v1/jobs/42/x", false},
+		{"/api/v1/admin/repos/{name}/pause", "/api/v1/admin/repos/api/pause", true},
+		{"/api/v1/admin/repos/{name}/pause", "/api/v1/admin/repos/api/resume", false},
+	}
+	for _, testCase := range testCases {
+		if got := matchPath(testCase.pattern, testCase.path); got != testCase.matches {
+			t.Errorf("%s %s: expected %t, got %t", testCase.pattern, testCase.path, testCase.matches, got)
+		}
+	}
+}
+
+func TestRouteCheck(t *testing.T) {
+	rt := &route{
+		Path:    "/api/v1/test",
+		Methods: []string{"GET"},
+		Params: []*param{
+			{Name: "q", Required: true},
+			{Name: "limit", Type: paramInteger},
+			{Name: "mode", Enum: []string{"regexp", "structural"}},
+			{Name: "rng", Pattern: rangePattern},
+			{Name: "i", Type: paramBoolean},
+		},
+	}
+
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{"q=foo", ""},
+		{"q=foo&limit=10&mode=structural&rng=5:10&i=nope&other=x", ""},
+		{"limit=10", "q is required"},
+		{"q=foo&limit=-1", "limit must be a non-negative integer"},
+		{"q=foo&mode=glob", "mode must be one of regexp, structural"},
+		{"q=foo&rng=a:b", "rng must match"},
+	}
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("GET", "/api/v1/test?"+testCase.query, nil)
+		err := rt.check(r)
+		if testCase.err == "" && err != nil {
+			t.Errorf("%s: expected no error, got %s", testCase.query, err)
+		} else if testCase.err != "" && (err == nil || !strings.HasPrefix(err.Error(), testCase.err)) {
+			t.Errorf("%s: expected %q, got %v", testCase.query, testCase.err, err)
+		}
+	}
+}
+
+func TestRoutesFor(t *testing.T) {
+	var paths []string
+	for _, rt := range routesFor("/api/v1/jobs/abc") {
+		paths = append(paths, rt.Path)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"/api/v1/jobs/{id}"}) {
+		t.Errorf("expected the jobs route, got %v", paths)
+	}
+}
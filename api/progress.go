@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/searcher"
+)
+
+// Serve the progress of the first indexing of the repos. It is served
+// before the repos can be searched too, see ProgressHandler. Without a
+// Progress, every repo that can be searched is ready.
+func setupProgress(m *http.ServeMux, a *authorizer, idx map[string]*searcher.Searcher, progress *searcher.Progress) {
+	if progress == nil {
+		names := make([]string, 0, len(idx))
+		for name := range idx {
+			names = append(names, name)
+		}
+
+		progress = searcher.ReadyProgress(names)
+	}
+
+	m.HandleFunc("/api/v1/indexing-progress", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		writeResp(w, progress.Report(time.Now(), func(name string) bool {
+			return a.canAccess(r, name)
+		}))
+	})
+}
+
+// ProgressHandler serves the progress of the first indexing of the repos
+// while the API can't be served yet. Access can't be checked then, so only
+// the counts of the repos in each state are given.
+func ProgressHandler(progress *searcher.Progress) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := progress.Report(time.Now(), nil)
+		res.Repos = nil
+		writeResp(w, res)
+	})
+}
+
+// The response to API requests while the repos are first indexed.
+type notReady struct {
+	Error     string
+	RequestId string `json:",omitempty"`
+	Indexing  bool
+	Progress  *searcher.ProgressReport
+}
+
+// NotReadyHandler answers API requests while the repos are first indexed
+// with a 503 that tells how far along the indexing is.
+func NotReadyHandler(progress *searcher.Progress) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := progress.Report(time.Now(), nil)
+		res.Repos = nil
+		writeJson(w, &notReady{
+			Error:     "Hound is not ready.",
+			RequestId: requestId(r),
+			Indexing:  true,
+			Progress:  res,
+		}, http.StatusServiceUnavailable)
+	})
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+// A search query with the qualifiers that were given in q, such as
+// repo:foo path:*.go lang:go case:yes, taken out of its pattern.
+type query struct {
+	// The pattern to search for.
+	Pattern string
+
+	// Globs of repo names, the repos must match one of them.
+	Repos []string
+
+	// Globs of file paths, files must match one of Paths and none of
+	// ExcludePaths.
+	Paths        []string
+	ExcludePaths []string
+
+	Lang       *language
+	IgnoreCase *bool
+	Literal    *bool
+	WholeWord  *bool
+
+	// The user or team of the CODEOWNERS file that owns the files.
+	Owner string
+
+	// The repo whose dependencies are searched, rather than the repos.
+	DepsOf string
+}
+
+// A word of a query and the whitespace after it.
+var queryWordPattern = regexp.MustCompile(`(\S+)\s*`)
+
+// Parse the qualifiers out of q. Only words of q that are a known qualifier
+// with a valid value are taken out, along with the whitespace after them,
+// and the rest of q is the pattern. A literal q is searched for as it is.
+func parseQuery(q string, literal bool) *query {
+	res := &query{Pattern: q}
+	if literal {
+		return res
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range queryWordPattern.FindAllStringSubmatchIndex(q, -1) {
+		word := q[loc[2]:loc[3]]
+		ix := strings.Index(word, ":")
+
+		// a bare key, like case: in a switch, is part of the pattern.
+		if ix < 0 || ix == len(word)-1 || !res.qualify(word[:ix], word[ix+1:]) {
+			continue
+		}
+
+		b.WriteString(q[last:loc[0]])
+		last = loc[1]
+	}
+
+	if last == 0 {
+		return res
+	}
+
+	// a qualifier at the end takes the whitespace before it along.
+	if last == len(q) {
+		res.Pattern = strings.TrimRight(b.String(), " \t\n\f\r")
+	} else {
+		res.Pattern = b.String() + q[last:]
+	}
+	return res
+}
+
+// Apply the qualifier, returning false when key isn't one or val isn't a
+// valid value for it, which leaves the word to the pattern.
+func (q *query) qualify(key, val string) bool {
+	switch key {
+	case "repo":
+		if _, err := path.Match(val, ""); err != nil {
+			return false
+		}
+		q.Repos = append(q.Repos, val)
+	case "path", "-path":
+		if key == "path" {
+			q.Paths = append(q.Paths, val)
+		} else {
+			q.ExcludePaths = append(q.ExcludePaths, val)
+		}
+	case "lang":
+		lang, ok := languages[val]
+		if !ok {
+			return false
+		}
+		q.Lang = lang
+	case "owner":
+		q.Owner = val
+	case "deps-of":
+		q.DepsOf = val
+	case "case", "literal", "word":
+		b, err := parseYesNo(val)
+		if err != nil {
+			return false
+		}
+
+		// case:yes means the search is case sensitive.
+		switch key {
+		case "case":
+			b = !b
+			q.IgnoreCase = &b
+		case "literal":
+			q.Literal = &b
+		case "word":
+			q.WholeWord = &b
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func parseYesNo(v string) (bool, error) {
+	switch v {
+	case "yes", "y", "true":
+		return true, nil
+	case "no", "n", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not yes or no", v)
+}
+
+// Restrict the search options to the qualified paths and language and set
+// the qualified options.
+func (q *query) apply(opt *index.SearchOptions) {
+	if q.IgnoreCase != nil {
+		opt.IgnoreCase = *q.IgnoreCase
+	}
+
+	if q.Literal != nil {
+		opt.LiteralSearch = *q.Literal
+	}
+
+	if q.WholeWord != nil {
+		opt.WholeWord = *q.WholeWord
+	}
+
+	if q.Owner != "" {
+		opt.Owner = q.Owner
+	}
+
+	if q.Lang != nil {
+		opt.FileRegexps = append(opt.FileRegexps, q.Lang.searchOptions().FileRegexp)
+	}
+
+	if len(q.Paths) > 0 {
+		opt.FileRegexps = append(opt.FileRegexps, globsToRegexp(q.Paths))
+	}
+
+	if len(q.ExcludePaths) > 0 {
+		pat := globsToRegexp(q.ExcludePaths)
+		if opt.ExcludeFileRegexp != "" {
+			pat = "(?:" + opt.ExcludeFileRegexp + ")|" + pat
+		}
+		opt.ExcludeFileRegexp = pat
+	}
+}
+
+// Keep the repos that match the qualified repos.
+func (q *query) filterRepos(repos []string) []string {
+	if len(q.Repos) == 0 {
+		return repos
+	}
+
+	var res []string
+	for _, repo := range repos {
+		for _, pat := range q.Repos {
+			if ok, _ := path.Match(pat, repo); ok {
+				res = append(res, repo)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Convert file globs to a regexp that matches any of them. A * doesn't
+// cross directories while ** does. Globs without a / match the name of the
+// file in any directory and a trailing / matches everything below it.
+func globsToRegexp(globs []string) string {
+	pats := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		prefix := "(?:^|/)"
+		if strings.Contains(glob, "/") {
+			prefix = "^"
+			glob = strings.TrimPrefix(glob, "/")
+		}
+
+		if strings.HasSuffix(glob, "/") {
+			glob += "**"
+		}
+
+		var b strings.Builder
+		rs := []rune(glob)
+		for i := 0; i < len(rs); i++ {
+			switch c := rs[i]; {
+			case c == '*' && i+1 < len(rs) && rs[i+1] == '*':
+				b.WriteString(".*")
+				i++
+			case c == '*':
+				b.WriteString("[^/]*")
+			case c == '?':
+				b.WriteString("[^/]")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		pats = append(pats, prefix+b.String()+"$")
+	}
+	return "(?:" + strings.Join(pats, "|") + ")"
+}
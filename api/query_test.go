@@ -0,0 +1,72 @@
+package api
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	yes, no := true, false
+	testCases := []struct {
+		q     string
+		query query
+	}{
+		{"func main", query{Pattern: "func main"}},
+		{"  spaced   out ", query{Pattern: "  spaced   out "}},
+		{"repo:api* path:*.go handler", query{Pattern: "handler", Repos: []string{"api*"}, Paths: []string{"*.go"}}},
+		{"-path:vendor/ foo bar", query{Pattern: "foo bar", ExcludePaths: []string{"vendor/"}}},
+		{"case:yes Foo", query{Pattern: "Foo", IgnoreCase: &no}},
+		{"case:no literal:y word:false a.b", query{Pattern: "a.b", IgnoreCase: &yes, Literal: &yes, WholeWord: &no}},
+		{"owner:@org/team deps-of:web init", query{Pattern: "init", Owner: "@org/team", DepsOf: "web"}},
+		{"case: x", query{Pattern: "case: x"}},
+		{"http://example.com", query{Pattern: "http://example.com"}},
+		{"lang:go func", query{Pattern: "func", Lang: languages["go"]}},
+		{"foo\t  repo:api  bar", query{Pattern: "foo\t  bar", Repos: []string{"api"}}},
+		{"foo  repo:api ", query{Pattern: "foo", Repos: []string{"api"}}},
+		{"lang:cobol x", query{Pattern: "lang:cobol x"}},
+		{"case:default x", query{Pattern: "case:default x"}},
+		{"repo:[ x", query{Pattern: "repo:[ x"}},
+	}
+	for _, testCase := range testCases {
+		q := parseQuery(testCase.q, false)
+		if !reflect.DeepEqual(*q, testCase.query) {
+			t.Errorf("%q: expected %+v, got %+v", testCase.q, testCase.query, *q)
+		}
+	}
+
+	// a literal query is searched for as it is.
+	q := "repo:api  path:*.go"
+	if got := parseQuery(q, true); !reflect.DeepEqual(*got, query{Pattern: q}) {
+		t.Errorf("%q: expected it to be left as it is, got %+v", q, *got)
+	}
+}
+
+func TestGlobsToRegexp(t *testing.T) {
+	testCases := []struct {
+		globs     []string
+		matches   []string
+		unmatched []string
+	}{
+		{[]string{"*.go"}, []string{"main.go", "cmd/x/main.go"}, []string{"main.go.orig", "go"}},
+		{[]string{"src/*.go"}, []string{"src/a.go", "src/a_test.go"}, []string{"src/x/a.go", "lib/src/a.go"}},
+		{[]string{"src/**/*.proto"}, []string{"src/a/b/c.proto"}, []string{"a/src/c.proto"}},
+		{[]string{"vendor/"}, []string{"vendor/a/b.go"}, []string{"vendored/a.go"}},
+		{[]string{"/docs/*.md"}, []string{"docs/a.md"}, []string{"x/docs/a.md"}},
+		{[]string{"a?.txt", "*.[ch]"}, []string{"ab.txt", "x.[ch]"}, []string{"a/b.txt", "x.c"}},
+	}
+	for _, testCase := range testCases {
+		re := regexp.MustCompile(globsToRegexp(testCase.globs))
+		for _, p := range testCase.matches {
+			if !re.MatchString(p) {
+				t.Errorf("%v: expected %s to match", testCase.globs, p)
+			}
+		}
+
+		for _, p := range testCase.unmatched {
+			if re.MatchString(p) {
+				t.Errorf("%v: expected %s not to match", testCase.globs, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The files of a language and patterns for the lines that define a symbol,
+// in which %s stands for the quoted symbol.
+type language struct {
+	exts []string
+	defs []string
+}
+
+var languages = map[string]*language{
+	"go": {
+		exts: []string{"go"},
+		defs: []string{
+			`^\s*func\s+(\([^)]*\)\s*)?%s\b`,
+			`^\s*(type|var|const)\s+%s\b`,
+			`^\s+%s\s+(struct\b|interface\b|[\w.*\[\]]+(\s*=.*)?$)`,
+		},
+	},
+	"python": {
+		exts: []string{"py", "pyi"},
+		defs: []string{`^\s*(async\s+)?(def|class)\s+%s\b`, `^%s\s*(:[^=]*)?=[^=]`},
+	},
+	"javascript": {
+		exts: []string{"js", "jsx", "mjs", "cjs"},
+		defs: []string{`\b(function\*?|class|const|let|var)\s+%s\b`},
+	},
+	"typescript": {
+		exts: []string{"ts", "tsx"},
+		defs: []string{`\b(function\*?|class|const|let|var|interface|type|enum|namespace)\s+%s\b`},
+	},
+	"java": {
+		exts: []string{"java"},
+		defs: []string{`\b(class|interface|enum|record)\s+%s\b`, `^\s*((public|private|protected|static|final|abstract|synchronized)\s+)*[\w<>\[\],]+\s+%s\s*\([^;]*$`},
+	},
+	"ruby": {
+		exts: []string{"rb"},
+		defs: []string{`^\s*(def\s+(self\.)?|class\s+|module\s+)%s\b`},
+	},
+	"rust": {
+		exts: []string{"rs"},
+		defs: []string{`\b(fn|struct|enum|trait|type|const|static|mod|union|macro_rules!)\s+%s\b`},
+	},
+	"c": {
+		exts: []string{"c", "h", "cc", "cpp", "cxx", "hh", "hpp"},
+		defs: []string{`\b(struct|union|enum|class|typedef\s.*)\s*%s\b`, `^#define\s+%s\b`, `^[\w*].*[\s*]%s\s*\([^;]*$`},
+	},
+}
+
+// Used when no language is given.
+var anyLanguage = &language{
+	defs: []string{`\b(func|function|def|class|struct|interface|type|enum|trait|fn|module)\s+%s\b`},
+}
+
+// Where a symbol is defined or referenced. Columns count bytes from 1, like
+// line numbers.
+type symbolLocation struct {
+	Repo       string
+	Filename   string
+	LineNumber int
+	Column     int
+	Line       string
+}
+
+// The response to a references lookup.
+type symbolReferences struct {
+	Symbol      string
+	Definitions []*symbolLocation
+	References  []*symbolLocation
+
+	searchFailures
+}
+
+// The names of the supported languages.
+func languageNames() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The search options that limit a search to the files of the language.
+func (l *language) searchOptions() *index.SearchOptions {
+	opt := &index.SearchOptions{}
+	if len(l.exts) > 0 {
+		opt.FileRegexp = `\.(` + strings.Join(l.exts, "|") + `)$`
+	}
+	return opt
+}
+
+// Compile the definition patterns of the language for the symbol.
+func (l *language) definitions(symbol string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(l.defs))
+	for _, def := range l.defs {
+		re, err := regexp.Compile(fmt.Sprintf(def, regexp.QuoteMeta(symbol)))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Sort the matches of a word boundary search for the symbol into the lines
+// that define it and those that refer to it.
+func findReferences(
+	symbol string,
+	lang *language,
+	results map[string]*index.SearchResponse) (*symbolReferences, error) {
+	defs, err := lang.definitions(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(symbol) + `\b`)
+
+	res := &symbolReferences{
+		Symbol:      symbol,
+		Definitions: []*symbolLocation{},
+		References:  []*symbolLocation{},
+	}
+
+	if err := eachMatch(results, "", func(m *matchLine) error {
+		loc := &symbolLocation{
+			Repo:       m.Repo,
+			Filename:   m.Filename,
+			LineNumber: m.LineNumber,
+			Column:     1,
+			Line:       m.Line,
+		}
+
+		if ix := word.FindStringIndex(m.Line); ix != nil {
+			loc.Column = ix[0] + 1
+		}
+
+		for _, def := range defs {
+			if def.MatchString(m.Line) {
+				res.Definitions = append(res.Definitions, loc)
+				return nil
+			}
+		}
+
+		res.References = append(res.References, loc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
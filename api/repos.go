@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/strs"
+)
+
+const (
+	adminReposPath = "/api/v1/admin/repos/"
+
+	// The most repos a bulk request may act on and its largest body, which
+	// bound the work of a single request.
+	maxBulkRepos     = 1000
+	maxBulkBodyBytes = 1 << 20
+)
+
+// The actions of bulk requests. Repos are added and removed in the config,
+// so those actions are reported as failed for each repo.
+var repoActions = []string{"pause", "resume", "update", "reindex", "add", "remove"}
+
+// An action to take on each of the repos.
+type repoOperation struct {
+	Action string
+	Repos  []string
+}
+
+// A batch of operations, which are taken in order.
+type bulkRepoRequest struct {
+	Operations []*repoOperation
+}
+
+// The outcome of an action on one repo, with the status of the repo after
+// it when it succeeded.
+type repoOperationResult struct {
+	Action string
+	Repo   string
+	Ok     bool
+	Error  string           `json:",omitempty"`
+	Status *searcher.Status `json:",omitempty"`
+}
+
+// The outcome of each action on each repo, in the order of the request,
+// and the number of them that failed.
+type bulkRepoResults struct {
+	Results []*repoOperationResult
+	Failed  int
+}
+
+func (req *bulkRepoRequest) check() error {
+	if len(req.Operations) == 0 {
+		return errors.New("a bulk request needs operations")
+	}
+
+	var n int
+	for i, op := range req.Operations {
+		if !strs.Contains(repoActions, op.Action) {
+			return fmt.Errorf("operation %d: action must be one of %s", i+1, strings.Join(repoActions, ", "))
+		}
+
+		if len(op.Repos) == 0 {
+			return fmt.Errorf("operation %d needs repos", i+1)
+		}
+		n += len(op.Repos)
+	}
+
+	if n > maxBulkRepos {
+		return fmt.Errorf("a bulk request can act on at most %d repos", maxBulkRepos)
+	}
+	return nil
+}
+
+// Take the action on the repo.
+func takeRepoAction(s *searcher.Searcher, action string) error {
+	switch action {
+	case "pause":
+		s.Pause()
+	case "resume":
+		s.Resume()
+	case "update":
+		if !s.Update() {
+			return errors.New("Push updates are not enabled for the repository")
+		}
+	case "reindex":
+		if !s.Reindex() {
+			return errors.New("Updates are not enabled for the repository")
+		}
+	case "add", "remove":
+		return fmt.Errorf("repos are added and removed in the config, which is read when the server starts")
+	}
+	return nil
+}
+
+// Serve the endpoints that let admins pause the updates of a repo, while it
+// is under maintenance or rate limited, and resume them, without changing
+// the config, along with bulk requests that act on many repos at once and
+// report the outcome for each. Repos are no longer paused once the server
+// restarts.
+func setupRepoAdmin(m *http.ServeMux, a *authorizer, idx map[string]*searcher.Searcher) {
+	m.HandleFunc(adminReposPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		var name, action string
+		rest := strings.TrimPrefix(r.URL.Path, adminReposPath)
+		if ix := strings.LastIndex(rest, "/"); ix >= 0 {
+			name, action = rest[:ix], rest[ix+1:]
+		}
+
+		if action != "pause" && action != "resume" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusNotFound)),
+				http.StatusNotFound)
+			return
+		}
+
+		s := idx[name]
+		a.record(r, &audit.Event{Action: action, Repos: []string{name}})
+		if s == nil || !a.canAccess(r, name) {
+			writeError(w,
+				fmt.Errorf("No such repository: %s", name),
+				http.StatusNotFound)
+			return
+		}
+
+		if err := takeRepoAction(s, action); err != nil {
+			writeError(w, err, http.StatusForbidden)
+			return
+		}
+
+		writeResp(w, s.Status())
+	})
+
+	m.HandleFunc(strings.TrimSuffix(adminReposPath, "/"), func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		var req bulkRepoRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("invalid bulk request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := req.check(); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		// one repo failing doesn't stop the others, each has its outcome.
+		var res bulkRepoResults
+		for _, op := range req.Operations {
+			a.record(r, &audit.Event{Action: op.Action, Repos: op.Repos})
+			for _, name := range op.Repos {
+				rr := &repoOperationResult{Action: op.Action, Repo: name}
+				res.Results = append(res.Results, rr)
+
+				var err error
+				s := idx[name]
+				if op.Action != "add" && (s == nil || !a.canAccess(r, name)) {
+					err = fmt.Errorf("No such repository: %s", name)
+				} else {
+					err = takeRepoAction(s, op.Action)
+				}
+
+				if err != nil {
+					rr.Error = err.Error()
+					res.Failed++
+					continue
+				}
+
+				rr.Ok = true
+				rr.Status = s.Status()
+			}
+		}
+
+		status := http.StatusOK
+		if res.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		writeJson(w, &res, status)
+	})
+}
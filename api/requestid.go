@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+const (
+	// The header requests are identified by, which a proxy in front of
+	// Hound may have set already.
+	requestIdHeader = "X-Request-ID"
+
+	requestIdBytes = 8
+)
+
+// The request ids that are accepted from clients, others are replaced so
+// that they can't break up log lines.
+var validRequestId = regexp.MustCompile(`^[\w.:/+=@-]{1,128}$`)
+
+type requestIdKey struct{}
+
+func newRequestId() string {
+	b := make([]byte, requestIdBytes)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// The id of the request, empty when it didn't pass through WithRequestId.
+func requestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdKey{}).(string)
+	return id
+}
+
+// WithRequestId gives every request an id, the X-Request-ID it came with or
+// a new one, which is returned in the X-Request-ID header of the response
+// and in its error, and recorded in the audit log and the logs of failures,
+// so that a failure can be found in the logs of proxies and of Hound.
+func WithRequestId(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIdHeader)
+		if !validRequestId.MatchString(id) {
+			id = newRequestId()
+		}
+
+		w.Header().Set(requestIdHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)))
+	})
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The levels of SARIF results, which are the severities of scan rules.
+var sarifLevels = []string{"error", "warning", "note"}
+
+// The parts of a SARIF 2.1.0 log that search results fill in. The paths of
+// results are relative to their repo, which is named by the uriBaseId, so
+// tools that check out a single repo can resolve them.
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool          `json:"tool"`
+	Invocations []*sarifInvocation `json:"invocations"`
+	Results     []*sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string       `json:"name"`
+		InformationUri string       `json:"informationUri"`
+		Rules          []*sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	Id                   string        `json:"id"`
+	ShortDescription     *sarifMessage `json:"shortDescription,omitempty"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                 `json:"executionSuccessful"`
+	ToolExecutionNotifications []*sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level          string       `json:"level"`
+	Message        sarifMessage `json:"message"`
+	AssociatedRule struct {
+		Id string `json:"id"`
+	} `json:"associatedRule"`
+}
+
+type sarifResult struct {
+	RuleId    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			Uri       string `json:"uri"`
+			UriBaseId string `json:"uriBaseId"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine int          `json:"startLine"`
+			Snippet   sarifMessage `json:"snippet"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+func newSarifRun() *sarifRun {
+	run := &sarifRun{
+		Invocations: []*sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []*sarifResult{},
+	}
+	run.Tool.Driver.Name = "hound"
+	run.Tool.Driver.InformationUri = "https://github.com/hound-search/hound"
+	return run
+}
+
+// Add a rule to the run along with a result for each of its matches, in
+// the given sort order. A rule that failed has no results and makes the run
+// unsuccessful.
+func (run *sarifRun) addRule(id, level, message string, results map[string]*index.SearchResponse, order string, err error) {
+	rule := &sarifRule{Id: id}
+	if message != "" {
+		rule.ShortDescription = &sarifMessage{message}
+	}
+	rule.DefaultConfiguration.Level = level
+	run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+
+	if err != nil {
+		n := &sarifNotification{Level: "error", Message: sarifMessage{err.Error()}}
+		n.AssociatedRule.Id = id
+		inv := run.Invocations[0]
+		inv.ExecutionSuccessful = false
+		inv.ToolExecutionNotifications = append(inv.ToolExecutionNotifications, n)
+		return
+	}
+
+	for _, f := range sortedFiles(results, order) {
+		for _, m := range f.fm.Matches {
+			loc := &sarifLocation{}
+			loc.PhysicalLocation.ArtifactLocation.Uri = f.fm.Filename
+			loc.PhysicalLocation.ArtifactLocation.UriBaseId = f.repo
+			loc.PhysicalLocation.Region.StartLine = m.LineNumber
+			loc.PhysicalLocation.Region.Snippet.Text = m.Line
+
+			run.Results = append(run.Results, &sarifResult{
+				RuleId:    id,
+				Level:     level,
+				Message:   sarifMessage{message},
+				Locations: []*sarifLocation{loc},
+			})
+		}
+	}
+}
+
+func writeSarif(w http.ResponseWriter, run *sarifRun) error {
+	w.Header().Set("Content-Type", "application/sarif+json;charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	return json.NewEncoder(w).Encode(&sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []*sarifRun{run},
+	})
+}
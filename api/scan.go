@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/strs"
+)
+
+const (
+	// The most rules a scan may have and the largest request body, which
+	// bound the work of a single request.
+	maxScanRules     = 500
+	maxScanBodyBytes = 1 << 20
+)
+
+// A rule of a scan, a pattern that should not appear in the files and repos
+// it applies to. The pattern may carry the qualifiers of a search.
+type scanRule struct {
+	Name         string
+	Pattern      string
+	Literal      bool   `json:",omitempty"`
+	IgnoreCase   bool   `json:",omitempty"`
+	Files        string `json:",omitempty"`
+	ExcludeFiles string `json:",omitempty"`
+
+	// The repos the rule applies to, those of the scan when empty.
+	Repos string `json:",omitempty"`
+
+	// What a match of the rule means and its level in SARIF: error, the
+	// default, warning or note.
+	Message  string `json:",omitempty"`
+	Severity string `json:",omitempty"`
+}
+
+// A batch of rules to search for at once, in the repos and with the tags
+// given like those of a search.
+type scanRequest struct {
+	Repos string
+	Tags  string `json:",omitempty"`
+	Rules []*scanRule
+
+	// The most matching lines to return for each rule, 0 for no limit.
+	MaxMatches int `json:",omitempty"`
+
+	// The longest line to return, in bytes, as with the maxLineLength of a
+	// search.
+	MaxLineLength int `json:",omitempty"`
+}
+
+// The matches of a rule, or why it couldn't be searched for.
+type scanRuleResult struct {
+	Rule      string
+	Results   map[string]*index.SearchResponse `json:",omitempty"`
+	Truncated bool                             `json:",omitempty"`
+	Error     string                           `json:",omitempty"`
+
+	searchFailures
+}
+
+type scanResults struct {
+	Rules []*scanRuleResult
+}
+
+func (req *scanRequest) check() error {
+	if len(req.Rules) == 0 {
+		return errors.New("a scan needs rules")
+	}
+
+	if len(req.Rules) > maxScanRules {
+		return fmt.Errorf("a scan can have at most %d rules", maxScanRules)
+	}
+
+	for i, rule := range req.Rules {
+		if rule.Name == "" || rule.Pattern == "" {
+			return fmt.Errorf("rule %d needs a name and a pattern", i+1)
+		}
+
+		if rule.Severity == "" {
+			rule.Severity = sarifLevels[0]
+		} else if !strs.Contains(sarifLevels, rule.Severity) {
+			return fmt.Errorf("rule %s: severity must be error, warning or note", rule.Name)
+		}
+	}
+	return nil
+}
+
+// Search for a rule in its repos, among those the request may access,
+// adding the files it opened to st.
+func scanFor(a *authorizer, r *http.Request, req *scanRequest, rule *scanRule, idx map[string]*searcher.Searcher, st *Stats, br *breakers) *scanRuleResult {
+	res := &scanRuleResult{Rule: rule.Name}
+
+	names := rule.Repos
+	if names == "" {
+		names = req.Repos
+	}
+
+	opt := &index.SearchOptions{
+		FileRegexp:        rule.Files,
+		ExcludeFileRegexp: rule.ExcludeFiles,
+		IgnoreCase:        rule.IgnoreCase,
+		LiteralSearch:     rule.Literal,
+		MaxMatches:        req.MaxMatches,
+		MaxLineLength:     req.MaxLineLength,
+	}
+
+	repos := a.visible(r, parseAsTaggedRepoList(names, req.Tags, idx))
+	q := parseQuery(rule.Pattern, opt.LiteralSearch)
+	q.apply(opt)
+	err := index.CheckPattern(q.Pattern, opt)
+
+	if err == nil {
+		repos, err = a.filterDeps(r, q, q.filterRepos(repos), idx)
+	}
+
+	if err == nil {
+		res.Results, err = searchAll(q.Pattern, opt, repos, idx, st, br, &res.searchFailures)
+	}
+
+	if err == nil && opt.MaxMatches > 0 {
+		res.Truncated = capMatches(res.Results, opt.MaxMatches)
+	}
+
+	if err != nil {
+		res.Results = nil
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Serve scans, which search for a batch of rules in one request so that CI
+// jobs can check policies against the indexes.
+func setupScan(m *http.ServeMux, a *authorizer, idx map[string]*searcher.Searcher, br *breakers, lineLimit int) {
+	m.HandleFunc("/api/v1/scan", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) || !a.chargeSearch(w, r) {
+			return
+		}
+
+		var req scanRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScanBodyBytes)).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("invalid scan: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := req.check(); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		req.MaxLineLength = maxLineLength(req.MaxLineLength, lineLimit)
+
+		var res scanResults
+		var st Stats
+		var names, searched []string
+		for _, rule := range req.Rules {
+			rr := scanFor(a, r, &req, rule, idx, &st, br)
+			res.Rules = append(res.Rules, rr)
+			names = append(names, rule.Name)
+			searched = append(searched, resultRepos(rr.Results)...)
+		}
+
+		a.chargeFilesOpened(r, st.FilesOpened)
+
+		a.record(r, &audit.Event{
+			Action: "scan",
+			Query:  strings.Join(names, ","),
+			Repos:  searched,
+		})
+
+		if r.URL.Query().Get("format") != formatSARIF {
+			writeResp(w, &res)
+			return
+		}
+
+		run := newSarifRun()
+		for i, rr := range res.Rules {
+			var err error
+			if rr.Error != "" {
+				err = errors.New(rr.Error)
+			}
+
+			rule := req.Rules[i]
+			msg := rule.Message
+			if msg == "" {
+				msg = fmt.Sprintf("Matches %s", rule.Pattern)
+			}
+			run.addRule(rule.Name, rule.Severity, msg, rr.Results, "", err)
+		}
+
+		if err := writeSarif(w, run); err != nil {
+			log.Printf("Request %s: failed to write sarif results: %s", requestId(r), err)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hound-search/hound/audit"
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/saved"
+)
+
+const searchesFilename = "searches.json"
+
+// The options of a search given in the request.
+func searchOptionsOf(r *http.Request) map[string]string {
+	opts := map[string]string{}
+	for _, name := range saved.Options {
+		opts[name] = r.FormValue(name)
+	}
+	return opts
+}
+
+// Determine whether the request may see the search, which is only allowed
+// within the tenant it was saved in, and for admins.
+func (a *authorizer) maySee(r *http.Request, search *saved.Search) bool {
+	t := a.identify(r)
+	return tenantOf(t) == search.Tenant || (t != nil && t.HasScope(auth.ScopeAdmin))
+}
+
+// Determine whether the request may change the search, which is allowed
+// for its owner and admins, or anyone when it has no owner.
+func (a *authorizer) mayChange(r *http.Request, search *saved.Search) bool {
+	if search.Owner == "" {
+		return true
+	}
+
+	t := a.identify(r)
+	return t != nil && (t.Name == search.Owner || t.HasScope(auth.ScopeAdmin))
+}
+
+func setupSearches(api, m *http.ServeMux, a *authorizer, searches *saved.Store) {
+	api.HandleFunc("/api/v1/searches", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		id := r.FormValue("id")
+		if r.Method != "GET" && r.Method != "POST" {
+			search := searches.Get(id)
+			if search == nil || !a.maySee(r, search) {
+				writeError(w,
+					fmt.Errorf("No such search: %s", id),
+					http.StatusNotFound)
+				return
+			}
+
+			if !a.mayChange(r, search) {
+				writeError(w,
+					fmt.Errorf("Search %s belongs to %s", id, search.Owner),
+					http.StatusForbidden)
+				return
+			}
+		}
+
+		switch r.Method {
+		case "GET":
+			if id == "" {
+				res := []*saved.Search{}
+				for _, search := range searches.List() {
+					if a.maySee(r, search) {
+						res = append(res, search)
+					}
+				}
+				writeResp(w, res)
+				return
+			}
+
+			search := searches.Get(id)
+			if search == nil || !a.maySee(r, search) {
+				writeError(w,
+					fmt.Errorf("No such search: %s", id),
+					http.StatusNotFound)
+				return
+			}
+			writeResp(w, search)
+		case "POST":
+			var owner string
+			t := a.identify(r)
+			if t != nil {
+				owner = t.Name
+			}
+
+			search, err := searches.Create(r.FormValue("name"), owner, tenantOf(t), searchOptionsOf(r))
+			a.record(r, &audit.Event{Action: "save-search", Query: r.FormValue("q"), Error: errString(err)})
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			writeJson(w, search, http.StatusCreated)
+		case "PUT":
+			search, err := searches.Update(id, r.FormValue("name"), searchOptionsOf(r))
+			a.record(r, &audit.Event{Action: "update-search", Query: r.FormValue("q"), Error: errString(err)})
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			writeResp(w, search)
+		case "DELETE":
+			_, err := searches.Delete(id)
+			a.record(r, &audit.Event{Action: "delete-search", Query: id, Error: errString(err)})
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeResp(w, "ok")
+		default:
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+		}
+	})
+
+	// short links open the saved search in the UI.
+	m.Handle("/s/", WithRequestId(a.identified(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeSearch, w, r) {
+			return
+		}
+
+		search := searches.Get(strings.TrimPrefix(r.URL.Path, "/s/"))
+		if search == nil || !a.maySee(r, search) {
+			http.NotFound(w, r)
+			return
+		}
+
+		v := url.Values{}
+		for name, val := range search.Options {
+			v.Set(name, val)
+		}
+		http.Redirect(w, r, "/?"+v.Encode(), http.StatusFound)
+	}))))
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The orders search results can be sorted in.
+const (
+	sortPath    = "path"
+	sortRepo    = "repo"
+	sortMatches = "matches"
+	sortRecency = "recency"
+)
+
+var sortOrders = []string{sortPath, sortRepo, sortMatches, sortRecency}
+
+// A file with matches and the repo it is in.
+type repoFile struct {
+	repo string
+	fm   *index.FileMatch
+}
+
+func matchesIn(fm *index.FileMatch) int {
+	if fm.Count > 0 {
+		return fm.Count
+	}
+	return len(fm.Matches)
+}
+
+// Determine whether a sorts before b in the given order. Files that are
+// otherwise equal are ordered by path and then by repo, so the order is the
+// same from one search to the next.
+func sortsBefore(order string, a, b *repoFile) bool {
+	switch order {
+	case sortRepo:
+		if a.repo != b.repo {
+			return a.repo < b.repo
+		}
+	case sortMatches:
+		if na, nb := matchesIn(a.fm), matchesIn(b.fm); na != nb {
+			return na > nb
+		}
+	case sortRecency:
+		if !a.fm.ModTime.Equal(b.fm.ModTime) {
+			return a.fm.ModTime.After(b.fm.ModTime)
+		}
+	}
+
+	if a.fm.Filename != b.fm.Filename {
+		return a.fm.Filename < b.fm.Filename
+	}
+	return a.repo < b.repo
+}
+
+// The files with matches across every repo, in the given order or by repo
+// and path when there is none.
+func sortedFiles(results map[string]*index.SearchResponse, order string) []*repoFile {
+	if order == "" {
+		order = sortRepo
+	}
+
+	var files []*repoFile
+	for repo, res := range results {
+		for _, fm := range res.Matches {
+			files = append(files, &repoFile{repo, fm})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return sortsBefore(order, files[i], files[j])
+	})
+	return files
+}
+
+// Sort the files of each repo in the given order and return the repos in
+// the order their first files come in when the results of every repo are
+// merged.
+func sortResults(results map[string]*index.SearchResponse, order string) []string {
+	var repos []string
+	seen := map[string]bool{}
+	for _, f := range sortedFiles(results, order) {
+		if !seen[f.repo] {
+			seen[f.repo] = true
+			repos = append(repos, f.repo)
+		}
+	}
+
+	for _, res := range results {
+		fms := res.Matches
+		sort.SliceStable(fms, func(i, j int) bool {
+			return sortsBefore(order, &repoFile{fm: fms[i]}, &repoFile{fm: fms[j]})
+		})
+	}
+	return repos
+}
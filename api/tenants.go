@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/hound-search/hound/auth"
+	"github.com/hound-search/hound/config"
+)
+
+// A tenant with its repos, its quotas and how much of them it used.
+type tenantReport struct {
+	Repos  []string
+	Quotas *config.TenantConfig `json:",omitempty"`
+	Usage  *auth.TenantUsage
+}
+
+// Serve the tenants of the config with the repos they own and their usage
+// of their quotas.
+func setupTenants(m *http.ServeMux, a *authorizer, cfg *config.Config) {
+	m.HandleFunc("/api/v1/admin/tenants", func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(auth.ScopeAdmin, w, r) {
+			return
+		}
+
+		now := time.Now()
+		res := map[string]*tenantReport{}
+		for name, t := range cfg.Tenants {
+			res[name] = &tenantReport{
+				Repos:  []string{},
+				Quotas: t,
+				Usage:  a.quotas.Usage(name, now),
+			}
+		}
+
+		for name, repo := range cfg.Repos {
+			if t := res[repo.Tenant]; t != nil {
+				t.Repos = append(t.Repos, name)
+			}
+		}
+
+		for _, t := range res {
+			sort.Strings(t.Repos)
+		}
+
+		writeResp(w, res)
+	})
+}
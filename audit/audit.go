@@ -0,0 +1,126 @@
+// Package audit records who searched for what and who changed what through
+// the API.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/httpqueue"
+)
+
+const (
+	httpQueueSize   = 1024
+	httpSinkTimeout = 10 * time.Second
+)
+
+// A single audited request.
+type Event struct {
+	Time time.Time
+
+	// The name of the access key of the request, empty if it had none.
+	Identity string `json:",omitempty"`
+	Remote   string
+
+	// The X-Request-ID of the request, to find it in the logs of proxies.
+	RequestId string `json:",omitempty"`
+
+	// What was done, i.e. search or reindex.
+	Action string
+	Query  string   `json:",omitempty"`
+	Repos  []string `json:",omitempty"`
+	Error  string   `json:",omitempty"`
+}
+
+// Somewhere events are sent.
+type Sink interface {
+	Record(e *Event) error
+}
+
+// Records events to every sink, logging the events that can't be recorded.
+type Logger struct {
+	sinks []Sink
+}
+
+// Create a Logger for the config, which may be nil in which case events
+// are discarded.
+func New(cfg *config.AuditConfig) (*Logger, error) {
+	l := &Logger{}
+	if cfg == nil {
+		return l, nil
+	}
+
+	if cfg.File != "" {
+		s, err := newFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		l.sinks = append(l.sinks, s)
+	}
+
+	if cfg.Url != "" {
+		l.sinks = append(l.sinks, newHTTPSink(cfg.Url))
+	}
+
+	return l, nil
+}
+
+// Record the event, setting its time if it has none.
+func (l *Logger) Record(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for _, s := range l.sinks {
+		if err := s.Record(e); err != nil {
+			log.Printf("audit: failed to record %s: %s", e.Action, err)
+		}
+	}
+}
+
+// Appends each event to a file as a line of JSON.
+type fileSink struct {
+	f   *os.File
+	lck sync.Mutex
+}
+
+func newFileSink(name string) (*fileSink, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Record(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+// Posts each event as JSON to a URL in the background.
+type httpSink struct {
+	q *httpqueue.Queue
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{httpqueue.New("audit", url, httpQueueSize, httpSinkTimeout)}
+}
+
+func (s *httpSink) Record(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.q.Send(b)
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "audit.log")
+	l, err := New(&config.AuditConfig{File: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Record(&Event{Identity: "ci", Action: "search", Query: "foo", Repos: []string{"a", "b"}})
+	l.Record(&Event{Action: "reindex", Repos: []string{"a"}})
+
+	r, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var events []*Event
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, &e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if e := events[0]; e.Identity != "ci" || e.Query != "foo" || len(e.Repos) != 2 || e.Time.IsZero() {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	if e := events[1]; e.Action != "reindex" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	ch := make(chan *Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		ch <- &e
+	}))
+	defer srv.Close()
+
+	l, err := New(&config.AuditConfig{Url: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Record(&Event{Action: "update", Repos: []string{"a"}})
+
+	select {
+	case e := <-ch:
+		if e.Action != "update" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+}
+
+func TestNoConfig(t *testing.T) {
+	l, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with no sinks events are discarded.
+	l.Record(&Event{Action: "search"})
+}
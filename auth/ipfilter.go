@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The groups of API routes that can be given their own IP rules.
+const (
+	RouteSearch   = "search"
+	RouteUpdate   = "update"
+	RouteWebhooks = "webhooks"
+	RouteAdmin    = "admin"
+)
+
+// A list of networks parsed from addresses and CIDRs.
+type networks []*net.IPNet
+
+func parseNetworks(cidrs []string) (networks, error) {
+	var nets networks
+	for _, cidr := range cidrs {
+		// a bare address matches just that address.
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Determine whether the address, with or without a port, is in one of the
+// networks.
+func (nets networks) contains(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type ipRules struct {
+	allow networks
+	deny  networks
+}
+
+func parseIPRules(cfg *config.IPRules) (*ipRules, error) {
+	allow, err := parseNetworks(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parseNetworks(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ipRules{allow: allow, deny: deny}, nil
+}
+
+// An address is allowed when it isn't denied and, if there is an allow list,
+// it is on it.
+func (r *ipRules) allows(addr string) bool {
+	if r.deny.contains(addr) {
+		return false
+	}
+	return len(r.allow) == 0 || r.allow.contains(addr)
+}
+
+// Decides which addresses may use the API, and each group of its routes.
+type IPFilter struct {
+	all    *ipRules
+	groups map[string]*ipRules
+}
+
+func NewIPFilter(cfg *config.IPFilterConfig) (*IPFilter, error) {
+	all, err := parseIPRules(&cfg.IPRules)
+	if err != nil {
+		return nil, fmt.Errorf("ip-filter: %s", err)
+	}
+
+	f := &IPFilter{
+		all:    all,
+		groups: map[string]*ipRules{},
+	}
+
+	for group, rules := range cfg.Groups {
+		switch group {
+		case RouteSearch, RouteUpdate, RouteWebhooks, RouteAdmin:
+		default:
+			return nil, fmt.Errorf("ip-filter: unknown route group: %q", group)
+		}
+
+		if f.groups[group], err = parseIPRules(rules); err != nil {
+			return nil, fmt.Errorf("ip-filter: %s", err)
+		}
+	}
+
+	return f, nil
+}
+
+// Determine whether the address may use the routes of the group. It must
+// be allowed by both the rules for the whole API and those of the group.
+func (f *IPFilter) Allows(group, addr string) bool {
+	if !f.all.allows(addr) {
+		return false
+	}
+
+	if r := f.groups[group]; r != nil {
+		return r.allows(addr)
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestIPFilter(t *testing.T) {
+	if _, err := NewIPFilter(&config.IPFilterConfig{
+		Groups: map[string]*config.IPRules{"nope": {}},
+	}); err == nil {
+		t.Fatal("expected an error for an unknown route group")
+	}
+
+	if _, err := NewIPFilter(&config.IPFilterConfig{
+		IPRules: config.IPRules{Allow: []string{"10.0.0.0/33"}},
+	}); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+
+	f, err := NewIPFilter(&config.IPFilterConfig{
+		IPRules: config.IPRules{Deny: []string{"192.0.2.1"}},
+		Groups: map[string]*config.IPRules{
+			RouteAdmin:    {Allow: []string{"10.0.0.0/8", "::1"}},
+			RouteWebhooks: {Allow: []string{"192.0.2.0/24"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group string
+		addr  string
+		want  bool
+	}{
+		{RouteSearch, "203.0.113.7:1234", true},
+		{RouteSearch, "192.0.2.1:1234", false},
+		{RouteAdmin, "10.1.2.3:1234", true},
+		{RouteAdmin, "[::1]:1234", true},
+		{RouteAdmin, "203.0.113.7:1234", false},
+		{RouteWebhooks, "192.0.2.9:1234", true},
+		{RouteWebhooks, "192.0.2.1:1234", false},
+		{RouteWebhooks, "10.1.2.3:1234", false},
+	}
+
+	for _, test := range tests {
+		if got := f.Allows(test.group, test.addr); got != test.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", test.group, test.addr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/strs"
+)
+
+const (
+	// How long keys fetched from the JWKS are used before they are fetched
+	// again.
+	jwksTTL = time.Hour
+
+	// The least time between fetches of the JWKS, so tokens signed with
+	// unknown keys or an unavailable JWKS don't cause a fetch per request.
+	jwksMinRefresh = time.Minute
+
+	// Allowed difference between our clock and that of the issuer.
+	jwtLeeway = time.Minute
+)
+
+// The hash for each supported signing algorithm. Only asymmetric
+// algorithms are supported since the keys come from a JWKS.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Validates JSON Web Tokens against the keys of a JWKS and maps their
+// claims to roles and repos.
+type JWTAuth struct {
+	cfg    *config.JWTAuthConfig
+	client *http.Client
+
+	lck       sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+}
+
+func NewJWTAuth(cfg *config.JWTAuthConfig) (*JWTAuth, error) {
+	if cfg.JwksUrl == "" {
+		return nil, errors.New("jwt-auth requires jwks-url")
+	}
+
+	roles := make([]string, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		roles = append(roles, rule.Role)
+	}
+
+	if err := checkRuleRoles(roles); err != nil {
+		return nil, fmt.Errorf("jwt-auth: %s", err)
+	}
+
+	return &JWTAuth{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Determine whether the bearer token looks like a JWT rather than an
+// access key.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validate the token and return a Token for it. The token has the most
+// privileged role and every repo granted by the rules that match its
+// claims, bound to the tenant of the first of them. Returns an error if the
+// token isn't valid at the given time or no rule matches.
+func (j *JWTAuth) Authenticate(token string, now time.Time) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, err
+	}
+
+	hash, ok := jwtHashes[hdr.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported jwt algorithm: %q", hdr.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := j.key(hdr.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verify(key, hdr.Alg, hash, h.Sum(nil), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	expires, err := j.checkClaims(claims, now)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := claims["sub"].(string)
+	if name == "" {
+		name = "jwt"
+	}
+
+	var t *Token
+	for _, rule := range j.cfg.Rules {
+		if !claimsMatch(claims, rule.Claims) {
+			continue
+		}
+
+		if t == nil {
+			t = newGrantedToken(name, rule.Tenant)
+			t.Expires = expires
+		} else if rule.Tenant != t.Tenant {
+			continue
+		}
+		t.grant(rule.Role, rule.Repos)
+	}
+
+	if t == nil {
+		return nil, fmt.Errorf("no jwt-auth rule matches %s", name)
+	}
+
+	return t, nil
+}
+
+// Check the registered claims, returning the expiry of the token.
+func (j *JWTAuth) checkClaims(claims map[string]interface{}, now time.Time) (*time.Time, error) {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("jwt has no exp claim")
+	}
+
+	expires := time.Unix(int64(exp), 0).UTC()
+	if !now.Before(expires.Add(jwtLeeway)) {
+		return nil, errors.New("jwt has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("jwt is not valid yet")
+	}
+
+	if j.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.cfg.Issuer {
+			return nil, fmt.Errorf("unexpected jwt issuer: %q", iss)
+		}
+	}
+
+	if j.cfg.Audience != "" && !strs.Contains(claimValues(claims["aud"]), j.cfg.Audience) {
+		return nil, errors.New("jwt is not for this audience")
+	}
+
+	return &expires, nil
+}
+
+// The string values of a claim, which may be a single value or a list.
+func claimValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case bool, float64:
+		return []string{fmt.Sprint(v)}
+	case []interface{}:
+		var vals []string
+		for _, e := range v {
+			vals = append(vals, claimValues(e)...)
+		}
+		return vals
+	}
+	return nil
+}
+
+// Determine whether, for every claim of the rule, the token has one of its
+// values.
+func claimsMatch(claims map[string]interface{}, want map[string][]string) bool {
+	for name, vals := range want {
+		found := false
+		for _, v := range claimValues(claims[name]) {
+			if strs.Contains(vals, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verify(key crypto.PublicKey, alg string, hash crypto.Hash, digest, sig []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			break
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			break
+		}
+
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	}
+	return errors.New("invalid jwt signature")
+}
+
+// Find the key with the given id, fetching the JWKS when the keys are stale
+// or the key is unknown. The JWKS is fetched at most once every
+// jwksMinRefresh.
+func (j *JWTAuth) key(kid string, now time.Time) (crypto.PublicKey, error) {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	key, ok := j.keys[kid]
+	if (ok && now.Sub(j.fetched) < jwksTTL) || now.Sub(j.attempted) < jwksMinRefresh {
+		if !ok {
+			return nil, fmt.Errorf("unknown jwt key: %q", kid)
+		}
+		return key, nil
+	}
+
+	j.attempted = now
+	keys, err := j.fetchKeys()
+	if err != nil {
+		// keep using the keys we have until the JWKS can be fetched.
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	j.keys = keys
+	j.fetched = now
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown jwt key: %q", kid)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *JWTAuth) fetchKeys() (map[string]crypto.PublicKey, error) {
+	res, err := j.client.Get(j.cfg.JwksUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", j.cfg.JwksUrl, res.Status)
+	}
+
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// keys of other types are skipped rather than failing the set.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %q", k.Crv)
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("jwk point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %q", k.Kty)
+}
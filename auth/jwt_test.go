@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, key crypto.Signer, alg, kid string, claims map[string]interface{}) string {
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b64(hdr) + "." + b64(body)
+	h := jwtHashes[alg].New()
+	h.Write([]byte(msg))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, jwtHashes[alg], digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+
+	return msg + "." + b64(sig)
+}
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa",
+					"n":   b64(rsaKey.N.Bytes()),
+					"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec",
+					"crv": "P-256",
+					"x":   b64(ecKey.X.Bytes()),
+					"y":   b64(ecKey.Y.Bytes()),
+				},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	j, err := NewJWTAuth(&config.JWTAuthConfig{
+		JwksUrl:  srv.URL,
+		Issuer:   "https://ci.example.com",
+		Audience: "hound",
+		Rules: []*config.JWTAuthRule{
+			{
+				Claims: map[string][]string{"repository_owner": {"acme"}},
+				Repos:  []string{"acme-*"},
+			},
+			{
+				Claims: map[string][]string{"repository_owner": {"acme"}, "ref": {"refs/heads/main"}},
+				Role:   "updater",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"sub":              "ci-job",
+		"iss":              "https://ci.example.com",
+		"aud":              []string{"hound"},
+		"exp":              now.Add(time.Hour).Unix(),
+		"repository_owner": "acme",
+		"ref":              "refs/heads/feature",
+	}
+
+	tok, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "rsa", claims), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Name != "ci-job" || tok.Role != RoleReader || !tok.CanAccess("acme-api") || tok.CanAccess("other") {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	claims["ref"] = "refs/heads/main"
+	tok, err = j.Authenticate(signJWT(t, ecKey, "ES256", "ec", claims), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Role != RoleUpdater || !tok.CanAccess("other") {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	if fetches != 1 {
+		t.Fatalf("expected the JWKS to be fetched once, got %d", fetches)
+	}
+
+	if _, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "ec", claims), now); err == nil {
+		t.Fatal("expected a token signed with the wrong key to be rejected")
+	}
+
+	claims["iss"] = "https://evil.example.com"
+	if _, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "rsa", claims), now); err == nil {
+		t.Fatal("expected a token from another issuer to be rejected")
+	}
+
+	claims["iss"] = "https://ci.example.com"
+	claims["repository_owner"] = "other"
+	if _, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "rsa", claims), now); err == nil {
+		t.Fatal("expected a token that matches no rule to be rejected")
+	}
+
+	if _, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "unknown", claims), now); err == nil {
+		t.Fatal("expected a token signed with an unknown key to be rejected")
+	}
+
+	if fetches != 1 {
+		t.Fatalf("expected unknown keys not to refetch the JWKS straight away, got %d fetches", fetches)
+	}
+
+	claims["repository_owner"] = "acme"
+	if _, err := j.Authenticate(signJWT(t, rsaKey, "RS256", "rsa", claims), now.Add(2*time.Hour)); err == nil {
+		t.Fatal("expected an expired token to be rejected")
+	}
+}
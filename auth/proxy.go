@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/strs"
+)
+
+const (
+	defaultUserHeader   = "X-Forwarded-User"
+	defaultGroupsHeader = "X-Auth-Request-Groups"
+)
+
+// The order of roles from least to most privileged.
+var roleRank = map[Role]int{
+	RoleReader:  1,
+	RoleUpdater: 2,
+	RoleAdmin:   3,
+}
+
+// Identifies users from the headers set by an authenticating reverse proxy,
+// such as oauth2-proxy. The headers are only trusted on requests that come
+// from one of the trusted proxies.
+type ProxyAuth struct {
+	userHeader   string
+	groupsHeader string
+	trusted      networks
+	rules        []*config.ProxyAuthRule
+}
+
+func NewProxyAuth(cfg *config.ProxyAuthConfig) (*ProxyAuth, error) {
+	if len(cfg.TrustedProxies) == 0 {
+		return nil, errors.New("proxy-auth requires trusted-proxies")
+	}
+
+	p := &ProxyAuth{
+		userHeader:   cfg.UserHeader,
+		groupsHeader: cfg.GroupsHeader,
+		rules:        cfg.Rules,
+	}
+
+	if p.userHeader == "" {
+		p.userHeader = defaultUserHeader
+	}
+
+	if p.groupsHeader == "" {
+		p.groupsHeader = defaultGroupsHeader
+	}
+
+	trusted, err := parseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("proxy-auth: %s", err)
+	}
+	p.trusted = trusted
+
+	roles := make([]string, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		roles = append(roles, rule.Role)
+	}
+
+	if err := checkRuleRoles(roles); err != nil {
+		return nil, fmt.Errorf("proxy-auth: %s", err)
+	}
+
+	return p, nil
+}
+
+func (p *ProxyAuth) matches(rule *config.ProxyAuthRule, user string, groups []string) bool {
+	if strs.Contains(rule.Users, user) {
+		return true
+	}
+
+	for _, g := range groups {
+		if strs.Contains(rule.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return a token for the user named in the headers of the request. The
+// token has the most privileged role and every repo granted by the rules
+// that match the user or their groups. It is bound to the tenant of the
+// first matching rule, and rules of other tenants are ignored. Returns nil
+// if the request has no user, doesn't come from a trusted proxy or no rule
+// matches.
+func (p *ProxyAuth) Identify(r *http.Request) *Token {
+	user := strings.TrimSpace(r.Header.Get(p.userHeader))
+	if user == "" || !p.trusted.contains(r.RemoteAddr) {
+		return nil
+	}
+
+	var groups []string
+	for _, g := range strings.Split(r.Header.Get(p.groupsHeader), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	var t *Token
+	for _, rule := range p.rules {
+		if !p.matches(rule, user, groups) {
+			continue
+		}
+
+		if t == nil {
+			t = newGrantedToken(user, rule.Tenant)
+		} else if rule.Tenant != t.Tenant {
+			continue
+		}
+		t.grant(rule.Role, rule.Repos)
+	}
+
+	return t
+}
+
+// A token for an identity that is granted roles and repos by rules, it
+// starts with the reader role and no repos.
+func newGrantedToken(name, tenant string) *Token {
+	return &Token{Name: name, Role: RoleReader, Repos: []string{}, Tenant: tenant}
+}
+
+// Add the role and repos granted by a rule to the token. The token keeps
+// the most privileged role and a rule without repos grants every repo.
+func (t *Token) grant(role string, repos []string) {
+	if r := Role(role); roleRank[r] > roleRank[t.Role] {
+		t.Role = r
+	}
+
+	if len(repos) == 0 || t.Repos == nil {
+		t.Repos = nil
+	} else {
+		t.Repos = append(t.Repos, repos...)
+	}
+}
+
+// Check the role of each rule, an empty role is a reader.
+func checkRuleRoles(roles []string) error {
+	for _, role := range roles {
+		if role == "" {
+			continue
+		}
+
+		if _, err := ParseRole(role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestProxyAuth(t *testing.T) {
+	if _, err := NewProxyAuth(&config.ProxyAuthConfig{}); err == nil {
+		t.Fatal("expected an error without trusted-proxies")
+	}
+
+	p, err := NewProxyAuth(&config.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"},
+		Rules: []*config.ProxyAuthRule{
+			{Groups: []string{"eng"}, Repos: []string{"eng-*"}},
+			{Users: []string{"alice"}, Repos: []string{"secret"}, Role: "updater"},
+			{Users: []string{"root"}, Role: "admin"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/repos", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	r.Header.Set("X-Forwarded-User", "alice")
+	r.Header.Set("X-Auth-Request-Groups", "ops, eng")
+
+	tok := p.Identify(r)
+	if tok == nil {
+		t.Fatal("expected alice to be identified")
+	}
+
+	if tok.Name != "alice" || tok.Role != RoleUpdater {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	for repo, want := range map[string]bool{"eng-api": true, "secret": true, "other": false} {
+		if got := tok.CanAccess(repo); got != want {
+			t.Errorf("CanAccess(%s) = %v, want %v", repo, got, want)
+		}
+	}
+
+	r.Header.Set("X-Forwarded-User", "root")
+	r.Header.Del("X-Auth-Request-Groups")
+	if tok := p.Identify(r); tok == nil || tok.Role != RoleAdmin || !tok.CanAccess("other") {
+		t.Fatalf("expected root to be an admin of every repo, got %+v", tok)
+	}
+
+	r.Header.Set("X-Forwarded-User", "bob")
+	if tok := p.Identify(r); tok != nil {
+		t.Fatal("expected a user without a rule not to be identified")
+	}
+
+	r.Header.Set("X-Forwarded-User", "alice")
+	r.RemoteAddr = "192.168.0.1:4567"
+	if tok := p.Identify(r); tok != nil {
+		t.Fatal("expected headers from an untrusted address to be ignored")
+	}
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The windows search quotas are counted in, an hour and a day.
+var quotaWindows = []time.Duration{time.Hour, 24 * time.Hour}
+
+// The searches made in a window and the files they opened.
+type searchWindow struct {
+	start    time.Time
+	searches int64
+	files    int64
+}
+
+// The state of a search quota, as reported in the headers of search
+// responses.
+type QuotaState struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Time
+}
+
+// Counts the searches of access keys, users and tenants, and the files
+// they open, in windows of an hour and a day, refusing searches beyond
+// their quotas. The files a search opens are only known once it is done,
+// so a search may go beyond the quota of files, but the next one is
+// refused.
+type SearchQuotas struct {
+	lck     sync.Mutex
+	keys    *config.SearchQuotasConfig
+	tenants map[string]*config.TenantConfig
+
+	// the windows of each key, user and tenant, by the names of quotas.
+	used map[string][]*searchWindow
+}
+
+func NewSearchQuotas(keys *config.SearchQuotasConfig, tenants map[string]*config.TenantConfig) *SearchQuotas {
+	return &SearchQuotas{
+		keys:    keys,
+		tenants: tenants,
+		used:    map[string][]*searchWindow{},
+	}
+}
+
+// The quotas that apply to the token, by the names their usage is kept
+// under. Keys and users of different tenants may have the same name, so
+// theirs are qualified by the tenant.
+func (q *SearchQuotas) quotas(t *Token) map[string]*config.SearchQuota {
+	res := map[string]*config.SearchQuota{}
+	if k := q.keys; k != nil && !t.HasScope(ScopeAdmin) {
+		quota, ok := k.Keys[t.Name]
+		if !ok {
+			quota = k.Default
+		}
+
+		if quota != nil {
+			res["key:"+t.Tenant+"/"+t.Name] = quota
+		}
+	}
+
+	if tc := q.tenants[t.Tenant]; t.Tenant != "" && tc != nil {
+		res["tenant:"+t.Tenant] = &tc.SearchQuota
+	}
+	return res
+}
+
+// The windows of the named quota that now falls in, starting new ones
+// for those that are over.
+func (q *SearchQuotas) windows(name string, now time.Time) []*searchWindow {
+	ws, ok := q.used[name]
+	if !ok {
+		ws = make([]*searchWindow, len(quotaWindows))
+		q.used[name] = ws
+	}
+
+	for i, d := range quotaWindows {
+		start := now.Truncate(d)
+		if ws[i] == nil || !ws[i].start.Equal(start) {
+			ws[i] = &searchWindow{start: start}
+		}
+	}
+	return ws
+}
+
+// The state of each limit of the quota in the windows.
+func quotaStates(quota *config.SearchQuota, ws []*searchWindow) []*QuotaState {
+	limits := [][2]int64{
+		{quota.SearchesPerHour, quota.FilesOpenedPerHour},
+		{quota.SearchesPerDay, quota.FilesOpenedPerDay},
+	}
+
+	var res []*QuotaState
+	for i, w := range ws {
+		reset := w.start.Add(quotaWindows[i])
+		for j, used := range []int64{w.searches, w.files} {
+			limit := limits[i][j]
+			if limit <= 0 {
+				continue
+			}
+
+			remaining := limit - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			res = append(res, &QuotaState{Limit: limit, Remaining: remaining, Reset: reset})
+		}
+	}
+	return res
+}
+
+// Count a search by the token against its quotas, returning the state of
+// the quota closest to being used up, nil if it has none. If a quota is
+// used up, the search is refused and the state is that of the used up
+// quota that resets last.
+func (q *SearchQuotas) Charge(t *Token, now time.Time) (*QuotaState, bool) {
+	if t == nil {
+		return nil, true
+	}
+
+	quotas := q.quotas(t)
+	if len(quotas) == 0 {
+		return nil, true
+	}
+
+	q.lck.Lock()
+	defer q.lck.Unlock()
+
+	var exceeded *QuotaState
+	for name, quota := range quotas {
+		for _, s := range quotaStates(quota, q.windows(name, now)) {
+			if s.Remaining == 0 && (exceeded == nil || s.Reset.After(exceeded.Reset)) {
+				exceeded = s
+			}
+		}
+	}
+
+	if exceeded != nil {
+		return exceeded, false
+	}
+
+	var tightest *QuotaState
+	for name, quota := range quotas {
+		ws := q.windows(name, now)
+		for _, w := range ws {
+			w.searches++
+		}
+
+		for _, s := range quotaStates(quota, ws) {
+			if tightest == nil || s.Remaining < tightest.Remaining {
+				tightest = s
+			}
+		}
+	}
+	return tightest, true
+}
+
+// Count the files opened by a search of the token against its quotas.
+func (q *SearchQuotas) AddFilesOpened(t *Token, n int, now time.Time) {
+	if t == nil || n == 0 {
+		return
+	}
+
+	quotas := q.quotas(t)
+
+	q.lck.Lock()
+	defer q.lck.Unlock()
+
+	for name := range quotas {
+		for _, w := range q.windows(name, now) {
+			w.files += int64(n)
+		}
+	}
+}
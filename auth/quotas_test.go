@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestSearchQuotas(t *testing.T) {
+	q := NewSearchQuotas(&config.SearchQuotasConfig{
+		Default: &config.SearchQuota{SearchesPerHour: 2},
+		Keys: map[string]*config.SearchQuota{
+			"ci": {FilesOpenedPerDay: 100},
+		},
+	}, map[string]*config.TenantConfig{
+		"acme": {SearchQuota: config.SearchQuota{SearchesPerDay: 3}},
+	})
+
+	now := time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC)
+	alice := &Token{Name: "alice"}
+	for i := 0; i < 2; i++ {
+		s, ok := q.Charge(alice, now)
+		if !ok || s.Limit != 2 || s.Remaining != int64(1-i) {
+			t.Fatalf("search %d: unexpected state %+v, %v", i, s, ok)
+		}
+	}
+
+	s, ok := q.Charge(alice, now)
+	if ok || s.Remaining != 0 || !s.Reset.Equal(now.Truncate(time.Hour).Add(time.Hour)) {
+		t.Fatalf("expected the third search of the hour to be refused, got %+v, %v", s, ok)
+	}
+
+	if _, ok := q.Charge(alice, now.Add(time.Hour)); !ok {
+		t.Fatal("expected searches to be allowed in the next hour")
+	}
+
+	// files are counted once the search is done, so the search that goes
+	// beyond the quota is allowed but the next one isn't.
+	ci := &Token{Name: "ci"}
+	if _, ok := q.Charge(ci, now); !ok {
+		t.Fatal("expected ci to search")
+	}
+	q.AddFilesOpened(ci, 150, now)
+	if s, ok := q.Charge(ci, now.Add(time.Hour)); ok || !s.Reset.Equal(now.Truncate(24*time.Hour).Add(24*time.Hour)) {
+		t.Fatalf("expected ci to have used up its files for the day, got %+v, %v", s, ok)
+	}
+
+	// the keys of a tenant share its quota.
+	bob := &Token{Name: "bob", Tenant: "acme"}
+	carol := &Token{Name: "carol", Tenant: "acme"}
+	for _, tok := range []*Token{bob, carol, carol} {
+		if _, ok := q.Charge(tok, now.Add(2*time.Hour)); !ok {
+			t.Fatalf("expected %s to search", tok.Name)
+		}
+	}
+
+	if _, ok := q.Charge(bob, now.Add(3*time.Hour)); ok {
+		t.Fatal("expected the tenant to have used up its searches for the day")
+	}
+
+	if s, ok := q.Charge(&Token{Name: "root", Role: RoleAdmin}, now); !ok || s != nil {
+		t.Fatal("expected admins to have no quota")
+	}
+
+	if s, ok := q.Charge(nil, now); !ok || s != nil {
+		t.Fatal("expected requests without a key to have no quota")
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The requests a tenant made in the current window of a quota.
+type usage struct {
+	start time.Time
+	count int
+}
+
+// The usage of a tenant, the searches of the current minute and the
+// updates of the current hour.
+type TenantUsage struct {
+	Searches int
+	Updates  int
+}
+
+// Counts the searches and updates of each tenant, refusing those beyond
+// the tenant's quotas. Searches are counted in windows of a minute and
+// updates in windows of an hour.
+type Quotas struct {
+	lck     sync.Mutex
+	tenants map[string]*config.TenantConfig
+	used    map[string]map[Scope]*usage
+}
+
+func NewQuotas(tenants map[string]*config.TenantConfig) *Quotas {
+	return &Quotas{
+		tenants: tenants,
+		used:    map[string]map[Scope]*usage{},
+	}
+}
+
+// The limit and window of the quota of the tenant for the scope, a limit of
+// zero is no limit.
+func (q *Quotas) quota(tenant string, scope Scope) (int, time.Duration) {
+	t := q.tenants[tenant]
+	if t == nil {
+		return 0, 0
+	}
+
+	switch scope {
+	case ScopeSearch:
+		return t.MaxSearchesPerMinute, time.Minute
+	case ScopeUpdate:
+		return t.MaxUpdatesPerHour, time.Hour
+	}
+	return 0, 0
+}
+
+// The usage of the scope by the tenant in the window that now falls in.
+func (q *Quotas) current(tenant string, scope Scope, window time.Duration, now time.Time) *usage {
+	byScope, ok := q.used[tenant]
+	if !ok {
+		byScope = map[Scope]*usage{}
+		q.used[tenant] = byScope
+	}
+
+	start := now.Truncate(window)
+	u, ok := byScope[scope]
+	if !ok || !u.start.Equal(start) {
+		u = &usage{start: start}
+		byScope[scope] = u
+	}
+	return u
+}
+
+// Count a request of the tenant that needs the scope, returning false if
+// the tenant has used up its quota. Requests outside of a tenant and those
+// with no quota are always allowed.
+func (q *Quotas) Allow(tenant string, scope Scope, now time.Time) bool {
+	limit, window := q.quota(tenant, scope)
+	if tenant == "" || limit == 0 {
+		return true
+	}
+
+	q.lck.Lock()
+	defer q.lck.Unlock()
+
+	u := q.current(tenant, scope, window, now)
+	if u.count >= limit {
+		return false
+	}
+	u.count++
+	return true
+}
+
+// The usage of the tenant at the given time.
+func (q *Quotas) Usage(tenant string, now time.Time) *TenantUsage {
+	q.lck.Lock()
+	defer q.lck.Unlock()
+
+	return &TenantUsage{
+		Searches: q.current(tenant, ScopeSearch, time.Minute, now).count,
+		Updates:  q.current(tenant, ScopeUpdate, time.Hour, now).count,
+	}
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestQuotas(t *testing.T) {
+	q := NewQuotas(map[string]*config.TenantConfig{
+		"acme":  {MaxSearchesPerMinute: 2, MaxUpdatesPerHour: 1},
+		"other": {},
+	})
+
+	now := time.Date(2020, 1, 1, 12, 0, 10, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if !q.Allow("acme", ScopeSearch, now) {
+			t.Fatalf("expected search %d to be allowed", i)
+		}
+	}
+
+	if q.Allow("acme", ScopeSearch, now) {
+		t.Fatal("expected the third search of the minute to be refused")
+	}
+
+	if u := q.Usage("acme", now); u.Searches != 2 || u.Updates != 0 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+
+	if !q.Allow("acme", ScopeSearch, now.Add(time.Minute)) {
+		t.Fatal("expected searches to be allowed in the next minute")
+	}
+
+	if !q.Allow("acme", ScopeUpdate, now) || q.Allow("acme", ScopeUpdate, now.Add(30*time.Minute)) {
+		t.Fatal("expected one update an hour")
+	}
+
+	for i := 0; i < 10; i++ {
+		if !q.Allow("other", ScopeSearch, now) || !q.Allow("", ScopeUpdate, now) {
+			t.Fatal("expected requests without a quota to be allowed")
+		}
+	}
+}
+
+func TestTenantTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenTokenStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Create("boss", RoleAdmin, nil, nil, "acme"); err == nil {
+		t.Fatal("expected an admin token bound to a tenant to be refused")
+	}
+
+	_, tok, err := s.Create("ci", "", []Scope{ScopeSearch, ScopeUpdate}, nil, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Tenant != "acme" || !tok.HasScope(ScopeUpdate) {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	// a tenant's token never has the admin scope, whatever its role.
+	if (&Token{Role: RoleAdmin, Tenant: "acme"}).HasScope(ScopeAdmin) {
+		t.Fatal("expected a tenant's token not to be an admin")
+	}
+
+	p, err := NewProxyAuth(&config.ProxyAuthConfig{
+		TrustedProxies: []string{"127.0.0.1"},
+		Rules: []*config.ProxyAuthRule{
+			{Groups: []string{"acme"}, Role: "updater", Tenant: "acme"},
+			{Groups: []string{"globex"}, Repos: []string{"globex-*"}, Tenant: "globex"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/repos", nil)
+	r.RemoteAddr = "127.0.0.1:4567"
+	r.Header.Set("X-Forwarded-User", "alice")
+	r.Header.Set("X-Auth-Request-Groups", "acme,globex")
+
+	// the rules of the other tenant are ignored.
+	if tok := p.Identify(r); tok == nil || tok.Tenant != "acme" || tok.Role != RoleUpdater || tok.Repos != nil {
+		t.Fatalf("expected alice to be bound to acme, got %+v", tok)
+	}
+}
@@ -0,0 +1,315 @@
+// Package auth manages the access keys used to authorize API requests.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// What a key is allowed to do. The admin scope implies every other scope.
+type Scope string
+
+const (
+	ScopeSearch Scope = "search"
+	ScopeUpdate Scope = "update"
+	ScopeAdmin  Scope = "admin"
+
+	// Prepended to generated keys so they are easy to recognize.
+	keyPrefix = "hound_"
+	keyBytes  = 32
+)
+
+// A named set of scopes that can be given to a token instead of listing
+// the scopes.
+type Role string
+
+const (
+	RoleReader  Role = "reader"
+	RoleUpdater Role = "updater"
+	RoleAdmin   Role = "admin"
+)
+
+var roleScopes = map[Role][]Scope{
+	RoleReader:  {ScopeSearch},
+	RoleUpdater: {ScopeSearch, ScopeUpdate},
+	RoleAdmin:   {ScopeAdmin},
+}
+
+var validName = regexp.MustCompile(`^[\w.-]+$`)
+
+// Parse a role name, returning an error for unknown roles.
+func ParseRole(s string) (Role, error) {
+	if _, ok := roleScopes[Role(s)]; !ok {
+		return "", fmt.Errorf("unknown role: %q", s)
+	}
+	return Role(s), nil
+}
+
+// Parse a scope name, returning an error for unknown scopes.
+func ParseScope(s string) (Scope, error) {
+	switch sc := Scope(s); sc {
+	case ScopeSearch, ScopeUpdate, ScopeAdmin:
+		return sc, nil
+	}
+	return "", fmt.Errorf("unknown scope: %q", s)
+}
+
+// A named access key. The key itself is never kept, only its hash. A token
+// is granted the scopes of its role in addition to its own scopes.
+type Token struct {
+	Name    string
+	Role    Role       `json:",omitempty"`
+	Scopes  []Scope    `json:",omitempty"`
+	Expires *time.Time `json:",omitempty"`
+	Created time.Time
+
+	// Globs of the names of the repos the token may access, nil means
+	// every repo.
+	Repos []string `json:",omitempty"`
+
+	// The tenant the token is bound to, it only accesses the repos of the
+	// tenant and never has the admin scope.
+	Tenant string `json:",omitempty"`
+
+	hash string
+}
+
+// Determine whether the token grants the scope.
+func (t *Token) HasScope(scope Scope) bool {
+	if scope == ScopeAdmin && t.Tenant != "" {
+		return false
+	}
+
+	for _, scopes := range [][]Scope{t.Scopes, roleScopes[t.Role]} {
+		for _, s := range scopes {
+			if s == scope || s == ScopeAdmin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsScope(scopes []Scope, scope Scope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Determine whether the token may access the named repo.
+func (t *Token) CanAccess(repo string) bool {
+	if t.Repos == nil {
+		return true
+	}
+
+	for _, pat := range t.Repos {
+		if ok, _ := path.Match(pat, repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Determine whether the token has expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return t.Expires != nil && !now.Before(*t.Expires)
+}
+
+// The format of the file the tokens are kept in.
+type storedToken struct {
+	*Token
+	Hash string
+}
+
+func hashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// The set of tokens, persisted to a file as they change.
+type TokenStore struct {
+	path   string
+	byName map[string]*Token
+	byHash map[string]*Token
+	lck    sync.RWMutex
+}
+
+// Open the tokens kept in the file at path, a missing file holds no tokens.
+func OpenTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{
+		path:   path,
+		byName: map[string]*Token{},
+		byHash: map[string]*Token{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stored []*storedToken
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	for _, st := range stored {
+		st.Token.hash = st.Hash
+		s.byName[st.Name] = st.Token
+		s.byHash[st.Hash] = st.Token
+	}
+
+	return s, nil
+}
+
+// Write the tokens to a temporary file that is renamed into place, so the
+// file is never left partially written.
+func (s *TokenStore) save() error {
+	stored := make([]*storedToken, 0, len(s.byName))
+	for _, t := range s.byName {
+		stored = append(stored, &storedToken{Token: t, Hash: t.hash})
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].Name < stored[j].Name
+	})
+
+	b, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".tokens-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Create a token with the given role and scopes that expires at the given
+// time, or never if expires is nil, bound to the tenant unless it is empty.
+// The generated key is returned and can't be recovered later.
+func (s *TokenStore) Create(name string, role Role, scopes []Scope, expires *time.Time, tenant string) (string, *Token, error) {
+	if !validName.MatchString(name) {
+		return "", nil, fmt.Errorf("invalid token name: %q", name)
+	}
+
+	if role == "" && len(scopes) == 0 {
+		return "", nil, errors.New("a token needs a role or at least one scope")
+	}
+
+	if tenant != "" && (role == RoleAdmin || containsScope(scopes, ScopeAdmin)) {
+		return "", nil, errors.New("a token bound to a tenant can't be an admin")
+	}
+
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	key := keyPrefix + hex.EncodeToString(b)
+
+	t := &Token{
+		Name:    name,
+		Role:    role,
+		Scopes:  scopes,
+		Expires: expires,
+		Created: time.Now().UTC(),
+		Tenant:  tenant,
+		hash:    hashKey(key),
+	}
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	if _, ok := s.byName[name]; ok {
+		return "", nil, fmt.Errorf("token %s already exists", name)
+	}
+
+	s.byName[name] = t
+	s.byHash[t.hash] = t
+	if err := s.save(); err != nil {
+		delete(s.byName, name)
+		delete(s.byHash, t.hash)
+		return "", nil, err
+	}
+
+	return key, t, nil
+}
+
+// Delete the named token. Returns false if there is no such token.
+func (s *TokenStore) Delete(name string) (bool, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	t, ok := s.byName[name]
+	if !ok {
+		return false, nil
+	}
+
+	delete(s.byName, name)
+	delete(s.byHash, t.hash)
+	if err := s.save(); err != nil {
+		s.byName[name] = t
+		s.byHash[t.hash] = t
+		return false, err
+	}
+
+	return true, nil
+}
+
+// All of the tokens, ordered by name.
+func (s *TokenStore) List() []*Token {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	tokens := make([]*Token, 0, len(s.byName))
+	for _, t := range s.byName {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+	return tokens
+}
+
+// Find the unexpired token for the key, nil if there is none.
+func (s *TokenStore) Authenticate(key string, now time.Time) *Token {
+	if key == "" {
+		return nil
+	}
+
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	t := s.byHash[hashKey(key)]
+	if t == nil || t.Expired(now) {
+		return nil
+	}
+	return t
+}
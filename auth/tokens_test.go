@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tokens.json")
+	s, err := OpenTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	key, tok, err := s.Create("ci", "", []Scope{ScopeSearch}, &expires, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, keyPrefix) {
+		t.Fatalf("unexpected key: %s", key)
+	}
+
+	if _, _, err := s.Create("ci", "", []Scope{ScopeSearch}, nil, ""); err == nil {
+		t.Fatal("expected an error for a duplicate name")
+	}
+
+	if got := s.Authenticate(key, now); got != tok {
+		t.Fatalf("expected the key to authenticate, got %v", got)
+	}
+
+	if got := s.Authenticate(key, expires); got != nil {
+		t.Fatal("expected an expired key to be rejected")
+	}
+
+	if got := s.Authenticate("hound_wrong", now); got != nil {
+		t.Fatal("expected an unknown key to be rejected")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), key) {
+		t.Fatal("expected the key itself not to be stored")
+	}
+
+	// the token must survive a reopen.
+	s, err = OpenTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Authenticate(key, now); got == nil || got.Name != "ci" {
+		t.Fatalf("expected the key to authenticate after reopening, got %v", got)
+	}
+
+	if ok, err := s.Delete("ci"); !ok || err != nil {
+		t.Fatalf("expected the token to be deleted, got %v, %v", ok, err)
+	}
+
+	if got := s.Authenticate(key, now); got != nil {
+		t.Fatal("expected a deleted key to be rejected")
+	}
+
+	if len(s.List()) != 0 {
+		t.Fatalf("expected no tokens, got %v", s.List())
+	}
+}
+
+func TestScopes(t *testing.T) {
+	admin := &Token{Scopes: []Scope{ScopeAdmin}}
+	if !admin.HasScope(ScopeSearch) || !admin.HasScope(ScopeUpdate) {
+		t.Fatal("expected admin to imply every scope")
+	}
+
+	search := &Token{Scopes: []Scope{ScopeSearch}}
+	if search.HasScope(ScopeUpdate) || search.HasScope(ScopeAdmin) {
+		t.Fatal("expected search to grant only search")
+	}
+
+	if _, err := ParseScope("root"); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	reader := &Token{Role: RoleReader}
+	if !reader.HasScope(ScopeSearch) || reader.HasScope(ScopeUpdate) || reader.HasScope(ScopeAdmin) {
+		t.Fatal("expected a reader to only search")
+	}
+
+	updater := &Token{Role: RoleUpdater}
+	if !updater.HasScope(ScopeSearch) || !updater.HasScope(ScopeUpdate) || updater.HasScope(ScopeAdmin) {
+		t.Fatal("expected an updater to search and update")
+	}
+
+	admin := &Token{Role: RoleAdmin}
+	if !admin.HasScope(ScopeUpdate) || !admin.HasScope(ScopeAdmin) {
+		t.Fatal("expected an admin to do everything")
+	}
+
+	// scopes add to those of the role.
+	extra := &Token{Role: RoleReader, Scopes: []Scope{ScopeUpdate}}
+	if !extra.HasScope(ScopeUpdate) {
+		t.Fatal("expected scopes to add to the role")
+	}
+
+	if _, err := ParseRole("owner"); err == nil {
+		t.Fatal("expected an error for an unknown role")
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -18,6 +19,106 @@ type Response struct {
 		FilesOpened int
 		Duration    int
 	} `json:",omitempty"`
+
+	// Set when maxMatches cut the results short.
+	Truncated bool `json:",omitempty"`
+
+	// The reason the search failed, which the API reports with an ok
+	// status.
+	Error string `json:",omitempty"`
+}
+
+// The options of a search, which are passed on as the parameters of
+// /api/v1/search.
+type SearchOptions struct {
+	Repos        string
+	Tags         string
+	Files        string
+	ExcludeFiles string
+	Context      int
+	IgnoreCase   bool
+	Literal      bool
+	WholeWord    bool
+	Stats        bool
+
+	// A branch, tag or commit from the indexed history of the repos, the
+	// indexed head when empty.
+	Rev string
+
+	// The most matching lines to return in all, 0 for no limit.
+	MaxMatches int
+
+	// "block" for the function or block around each match as its context
+	// rather than Context lines.
+	ContextMode string
+
+	// Ask for the tokens of the lines of the matches, to highlight them.
+	Highlight bool
+
+	// The longest line to return, in bytes, 0 for the limit of the server.
+	// Longer lines are cut down around their match.
+	MaxLineLength int
+
+	// Comma separated globs such as *.go, the file paths must match any of
+	// Paths and none of ExcludePaths.
+	Paths        string
+	ExcludePaths string
+}
+
+func (o *SearchOptions) values(pattern string) url.Values {
+	v := url.Values{
+		"q":     {pattern},
+		"repos": {o.Repos},
+		"files": {o.Files},
+		"ctx":   {fmt.Sprintf("%d", o.Context)},
+		"i":     {fmt.Sprintf("%t", o.IgnoreCase)},
+		"stats": {fmt.Sprintf("%t", o.Stats)},
+	}
+
+	if o.Tags != "" {
+		v.Set("tags", o.Tags)
+	}
+
+	if o.ExcludeFiles != "" {
+		v.Set("excludeFiles", o.ExcludeFiles)
+	}
+
+	if o.Paths != "" {
+		v.Set("paths", o.Paths)
+	}
+
+	if o.ExcludePaths != "" {
+		v.Set("excludePaths", o.ExcludePaths)
+	}
+
+	if o.Literal {
+		v.Set("literal", "true")
+	}
+
+	if o.WholeWord {
+		v.Set("w", "true")
+	}
+
+	if o.Rev != "" {
+		v.Set("rev", o.Rev)
+	}
+
+	if o.MaxMatches > 0 {
+		v.Set("maxMatches", fmt.Sprintf("%d", o.MaxMatches))
+	}
+
+	if o.Highlight {
+		v.Set("highlight", "true")
+	}
+
+	if o.ContextMode != "" {
+		v.Set("ctxMode", o.ContextMode)
+	}
+
+	if o.MaxLineLength > 0 {
+		v.Set("maxLineLength", fmt.Sprintf("%d", o.MaxLineLength))
+	}
+	return v
 }
 
 type Presenter interface {
@@ -31,6 +132,21 @@ type Presenter interface {
 type Config struct {
 	HttpHeaders map[string]string `json:"http-headers"`
 	Host        string            `json:"host"`
+
+	// Sent as a bearer token to servers that require access keys.
+	AccessKey string `json:"access-key"`
+
+	// The directories of local checkouts of repos, by repo name, which the
+	// TUI opens files in with $EDITOR.
+	Checkouts map[string]string `json:"checkouts"`
+}
+
+// The url of the server, the host may be given with or without a scheme.
+func (c *Config) baseUrl() string {
+	if strings.Contains(c.Host, "://") {
+		return strings.TrimSuffix(c.Host, "/")
+	}
+	return "http://" + c.Host
 }
 
 // Extract a repo name from the given url.
@@ -69,10 +185,10 @@ func repoNameFor(repos map[string]*config.Repo, repo string) string {
 	return name
 }
 
-func doHttpGet(cfg *Config, uri string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", uri, nil)
-	if err != nil {
-		return nil, err
+// Send the request with the access key and the http headers of the config.
+func doHttp(cfg *Config, req *http.Request) (*http.Response, error) {
+	if cfg.AccessKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AccessKey)
 	}
 
 	for key, val := range cfg.HttpHeaders {
@@ -87,18 +203,47 @@ func doHttpGet(cfg *Config, uri string) (*http.Response, error) {
 	return c.Do(req)
 }
 
+func doHttpGet(cfg *Config, uri string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doHttp(cfg, req)
+}
+
+// Read the error the API responded with, or the status when it didn't
+// give one, along with the id of the request to look it up in the logs.
+func errorOf(res *http.Response) error {
+	var e struct {
+		Error string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.Error != "" {
+		return withRequestId(errors.New(e.Error), res)
+	}
+	return withRequestId(fmt.Errorf("Status %d", res.StatusCode), res)
+}
+
+func withRequestId(err error, res *http.Response) error {
+	if id := res.Header.Get("X-Request-ID"); id != "" {
+		return fmt.Errorf("%s (request %s)", err, id)
+	}
+	return err
+}
+
 // Executes a search on the API running on host.
 func Search(r *Response, cfg *Config, pattern, repos, files string, context int, ignoreCase, stats bool) error {
-	u := fmt.Sprintf("http://%s/api/v1/search?%s",
-		cfg.Host,
-		url.Values{
-			"q":     {pattern},
-			"repos": {repos},
-			"files": {files},
-			"ctx":   {fmt.Sprintf("%d", context)},
-			"i":     {fmt.Sprintf("%t", ignoreCase)},
-			"stats": {fmt.Sprintf("%t", stats)},
-		}.Encode())
+	return SearchWith(r, cfg, pattern, &SearchOptions{
+		Repos:      repos,
+		Files:      files,
+		Context:    context,
+		IgnoreCase: ignoreCase,
+		Stats:      stats,
+	})
+}
+
+// Executes a search with the options on the API running on host.
+func SearchWith(r *Response, cfg *Config, pattern string, opt *SearchOptions) error {
+	u := fmt.Sprintf("%s/api/v1/search?%s", cfg.baseUrl(), opt.values(pattern).Encode())
 
 	res, err := doHttpGet(cfg, u)
 	if err != nil {
@@ -107,29 +252,81 @@ func Search(r *Response, cfg *Config, pattern, repos, files string, context int,
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("Status %d", res.StatusCode)
+		return errorOf(res)
 	}
 
-	return json.NewDecoder(res.Body).Decode(r)
+	if err := json.NewDecoder(res.Body).Decode(r); err != nil {
+		return err
+	}
+
+	if r.Error != "" {
+		return withRequestId(errors.New(r.Error), res)
+	}
+	return nil
 }
 
 // Load the list of repositories from the API running on host.
 func LoadRepos(repos map[string]*config.Repo, cfg *Config) error {
-	res, err := doHttpGet(cfg, fmt.Sprintf("http://%s/api/v1/repos", cfg.Host))
+	res, err := doHttpGet(cfg, fmt.Sprintf("%s/api/v1/repos", cfg.baseUrl()))
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return errorOf(res)
+	}
+
 	return json.NewDecoder(res.Body).Decode(&repos)
 }
 
+// The url of a line of a file on the site that hosts the repo, built from
+// the url-pattern of the repo by the API running on host.
+func LinkTo(cfg *Config, repo, path string, line int, rev string) (string, error) {
+	u := fmt.Sprintf("%s/api/v1/link?%s", cfg.baseUrl(), url.Values{
+		"repo": {repo},
+		"path": {path},
+		"line": {fmt.Sprintf("%d", line)},
+		"rev":  {rev},
+	}.Encode())
+
+	res, err := doHttpGet(cfg, u)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errorOf(res)
+	}
+
+	var l struct {
+		Url string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&l); err != nil {
+		return "", err
+	}
+	return l.Url, nil
+}
+
 // Execute a search and load the list of repositories in parallel on the host.
 func SearchAndLoadRepos(cfg *Config, pattern, repos, files string, context int, ignoreCase, stats bool) (*Response, map[string]*config.Repo, error) {
+	return SearchWithAndLoadRepos(cfg, pattern, &SearchOptions{
+		Repos:      repos,
+		Files:      files,
+		Context:    context,
+		IgnoreCase: ignoreCase,
+		Stats:      stats,
+	})
+}
+
+// Execute a search with the options and load the list of repositories in
+// parallel on the host.
+func SearchWithAndLoadRepos(cfg *Config, pattern string, opt *SearchOptions) (*Response, map[string]*config.Repo, error) {
 	chs := make(chan error)
 	var res Response
 	go func() {
-		chs <- Search(&res, cfg, pattern, repos, files, context, ignoreCase, stats)
+		chs <- SearchWith(&res, cfg, pattern, opt)
 	}()
 
 	chr := make(chan error)
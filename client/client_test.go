@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/hound-search/hound/index"
+)
+
+func TestSearchWith(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get("Authorization"); h != "Bearer k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"Error": "Unauthorized"}) //nolint
+			return
+		}
+
+		if r.FormValue("q") == "(" {
+			json.NewEncoder(w).Encode(map[string]string{"Error": "missing closing )"}) //nolint
+			return
+		}
+
+		for key, want := range map[string]string{"excludeFiles": "vendor/", "literal": "true", "w": "true", "rev": "main", "maxMatches": "5", "maxLineLength": "200", "ctxMode": "block", "highlight": "true", "paths": "*.go,*.proto", "excludePaths": "*_test.go"} {
+			if got := r.FormValue(key); got != want {
+				t.Errorf("expected %s=%s, got %q", key, want, got)
+			}
+		}
+
+		json.NewEncoder(w).Encode(&Response{ //nolint
+			Results: map[string]*index.SearchResponse{
+				"r": {Matches: []*index.FileMatch{{Filename: "a.go", Matches: []*index.Match{{Line: "TODO", LineNumber: 3}}}}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	cfg := &Config{Host: srv.URL, AccessKey: "k"}
+	opt := &SearchOptions{Repos: "*", ExcludeFiles: "vendor/", Literal: true, WholeWord: true, Rev: "main", MaxMatches: 5, MaxLineLength: 200, ContextMode: "block", Highlight: true, Paths: "*.go,*.proto", ExcludePaths: "*_test.go"}
+
+	var res Response
+	if err := SearchWith(&res, cfg, "TODO", opt); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Results["r"].Matches) != 1 {
+		t.Fatalf("expected a match, got %+v", res.Results)
+	}
+
+	if err := SearchWith(&res, cfg, "(", opt); err == nil || err.Error() != "missing closing )" {
+		t.Fatalf("expected the error of the API, got %v", err)
+	}
+
+	cfg.AccessKey = ""
+	if err := SearchWith(&res, cfg, "TODO", opt); err == nil || err.Error() != "Unauthorized" {
+		t.Fatalf("expected Unauthorized, got %v", err)
+	}
+}
+
+func TestGrepPresenter(t *testing.T) {
+	f, err := ioutil.TempFile("", "hound-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	res := &Response{
+		Results: map[string]*index.SearchResponse{
+			"b": {Matches: []*index.FileMatch{{Filename: "x.go", Matches: []*index.Match{
+				{Line: "foo", LineNumber: 2, Before: []string{"one"}, After: []string{"three"}},
+			}}}},
+			"a": {Matches: []*index.FileMatch{{Filename: "y.go", Matches: []*index.Match{
+				{Line: "a foo", LineNumber: 7, Before: []string{}, After: []string{}},
+			}}}},
+		},
+	}
+
+	if err := NewGrepPresenter(f).Present(regexp.MustCompile("foo"), 1, nil, res); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a:y.go:7:a foo\n--\nb-x.go-1-one\nb:x.go:2:foo\nb-x.go-3-three\n"
+	if string(b) != want {
+		t.Fatalf("expected %q, got %q", want, b)
+	}
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 
 	"github.com/hound-search/hound/ansi"
 	"github.com/hound-search/hound/config"
@@ -13,6 +15,20 @@ type grepPresenter struct {
 	f *os.File
 }
 
+// The names of the repos with results, sorted.
+func sortedRepos(res *Response) []string {
+	repos := make([]string, 0, len(res.Results))
+	for repo := range res.Results {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// Write each line as repo:path:line:text, like grep -n with the repo in
+// front, so the output can be parsed by tools that read grep output. As
+// with grep, context lines use - in place of : and groups of lines are
+// separated by --.
 func (p *grepPresenter) Present(
 	re *regexp.Regexp,
 	ctx int,
@@ -21,9 +37,36 @@ func (p *grepPresenter) Present(
 
 	c := ansi.NewFor(p.f)
 
-	if _, err := fmt.Fprintf(p.f, "%s\n",
-		c.Fg("// TODO(knorton): Implement", ansi.Yellow, ansi.Bold)); err != nil {
-		return err
+	var buf bytes.Buffer
+	first := true
+	for _, repo := range sortedRepos(res) {
+		for _, file := range res.Results[repo].Matches {
+			for _, block := range coalesceMatches(file.Matches) {
+				if ctx > 0 && !first {
+					buf.WriteString(c.Fg("--", ansi.Cyan, ansi.Normal) + "\n")
+				}
+				first = false
+
+				for i, line := range block.Lines {
+					sep := "-"
+					if block.Matches[i] {
+						sep = ":"
+						line = hiliteMatches(c, re, line)
+					}
+
+					fmt.Fprintf(&buf, "%s%s%s%s%s%s%s\n",
+						c.Fg(repo, ansi.Magenta, ansi.Normal), sep,
+						c.Fg(file.Filename, ansi.Magenta, ansi.Normal), sep,
+						c.Fg(fmt.Sprintf("%d", block.Start+i), ansi.Green, ansi.Normal), sep,
+						line)
+				}
+			}
+
+			if _, err := p.f.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
 	}
 
 	return nil
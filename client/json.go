@@ -0,0 +1,29 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+
+	"github.com/hound-search/hound/config"
+)
+
+type jsonPresenter struct {
+	f *os.File
+}
+
+// Write the response as the API returned it, for scripts.
+func (p *jsonPresenter) Present(
+	re *regexp.Regexp,
+	ctx int,
+	repos map[string]*config.Repo,
+	res *Response) error {
+
+	enc := json.NewEncoder(p.f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+func NewJsonPresenter(w *os.File) Presenter {
+	return &jsonPresenter{w}
+}
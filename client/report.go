@@ -0,0 +1,256 @@
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The formats WriteScanReport can write.
+var ScanFormats = []string{"text", "sarif", "junit"}
+
+// Write the report in one of ScanFormats.
+func WriteScanReport(w io.Writer, rep *ScanReport, format string) error {
+	switch format {
+	case "text":
+		return writeScanText(w, rep)
+	case "sarif":
+		return writeSarif(w, rep)
+	case "junit":
+		return writeJUnit(w, rep)
+	}
+	return fmt.Errorf("unknown format: %q, expected %s", format, strings.Join(ScanFormats, ", "))
+}
+
+// The message of a finding, the message of its rule or else the rule's
+// pattern.
+func (f *Finding) message() string {
+	if f.Rule.Message != "" {
+		return f.Rule.Message
+	}
+	return fmt.Sprintf("matches %s", f.Rule.Pattern)
+}
+
+// Write the findings as lines of repo:path:line: severity[rule] message,
+// like those of compilers.
+func writeScanText(w io.Writer, rep *ScanReport) error {
+	for _, rule := range rep.Rules {
+		if err, ok := rep.Errors[rule.Name]; ok {
+			if _, err := fmt.Fprintf(w, "error[%s]: rule failed: %s\n", rule.Name, err); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range rep.Findings[rule.Name] {
+			if _, err := fmt.Fprintf(w, "%s:%s:%d: %s[%s] %s\n    %s\n",
+				f.Repo, f.Path, f.Line, rule.Severity, rule.Name, f.message(), strings.TrimSpace(f.Text)); err != nil {
+				return err
+			}
+		}
+
+		if rep.Truncated[rule.Name] {
+			if _, err := fmt.Fprintf(w, "%s[%s]: more findings were left out\n", rule.Severity, rule.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The parts of SARIF 2.1.0 the report fills in.
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string       `json:"name"`
+			InformationUri string       `json:"informationUri"`
+			Rules          []*sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Invocations []*sarifInvocation `json:"invocations"`
+	Results     []*sarifResult     `json:"results"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	Id                   string        `json:"id"`
+	ShortDescription     *sarifMessage `json:"shortDescription,omitempty"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                 `json:"executionSuccessful"`
+	ToolExecutionNotifications []*sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level          string       `json:"level"`
+	Message        sarifMessage `json:"message"`
+	AssociatedRule struct {
+		Id string `json:"id"`
+	} `json:"associatedRule"`
+}
+
+type sarifResult struct {
+	RuleId    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			Uri       string `json:"uri"`
+			UriBaseId string `json:"uriBaseId"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine int          `json:"startLine"`
+			Snippet   sarifMessage `json:"snippet"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// Write the report as SARIF, which code scanning tools can show. The paths
+// of findings are relative to their repos, which are named by uriBaseId.
+func writeSarif(w io.Writer, rep *ScanReport) error {
+	run := &sarifRun{
+		Invocations: []*sarifInvocation{{ExecutionSuccessful: len(rep.Errors) == 0}},
+		Results:     []*sarifResult{},
+	}
+	run.Tool.Driver.Name = "hound"
+	run.Tool.Driver.InformationUri = "https://github.com/hound-search/hound"
+
+	for _, rule := range rep.Rules {
+		sr := &sarifRule{Id: rule.Name}
+		if rule.Message != "" {
+			sr.ShortDescription = &sarifMessage{rule.Message}
+		}
+		sr.DefaultConfiguration.Level = rule.Severity
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sr)
+
+		if err, ok := rep.Errors[rule.Name]; ok {
+			n := &sarifNotification{Level: "error", Message: sarifMessage{err}}
+			n.AssociatedRule.Id = rule.Name
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications, n)
+		}
+
+		for _, f := range rep.Findings[rule.Name] {
+			loc := &sarifLocation{}
+			loc.PhysicalLocation.ArtifactLocation.Uri = f.Path
+			loc.PhysicalLocation.ArtifactLocation.UriBaseId = f.Repo
+			loc.PhysicalLocation.Region.StartLine = f.Line
+			loc.PhysicalLocation.Region.Snippet.Text = f.Text
+
+			run.Results = append(run.Results, &sarifResult{
+				RuleId:    rule.Name,
+				Level:     rule.Severity,
+				Message:   sarifMessage{f.message()},
+				Locations: []*sarifLocation{loc},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []*sarifRun{run},
+	})
+}
+
+// The parts of the JUnit XML the report fills in, which CI systems show as
+// test results.
+type junitSuite struct {
+	XMLName  xml.Name     `xml:"testsuite"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// Write the report as JUnit XML with a test case for each rule. Findings of
+// errors fail their rule, those of warnings and notes are only listed.
+func writeJUnit(w io.Writer, rep *ScanReport) error {
+	suite := &junitSuite{Name: "hound scan"}
+	for _, rule := range rep.Rules {
+		c := &junitCase{Name: rule.Name, Classname: "hound.scan"}
+		suite.Cases = append(suite.Cases, c)
+
+		if err, ok := rep.Errors[rule.Name]; ok {
+			c.Error = &junitMessage{Message: err}
+			suite.Errors++
+			continue
+		}
+
+		found := rep.Findings[rule.Name]
+		if len(found) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		for _, f := range found {
+			fmt.Fprintf(&b, "%s:%s:%d: %s\n", f.Repo, f.Path, f.Line, strings.TrimSpace(f.Text))
+		}
+
+		if rep.Truncated[rule.Name] {
+			b.WriteString("more findings were left out\n")
+		}
+
+		msg := "1 finding"
+		if len(found) > 1 {
+			msg = fmt.Sprintf("%d findings", len(found))
+		}
+
+		if rule.Message != "" {
+			msg = fmt.Sprintf("%s: %s", msg, rule.Message)
+		}
+
+		if rule.Severity == SeverityError {
+			c.Failure = &junitMessage{Message: msg, Body: b.String()}
+			suite.Failures++
+		} else {
+			c.SystemOut = msg + "\n" + b.String()
+		}
+	}
+	suite.Tests = len(suite.Cases)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The severities of rules, as in SARIF. Only findings of errors fail a
+// scan.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// A policy that a scan checks, a pattern that should not appear in the
+// files and repos it applies to.
+type ScanRule struct {
+	Name         string `json:"name"`
+	Pattern      string `json:"pattern"`
+	Literal      bool   `json:"literal"`
+	IgnoreCase   bool   `json:"ignore-case"`
+	Files        string `json:"files"`
+	ExcludeFiles string `json:"exclude-files"`
+	Repos        string `json:"repos"`
+
+	// What a finding of the rule tells the reader, and how bad it is.
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// The rules of a scan along with the repos they apply to, unless a rule
+// names its own.
+type RuleSet struct {
+	Repos string      `json:"repos"`
+	Tags  string      `json:"tags"`
+	Rules []*ScanRule `json:"rules"`
+}
+
+// Parse a rules file, which is either JSON or YAML of the same shape:
+//
+//	repos: "*"
+//	rules:
+//	  - name: no-println
+//	    pattern: fmt\.Println
+//	    files: \.go$
+//	    exclude-files: _test\.go$
+//	    message: Use the logger
+//
+// Only the YAML of such files is understood: mappings of scalars and a list
+// of them under rules.
+func ParseRules(b []byte) (*RuleSet, error) {
+	var rs RuleSet
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		if err := json.Unmarshal(t, &rs); err != nil {
+			return nil, err
+		}
+	} else {
+		obj, err := parseYAMLRules(b)
+		if err != nil {
+			return nil, err
+		}
+
+		js, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(js, &rs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rs.Rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+
+	seen := map[string]bool{}
+	for i, r := range rs.Rules {
+		switch {
+		case r.Name == "":
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		case r.Pattern == "":
+			return nil, fmt.Errorf("rule %s has no pattern", r.Name)
+		case seen[r.Name]:
+			return nil, fmt.Errorf("rule %s is given twice", r.Name)
+		}
+		seen[r.Name] = true
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityError
+		case SeverityError, SeverityWarning, SeverityNote:
+		default:
+			return nil, fmt.Errorf("rule %s: unknown severity %q, expected error, warning or note", r.Name, r.Severity)
+		}
+	}
+
+	if rs.Repos == "" {
+		rs.Repos = "*"
+	}
+	return &rs, nil
+}
+
+// Remove a comment from the line, a # at its start or after a space that
+// isn't quoted.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Parse a YAML scalar, which may be quoted. Plain true and false are
+// booleans.
+func parseYAMLScalar(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string: %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s == "true" || s == "yes":
+		return true, nil
+	case s == "false" || s == "no":
+		return false, nil
+	}
+	return s, nil
+}
+
+// Split a key: value line into the key and the parsed value, which is nil
+// when the line ends at the colon.
+func parseYAMLPair(line string) (string, interface{}, error) {
+	ix := strings.Index(line, ":")
+	if ix <= 0 {
+		return "", nil, fmt.Errorf("expected key: value, got %q", line)
+	}
+
+	key, rest := strings.TrimSpace(line[:ix]), strings.TrimSpace(line[ix+1:])
+	if rest == "" {
+		return key, nil, nil
+	}
+
+	val, err := parseYAMLScalar(rest)
+	return key, val, err
+}
+
+// Parse the YAML of a rules file into the maps and lists it stands for.
+func parseYAMLRules(b []byte) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+
+	// the list being filled, under the key of root it belongs to, and the
+	// item of it being filled.
+	var listKey string
+	var item map[string]interface{}
+	itemIndent := -1
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(stripComment(s.Text()), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't indent YAML", n)
+		}
+
+		indent := len(line) - len(trimmed)
+		switch {
+		case indent == 0:
+			key, val, err := parseYAMLPair(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+
+			item, itemIndent, listKey = nil, -1, ""
+			if val == nil {
+				listKey = key
+				root[key] = []interface{}{}
+				continue
+			}
+			root[key] = val
+		case listKey != "" && strings.HasPrefix(trimmed, "- "):
+			item = map[string]interface{}{}
+			root[listKey] = append(root[listKey].([]interface{}), item)
+
+			rest := strings.TrimLeft(trimmed[2:], " ")
+			itemIndent = len(line) - len(rest)
+			key, val, err := parseYAMLPair(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			item[key] = val
+		case item != nil && indent == itemIndent:
+			key, val, err := parseYAMLPair(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			item[key] = val
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indentation", n)
+		}
+	}
+	return root, s.Err()
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The matches of a rule, as /api/v1/scan returns them, or why the rule
+// couldn't be searched for.
+type RuleResult struct {
+	Rule      string
+	Results   map[string]*index.SearchResponse
+	Truncated bool   `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+type ScanResponse struct {
+	Rules []*RuleResult
+}
+
+// A line that matches a rule.
+type Finding struct {
+	Rule *ScanRule
+	Repo string
+	Rev  string
+	Path string
+	Line int
+	Text string
+}
+
+// The outcome of a scan, with the findings of each rule in the order of
+// the rule set.
+type ScanReport struct {
+	Rules    []*ScanRule
+	Findings map[string][]*Finding
+
+	// Why rules couldn't be searched for, by rule name.
+	Errors map[string]string
+
+	// The rules whose findings were cut short by the most matches.
+	Truncated map[string]bool
+}
+
+// Whether any rule of error severity found something.
+func (r *ScanReport) Failed() bool {
+	for _, rule := range r.Rules {
+		if rule.Severity == SeverityError && len(r.Findings[rule.Name]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func doHttpPostJson(cfg *Config, uri string, body interface{}) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doHttp(cfg, req)
+}
+
+// Search for all the rules at once on the API running on host, returning
+// at most maxMatches lines for each rule when it isn't 0.
+func Scan(cfg *Config, rs *RuleSet, maxMatches int) (*ScanReport, error) {
+	type rule struct {
+		Name         string
+		Pattern      string
+		Literal      bool
+		IgnoreCase   bool
+		Files        string
+		ExcludeFiles string
+		Repos        string
+		Message      string
+		Severity     string
+	}
+
+	req := struct {
+		Repos      string
+		Tags       string
+		Rules      []*rule
+		MaxMatches int
+	}{
+		Repos:      rs.Repos,
+		Tags:       rs.Tags,
+		MaxMatches: maxMatches,
+	}
+
+	for _, r := range rs.Rules {
+		req.Rules = append(req.Rules, &rule{
+			Name:         r.Name,
+			Pattern:      r.Pattern,
+			Literal:      r.Literal,
+			IgnoreCase:   r.IgnoreCase,
+			Files:        r.Files,
+			ExcludeFiles: r.ExcludeFiles,
+			Repos:        r.Repos,
+			Message:      r.Message,
+			Severity:     r.Severity,
+		})
+	}
+
+	res, err := doHttpPostJson(cfg, fmt.Sprintf("%s/api/v1/scan", cfg.baseUrl()), &req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errorOf(res)
+	}
+
+	var sr ScanResponse
+	if err := json.NewDecoder(res.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+	return newScanReport(rs, &sr), nil
+}
+
+// Flatten the results of each rule into its findings, sorted by repo, path
+// and line.
+func newScanReport(rs *RuleSet, sr *ScanResponse) *ScanReport {
+	rep := &ScanReport{
+		Rules:     rs.Rules,
+		Findings:  map[string][]*Finding{},
+		Errors:    map[string]string{},
+		Truncated: map[string]bool{},
+	}
+
+	byName := map[string]*ScanRule{}
+	for _, r := range rs.Rules {
+		byName[r.Name] = r
+	}
+
+	for _, rr := range sr.Rules {
+		rule := byName[rr.Rule]
+		if rule == nil {
+			continue
+		}
+
+		if rr.Error != "" {
+			rep.Errors[rule.Name] = rr.Error
+		}
+
+		if rr.Truncated {
+			rep.Truncated[rule.Name] = true
+		}
+
+		var found []*Finding
+		for repo, res := range rr.Results {
+			for _, fm := range res.Matches {
+				for _, m := range fm.Matches {
+					found = append(found, &Finding{
+						Rule: rule,
+						Repo: repo,
+						Rev:  res.Revision,
+						Path: fm.Filename,
+						Line: m.LineNumber,
+						Text: m.Line,
+					})
+				}
+			}
+		}
+
+		sort.SliceStable(found, func(i, j int) bool {
+			a, b := found[i], found[j]
+			if a.Repo != b.Repo {
+				return a.Repo < b.Repo
+			}
+			if a.Path != b.Path {
+				return a.Path < b.Path
+			}
+			return a.Line < b.Line
+		})
+		rep.Findings[rule.Name] = found
+	}
+	return rep
+}
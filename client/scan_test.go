@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/index"
+)
+
+const testRules = `# policies of prod code
+repos: "*"
+rules:
+  - name: no-println
+    pattern: fmt\.Println # not the logger
+    files: \.go$
+    exclude-files: _test\.go$
+    message: 'Use the logger, it''s structured'
+  - name: todo
+    pattern: "TODO #"
+    literal: true
+    severity: warning
+`
+
+func TestParseRules(t *testing.T) {
+	rs, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.Repos != "*" || len(rs.Rules) != 2 {
+		t.Fatalf("unexpected rule set: %+v", rs)
+	}
+
+	want := ScanRule{
+		Name:         "no-println",
+		Pattern:      `fmt\.Println`,
+		Files:        `\.go$`,
+		ExcludeFiles: `_test\.go$`,
+		Message:      "Use the logger, it's structured",
+		Severity:     SeverityError,
+	}
+	if *rs.Rules[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, rs.Rules[0])
+	}
+
+	if r := rs.Rules[1]; r.Pattern != "TODO #" || !r.Literal || r.Severity != SeverityWarning {
+		t.Fatalf("unexpected rule: %+v", r)
+	}
+
+	js, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJson, err := ParseRules(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *fromJson.Rules[0] != want {
+		t.Fatalf("expected %+v from JSON, got %+v", want, fromJson.Rules[0])
+	}
+
+	for _, bad := range []string{
+		"rules:\n",
+		"rules:\n  - pattern: x\n",
+		"rules:\n  - name: a\n    pattern: x\n    severity: fatal\n",
+		"rules:\n  - name: a\n    pattern: x\n  - name: a\n    pattern: y\n",
+		"rules:\n  - name: a\n      pattern: x\n",
+	} {
+		if _, err := ParseRules([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Repos string
+			Rules []struct {
+				Name    string
+				Pattern string
+				Files   string
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if req.Repos != "*" || len(req.Rules) != 2 || req.Rules[0].Files != `\.go$` {
+			t.Errorf("unexpected scan: %+v", req)
+		}
+
+		json.NewEncoder(w).Encode(&ScanResponse{ //nolint
+			Rules: []*RuleResult{
+				{
+					Rule: "no-println",
+					Results: map[string]*index.SearchResponse{
+						"r": {Matches: []*index.FileMatch{
+							{Filename: "b.go", Matches: []*index.Match{{Line: "\tfmt.Println(x)", LineNumber: 9}}},
+							{Filename: "a.go", Matches: []*index.Match{{Line: "fmt.Println(<y>)", LineNumber: 3}}},
+						}},
+					},
+				},
+				{Rule: "todo", Error: "no such repo"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	rs, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := Scan(&Config{Host: srv.URL}, rs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := rep.Findings["no-println"]
+	if len(found) != 2 || found[0].Path != "a.go" || found[1].Line != 9 {
+		t.Fatalf("expected the findings sorted by path, got %+v", found)
+	}
+
+	if !rep.Failed() || rep.Errors["todo"] != "no such repo" {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteScanReport(&buf, rep, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	run := log.Runs[0]
+	if len(run.Results) != 2 || len(run.Tool.Driver.Rules) != 2 || run.Invocations[0].ExecutionSuccessful {
+		t.Fatalf("unexpected SARIF: %s", buf.String())
+	}
+
+	if loc := run.Results[0].Locations[0].PhysicalLocation; loc.ArtifactLocation.UriBaseId != "r" || loc.Region.StartLine != 3 {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+
+	buf.Reset()
+	if err := WriteScanReport(&buf, rep, "junit"); err != nil {
+		t.Fatal(err)
+	}
+
+	var suite junitSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatal(err)
+	}
+
+	if suite.Tests != 2 || suite.Failures != 1 || suite.Errors != 1 {
+		t.Fatalf("unexpected JUnit: %s", buf.String())
+	}
+
+	if body := suite.Cases[0].Failure.Body; !strings.Contains(body, "r:a.go:3: fmt.Println(<y>)") {
+		t.Fatalf("expected the findings in the failure, got %q", body)
+	}
+
+	if err := WriteScanReport(&buf, rep, "html"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
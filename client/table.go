@@ -0,0 +1,40 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hound-search/hound/config"
+)
+
+type tablePresenter struct {
+	f *os.File
+}
+
+// Write a row for each matching line, leaving out the context, in columns
+// that line up.
+func (p *tablePresenter) Present(
+	re *regexp.Regexp,
+	ctx int,
+	repos map[string]*config.Repo,
+	res *Response) error {
+
+	w := tabwriter.NewWriter(p.f, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tFILE\tLINE\tMATCH")
+	for _, repo := range sortedRepos(res) {
+		for _, file := range res.Results[repo].Matches {
+			for _, m := range file.Matches {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
+					repo, file.Filename, m.LineNumber, strings.Replace(strings.TrimSpace(m.Line), "\t", " ", -1))
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func NewTablePresenter(w *os.File) Presenter {
+	return &tablePresenter{w}
+}
@@ -0,0 +1,583 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hound-search/hound/ansi"
+	"github.com/hound-search/hound/index"
+)
+
+const (
+	// How long typing has to pause before the query is searched.
+	tuiDebounce = 200 * time.Millisecond
+
+	// The most matches the TUI asks for, unless the options give a limit,
+	// so that a query of a letter or two stays quick.
+	tuiMaxMatches = 500
+)
+
+// The keys the TUI acts on.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyBackspace
+	keyTab
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEsc
+	keyQuit
+	keyOpen
+	keyEdit
+	keyClear
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// Parse what was read from the terminal into keys. An escape sequence is
+// assumed to arrive in a single read, so an escape on its own is the
+// escape key.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b && len(b) == 1:
+			keys = append(keys, key{code: keyEsc})
+			b = b[1:]
+		case c == 0x1b:
+			n := 2
+			for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+				n++
+			}
+			if n < len(b) {
+				n++
+			}
+
+			switch string(b[1:n]) {
+			case "[A", "OA":
+				keys = append(keys, key{code: keyUp})
+			case "[B", "OB":
+				keys = append(keys, key{code: keyDown})
+			case "[5~":
+				keys = append(keys, key{code: keyPageUp})
+			case "[6~":
+				keys = append(keys, key{code: keyPageDown})
+			}
+			b = b[n:]
+		case c == '\r' || c == '\n':
+			keys = append(keys, key{code: keyEnter})
+			b = b[1:]
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+			b = b[1:]
+		case c == '\t':
+			keys = append(keys, key{code: keyTab})
+			b = b[1:]
+		case c == 0x03 || c == 0x04:
+			keys = append(keys, key{code: keyQuit})
+			b = b[1:]
+		case c == 0x10:
+			keys = append(keys, key{code: keyUp})
+			b = b[1:]
+		case c == 0x0e:
+			keys = append(keys, key{code: keyDown})
+			b = b[1:]
+		case c == 0x0f:
+			keys = append(keys, key{code: keyOpen})
+			b = b[1:]
+		case c == 0x05:
+			keys = append(keys, key{code: keyEdit})
+			b = b[1:]
+		case c == 0x15:
+			keys = append(keys, key{code: keyClear})
+			b = b[1:]
+		case c < 0x20:
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			if r != utf8.RuneError {
+				keys = append(keys, key{code: keyRune, r: r})
+			}
+			b = b[n:]
+		}
+	}
+	return keys
+}
+
+// A matching line as the TUI lists it.
+type tuiMatch struct {
+	repo  string
+	file  string
+	rev   string
+	match *index.Match
+}
+
+// Flatten the results into their matching lines, by repo and then in the
+// order of the files.
+func flattenMatches(res *Response) []*tuiMatch {
+	var matches []*tuiMatch
+	for _, repo := range sortedRepos(res) {
+		r := res.Results[repo]
+		for _, file := range r.Matches {
+			for _, m := range file.Matches {
+				matches = append(matches, &tuiMatch{
+					repo:  repo,
+					file:  file.Filename,
+					rev:   r.Revision,
+					match: m,
+				})
+			}
+		}
+	}
+	return matches
+}
+
+// Fit the line into width columns, expanding tabs.
+func fitLine(s string, width int) string {
+	s = strings.Replace(s, "\t", "    ", -1)
+	if width <= 0 {
+		return ""
+	}
+
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// The results of a search the TUI started, which are dropped when another
+// search has started since.
+type tuiResult struct {
+	seq int
+	res *Response
+	err error
+	dur time.Duration
+}
+
+// An interactive search in the terminal. The query and the repos are
+// searched as they are typed, and the selected match is shown with the
+// lines around it.
+type tui struct {
+	cfg *Config
+	opt SearchOptions
+	in  *os.File
+	out *os.File
+	c   *ansi.Colorer
+
+	query string
+	repos string
+
+	// Whether the repos are being edited rather than the query.
+	editRepos bool
+
+	matches []*tuiMatch
+	sel     int
+	top     int
+	re      *regexp.Regexp
+
+	// The latest search started and what to show in the status line.
+	seq    int
+	status string
+
+	restore func() error
+}
+
+// Run the TUI on the terminal until it is quit, starting with the query and
+// searching with the options.
+func RunTUI(cfg *Config, query string, opt *SearchOptions) error {
+	t := &tui{
+		cfg:   cfg,
+		opt:   *opt,
+		in:    os.Stdin,
+		out:   os.Stdout,
+		c:     ansi.NewFor(os.Stdout),
+		query: query,
+		repos: opt.Repos,
+	}
+
+	if t.opt.MaxMatches == 0 {
+		t.opt.MaxMatches = tuiMaxMatches
+	}
+
+	if err := t.start(); err != nil {
+		return err
+	}
+	defer t.stop() //nolint
+
+	return t.loop()
+}
+
+// Take over the terminal, on the alternate screen so what was on it comes
+// back once the TUI is quit.
+func (t *tui) start() error {
+	restore, err := ansi.MakeRaw(t.in)
+	if err != nil {
+		return fmt.Errorf("the TUI needs a terminal: %s", err)
+	}
+	t.restore = restore
+
+	_, err = t.out.WriteString("\x1b[?1049h")
+	return err
+}
+
+func (t *tui) stop() error {
+	if _, err := t.out.WriteString("\x1b[?1049l\x1b[?25h"); err != nil {
+		return err
+	}
+	return t.restore()
+}
+
+func (t *tui) loop() error {
+	keys := make(chan []key)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := t.in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+
+	results := make(chan *tuiResult)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var debounce <-chan time.Time
+	if t.query != "" {
+		debounce = time.After(0)
+	}
+
+	var cols, rows int
+	dirty := true
+	for {
+		if dirty {
+			cols, rows = t.render()
+			dirty = false
+		}
+
+		select {
+		case ks, ok := <-keys:
+			if !ok {
+				return nil
+			}
+
+			dirty = true
+			for _, k := range ks {
+				changed, quit, err := t.handle(k, rows)
+				if err != nil {
+					t.status = err.Error()
+				}
+
+				if quit {
+					return nil
+				}
+
+				if changed {
+					debounce = time.After(tuiDebounce)
+				}
+			}
+		case <-debounce:
+			debounce = nil
+			t.search(results)
+			dirty = true
+		case r := <-results:
+			if r.seq == t.seq {
+				t.show(r)
+				dirty = true
+			}
+		case <-ticker.C:
+			// the screen is drawn again when the terminal is resized.
+			if c, r, err := ansi.Size(t.out); err == nil && (c != cols || r != rows) {
+				dirty = true
+			}
+		}
+	}
+}
+
+// Start a search of the query in the background, the results are sent to
+// results.
+func (t *tui) search(results chan<- *tuiResult) {
+	t.seq++
+	if t.query == "" {
+		t.matches, t.sel, t.top, t.status = nil, 0, 0, ""
+		return
+	}
+
+	opt := t.opt
+	opt.Repos = t.repos
+	if opt.Repos == "" {
+		opt.Repos = "*"
+	}
+
+	seq, query := t.seq, t.query
+	t.status = "searching..."
+	go func() {
+		start := time.Now()
+		var res Response
+		err := SearchWith(&res, t.cfg, query, &opt)
+		results <- &tuiResult{seq: seq, res: &res, err: err, dur: time.Since(start)}
+	}()
+
+	pat := query
+	if opt.Literal {
+		pat = regexp.QuoteMeta(pat)
+	}
+	t.re, _ = regexp.Compile(index.GetRegexpPattern(pat, opt.IgnoreCase))
+}
+
+func (t *tui) show(r *tuiResult) {
+	t.sel, t.top = 0, 0
+	if r.err != nil {
+		t.matches = nil
+		t.status = r.err.Error()
+		return
+	}
+
+	t.matches = flattenMatches(r.res)
+	files := 0
+	for _, res := range r.res.Results {
+		files += len(res.Matches)
+	}
+
+	t.status = fmt.Sprintf("%d matches in %d files (%d ms)", len(t.matches), files, r.dur/time.Millisecond)
+	if r.res.Truncated {
+		t.status += ", more were left out"
+	}
+}
+
+// Act on a key, reporting whether the query or the repos changed and
+// whether the TUI is to quit.
+func (t *tui) handle(k key, rows int) (bool, bool, error) {
+	field := &t.query
+	if t.editRepos {
+		field = &t.repos
+	}
+
+	page := t.listRows(rows)
+	switch k.code {
+	case keyRune:
+		*field += string(k.r)
+		return true, false, nil
+	case keyBackspace:
+		if *field == "" {
+			return false, false, nil
+		}
+		_, n := utf8.DecodeLastRuneInString(*field)
+		*field = (*field)[:len(*field)-n]
+		return true, false, nil
+	case keyClear:
+		*field = ""
+		return true, false, nil
+	case keyTab:
+		t.editRepos = !t.editRepos
+	case keyUp:
+		t.move(-1)
+	case keyDown:
+		t.move(1)
+	case keyPageUp:
+		t.move(-page)
+	case keyPageDown:
+		t.move(page)
+	case keyEnter, keyOpen:
+		return false, false, t.openInBrowser()
+	case keyEdit:
+		return false, false, t.openInEditor()
+	case keyEsc, keyQuit:
+		return false, true, nil
+	}
+	return false, false, nil
+}
+
+func (t *tui) move(n int) {
+	t.sel += n
+	if t.sel >= len(t.matches) {
+		t.sel = len(t.matches) - 1
+	}
+
+	if t.sel < 0 {
+		t.sel = 0
+	}
+}
+
+func (t *tui) selected() *tuiMatch {
+	if t.sel < len(t.matches) {
+		return t.matches[t.sel]
+	}
+	return nil
+}
+
+// Open the url of the selected match, from the url-pattern of its repo, in
+// the browser.
+func (t *tui) openInBrowser() error {
+	m := t.selected()
+	if m == nil {
+		return nil
+	}
+
+	u, err := LinkTo(t.cfg, m.repo, m.file, m.match.LineNumber, m.rev)
+	if err != nil {
+		return err
+	}
+
+	opener := "xdg-open"
+	switch runtime.GOOS {
+	case "darwin":
+		opener = "open"
+	case "windows":
+		opener = "explorer"
+	}
+
+	if err := exec.Command(opener, u).Start(); err != nil {
+		return err
+	}
+
+	t.status = "opened " + u
+	return nil
+}
+
+// Open the file of the selected match at its line with $EDITOR, in the
+// checkout of its repo given by the config.
+func (t *tui) openInEditor() error {
+	m := t.selected()
+	if m == nil {
+		return nil
+	}
+
+	dir := t.cfg.Checkouts[m.repo]
+	if dir == "" {
+		return fmt.Errorf("%s has no checkout, add it to checkouts in the config", m.repo)
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// the editor gets the terminal until it exits.
+	if err := t.stop(); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(editor, fmt.Sprintf("+%d", m.match.LineNumber), filepath.Join(dir, filepath.FromSlash(m.file)))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = t.in, t.out, os.Stderr
+	runErr := cmd.Run()
+
+	if err := t.start(); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// The number of rows the list of matches takes, leaving room for the
+// inputs, the status line and the preview.
+func (t *tui) listRows(rows int) int {
+	n := rows - 4 - t.previewRows(rows)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (t *tui) previewRows(rows int) int {
+	n := 2*t.opt.Context + 1
+	if n > rows/3 {
+		n = rows / 3
+	}
+	return n
+}
+
+// Draw the screen, returning its size.
+func (t *tui) render() (int, int) {
+	cols, rows, err := ansi.Size(t.out)
+	if err != nil || cols <= 0 || rows <= 0 {
+		cols, rows = 80, 24
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[?25l\x1b[H")
+	line := func(s string) {
+		buf.WriteString(s)
+		buf.WriteString("\x1b[K\r\n")
+	}
+
+	label := func(name string, editing bool) string {
+		if editing {
+			return t.c.Fg(name, ansi.Yellow, ansi.Bold)
+		}
+		return name
+	}
+
+	line(label("query> ", !t.editRepos) + fitLine(t.query, cols-7))
+	line(label("repos> ", t.editRepos) + fitLine(t.repos, cols-7))
+	line(t.c.Fg(fitLine(t.status, cols), ansi.Cyan, ansi.Normal))
+
+	list := t.listRows(rows)
+	if t.sel < t.top {
+		t.top = t.sel
+	} else if t.sel >= t.top+list {
+		t.top = t.sel - list + 1
+	}
+
+	for i := t.top; i < t.top+list; i++ {
+		if i >= len(t.matches) {
+			line("")
+			continue
+		}
+
+		m := t.matches[i]
+		s := fitLine(fmt.Sprintf("%s:%s:%d: %s", m.repo, m.file, m.match.LineNumber,
+			strings.TrimSpace(m.match.Line)), cols)
+		if i == t.sel {
+			s = t.c.FgBg(s, ansi.Black, ansi.Normal, ansi.White, ansi.Normal)
+		}
+		line(s)
+	}
+
+	help := "tab: query/repos  up/down: select  enter: open in browser  ctrl-e: open in $EDITOR  esc: quit"
+	line(t.c.Fg(fitLine(help, cols), ansi.Blue, ansi.Normal))
+
+	if m := t.selected(); m != nil {
+		start := m.match.LineNumber - len(m.match.Before)
+		ctx := append(append(append([]string{}, m.match.Before...), m.match.Line), m.match.After...)
+		for i, l := range ctx {
+			if i >= t.previewRows(rows) {
+				break
+			}
+
+			s := fitLine(l, cols-8)
+			if start+i == m.match.LineNumber && t.re != nil {
+				s = hiliteMatches(t.c, t.re, s)
+			}
+			line(fmt.Sprintf("%6d  %s", start+i, s))
+		}
+	}
+	buf.WriteString("\x1b[J")
+
+	// the cursor is left at the end of the field being edited.
+	row, col := 1, 8+utf8.RuneCountInString(t.query)
+	if t.editRepos {
+		row, col = 2, 8+utf8.RuneCountInString(t.repos)
+	}
+	fmt.Fprintf(&buf, "\x1b[%d;%dH\x1b[?25h", row, col)
+
+	t.out.Write(buf.Bytes()) //nolint
+	return cols, rows
+}
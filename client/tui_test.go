@@ -0,0 +1,66 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/hound-search/hound/index"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("a\xc3\xa9\x1b[A\x1b[6~\x7f\t\r\x1bOB\x05\x01"))
+	want := []key{
+		{code: keyRune, r: 'a'},
+		{code: keyRune, r: 'é'},
+		{code: keyUp},
+		{code: keyPageDown},
+		{code: keyBackspace},
+		{code: keyTab},
+		{code: keyEnter},
+		{code: keyDown},
+		{code: keyEdit},
+	}
+
+	if len(keys) != len(want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("key %d: expected %v, got %v", i, want[i], keys[i])
+		}
+	}
+
+	if keys := parseKeys([]byte{0x1b}); len(keys) != 1 || keys[0].code != keyEsc {
+		t.Errorf("expected a lone escape to be the escape key, got %v", keys)
+	}
+}
+
+func TestFlattenMatches(t *testing.T) {
+	res := &Response{
+		Results: map[string]*index.SearchResponse{
+			"b": {Revision: "2", Matches: []*index.FileMatch{
+				{Filename: "x.go", Matches: []*index.Match{{LineNumber: 1}, {LineNumber: 5}}},
+			}},
+			"a": {Revision: "1", Matches: []*index.FileMatch{
+				{Filename: "y.go", Matches: []*index.Match{{LineNumber: 3}}},
+			}},
+		},
+	}
+
+	matches := flattenMatches(res)
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matches, got %d", len(matches))
+	}
+
+	if m := matches[0]; m.repo != "a" || m.rev != "1" || m.match.LineNumber != 3 {
+		t.Errorf("expected the match of a first, got %+v", m)
+	}
+
+	if m := matches[2]; m.repo != "b" || m.file != "x.go" || m.match.LineNumber != 5 {
+		t.Errorf("expected the second match of b last, got %+v", m)
+	}
+
+	if s := fitLine("\tcafé au lait", 8); s != "    café" {
+		t.Errorf("expected the line to be cut to 8 columns, got %q", s)
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"flag"
-	"log"
+	"fmt"
 	"os"
 	"os/user"
 	"regexp"
@@ -80,51 +80,177 @@ func defaultFlagForHost() string {
 	return "localhost:6080"
 }
 
+// The presenters of the -format flag.
+var presenters = map[string]func(*os.File) client.Presenter{
+	"ack":   client.NewAckPresenter,
+	"grep":  client.NewGrepPresenter,
+	"json":  client.NewJsonPresenter,
+	"table": client.NewTablePresenter,
+}
+
+// The exit codes, which follow grep: 1 when nothing is found, or with
+// -fail-if-found when something is, and 2 when the search fails.
+const (
+	exitFailed = 1
+	exitError  = 2
+)
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "hound: %s\n", err)
+	os.Exit(exitError)
+}
+
+// The number of matching lines in the response.
+func countMatches(res *client.Response) int {
+	n := 0
+	for _, r := range res.Results {
+		for _, fm := range r.Matches {
+			n += len(fm.Matches)
+		}
+	}
+	return n
+}
+
+// Read the config from the file given by -config, or else the default
+// paths. The flags of fs take precedence over the environment, which takes
+// precedence over the config files.
+func loadClientConfig(fs *flag.FlagSet, path, host, key string) (*client.Config, error) {
+	cfg := &client.Config{
+		Host:        defaultFlagForHost(),
+		HttpHeaders: nil,
+	}
+
+	var err error
+	if path != "" {
+		err = loadConfigFrom(path, cfg)
+	} else {
+		err = loadConfig(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("HOUND_HOST"); v != "" {
+		cfg.Host = v
+	}
+
+	if v := os.Getenv("HOUND_ACCESS_KEY"); v != "" {
+		cfg.AccessKey = v
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Host = host
+		case "key":
+			cfg.AccessKey = key
+		}
+	})
+	return cfg, nil
+}
+
 func main() {
-	flagHost := flag.String("host", defaultFlagForHost(), "")
-	flagRepos := flag.String("repos", "*", "")
-	flagFiles := flag.String("files", "", "")
-	flagContext := flag.Int("context", 2, "")
-	flagCase := flag.Bool("ignore-case", false, "")
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		scanMain(os.Args[2:])
+		return
+	}
+
+	flagConfig := flag.String("config", "", "A config file to read the host, access key and http headers from, in place of /etc/hound.conf and ~/.hound")
+	flagHost := flag.String("host", defaultFlagForHost(), "The address of houndd, with an optional http:// or https://, or $HOUND_HOST")
+	flagKey := flag.String("key", "", "The access key to send, or $HOUND_ACCESS_KEY")
+	flagRepos := flag.String("repos", "*", "Comma separated repos to search")
+	flagTags := flag.String("tags", "", "Comma separated tags, only repos with any of them are searched")
+	flagFiles := flag.String("files", "", "A regular expression the file paths must match")
+	flagExcludeFiles := flag.String("exclude-files", "", "A regular expression the file paths must not match")
+	flagPaths := flag.String("paths", "", "Comma separated globs such as *.go, the file paths must match any of them")
+	flagExcludePaths := flag.String("exclude-paths", "", "Comma separated globs the file paths must not match")
+	flagContext := flag.Int("context", 2, "Lines of context around each match")
+	flagContextMode := flag.String("context-mode", "", "block for the function or block around each match as its context rather than -context lines")
+	flagCase := flag.Bool("ignore-case", false, "Ignore case")
+	flagLiteral := flag.Bool("literal", false, "Search for the pattern as a literal string")
+	flagWord := flag.Bool("word", false, "Only match the pattern as a whole word")
+	flagBranch := flag.String("branch", "", "A branch, tag or commit from the indexed history of the repos to search")
+	flagMaxMatches := flag.Int("max-matches", 0, "The most matching lines to return")
+	flagMaxLineLength := flag.Int("max-line-length", 0, "The longest line to show, in bytes, longer ones are cut down around their match")
 	flagStats := flag.Bool("show-stats", false, "")
-	flagGrep := flag.Bool("like-grep", false, "")
+	flagGrep := flag.Bool("like-grep", false, "The same as -format grep")
+	flagFormat := flag.String("format", "ack", "The output format: ack, grep, json or table")
+	flagFailIfFound := flag.Bool("fail-if-found", false, "Exit with 1 when the pattern is found and 0 when it isn't, for CI checks")
+	flagTUI := flag.Bool("tui", false, "Search interactively in the terminal, starting with the pattern if one is given")
 
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if flag.NArg() > 1 || (flag.NArg() == 0 && !*flagTUI) {
 		flag.Usage()
-		return
+		os.Exit(exitError)
 	}
 
-	pat := index.GetRegexpPattern(flag.Arg(0), *flagCase)
+	format := *flagFormat
+	if *flagGrep {
+		format = "grep"
+	}
+
+	newPresenter := presenters[format]
+	if newPresenter == nil {
+		fail(fmt.Errorf("unknown format: %q, expected ack, grep, json or table", format))
+	}
+
+	pat := flag.Arg(0)
+	if *flagLiteral {
+		pat = regexp.QuoteMeta(pat)
+	}
 
-	reg, err := regexp.Compile(pat)
+	if *flagWord {
+		pat = `\b(?:` + pat + `)\b`
+	}
+
+	reg, err := regexp.Compile(index.GetRegexpPattern(pat, *flagCase))
 	if err != nil {
-		// TODO(knorton): Better error reporting
-		log.Panic(err)
+		fail(err)
 	}
 
-	cfg := client.Config{
-		Host:        *flagHost,
-		HttpHeaders: nil,
+	cfg, err := loadClientConfig(flag.CommandLine, *flagConfig, *flagHost, *flagKey)
+	if err != nil {
+		fail(err)
+	}
+
+	opt := &client.SearchOptions{
+		Repos:         *flagRepos,
+		Tags:          *flagTags,
+		Files:         *flagFiles,
+		ExcludeFiles:  *flagExcludeFiles,
+		Paths:         *flagPaths,
+		ExcludePaths:  *flagExcludePaths,
+		Context:       *flagContext,
+		ContextMode:   *flagContextMode,
+		IgnoreCase:    *flagCase,
+		Literal:       *flagLiteral,
+		WholeWord:     *flagWord,
+		Stats:         *flagStats,
+		Rev:           *flagBranch,
+		MaxMatches:    *flagMaxMatches,
+		MaxLineLength: *flagMaxLineLength,
 	}
 
-	if err := loadConfig(&cfg); err != nil {
-		log.Panic(err)
+	if *flagTUI {
+		if err := client.RunTUI(cfg, flag.Arg(0), opt); err != nil {
+			fail(err)
+		}
+		return
 	}
 
-	res, repos, err := client.SearchAndLoadRepos(&cfg,
-		flag.Arg(0),
-		*flagRepos,
-		*flagFiles,
-		*flagContext,
-		*flagCase,
-		*flagStats)
+	res, repos, err := client.SearchWithAndLoadRepos(cfg, flag.Arg(0), opt)
 	if err != nil {
-		log.Panic(err)
+		fail(err)
+	}
+
+	if err := newPresenter(os.Stdout).Present(reg, *flagContext, repos, res); err != nil {
+		fail(err)
 	}
 
-	if err := newPresenter(*flagGrep).Present(reg, *flagContext, repos, res); err != nil {
-		log.Panic(err)
+	// as with grep, finding nothing fails unless -fail-if-found turns that
+	// around.
+	if found := countMatches(res) > 0; found == *flagFailIfFound {
+		os.Exit(exitFailed)
 	}
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hound-search/hound/client"
+)
+
+const scanUsage = `usage: hound scan -rules <file> [flags]
+
+Search for each rule of the file in the indexed repos and report what was
+found. Exits with 1 when a rule of error severity is found and 2 when the
+scan, or any of its rules, fails.
+
+Flags:
+`
+
+func writeReportTo(filename string, rep *client.ScanReport, format string) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := client.WriteScanReport(w, rep, format); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Run hound scan with the arguments that follow it.
+func scanMain(args []string) {
+	fs := flag.NewFlagSet("hound scan", flag.ExitOnError)
+	flagConfig := fs.String("config", "", "A config file to read the host, access key and http headers from, in place of /etc/hound.conf and ~/.hound")
+	flagHost := fs.String("host", defaultFlagForHost(), "The address of houndd, with an optional http:// or https://, or $HOUND_HOST")
+	flagKey := fs.String("key", "", "The access key to send, or $HOUND_ACCESS_KEY")
+	flagRules := fs.String("rules", "", "The YAML or JSON file of rules to scan for")
+	flagRepos := fs.String("repos", "", "Comma separated repos to scan, in place of those of the rules file")
+	flagTags := fs.String("tags", "", "Comma separated tags, in place of those of the rules file")
+	flagFormat := fs.String("format", "text", "The report format: "+strings.Join(client.ScanFormats, ", "))
+	flagOutput := fs.String("output", "", "A file to write the report to, in place of stdout")
+	flagMaxMatches := fs.Int("max-matches", 1000, "The most findings to report for each rule, 0 for no limit")
+
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), scanUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args) //nolint
+
+	if *flagRules == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+
+	known := false
+	for _, f := range client.ScanFormats {
+		known = known || f == *flagFormat
+	}
+
+	if !known {
+		fail(fmt.Errorf("unknown format: %q, expected %s", *flagFormat, strings.Join(client.ScanFormats, ", ")))
+	}
+
+	b, err := ioutil.ReadFile(*flagRules)
+	if err != nil {
+		fail(err)
+	}
+
+	rs, err := client.ParseRules(b)
+	if err != nil {
+		fail(fmt.Errorf("%s: %s", *flagRules, err))
+	}
+
+	if *flagRepos != "" {
+		rs.Repos = *flagRepos
+	}
+
+	if *flagTags != "" {
+		rs.Tags = *flagTags
+	}
+
+	cfg, err := loadClientConfig(fs, *flagConfig, *flagHost, *flagKey)
+	if err != nil {
+		fail(err)
+	}
+
+	rep, err := client.Scan(cfg, rs, *flagMaxMatches)
+	if err != nil {
+		fail(err)
+	}
+
+	if *flagOutput == "" {
+		err = client.WriteScanReport(os.Stdout, rep, *flagFormat)
+	} else {
+		err = writeReportTo(*flagOutput, rep, *flagFormat)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	// the text on stdout already tells why rules failed.
+	if *flagFormat != "text" || *flagOutput != "" {
+		for name, err := range rep.Errors {
+			fmt.Fprintf(os.Stderr, "hound: rule %s: %s\n", name, err)
+		}
+	}
+
+	// a rule that couldn't be searched for leaves the policy unchecked,
+	// which is worse than a violation of it.
+
+	switch {
+	case len(rep.Errors) > 0:
+		os.Exit(exitError)
+	case rep.Failed():
+		os.Exit(exitFailed)
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: houndctl [flags] <command> [args]
+
+Commands:
+  repos list                  list the repos
+  repos pause <repo>          pause the updates of a repo
+  repos resume <repo>         resume the updates of a repo
+  repos apply <file>          pause, resume, update or reindex many repos
+                              at once, from a JSON file of operations or -
+  update [-wait] <repo>...    pull repos, waiting until they are indexed
+                              with -wait
+  reindex <repo>...           rebuild repos from a fresh clone
+  status [repo...]            show the state of the indexes of repos
+  config                      print the config houndd loaded, without its
+                              secrets
+  tokens list                 list the access keys
+  tokens create [flags] <name>
+                              create an access key, printing it once
+  tokens delete <name>        delete an access key
+
+Repos are added and removed in the config of houndd, which it reads when it
+starts.
+
+Flags:
+`
+
+// Talks to the API of a running houndd.
+type client struct {
+	host string
+	key  string
+	http *http.Client
+}
+
+// The error of an API response that isn't ok.
+type apiError struct {
+	Error string
+}
+
+// Send a request to the API and decode its JSON response into res, unless
+// res is nil.
+func (c *client) do(method, path string, vals url.Values, res interface{}) error {
+	u := c.host + path
+	// only the form values of a POST are read from its body.
+	var body io.Reader
+	if method == "POST" {
+		body = strings.NewReader(vals.Encode())
+	} else if len(vals) > 0 {
+		u += "?" + vals.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.send(req, res)
+}
+
+// Post the JSON body to the API and decode its JSON response into res.
+func (c *client) postJson(path string, body []byte, res interface{}) error {
+	req, err := http.NewRequest("POST", c.host+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return c.send(req, res)
+}
+
+// Send the request with the access key, returning the error of a response
+// that isn't ok.
+func (c *client) send(req *http.Request, res interface{}) error {
+	method, path := req.Method, req.URL.Path
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// the request id finds the request in the logs of houndd.
+	var e apiError
+	if json.Unmarshal(b, &e) == nil && e.Error != "" {
+		return fmt.Errorf("%s (request %s)", e.Error, resp.Header.Get("X-Request-ID"))
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: %s (request %s)", method, path, resp.Status, resp.Header.Get("X-Request-ID"))
+	}
+
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(b, res)
+}
+
+// Print v as indented JSON, for scripts.
+func printJson(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func reposCmd(c *client, args []string, asJson bool) error {
+	if len(args) == 0 {
+		return errors.New("repos: expected list, pause, resume or apply")
+	}
+
+	switch args[0] {
+	case "list":
+		var res map[string]json.RawMessage
+		if err := c.do("GET", "/api/v1/repos", nil, &res); err != nil {
+			return err
+		}
+
+		if asJson {
+			return printJson(res)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tVCS\tURL")
+		for _, name := range sortedKeys(res) {
+			var repo struct {
+				Url string `json:"url"`
+				Vcs string `json:"vcs"`
+			}
+			if err := json.Unmarshal(res[name], &repo); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, repo.Vcs, repo.Url)
+		}
+		return w.Flush()
+	case "pause", "resume":
+		if len(args) != 2 {
+			return fmt.Errorf("repos %s: expected a repo", args[0])
+		}
+
+		var st json.RawMessage
+		path := "/api/v1/admin/repos/" + url.PathEscape(args[1]) + "/" + args[0]
+		if err := c.do("POST", path, nil, &st); err != nil {
+			return err
+		}
+
+		if asJson {
+			return printJson(st)
+		}
+		fmt.Printf("%sd %s\n", args[0], args[1])
+		return nil
+	case "apply":
+		if len(args) != 2 {
+			return errors.New("repos apply: expected a file of operations, or - for stdin")
+		}
+		return applyCmd(c, args[1], asJson)
+	case "add", "remove":
+		return fmt.Errorf("repos %s: repos are added and removed in the config of houndd, which it reads when it starts", args[0])
+	}
+	return fmt.Errorf("repos: unknown command %q", args[0])
+}
+
+// Send the operations in the file to the bulk endpoint and print the
+// outcome for each repo, failing if any of them failed.
+func applyCmd(c *client, filename string, asJson bool) error {
+	var b []byte
+	var err error
+	if filename == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Results []*struct {
+			Action string
+			Repo   string
+			Ok     bool
+			Error  string
+		}
+		Failed int
+	}
+	if err := c.postJson("/api/v1/admin/repos", b, &res); err != nil {
+		return err
+	}
+
+	if asJson {
+		if err := printJson(&res); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tREPO\tRESULT")
+		for _, r := range res.Results {
+			result := "ok"
+			if !r.Ok {
+				result = r.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Action, r.Repo, result)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if res.Failed > 0 {
+		return fmt.Errorf("repos apply: %d of %d operations failed", res.Failed, len(res.Results))
+	}
+	return nil
+}
+
+// The state of an update job, as reported by /api/v1/jobs/{id}.
+type job struct {
+	Id    string
+	State string
+	Repos map[string]*struct {
+		State string
+		Rev   string
+		Error string
+	}
+}
+
+func updateCmd(c *client, args []string, asJson bool) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "Wait until the repos are pulled and indexed, failing if any of them fails")
+	maxWait := fs.Duration("max-wait", 10*time.Minute, "The longest to wait with -wait")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("update: expected repos")
+	}
+
+	repos := strings.Join(fs.Args(), ",")
+	if !*wait {
+		if err := c.do("POST", "/api/v1/update", url.Values{"repos": {repos}}, nil); err != nil {
+			return err
+		}
+
+		fmt.Printf("updating %s\n", strings.Join(fs.Args(), ", "))
+		return nil
+	}
+
+	var j job
+	if err := c.do("POST", "/api/v1/update", url.Values{"repos": {repos}, "async": {"true"}}, &j); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(*maxWait)
+	for j.State == "queued" || j.State == "running" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("update: job %s is still %s after %s", j.Id, j.State, *maxWait)
+		}
+		time.Sleep(time.Second)
+
+		if err := c.do("GET", "/api/v1/jobs/"+j.Id, nil, &j); err != nil {
+			return err
+		}
+	}
+
+	if asJson {
+		if err := printJson(&j); err != nil {
+			return err
+		}
+	} else {
+		names := make([]string, 0, len(j.Repos))
+		for name := range j.Repos {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tSTATE\tREV\tERROR")
+		for _, name := range names {
+			r := j.Repos[name]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, r.State, r.Rev, r.Error)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if j.State != "done" {
+		return fmt.Errorf("update: job %s %s", j.Id, j.State)
+	}
+	return nil
+}
+
+func reindexCmd(c *client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("reindex: expected repos")
+	}
+
+	vals := url.Values{"repos": {strings.Join(args, ",")}}
+	if err := c.do("POST", "/api/v1/reindex", vals, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("reindexing %s\n", strings.Join(args, ", "))
+	return nil
+}
+
+func statusCmd(c *client, args []string, asJson bool) error {
+	vals := url.Values{}
+	if len(args) > 0 {
+		vals.Set("repos", strings.Join(args, ","))
+	}
+
+	var res map[string]json.RawMessage
+	if err := c.do("GET", "/api/v1/status", vals, &res); err != nil {
+		return err
+	}
+
+	if asJson {
+		return printJson(res)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tREV\tFILES\tINDEXED\tSTATE\tLAST ERROR")
+	for _, name := range sortedKeys(res) {
+		var st struct {
+			Rev         string
+			LastIndexed time.Time
+			Files       int
+			Indexing    bool
+			Paused      bool
+			Archived    bool
+			Deleted     bool
+			Unhealthy   bool
+			LastError   string
+		}
+		if err := json.Unmarshal(res[name], &st); err != nil {
+			return err
+		}
+
+		state := "ok"
+		switch {
+		case st.Indexing:
+			state = "indexing"
+		case st.Deleted:
+			state = "deleted"
+		case st.Archived:
+			state = "archived"
+		case st.Paused:
+			state = "paused"
+		case st.Unhealthy:
+			state = "unhealthy"
+		}
+
+		rev := st.Rev
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			name, rev, st.Files, formatTime(&st.LastIndexed), state, st.LastError)
+	}
+	return w.Flush()
+}
+
+func configCmd(c *client) error {
+	var res json.RawMessage
+	if err := c.do("GET", "/api/v1/admin/config", nil, &res); err != nil {
+		return err
+	}
+	return printJson(res)
+}
+
+func tokensCmd(c *client, args []string, asJson bool) error {
+	if len(args) == 0 {
+		return errors.New("tokens: expected list, create or delete")
+	}
+
+	type token struct {
+		Name    string
+		Role    string
+		Scopes  []string
+		Expires *time.Time
+		Created time.Time
+		Tenant  string
+		Key     string
+	}
+
+	switch args[0] {
+	case "list":
+		var res []*token
+		if err := c.do("GET", "/api/v1/admin/tokens", nil, &res); err != nil {
+			return err
+		}
+
+		if asJson {
+			return printJson(res)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tROLE\tSCOPES\tTENANT\tCREATED\tEXPIRES")
+		for _, t := range res {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.Name, t.Role, strings.Join(t.Scopes, ","), t.Tenant, formatTime(&t.Created), formatTime(t.Expires))
+		}
+		return w.Flush()
+	case "create":
+		fs := flag.NewFlagSet("tokens create", flag.ContinueOnError)
+		role := fs.String("role", "", "The role of the key: reader, updater or admin")
+		scopes := fs.String("scopes", "", "Comma separated scopes: search, update or admin")
+		expires := fs.String("expires", "", "When the key expires, as a duration like 720h or an RFC 3339 time")
+		tenant := fs.String("tenant", "", "The tenant the key is bound to")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			return errors.New("tokens create: expected a name")
+		}
+
+		vals := url.Values{
+			"name":    {fs.Arg(0)},
+			"role":    {*role},
+			"scopes":  {*scopes},
+			"expires": {*expires},
+			"tenant":  {*tenant},
+		}
+
+		var t token
+		if err := c.do("POST", "/api/v1/admin/tokens", vals, &t); err != nil {
+			return err
+		}
+
+		if asJson {
+			return printJson(&t)
+		}
+
+		// the key is only ever shown here.
+		fmt.Println(t.Key)
+		return nil
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("tokens delete: expected a name")
+		}
+
+		vals := url.Values{"name": {args[1]}}
+		if err := c.do("DELETE", "/api/v1/admin/tokens", vals, nil); err != nil {
+			return err
+		}
+
+		fmt.Printf("deleted %s\n", args[1])
+		return nil
+	}
+	return fmt.Errorf("tokens: unknown command %q", args[0])
+}
+
+func main() {
+	flagHost := flag.String("host", "localhost:6080", "The address of houndd, with an optional http:// or https://")
+	flagKey := flag.String("key", os.Getenv("HOUND_ACCESS_KEY"), "The access key or admin-token, $HOUND_ACCESS_KEY by default")
+	flagJson := flag.Bool("json", false, "Print the responses as JSON")
+	flagTimeout := flag.Duration("timeout", time.Minute, "How long to wait for a response")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	host := *flagHost
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	c := &client{
+		host: strings.TrimSuffix(host, "/"),
+		key:  *flagKey,
+		http: &http.Client{Timeout: *flagTimeout},
+	}
+
+	var err error
+	args := flag.Args()
+	switch args[0] {
+	case "repos":
+		err = reposCmd(c, args[1:], *flagJson)
+	case "update":
+		err = updateCmd(c, args[1:], *flagJson)
+	case "reindex":
+		err = reindexCmd(c, args[1:])
+	case "status":
+		err = statusCmd(c, args[1:], *flagJson)
+	case "config":
+		err = configCmd(c)
+	case "tokens":
+		err = tokensCmd(c, args[1:], *flagJson)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "houndctl: %s\n", err)
+		os.Exit(1)
+	}
+}
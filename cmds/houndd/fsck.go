@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// Verify every index in the dbpath, writing what was found for each to w,
+// and remove the ones that are corrupt so they are rebuilt the next time
+// houndd starts. It must not run while houndd is serving from the same
+// dbpath. Returns the number of corrupt indexes.
+func fsck(cfg *config.Config, w io.Writer) (int, error) {
+	dirs, err := filepath.Glob(filepath.Join(cfg.DbPath, "idx-*"))
+	if err != nil {
+		return 0, err
+	}
+
+	var corrupt int
+	for _, dir := range dirs {
+		ref, err := index.Read(dir)
+		if err == nil && !ref.HasData() {
+			// only the manifest of an index in the store.
+			continue
+		}
+
+		if err == nil {
+			err = ref.Verify()
+		}
+
+		if err == nil {
+			fmt.Fprintf(w, "%s: ok (%s at %s)\n", filepath.Base(dir), ref.Url, ref.Rev)
+			continue
+		}
+
+		corrupt++
+		fmt.Fprintf(w, "%s: corrupt, removing: %s\n", filepath.Base(dir), err)
+		if err := ref.Remove(); err != nil {
+			return corrupt, err
+		}
+	}
+	return corrupt, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/hound-search/hound/api"
@@ -22,7 +24,7 @@ import (
 	"github.com/hound-search/hound/web"
 )
 
-const gracefulShutdownSignal = syscall.SIGTERM
+var gracefulShutdownSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
 
 var (
 	info_log   *log.Logger
@@ -31,7 +33,7 @@ var (
 	basepath   = filepath.Dir(b)
 )
 
-func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, error) {
+func makeSearchers(cfg *config.Config, progress *searcher.Progress) (map[string]*searcher.Searcher, bool, error) {
 	// Ensure we have a dbpath
 	if _, err := os.Stat(cfg.DbPath); err != nil {
 		if err := os.MkdirAll(cfg.DbPath, os.ModePerm); err != nil {
@@ -39,7 +41,7 @@ func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, err
 		}
 	}
 
-	searchers, errs, err := searcher.MakeAll(cfg)
+	searchers, errs, err := searcher.MakeAll(cfg, progress)
 	if err != nil {
 		return nil, false, err
 	}
@@ -57,25 +59,61 @@ func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, err
 	return searchers, true, nil
 }
 
-func handleShutdown(shutdownCh <-chan os.Signal, searchers map[string]*searcher.Searcher) {
+// Once a shutdown signal arrives, stop taking requests and polling repos,
+// then wait for the searches in flight and the index builds under way to
+// finish, or for the timeout, before exiting.
+func handleShutdown(
+	shutdownCh <-chan os.Signal,
+	ws *web.Server,
+	searchers map[string]*searcher.Searcher,
+	timeout time.Duration) {
 	go func() {
-		<-shutdownCh
-		info_log.Printf("Graceful shutdown requested...")
+		sig := <-shutdownCh
+		info_log.Printf("Graceful shutdown requested by %s...", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
 		for _, s := range searchers {
 			s.Stop()
 		}
 
-		for _, s := range searchers {
-			s.Wait()
+		if err := ws.Shutdown(ctx); err != nil {
+			error_log.Printf("Failed to drain connections: %s", err)
 		}
 
-		os.Exit(0)
+		done := make(chan struct{})
+		go func() {
+			for _, s := range searchers {
+				s.Wait()
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			info_log.Printf("Shutdown complete")
+			os.Exit(0)
+		case <-ctx.Done():
+			error_log.Printf("Timed out after %s waiting for index builds to finish", timeout)
+			os.Exit(1)
+		}
 	}()
 }
 
+// Periodically resolve the secret references in the config again so the
+// next poll of each repo uses rotated secrets.
+func refreshSecrets(cfg *config.Config, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := cfg.RefreshSecrets(); err != nil {
+			error_log.Printf("Failed to refresh secrets: %s", err)
+		}
+	}
+}
+
 func registerShutdownSignal() <-chan os.Signal {
 	shutdownCh := make(chan os.Signal, 1)
-	signal.Notify(shutdownCh, gracefulShutdownSignal)
+	signal.Notify(shutdownCh, gracefulShutdownSignals...)
 	return shutdownCh
 }
 
@@ -105,13 +143,17 @@ func runHttp( //nolint
 	idx map[string]*searcher.Searcher) error {
 	m := http.DefaultServeMux
 
-	h, err := ui.Content(dev, cfg)
+	visible, err := api.Setup(m, idx, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	h, err := ui.Content(dev, cfg, visible)
 	if err != nil {
 		return err
 	}
 
 	m.Handle("/", h)
-	api.Setup(m, idx)
 	return http.ListenAndServe(addr, m)
 }
 
@@ -133,6 +175,11 @@ func main() {
 	flagAddr := flag.String("addr", ":6080", "")
 	flagDev := flag.Bool("dev", false, "")
 	flagVer := flag.Bool("version", false, "Display version and exit")
+	flagValidate := flag.Bool("validate-config", false, "Check the config for problems and exit")
+	flagLive := flag.Bool("validate-live", false, "With -validate-config, also check that repos and storage can be reached")
+	flagDebugAddr := flag.String("debug-addr", "", "Serve pprof and runtime stats without auth on this address, e.g. localhost:6060")
+	flagFsck := flag.Bool("fsck", false, "Verify the indexes in the dbpath, remove the corrupt ones so they are rebuilt, and exit")
+	flagShutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for searches and index builds to finish on shutdown")
 
 	flag.Parse()
 
@@ -142,17 +189,62 @@ func main() {
 	}
 
 	var cfg config.Config
+	if *flagValidate {
+		if err := cfg.LoadFromFile(*flagConf); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *flagConf, err)
+			os.Exit(1)
+		}
+
+		errs := validateConfig(&cfg, *flagLive)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *flagConf, err)
+		}
+
+		if len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "%d problems found\n", len(errs))
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", *flagConf)
+		os.Exit(0)
+	}
+
 	if err := cfg.LoadFromFile(*flagConf); err != nil {
 		panic(err)
 	}
 
+	if *flagFsck {
+		n, err := fsck(&cfg, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fsck: %s\n", err)
+			os.Exit(1)
+		}
+
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "%d corrupt indexes removed\n", n)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// The debug listener is up while the indexes are first built, which is
+	// when memory use tends to peak.
+	if *flagDebugAddr != "" {
+		go func() {
+			error_log.Println(http.ListenAndServe(*flagDebugAddr, api.DebugHandler()))
+		}()
+	}
+
 	// Start the web server on a background routine.
-	ws := web.Start(&cfg, *flagAddr, *flagDev)
+	ws, err := web.Start(&cfg, *flagAddr, *flagDev)
+	if err != nil {
+		panic(err)
+	}
 
 	// It's not safe to be killed during makeSearchers, so register the
 	// shutdown signal here and defer processing it until we are ready.
 	shutdownCh := registerShutdownSignal()
-	idx, ok, err := makeSearchers(&cfg)
+	idx, ok, err := makeSearchers(&cfg, ws.Progress())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -162,7 +254,11 @@ func main() {
 		info_log.Println("All indexes built!")
 	}
 
-	handleShutdown(shutdownCh, idx)
+	handleShutdown(shutdownCh, ws, idx, *flagShutdownTimeout)
+
+	if d := cfg.SecretsRefreshInterval(); d > 0 {
+		go refreshSecrets(&cfg, d)
+	}
 
 	host := *flagAddr
 	if strings.HasPrefix(host, ":") { //nolint
@@ -181,8 +277,17 @@ func main() {
 		}
 	}
 
-	info_log.Printf("running server at http://%s\n", host)
+	scheme := "http"
+	if cfg.TLS != nil {
+		scheme = "https"
+	}
+	info_log.Printf("running server at %s://%s\n", scheme, host)
 
 	// Fully enable the web server now that we have indexes
-	panic(ws.ServeWithIndex(idx))
+	if err := ws.ServeWithIndex(idx); err != http.ErrServerClosed {
+		panic(err)
+	}
+
+	// the server is closed by a shutdown, which exits once it completes.
+	select {}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hound-search/hound/api"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/notify"
+	"github.com/hound-search/hound/storage"
+	"github.com/hound-search/hound/vcs"
+	"github.com/hound-search/hound/web"
+)
+
+// The number of repos whose remotes are checked at once.
+const maxConcurrentRemoteChecks = 8
+
+// Check that the remote of each repo can be read, for the drivers that are
+// able to check without cloning.
+func checkRemotes(cfg *config.Config) []error {
+	names := make([]string, 0, len(cfg.Repos))
+	for name := range cfg.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, maxConcurrentRemoteChecks)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		repo := cfg.Repos[name]
+		wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+		if err != nil {
+			// already reported by cfg.Validate.
+			continue
+		}
+
+		rc, ok := wd.Driver.(vcs.RemoteChecker)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := rc.CheckRemote(repo.CloneUrl()); err != nil {
+				errs[i] = fmt.Errorf("repos.%s: %s", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var res []error
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
+
+// Check the config for problems, returning all of them. With live set, the
+// remotes of repos and the storage backend are also contacted.
+func validateConfig(cfg *config.Config, live bool) []error {
+	errs := cfg.Validate()
+	errs = append(errs, api.Validate(cfg)...)
+	errs = append(errs, notify.Validate(cfg.Notifications)...)
+
+	if err := web.ValidateTLS(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %s", err))
+	}
+
+	store, err := storage.New(cfg.StorageConfig())
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if !live {
+		return errs
+	}
+
+	if store != nil {
+		if _, err := store.List(""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return append(errs, checkRemotes(cfg)...)
+}
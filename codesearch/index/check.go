@@ -0,0 +1,132 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+// Check reads the index file and verifies its structure: the header and
+// trailer, the offsets of its sections, the names of the files and every
+// posting list. Unlike Open, which exits when an index is corrupt, it
+// returns an error describing the first problem found.
+func Check(file string) error {
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if len(d) < len(magic)+5*4+len(trailerMagic) || string(d[:len(magic)]) != magic {
+		return fmt.Errorf("%s: bad header", file)
+	}
+
+	if string(d[len(d)-len(trailerMagic):]) != trailerMagic {
+		return fmt.Errorf("%s: bad trailer", file)
+	}
+
+	n := uint32(len(d) - len(trailerMagic) - 5*4)
+	var off [5]uint32
+	for i := range off {
+		off[i] = binary.BigEndian.Uint32(d[n+uint32(4*i):])
+	}
+
+	// the sections are in order: paths, names, posting lists, name index
+	// and posting list index.
+	pathData, nameData, postData, nameIndex, postIndex := off[0], off[1], off[2], off[3], off[4]
+	prev := uint32(len(magic))
+	for _, o := range off {
+		if o < prev || o > n {
+			return fmt.Errorf("%s: bad section offsets", file)
+		}
+		prev = o
+	}
+
+	if err := checkStrings(d[pathData:nameData]); err != nil {
+		return fmt.Errorf("%s: paths: %s", file, err)
+	}
+
+	if (postIndex-nameIndex)%4 != 0 || (n-postIndex)%postEntrySize != 0 {
+		return fmt.Errorf("%s: bad index sizes", file)
+	}
+
+	numName := int((postIndex-nameIndex)/4) - 1
+	if numName < 0 {
+		return fmt.Errorf("%s: bad name index", file)
+	}
+
+	names := d[nameData:postData]
+	for i := 0; i < numName; i++ {
+		o := binary.BigEndian.Uint32(d[nameIndex+uint32(4*i):])
+		if o >= uint32(len(names)) || bytes.IndexByte(names[o:], 0) < 0 {
+			return fmt.Errorf("%s: bad name %d", file, i)
+		}
+	}
+
+	posts := d[postData:nameIndex]
+	numPost := int((n - postIndex) / postEntrySize)
+	var last uint32
+	for i := 0; i < numPost; i++ {
+		e := d[postIndex+uint32(i*postEntrySize):]
+		trigram := uint32(e[0])<<16 | uint32(e[1])<<8 | uint32(e[2])
+		count := binary.BigEndian.Uint32(e[3:])
+		o := binary.BigEndian.Uint32(e[3+4:])
+		if i > 0 && trigram <= last {
+			return fmt.Errorf("%s: posting lists out of order", file)
+		}
+		last = trigram
+
+		if err := checkPostingList(posts, o, trigram, count, numName); err != nil {
+			return fmt.Errorf("%s: posting list %#x: %s", file, trigram, err)
+		}
+	}
+	return nil
+}
+
+// Check a sequence of NUL terminated strings that ends with an empty one.
+func checkStrings(d []byte) error {
+	for len(d) > 0 {
+		i := bytes.IndexByte(d, 0)
+		if i < 0 {
+			return fmt.Errorf("unterminated string")
+		}
+		if i == 0 {
+			return nil
+		}
+		d = d[i+1:]
+	}
+	return fmt.Errorf("unterminated list")
+}
+
+// Check that the posting list at off is for the trigram and has count file
+// ids, all of them below numName.
+func checkPostingList(posts []byte, off, trigram, count uint32, numName int) error {
+	if uint64(off)+3 > uint64(len(posts)) {
+		return fmt.Errorf("bad offset")
+	}
+
+	p := posts[off:]
+	if uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2]) != trigram {
+		return fmt.Errorf("trigram mismatch")
+	}
+	p = p[3:]
+
+	fileid := ^uint32(0)
+	for i := uint32(0); i < count; i++ {
+		delta, n := binary.Uvarint(p)
+		if n <= 0 || delta == 0 {
+			return fmt.Errorf("bad delta")
+		}
+		p = p[n:]
+
+		fileid += uint32(delta)
+		if int(fileid) >= numName {
+			return fmt.Errorf("bad file id %d", fileid)
+		}
+	}
+
+	if delta, n := binary.Uvarint(p); n <= 0 || delta != 0 {
+		return fmt.Errorf("unterminated")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, []string{"/a", "/b"}, postFiles)
+
+	if err := Check(out); err != nil {
+		t.Fatalf("Check of a good index = %v", err)
+	}
+
+	good, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// damage the header, a posting list and the trailer in turn.
+	for _, off := range []int{0, len(good) / 2, len(good) - 1} {
+		bad := append([]byte{}, good...)
+		bad[off] ^= 0xff
+		if err := ioutil.WriteFile(out, bad, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Check(out); err == nil {
+			t.Errorf("Check with byte %d damaged = nil, want an error", off)
+		}
+	}
+
+	if err := ioutil.WriteFile(out, good[:len(good)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Check(out); err == nil {
+		t.Errorf("Check of a truncated index = nil, want an error")
+	}
+}
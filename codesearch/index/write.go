@@ -118,6 +118,12 @@ func (ix *IndexWriter) AddFile(name string) {
 	ix.Add(name, f)
 }
 
+// NumNames returns the number of files added to the index so far, which
+// is the file id the next file added will have.
+func (ix *IndexWriter) NumNames() int {
+	return ix.numName
+}
+
 // Add adds the file f to the index under the given name.
 // It logs errors using package log.
 func (ix *IndexWriter) Add(name string, f io.Reader) string {
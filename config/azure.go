@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultAzureDevOpsUrl = "https://dev.azure.com"
+
+// Links to files in Azure Repos, which takes the path and the commit as
+// query parameters rather than in the path.
+var azureDevOpsUrlPattern = &UrlPattern{
+	BaseUrl: "{url}?path=/{path}&version=GC{rev}{anchor}",
+	Anchor:  "&line={line}",
+}
+
+// Options for adding the git repositories of an Azure DevOps organization,
+// or of one of its projects, to the repos. Url is only needed for Azure
+// DevOps Server.
+type AzureDevOpsConfig struct {
+	Organization string `json:"organization"`
+	Project      string `json:"project"`
+	Pat          string `json:"pat"`
+	Url          string `json:"url"`
+}
+
+type azureDevOpsRepo struct {
+	Name          string `json:"name"`
+	RemoteUrl     string `json:"remoteUrl"`
+	WebUrl        string `json:"webUrl"`
+	DefaultBranch string `json:"defaultBranch"`
+	IsDisabled    bool   `json:"isDisabled"`
+	Project       struct {
+		Name string `json:"name"`
+	} `json:"project"`
+}
+
+// The name of the repo that a repository of an Azure DevOps project is
+// added as.
+func AzureDevOpsRepoName(project, repo string) string {
+	return project + "/" + repo
+}
+
+func parseAzureDevOpsConfig(msg *SecretMessage) (*AzureDevOpsConfig, error) {
+	var vals map[string]interface{}
+	if err := json.Unmarshal(*msg, &vals); err != nil {
+		return nil, err
+	}
+
+	if _, err := resolveCredentials(vals); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	var c AzureDevOpsConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	if c.Organization == "" || c.Pat == "" {
+		return nil, errors.New("organization and pat are required")
+	}
+
+	if c.Url == "" {
+		c.Url = defaultAzureDevOpsUrl
+	}
+
+	return &c, nil
+}
+
+// List the git repositories of the organization, or of the project if one
+// is set.
+func (c *AzureDevOpsConfig) repositories() ([]*azureDevOpsRepo, error) {
+	u := strings.TrimRight(c.Url, "/") + "/" + url.PathEscape(c.Organization)
+	if c.Project != "" {
+		u += "/" + url.PathEscape(c.Project)
+	}
+	u += "/_apis/git/repositories?api-version=6.0"
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("", c.Pat)
+
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	var list struct {
+		Value []*azureDevOpsRepo `json:"value"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Value, nil
+}
+
+// Build the repo for a repository, applying the repo-defaults of the config.
+func (c *Config) azureDevOpsRepo(ar *azureDevOpsRepo, pat string) (*Repo, error) {
+	vals := map[string]interface{}{
+		"url":         ar.WebUrl,
+		"url-pattern": azureDevOpsUrlPattern,
+	}
+
+	if ref := strings.TrimPrefix(ar.DefaultBranch, "refs/heads/"); ref != "" {
+		vals["vcs-config"] = map[string]interface{}{"ref": ref}
+	}
+
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RepoDefaults != nil {
+		if b, err = mergeDefaults(b, c.RepoDefaults); err != nil {
+			return nil, err
+		}
+	}
+
+	var repo Repo
+	if err := json.Unmarshal(b, &repo); err != nil {
+		return nil, err
+	}
+	initRepo(&repo)
+
+	u, err := url.Parse(ar.RemoteUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.User = url.UserPassword("pat", pat)
+	repo.cloneUrl = u.String()
+
+	return &repo, nil
+}
+
+// Add the git repositories found in Azure DevOps to the repos. Repos that
+// are declared in the config take precedence over those found with the
+// same name, and disabled repositories are skipped. When Azure DevOps can't
+// be reached only the declared repos are searched, so that it being down
+// doesn't keep the server from starting.
+func syncAzureDevOps(c *Config) error {
+	if c.AzureDevOpsMessage == nil {
+		return nil
+	}
+
+	ac, err := parseAzureDevOpsConfig(c.AzureDevOpsMessage)
+	if err != nil {
+		return fmt.Errorf("azure-devops-sync: %s", err)
+	}
+
+	ars, err := ac.repositories()
+	if err != nil {
+		log.Printf("azure-devops-sync: %s, starting with the declared repos", err)
+		return nil
+	}
+
+	if c.Repos == nil {
+		c.Repos = map[string]*Repo{}
+	}
+
+	for _, ar := range ars {
+		name := AzureDevOpsRepoName(ar.Project.Name, ar.Name)
+		if ar.IsDisabled || c.Repos[name] != nil {
+			continue
+		}
+
+		repo, err := c.azureDevOpsRepo(ar, ac.Pat)
+		if err != nil {
+			return fmt.Errorf("azure-devops-sync: %s: %s", name, err)
+		}
+		c.Repos[name] = repo
+	}
+
+	return nil
+}
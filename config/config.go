@@ -1,10 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/redact"
 )
 
 const (
@@ -17,6 +23,15 @@ const (
 	defaultBaseUrl               = "{url}/blob/{rev}/{path}{anchor}"
 	defaultAnchor                = "#L{line}"
 	defaultHealthCheckURI        = "/healthz"
+	defaultSearchHistorySize     = 50
+	defaultBackoffAfterPolls     = 3
+	defaultMsBetweenRetries      = 5000
+	defaultMaxFailures           = 5
+	defaultMaxMappedMB           = 2048
+	defaultBreakerFailures       = 3
+	defaultBreakerTimeoutMs      = 10000
+	defaultBreakerCooldownMs     = 60000
+	defaultMaxSecretAlerts       = 100
 )
 
 type UrlPattern struct {
@@ -24,15 +39,279 @@ type UrlPattern struct {
 	Anchor  string `json:"anchor"`
 }
 
+// Options for indexing revisions from the history of a repo in addition
+// to its head.
+type HistoryConfig struct {
+	Revisions  int    `json:"revisions"`
+	Tags       int    `json:"tags"`
+	TagPattern string `json:"tag-pattern"`
+}
+
 type Repo struct {
 	Url               string         `json:"url"`
+	DisplayName       string         `json:"display-name,omitempty"`
+	Description       string         `json:"description,omitempty"`
+	Tags              []string       `json:"tags,omitempty"`
 	MsBetweenPolls    int            `json:"ms-between-poll"`
 	Vcs               string         `json:"vcs"`
 	VcsConfigMessage  *SecretMessage `json:"vcs-config"`
 	UrlPattern        *UrlPattern    `json:"url-pattern"`
+	LinkStyle         string         `json:"link-style,omitempty"`
 	ExcludeDotFiles   bool           `json:"exclude-dot-files"`
+	ExcludeIgnored    bool           `json:"exclude-ignored-files"`
+	ExcludeVendored   bool           `json:"exclude-vendored-files"`
+	VendoredPaths     []string       `json:"vendored-paths"`
+	IncludePaths      []string       `json:"include-paths"`
+	ExcludePaths      []string       `json:"exclude-paths"`
+	MaxFileSize       int64          `json:"max-file-size"`
+	ExcludeMinified   bool           `json:"exclude-minified-files"`
+	Encodings         []string       `json:"encodings,omitempty"`
+	History           *HistoryConfig `json:"index-history"`
+	IndexCommits      int            `json:"index-commits"`
 	EnablePollUpdates *bool          `json:"enable-poll-updates"`
 	EnablePushUpdates *bool          `json:"enable-push-updates"`
+
+	// The tenant the repo belongs to. Only the access keys and users of the
+	// tenant, and admins, may access it.
+	Tenant string `json:"tenant,omitempty"`
+
+	// The slash separated directory of the clone that is indexed as this
+	// repo, so that repos of the subdirectories of a monorepo share one
+	// clone of its url.
+	Subdir string `json:"subdir,omitempty"`
+
+	// Whether the indexes and clone of the repo are removed when a webhook
+	// tells that it was deleted upstream, rather than kept searchable.
+	RemoveWhenDeleted bool `json:"remove-when-deleted,omitempty"`
+
+	// Repos that don't change in BackoffAfterPolls polls in a row are
+	// polled half as often, up to MaxMsBetweenPolls apart, until they
+	// change or an update is asked for. Zero turns backing off off.
+	MaxMsBetweenPolls int `json:"max-ms-between-poll,omitempty"`
+	BackoffAfterPolls int `json:"backoff-after-polls,omitempty"`
+
+	// A repo that fails to update is retried MsBetweenRetries later, and
+	// twice as long after each failure in a row, up to MaxMsBetweenRetries,
+	// which defaults to ms-between-poll. After MaxFailures failures in a
+	// row it is reported as unhealthy.
+	MsBetweenRetries    int `json:"ms-between-retries,omitempty"`
+	MaxMsBetweenRetries int `json:"max-ms-between-retries,omitempty"`
+	MaxFailures         int `json:"max-failures,omitempty"`
+
+	// A cron expression of when to poll the repo, like "*/5 * * * *",
+	// which is used in place of ms-between-poll when given.
+	PollSchedule string `json:"poll-schedule,omitempty"`
+
+	// Repos of higher priority are indexed first when more repos need
+	// indexing than max-concurrent-indexers allows at once.
+	Priority int `json:"priority,omitempty"`
+
+	// The name of the repo this one is a fork or mirror of. Searches can
+	// collapse files that are identical in both into the matches of that
+	// repo.
+	ForkOf string `json:"fork-of,omitempty"`
+
+	// the unresolved values of a repo that uses secret references and the
+	// url with those references resolved.
+	secrets     *repoSecrets
+	resolvedUrl string
+
+	// the url with credentials for repos that are found by a sync rather
+	// than declared in the config.
+	cloneUrl string
+}
+
+// Where the audit log of API requests is written, either or both may be
+// set.
+type AuditConfig struct {
+	File string `json:"file"`
+	Url  string `json:"url"`
+}
+
+// A webhook that is told when repos are indexed or fail to update. Format
+// is one of "json", the default, "slack" or "teams". Events limits which
+// events are sent, none means all of them.
+type NotificationConfig struct {
+	Url    string   `json:"url"`
+	Format string   `json:"format"`
+	Events []string `json:"events"`
+}
+
+// Keeps the most recent searches of each access key or user, Size of them,
+// so they can be recalled.
+type SearchHistoryConfig struct {
+	Size int `json:"size"`
+}
+
+// Leaves repos whose index failed Failures searches in a row out of
+// searches of many repos for CooldownMs. Searches of many repos go on
+// without the repos that take longer than TimeoutMs.
+type SearchBreakerConfig struct {
+	Failures   int `json:"failures"`
+	TimeoutMs  int `json:"timeout-ms"`
+	CooldownMs int `json:"cooldown-ms"`
+}
+
+// The options of searches whose requests leave them out, so they can be
+// tuned for a deployment: the lines of context around each match, whether
+// case is ignored, the most matching lines to return, zero for no limit,
+// and globs of file paths that aren't searched, as excludePaths takes them.
+type SearchDefaultsConfig struct {
+	Context      *int     `json:"context,omitempty"`
+	IgnoreCase   bool     `json:"ignore-case,omitempty"`
+	MaxMatches   int      `json:"max-matches,omitempty"`
+	ExcludePaths []string `json:"exclude-paths,omitempty"`
+}
+
+// Hides secrets, such as access keys committed by mistake, in the lines
+// searches return. The text that any of the Patterns matches is masked,
+// along with that of the built in rules for common secrets unless
+// BuiltinRules is false.
+type RedactionConfig struct {
+	Patterns     []string `json:"patterns,omitempty"`
+	BuiltinRules *bool    `json:"builtin-rules,omitempty"`
+}
+
+// Are the built in rules for common secrets applied?
+func (r *RedactionConfig) BuiltinRulesEnabled() bool {
+	return optionToBool(r.BuiltinRules, true)
+}
+
+// Scans the files that changed in each new index of a repo for secrets and
+// raises a secret-found notification for each file and kind of secret, up
+// to MaxAlerts for an index. Patterns are named rules of its own, which
+// are used along with the built in rules of redaction unless BuiltinRules
+// is false.
+type SecretScanningConfig struct {
+	Patterns     map[string]string `json:"patterns,omitempty"`
+	BuiltinRules *bool             `json:"builtin-rules,omitempty"`
+	MaxAlerts    int               `json:"max-alerts,omitempty"`
+}
+
+// The rules to scan with: the built in ones, when they are enabled, then
+// the patterns in the order of their names.
+func (s *SecretScanningConfig) Rules() []redact.Rule {
+	var rules []redact.Rule
+	if optionToBool(s.BuiltinRules, true) {
+		rules = append(rules, redact.Builtin...)
+	}
+
+	names := make([]string, 0, len(s.Patterns))
+	for name := range s.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rules = append(rules, redact.Rule{Name: name, Pattern: s.Patterns[name]})
+	}
+	return rules
+}
+
+// Thresholds past which the detailed health check reports an unhealthy
+// server: a repo that hasn't updated for MaxStalenessMs and less than
+// MinFreeMB of disk space under the dbpath. Zero turns a check off.
+type HealthCheckConfig struct {
+	MaxStalenessMs int   `json:"max-staleness-ms"`
+	MinFreeMB      int64 `json:"min-free-mb"`
+}
+
+// Options for the upkeep of the dbpath. Every GcIntervalMs the directories
+// no repo uses any more are removed and every VerifyIntervalMs the indexes
+// are verified. While the dbpath takes more than MaxSizeMB, no history
+// indexes are built. Zero is no limit.
+type DiskConfig struct {
+	GcIntervalMs     int   `json:"gc-interval-ms"`
+	VerifyIntervalMs int   `json:"verify-interval-ms"`
+	MaxSizeMB        int64 `json:"max-size-mb"`
+}
+
+// An organization served by the same server as others, whose access keys
+// and users only see its own repos. Its requests are limited to the given
+// number of searches a minute and updates an hour, zero is no limit, and
+// the searches of its keys and users together to its search quota.
+type TenantConfig struct {
+	MaxSearchesPerMinute int `json:"max-searches-per-minute"`
+	MaxUpdatesPerHour    int `json:"max-updates-per-hour"`
+	SearchQuota
+}
+
+// Limits on the searches made in an hour and in a day, and on the files
+// they open, zero is no limit.
+type SearchQuota struct {
+	SearchesPerHour    int64 `json:"searches-per-hour"`
+	SearchesPerDay     int64 `json:"searches-per-day"`
+	FilesOpenedPerHour int64 `json:"files-opened-per-hour"`
+	FilesOpenedPerDay  int64 `json:"files-opened-per-day"`
+}
+
+// The search quotas of access keys and users by name, and the default for
+// those that aren't listed. Admins have no quota.
+type SearchQuotasConfig struct {
+	Default *SearchQuota            `json:"default"`
+	Keys    map[string]*SearchQuota `json:"keys"`
+}
+
+// Options for serving HTTPS. With a client CA, clients must present a
+// certificate signed by it unless ClientAuth is "optional".
+type TLSConfig struct {
+	CertFile     string `json:"cert-file"`
+	KeyFile      string `json:"key-file"`
+	ClientCAFile string `json:"client-ca-file"`
+	ClientAuth   string `json:"client-auth"`
+}
+
+// Addresses and CIDRs that may, or may not, use the API. An address that
+// is denied is rejected, otherwise it must be allowed when Allow is set.
+type IPRules struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Rules for the whole API along with rules for groups of its routes, which
+// apply in addition to them.
+type IPFilterConfig struct {
+	IPRules
+	Groups map[string]*IPRules `json:"groups"`
+}
+
+// Options for trusting the identity of users given in headers by an
+// authenticating reverse proxy.
+type ProxyAuthConfig struct {
+	UserHeader     string           `json:"user-header"`
+	GroupsHeader   string           `json:"groups-header"`
+	TrustedProxies []string         `json:"trusted-proxies"`
+	Rules          []*ProxyAuthRule `json:"rules"`
+}
+
+// Grants the users and members of the groups a role on the repos. Repos are
+// globs of repo names, none means every repo. With a tenant, they are bound
+// to it and only access its repos.
+type ProxyAuthRule struct {
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"`
+	Repos  []string `json:"repos"`
+	Role   string   `json:"role"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// Options for accepting JSON Web Tokens signed by a key from a JWKS as
+// bearer tokens.
+type JWTAuthConfig struct {
+	JwksUrl  string         `json:"jwks-url"`
+	Issuer   string         `json:"issuer"`
+	Audience string         `json:"audience"`
+	Rules    []*JWTAuthRule `json:"rules"`
+}
+
+// Grants tokens whose claims have one of the listed values, for every
+// listed claim, a role on the repos. Repos are globs of repo names, none
+// means every repo. With a tenant, they are bound to it as with proxy-auth.
+type JWTAuthRule struct {
+	Claims map[string][]string `json:"claims"`
+	Repos  []string            `json:"repos"`
+	Role   string              `json:"role"`
+	Tenant string              `json:"tenant,omitempty"`
 }
 
 // Used for interpreting the config value for fields that use *bool. If a value
@@ -44,6 +323,18 @@ func optionToBool(val *bool, def bool) bool {
 	return *val
 }
 
+// Determine whether the repo has any of the tags.
+func (r *Repo) HasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range r.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Are polling based updates enabled on this repo?
 func (r *Repo) PollUpdatesEnabled() bool {
 	return optionToBool(r.EnablePollUpdates, defaultPollEnabled)
@@ -60,7 +351,36 @@ type Config struct {
 	Repos                 map[string]*Repo          `json:"repos"`
 	MaxConcurrentIndexers int                       `json:"max-concurrent-indexers"`
 	HealthCheckURI        string                    `json:"health-check-uri"`
+	HealthCheck           *HealthCheckConfig        `json:"health-check"`
+	Disk                  *DiskConfig               `json:"disk"`
+	MaxFileSize           int64                     `json:"max-file-size"`
+	MaxMappedMB           int64                     `json:"max-mapped-mb"`
+	MaxLineLength         int                       `json:"max-line-length,omitempty"`
 	VCSConfigMessages     map[string]*SecretMessage `json:"vcs-config"`
+	SecretsMessage        *SecretMessage            `json:"secrets"`
+	AdminToken            string                    `json:"admin-token"`
+	RequireAccessKeys     bool                      `json:"require-access-keys"`
+	AuditLog              *AuditConfig              `json:"audit-log"`
+	Notifications         []*NotificationConfig     `json:"notifications"`
+	SearchHistory         *SearchHistoryConfig      `json:"search-history"`
+	SearchBreaker         *SearchBreakerConfig      `json:"search-breaker,omitempty"`
+	SearchDefaults        *SearchDefaultsConfig     `json:"search-defaults,omitempty"`
+	Redaction             *RedactionConfig          `json:"redaction,omitempty"`
+	SecretScanning        *SecretScanningConfig     `json:"secret-scanning,omitempty"`
+	ProxyAuth             *ProxyAuthConfig          `json:"proxy-auth"`
+	JWTAuth               *JWTAuthConfig            `json:"jwt-auth"`
+	TLS                   *TLSConfig                `json:"tls"`
+	IPFilter              *IPFilterConfig           `json:"ip-filter"`
+	StorageMessage        *SecretMessage            `json:"storage"`
+	AzureDevOpsMessage    *SecretMessage            `json:"azure-devops-sync"`
+	RepoDefaults          json.RawMessage           `json:"repo-defaults"`
+	Tenants               map[string]*TenantConfig  `json:"tenants,omitempty"`
+	SearchQuotas          *SearchQuotasConfig       `json:"search-quotas,omitempty"`
+
+	secrets *SecretsConfig
+
+	// the admin-token with its secret references resolved, when it has any.
+	adminToken string
 }
 
 // SecretMessage is just like json.RawMessage but it will not
@@ -82,43 +402,117 @@ func (s *SecretMessage) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Get the JSON encoded storage config. This returns nil if the config
+// doesn't declare a storage backend.
+func (c *Config) StorageConfig() []byte {
+	if c.StorageMessage == nil {
+		return nil
+	}
+	return *c.StorageMessage
+}
+
+// Get the admin-token that requests must send. This differs from AdminToken
+// only when it contains secret references, which are resolved here but never
+// in AdminToken.
+func (c *Config) ResolvedAdminToken() string {
+	secretsLck.RLock()
+	defer secretsLck.RUnlock()
+	if hasSecretRefs(c.AdminToken) {
+		return c.adminToken
+	}
+	return c.AdminToken
+}
+
 // Get the JSON encode vcs-config for this repo. This returns nil if
 // the repo doesn't declare a vcs-config.
 func (r *Repo) VcsConfig() []byte {
+	secretsLck.RLock()
+	defer secretsLck.RUnlock()
 	if r.VcsConfigMessage == nil {
 		return nil
 	}
 	return *r.VcsConfigMessage
 }
 
+// Get the url that should be used to clone the repo. This differs from Url
+// only when the url contains secret references, which are resolved here but
+// never in Url so they are not sent to the UI, or when the repo was found by
+// a sync that clones with credentials.
+func (r *Repo) CloneUrl() string {
+	secretsLck.RLock()
+	defer secretsLck.RUnlock()
+	if r.secrets != nil {
+		return r.resolvedUrl
+	}
+
+	if r.cloneUrl != "" {
+		return r.cloneUrl
+	}
+	return r.Url
+}
+
 // Populate missing config values with default values.
 func initRepo(r *Repo) {
 	if r.MsBetweenPolls == 0 {
 		r.MsBetweenPolls = defaultMsBetweenPoll
 	}
 
+	if r.MaxMsBetweenPolls > 0 && r.BackoffAfterPolls == 0 {
+		r.BackoffAfterPolls = defaultBackoffAfterPolls
+	}
+
+	if r.MsBetweenRetries == 0 {
+		r.MsBetweenRetries = defaultMsBetweenRetries
+	}
+
+	if r.MaxMsBetweenRetries == 0 {
+		r.MaxMsBetweenRetries = r.MsBetweenPolls
+		if r.MaxMsBetweenRetries < r.MsBetweenRetries {
+			r.MaxMsBetweenRetries = r.MsBetweenRetries
+		}
+	}
+
+	if r.MaxFailures == 0 {
+		r.MaxFailures = defaultMaxFailures
+	}
+
 	if r.Vcs == "" {
 		r.Vcs = defaultVcs
 	}
 
+	// the parts of the url-pattern that aren't given come from the link
+	// style, or the defaults when it has none.
+	def, ok := linkStyles[r.LinkStyle]
+	if !ok {
+		def = linkStyles[""]
+	}
+
+	// the paths of a repo of a subdir are relative to it, but the links of
+	// the link style are to the whole repo.
+	baseUrl := def.BaseUrl
+	if r.Subdir != "" {
+		baseUrl = strings.Replace(baseUrl, "{path}", path.Clean(r.Subdir)+"/{path}", 1)
+	}
+
 	if r.UrlPattern == nil {
 		r.UrlPattern = &UrlPattern{
-			BaseUrl: defaultBaseUrl,
-			Anchor:  defaultAnchor,
+			BaseUrl: baseUrl,
+			Anchor:  def.Anchor,
 		}
 	} else {
 		if r.UrlPattern.BaseUrl == "" {
-			r.UrlPattern.BaseUrl = defaultBaseUrl
+			r.UrlPattern.BaseUrl = baseUrl
 		}
 
 		if r.UrlPattern.Anchor == "" {
-			r.UrlPattern.Anchor = defaultAnchor
+			r.UrlPattern.Anchor = def.Anchor
 		}
 	}
 }
 
-// Populate missing config values with default values and
-// merge global VCS configs into repo level configs.
+// Populate missing config values with default values, add the repos
+// found by syncs, merge global VCS configs into repo level configs and
+// resolve credential and secret references.
 func initConfig(c *Config) error {
 	if c.MaxConcurrentIndexers == 0 {
 		c.MaxConcurrentIndexers = defaultMaxConcurrentIndexers
@@ -128,7 +522,116 @@ func initConfig(c *Config) error {
 		c.HealthCheckURI = defaultHealthCheckURI
 	}
 
-	return mergeVCSConfigs(c)
+	if c.MaxMappedMB == 0 {
+		c.MaxMappedMB = defaultMaxMappedMB
+	}
+
+	if c.SearchHistory != nil && c.SearchHistory.Size == 0 {
+		c.SearchHistory.Size = defaultSearchHistorySize
+	}
+
+	if b := c.SearchBreaker; b != nil {
+		if b.Failures == 0 {
+			b.Failures = defaultBreakerFailures
+		}
+
+		if b.TimeoutMs == 0 {
+			b.TimeoutMs = defaultBreakerTimeoutMs
+		}
+
+		if b.CooldownMs == 0 {
+			b.CooldownMs = defaultBreakerCooldownMs
+		}
+	}
+
+	if s := c.SecretScanning; s != nil && s.MaxAlerts == 0 {
+		s.MaxAlerts = defaultMaxSecretAlerts
+	}
+
+	if err := syncAzureDevOps(c); err != nil {
+		return err
+	}
+
+	// The global max-file-size applies to repos that don't set their own.
+	for _, repo := range c.Repos {
+		if repo.MaxFileSize == 0 {
+			repo.MaxFileSize = c.MaxFileSize
+		}
+	}
+
+	if err := mergeVCSConfigs(c); err != nil {
+		return err
+	}
+
+	if err := resolveVCSCredentials(c); err != nil {
+		return err
+	}
+
+	if err := resolveStorageCredentials(c); err != nil {
+		return err
+	}
+
+	return initSecrets(c)
+}
+
+// Fill in the values of def that are missing from val. Objects that are
+// in both are merged the same way, any other value in val is kept as is.
+func mergeDefaults(val, def json.RawMessage) (json.RawMessage, error) {
+	if bytes.Equal(bytes.TrimSpace(val), []byte("null")) {
+		return def, nil
+	}
+
+	var v, d map[string]json.RawMessage
+	if json.Unmarshal(val, &v) != nil || json.Unmarshal(def, &d) != nil || v == nil || d == nil {
+		return val, nil
+	}
+
+	for key, dv := range d {
+		vv, ok := v[key]
+		if !ok {
+			v[key] = dv
+			continue
+		}
+
+		m, err := mergeDefaults(vv, dv)
+		if err != nil {
+			return nil, err
+		}
+		v[key] = m
+	}
+
+	return json.Marshal(v)
+}
+
+// Merge the repo-defaults of the config object into every repo, so options
+// a repo doesn't set itself take the default value. This is done before
+// the config is decoded, while options that were left out can still be
+// told apart from those set to their zero value.
+func mergeRepoDefaults(obj map[string]json.RawMessage) error {
+	def, ok := obj["repo-defaults"]
+	if !ok {
+		return nil
+	}
+
+	var repos map[string]json.RawMessage
+	if err := json.Unmarshal(obj["repos"], &repos); err != nil || repos == nil {
+		return nil
+	}
+
+	for name, repo := range repos {
+		m, err := mergeDefaults(repo, def)
+		if err != nil {
+			return err
+		}
+		repos[name] = m
+	}
+
+	b, err := json.Marshal(repos)
+	if err != nil {
+		return err
+	}
+	obj["repos"] = b
+	return nil
 }
 
 func mergeVCSConfigs(cfg *Config) error {
@@ -180,14 +683,16 @@ func mergeVCSConfigs(cfg *Config) error {
 	return nil
 }
 
+// Load the config from a file, along with the files it includes, or from
+// a directory of config files. A relative dbpath is relative to the
+// directory of the file, or to the directory itself.
 func (c *Config) LoadFromFile(filename string) error {
-	r, err := os.Open(filename)
+	b, err := readConfig(filename)
 	if err != nil {
 		return err
 	}
-	defer r.Close()
 
-	if err := json.NewDecoder(r).Decode(c); err != nil {
+	if err := json.Unmarshal(b, c); err != nil {
 		return err
 	}
 
@@ -195,9 +700,14 @@ func (c *Config) LoadFromFile(filename string) error {
 		c.Title = defaultTitle
 	}
 
+	dir := filepath.Dir(filename)
+	if fi, err := os.Stat(filename); err == nil && fi.IsDir() {
+		dir = filename
+	}
+
 	if !filepath.IsAbs(c.DbPath) {
 		path, err := filepath.Abs(
-			filepath.Join(filepath.Dir(filename), c.DbPath))
+			filepath.Join(dir, c.DbPath))
 		if err != nil {
 			return err
 		}
@@ -211,8 +721,16 @@ func (c *Config) LoadFromFile(filename string) error {
 	return initConfig(c)
 }
 
-func (c *Config) ToJsonString() (string, error) {
-	b, err := json.Marshal(c.Repos)
+// The named repos as a json string, for the pages of the UI.
+func (c *Config) ReposJsonString(names []string) (string, error) {
+	repos := map[string]*Repo{}
+	for _, name := range names {
+		if repo := c.Repos[name]; repo != nil {
+			repos[name] = repo
+		}
+	}
+
+	b, err := json.Marshal(repos)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// A vcs-config key with this suffix names an environment variable
+	// that holds the value for the key without the suffix.
+	credentialEnvSuffix = "-env"
+
+	// A vcs-config key with this suffix names a file that holds the value
+	// for the key without the suffix.
+	credentialFileSuffix = "-file"
+)
+
+// Read the value of a single credential reference. The key is the full
+// vcs-config key (i.e. "password-env") and ref is the name of the
+// environment variable or the path of the file.
+func readCredential(key, ref string) (string, error) {
+	switch {
+	case strings.HasSuffix(key, credentialEnvSuffix):
+		val, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}
+		return val, nil
+	case strings.HasSuffix(key, credentialFileSuffix):
+		b, err := ioutil.ReadFile(ref)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return "", fmt.Errorf("%s is not a credential reference", key)
+}
+
+// Replace every "<key>-env" and "<key>-file" entry in the vcs-config values
+// with "<key>" holding the value read from the environment or the file. It is
+// an error to declare both a value and a reference for the same key.
+func resolveCredentials(vals map[string]interface{}) (bool, error) {
+	changed := false
+	for key, val := range vals {
+		var name string
+		if strings.HasSuffix(key, credentialEnvSuffix) {
+			name = strings.TrimSuffix(key, credentialEnvSuffix)
+		} else if strings.HasSuffix(key, credentialFileSuffix) {
+			name = strings.TrimSuffix(key, credentialFileSuffix)
+		} else {
+			continue
+		}
+
+		ref, ok := val.(string)
+		if !ok {
+			return false, fmt.Errorf("%s must be a string", key)
+		}
+
+		if _, ok := vals[name]; ok {
+			return false, fmt.Errorf("both %s and %s are set", name, key)
+		}
+
+		secret, err := readCredential(key, ref)
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", key, err)
+		}
+
+		vals[name] = secret
+		delete(vals, key)
+		changed = true
+	}
+	return changed, nil
+}
+
+// Resolve the credential references in the vcs-config of every repo. This runs
+// after the global vcs-config has been merged so references declared globally
+// are resolved for each repo.
+func resolveVCSCredentials(cfg *Config) error {
+	for name, repo := range cfg.Repos {
+		repoBytes := repo.VcsConfig()
+		if len(repoBytes) == 0 {
+			continue
+		}
+
+		var repoVals map[string]interface{}
+		if err := json.Unmarshal(repoBytes, &repoVals); err != nil {
+			return err
+		}
+
+		changed, err := resolveCredentials(repoVals)
+		if err != nil {
+			return fmt.Errorf("vcs-config for %s: %s", name, err)
+		}
+
+		if !changed {
+			continue
+		}
+
+		repoBytes, err = json.Marshal(&repoVals)
+		if err != nil {
+			return err
+		}
+
+		repoMessage := SecretMessage(repoBytes)
+		repo.VcsConfigMessage = &repoMessage
+	}
+
+	return nil
+}
+
+// Resolve credential references in the storage config.
+func resolveStorageCredentials(cfg *Config) error {
+	b := cfg.StorageConfig()
+	if len(b) == 0 {
+		return nil
+	}
+
+	var vals map[string]interface{}
+	if err := json.Unmarshal(b, &vals); err != nil {
+		return err
+	}
+
+	changed, err := resolveCredentials(vals)
+	if err != nil {
+		return fmt.Errorf("storage: %s", err)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	b, err = json.Marshal(&vals)
+	if err != nil {
+		return err
+	}
+
+	msg := SecretMessage(b)
+	cfg.StorageMessage = &msg
+	return nil
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The keys whose objects are merged across included files rather than
+// being set by just one of them.
+var mergedKeys = map[string]bool{
+	"repos":      true,
+	"vcs-config": true,
+}
+
+// Find the files named by an include entry. A directory includes every
+// .json file in it and a glob every file it matches. Relative entries are
+// relative to the directory of the including file.
+func includeFiles(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	if fi, err := os.Stat(pattern); err == nil {
+		if !fi.IsDir() {
+			return []string{pattern}, nil
+		}
+		pattern = filepath.Join(pattern, "*.json")
+	} else if !strings.ContainsAny(pattern, "*?[") {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Merge the top level keys of src into dst. The repos and vcs-config of
+// every file are combined, any other key may only be set once.
+func mergeConfigObject(dst, src map[string]json.RawMessage, filename string) error {
+	for key, val := range src {
+		if _, ok := dst[key]; !ok {
+			dst[key] = val
+			continue
+		}
+
+		if !mergedKeys[key] {
+			return fmt.Errorf("%s: %s is already set by another config file", filename, key)
+		}
+
+		// the values were checked to be objects, or null, as they were read.
+		var have, add map[string]json.RawMessage
+		if err := json.Unmarshal(dst[key], &have); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+
+		if err := json.Unmarshal(val, &add); err != nil {
+			return fmt.Errorf("%s: %s: %s", filename, key, err)
+		}
+
+		if have == nil {
+			have = map[string]json.RawMessage{}
+		}
+
+		for name, v := range add {
+			if _, ok := have[name]; ok {
+				return fmt.Errorf("%s: %s %q is already declared by another config file", filename, key, name)
+			}
+			have[name] = v
+		}
+
+		b, err := json.Marshal(have)
+		if err != nil {
+			return err
+		}
+		dst[key] = b
+	}
+	return nil
+}
+
+// Read the config file along with the files it includes, and the files
+// they include, into one JSON object. The stack holds the files being read
+// so include cycles are caught.
+func readConfigObject(filename string, stack []string) (map[string]json.RawMessage, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range stack {
+		if f == abs {
+			return nil, fmt.Errorf("%s: config files include each other", filename)
+		}
+	}
+	stack = append(stack, abs)
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	// the keys that are merged must be objects, which is checked here so
+	// the error names the file with one that isn't.
+	for key := range mergedKeys {
+		var m map[string]json.RawMessage
+		if val, ok := obj[key]; ok {
+			if err := json.Unmarshal(val, &m); err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", filename, key, err)
+			}
+		}
+	}
+
+	inc, ok := obj["include"]
+	if !ok {
+		return obj, nil
+	}
+	delete(obj, "include")
+
+	var patterns []string
+	if err := json.Unmarshal(inc, &patterns); err != nil {
+		return nil, fmt.Errorf("%s: include: %s", filename, err)
+	}
+
+	for _, pattern := range patterns {
+		files, err := includeFiles(filepath.Dir(filename), pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include: %s", filename, err)
+		}
+
+		for _, file := range files {
+			sub, err := readConfigObject(file, stack)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := mergeConfigObject(obj, sub, file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return obj, nil
+}
+
+// Read the config as JSON. The name is either a file, which may include
+// other files, or a directory whose .json files are merged. The
+// repo-defaults are merged into the repos.
+func readConfig(name string) ([]byte, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]json.RawMessage
+	if fi.IsDir() {
+		obj = map[string]json.RawMessage{}
+		files, err := includeFiles(name, ".")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			sub, err := readConfigObject(file, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := mergeConfigObject(obj, sub, file); err != nil {
+				return nil, err
+			}
+		}
+	} else if obj, err = readConfigObject(name, nil); err != nil {
+		return nil, err
+	}
+
+	if err := mergeRepoDefaults(obj); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(obj)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The url-patterns of the sites repos are commonly hosted on, which repos
+// choose with link-style. The empty style is the default, that of GitHub.
+var linkStyles = map[string]*UrlPattern{
+	"":          {BaseUrl: defaultBaseUrl, Anchor: defaultAnchor},
+	"github":    {BaseUrl: defaultBaseUrl, Anchor: defaultAnchor},
+	"gitlab":    {BaseUrl: "{url}/-/blob/{rev}/{path}{anchor}", Anchor: "#L{line}"},
+	"bitbucket": {BaseUrl: "{url}/src/{rev}/{path}{anchor}", Anchor: "#lines-{line}"},
+	"gitea":     {BaseUrl: "{url}/src/commit/{rev}/{path}{anchor}", Anchor: "#L{line}"},
+	"cgit":      {BaseUrl: "{url}/tree/{path}?id={rev}{anchor}", Anchor: "#n{line}"},
+	"gitweb":    {BaseUrl: "{url}?a=blob;f={path};hb={rev}{anchor}", Anchor: "#l{line}"},
+}
+
+// The names of the link styles, in order.
+func linkStyleNames() []string {
+	var names []string
+	for name := range linkStyles {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Matches the ssh urls of git and mercurial repos, like those of GitHub
+// (git@github.com:org/repo.git) and of Bitbucket, which may have a port
+// (ssh://git@bitbucket.example.com:7999/org/repo.git).
+var sshUrlPattern = regexp.MustCompile(`(git|hg)@(.*?)(:[0-9]+)?(:|/)(.*)(/)(.*)`)
+
+// Replace each {name} in the template with its value.
+func expandVars(template string, values map[string]string) string {
+	oldnew := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		oldnew = append(oldnew, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(oldnew...).Replace(template)
+}
+
+// The placeholders for the path of a file, the whole path, the directory
+// it is in, which is empty at the root, and its name.
+func fileVars(file string) map[string]string {
+	dir := path.Dir(file)
+	if dir == "." {
+		dir = ""
+	}
+
+	return map[string]string{
+		"path":     file,
+		"dirname":  dir,
+		"filename": path.Base(file),
+	}
+}
+
+// Abbreviate a commit hash to seven digits, as git does. Revisions that
+// aren't hashes, like branches and tags, are left as they are.
+func shortRev(rev string) string {
+	if len(rev) != 40 && len(rev) != 64 {
+		return rev
+	}
+
+	for _, c := range rev {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return rev
+		}
+	}
+	return rev[:7]
+}
+
+// The url of a file of the repo, and of a line of it when line is above
+// zero, on the site hosting it at revision rev. The url is expanded from
+// the url-pattern of the repo just as the UI expands it, except that the
+// urls of repos cloned over ssh are given with https rather than without
+// a scheme.
+func (r *Repo) LinkTo(file string, line int, rev string) string {
+	pattern := r.UrlPattern
+	if pattern == nil {
+		pattern = &UrlPattern{BaseUrl: defaultBaseUrl, Anchor: defaultAnchor}
+	}
+
+	url := strings.TrimSuffix(r.Url, ".git")
+	vars := fileVars(file)
+	vars["rev"] = rev
+	vars["rev-short"] = shortRev(rev)
+
+	if line > 0 {
+		anchorVars := fileVars(file)
+		anchorVars["line"] = strconv.Itoa(line)
+		vars["anchor"] = expandVars(pattern.Anchor, anchorVars)
+	}
+
+	// wikis don't link to lines, nor do their pages have the extension of
+	// the file.
+	if strings.HasSuffix(url, ".wiki") {
+		url = strings.TrimSuffix(url, ".wiki") + "/wiki"
+		vars["path"] = strings.TrimSuffix(file, ".md")
+		vars["anchor"] = ""
+	}
+
+	if m := sshUrlPattern.FindStringSubmatch(url); m != nil {
+		vars["hostname"] = "//" + m[2]
+		vars["port"] = m[3]
+		vars["project"] = m[5]
+		vars["repo"] = m[7]
+		url = "https:" + vars["hostname"] + m[3] + "/" + m[5] + "/" + m[7]
+	}
+
+	vars["url"] = url
+	for _, name := range []string{"anchor", "hostname", "port", "project", "repo"} {
+		if _, ok := vars[name]; !ok {
+			vars[name] = ""
+		}
+	}
+
+	return expandVars(pattern.BaseUrl, vars)
+}
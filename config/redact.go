@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// What secrets are replaced with.
+const redacted = "REDACTED"
+
+// Replace the password of the url, and its query, which may carry tokens.
+// Values that aren't urls are left as they are.
+func redactUrl(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return v
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
+}
+
+// Replace all but the scheme and host of the url of an endpoint, since the
+// urls of webhooks, like those of Slack, are themselves secrets.
+func redactEndpoint(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return v
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// The config as it was loaded, with the defaults applied, as JSON objects
+// keyed like the config file but without its secrets. The vcs-config,
+// secrets, storage and azure-devops-sync objects are left empty by
+// SecretMessage, the admin-token is replaced and so are the passwords in
+// the urls of repos and the urls that events are posted to.
+func (c *Config) Redacted() (map[string]interface{}, error) {
+	// refreshed secrets replace the vcs-config of repos.
+	secretsLck.RLock()
+	b, err := json.Marshal(c)
+	secretsLck.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	if m["admin-token"] != "" {
+		m["admin-token"] = redacted
+	}
+
+	if repos, ok := m["repos"].(map[string]interface{}); ok {
+		for _, r := range repos {
+			if r, ok := r.(map[string]interface{}); ok {
+				r["url"] = redactUrl(r["url"])
+			}
+		}
+	}
+
+	// the defaults are applied to the repos, but may hold a vcs-config.
+	if defaults, ok := m["repo-defaults"].(map[string]interface{}); ok {
+		if _, ok := defaults["vcs-config"]; ok {
+			defaults["vcs-config"] = map[string]interface{}{}
+		}
+
+		if u, ok := defaults["url"]; ok {
+			defaults["url"] = redactUrl(u)
+		}
+	}
+
+	if a, ok := m["audit-log"].(map[string]interface{}); ok {
+		a["url"] = redactEndpoint(a["url"])
+	}
+
+	if ns, ok := m["notifications"].([]interface{}); ok {
+		for _, n := range ns {
+			if n, ok := n.(map[string]interface{}); ok {
+				n["url"] = redactEndpoint(n["url"])
+			}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,465 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/sigv4"
+)
+
+const (
+	defaultVaultAddressEnv = "VAULT_ADDR"
+	defaultVaultTokenEnv   = "VAULT_TOKEN"
+	secretsRequestTimeout  = 30 * time.Second
+)
+
+// Matches references like ${vault:secret/data/hound#token} or
+// ${aws:prod/hound#password}. The key after # is optional for backends
+// that store a plain string.
+var secretRefRegexp = regexp.MustCompile(`\$\{(\w+):([^}#]+)(?:#([^}]+))?\}`)
+
+// Guards the resolved secret values of every repo since they may be
+// replaced by a refresh while searchers are reading them.
+var secretsLck sync.RWMutex
+
+// The secrets config block, which declares the backends that are used to
+// resolve ${backend:path#key} references in repo urls, vcs-config and the
+// admin-token.
+type SecretsConfig struct {
+	MsBetweenRefresh int           `json:"ms-between-refresh"`
+	Vault            *VaultSecrets `json:"vault"`
+	AWS              *AWSSecrets   `json:"aws"`
+}
+
+// Options for reading secrets from HashiCorp Vault. Both the KV version 1
+// and version 2 secret engines are supported.
+type VaultSecrets struct {
+	Address   string `json:"address"`
+	Token     string `json:"token"`
+	Namespace string `json:"namespace"`
+}
+
+// Options for reading secrets from AWS Secrets Manager. Credentials default
+// to the standard AWS environment variables.
+type AWSSecrets struct {
+	Region          string `json:"region"`
+	AccessKeyId     string `json:"access-key-id"`
+	SecretAccessKey string `json:"secret-access-key"`
+	SessionToken    string `json:"session-token"`
+	Endpoint        string `json:"endpoint"`
+}
+
+// A backend that is able to fetch the fields of a secret.
+type secretBackend interface {
+	fetch(path string) (map[string]string, error)
+}
+
+// The raw values of a repo before any secret references were resolved.
+type repoSecrets struct {
+	url       string
+	vcsConfig []byte
+}
+
+// Parse the secrets config block. Credential references (i.e. token-env)
+// are resolved for each backend before it is decoded.
+func parseSecretsConfig(msg *SecretMessage) (*SecretsConfig, error) {
+	var blocks map[string]json.RawMessage
+	if err := json.Unmarshal(*msg, &blocks); err != nil {
+		return nil, err
+	}
+
+	for name, b := range blocks {
+		var vals map[string]interface{}
+		if err := json.Unmarshal(b, &vals); err != nil || vals == nil {
+			continue
+		}
+
+		if _, err := resolveCredentials(vals); err != nil {
+			return nil, fmt.Errorf("secrets %s: %s", name, err)
+		}
+
+		nb, err := json.Marshal(vals)
+		if err != nil {
+			return nil, err
+		}
+		blocks[name] = nb
+	}
+
+	b, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	var sc SecretsConfig
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// Construct the backends declared in the secrets config.
+func (s *SecretsConfig) backends() map[string]secretBackend {
+	backends := map[string]secretBackend{}
+	if s.Vault != nil {
+		backends["vault"] = s.Vault
+	}
+	if s.AWS != nil {
+		backends["aws"] = s.AWS
+	}
+	return backends
+}
+
+// Returns true if the string contains any secret references.
+func hasSecretRefs(s string) bool {
+	return secretRefRegexp.MatchString(s)
+}
+
+// Resolves secret references against a set of backends, fetching each
+// secret at most once.
+type secretResolver struct {
+	backends map[string]secretBackend
+	cache    map[string]map[string]string
+}
+
+func newSecretResolver(backends map[string]secretBackend) *secretResolver {
+	return &secretResolver{
+		backends: backends,
+		cache:    map[string]map[string]string{},
+	}
+}
+
+func (r *secretResolver) lookup(backend, path, key string) (string, error) {
+	b := r.backends[backend]
+	if b == nil {
+		return "", fmt.Errorf("no %s secrets backend is configured", backend)
+	}
+
+	cacheKey := backend + ":" + path
+	fields, ok := r.cache[cacheKey]
+	if !ok {
+		var err error
+		fields, err = b.fetch(path)
+		if err != nil {
+			return "", fmt.Errorf("%s:%s: %s", backend, path, err)
+		}
+		r.cache[cacheKey] = fields
+	}
+
+	val, ok := fields[key]
+	if !ok {
+		if key == "" {
+			return "", fmt.Errorf("%s:%s requires a #key", backend, path)
+		}
+		return "", fmt.Errorf("%s:%s has no key %s", backend, path, key)
+	}
+	return val, nil
+}
+
+// Replace every secret reference in s with its value.
+func (r *secretResolver) expand(s string) (string, error) {
+	var err error
+	res := secretRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		m := secretRefRegexp.FindStringSubmatch(ref)
+		var val string
+		val, err = r.lookup(m[1], m[2], m[3])
+		return val
+	})
+	return res, err
+}
+
+// Replace the secret references in all the string values of a decoded
+// JSON document.
+func (r *secretResolver) expandValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return r.expand(t)
+	case map[string]interface{}:
+		for key, val := range t {
+			nv, err := r.expandValue(val)
+			if err != nil {
+				return nil, err
+			}
+			t[key] = nv
+		}
+	case []interface{}:
+		for i, val := range t {
+			nv, err := r.expandValue(val)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = nv
+		}
+	}
+	return v, nil
+}
+
+// Resolve the secret references in a JSON encoded vcs-config.
+func (r *secretResolver) expandJson(b []byte) ([]byte, error) {
+	if !hasSecretRefs(string(b)) {
+		return b, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	v, err := r.expandValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// Record the unresolved values of every repo that contains secret references
+// and resolve them for the first time.
+func initSecrets(cfg *Config) error {
+	for _, repo := range cfg.Repos {
+		if hasSecretRefs(repo.Url) || hasSecretRefs(string(repo.VcsConfig())) {
+			repo.secrets = &repoSecrets{
+				url:       repo.Url,
+				vcsConfig: repo.VcsConfig(),
+			}
+		}
+	}
+
+	if cfg.SecretsMessage != nil {
+		sc, err := parseSecretsConfig(cfg.SecretsMessage)
+		if err != nil {
+			return err
+		}
+		cfg.secrets = sc
+	}
+
+	return cfg.RefreshSecrets()
+}
+
+// Resolve all secret references against the configured backends. This is
+// done at load time and, if ms-between-refresh is set, periodically after
+// that so rotated secrets are picked up without a restart. Nothing is
+// replaced unless every reference resolves.
+func (c *Config) RefreshSecrets() error {
+	var backends map[string]secretBackend
+	if c.secrets != nil {
+		backends = c.secrets.backends()
+	}
+	r := newSecretResolver(backends)
+
+	type resolved struct {
+		url       string
+		vcsConfig []byte
+	}
+
+	res := map[*Repo]*resolved{}
+	for name, repo := range c.Repos {
+		if repo.secrets == nil {
+			continue
+		}
+
+		url, err := r.expand(repo.secrets.url)
+		if err != nil {
+			return fmt.Errorf("url for %s: %s", name, err)
+		}
+
+		var vcsConfig []byte
+		if repo.secrets.vcsConfig != nil {
+			vcsConfig, err = r.expandJson(repo.secrets.vcsConfig)
+			if err != nil {
+				return fmt.Errorf("vcs-config for %s: %s", name, err)
+			}
+		}
+
+		res[repo] = &resolved{url, vcsConfig}
+	}
+
+	var adminToken string
+	if hasSecretRefs(c.AdminToken) {
+		var err error
+		if adminToken, err = r.expand(c.AdminToken); err != nil {
+			return fmt.Errorf("admin-token: %s", err)
+		}
+	}
+
+	secretsLck.Lock()
+	defer secretsLck.Unlock()
+	c.adminToken = adminToken
+	for repo, v := range res {
+		repo.resolvedUrl = v.url
+		if v.vcsConfig != nil {
+			msg := SecretMessage(v.vcsConfig)
+			repo.VcsConfigMessage = &msg
+		}
+	}
+
+	return nil
+}
+
+// The interval between secret refreshes. Zero means secrets are only
+// resolved when the config is loaded.
+func (c *Config) SecretsRefreshInterval() time.Duration {
+	if c.secrets == nil {
+		return 0
+	}
+	return time.Duration(c.secrets.MsBetweenRefresh) * time.Millisecond
+}
+
+func doSecretsRequest(req *http.Request) ([]byte, error) {
+	c := http.Client{Timeout: secretsRequestTimeout}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, bytes.TrimSpace(b))
+	}
+
+	return b, nil
+}
+
+// Convert the decoded fields of a secret to strings. Non-string values are
+// kept in their JSON form.
+func secretFields(vals map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(vals))
+	for key, val := range vals {
+		if s, ok := val.(string); ok {
+			fields[key] = s
+			continue
+		}
+
+		b, err := json.Marshal(val)
+		if err != nil {
+			continue
+		}
+		fields[key] = string(b)
+	}
+	return fields
+}
+
+func (v *VaultSecrets) fetch(path string) (map[string]string, error) {
+	addr := v.Address
+	if addr == "" {
+		addr = os.Getenv(defaultVaultAddressEnv)
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is not set")
+	}
+
+	token := v.Token
+	if token == "" {
+		token = os.Getenv(defaultVaultTokenEnv)
+	}
+
+	req, err := http.NewRequest("GET",
+		strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	b, err := doSecretsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	// The KV version 2 engine nests the secret under data.data
+	// next to data.metadata.
+	if data, ok := res.Data["data"].(map[string]interface{}); ok {
+		if _, ok := res.Data["metadata"]; ok {
+			return secretFields(data), nil
+		}
+	}
+
+	return secretFields(res.Data), nil
+}
+
+func (a *AWSSecrets) fetch(path string) (map[string]string, error) {
+	region := sigv4.Region(a.Region)
+	if region == "" {
+		return nil, fmt.Errorf("aws region is not set")
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	sigv4.Sign(req,
+		sigv4.HashPayload(body),
+		region,
+		"secretsmanager",
+		&sigv4.Credentials{
+			AccessKeyId:     a.AccessKeyId,
+			SecretAccessKey: a.SecretAccessKey,
+			SessionToken:    a.SessionToken,
+		},
+		time.Now())
+
+	b, err := doSecretsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		SecretString string
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	// A secret that holds a JSON object can be referenced by key, any
+	// other secret is referenced without one.
+	var vals map[string]interface{}
+	if err := json.Unmarshal([]byte(res.SecretString), &vals); err == nil {
+		fields := secretFields(vals)
+		fields[""] = res.SecretString
+		return fields, nil
+	}
+
+	return map[string]string{"": res.SecretString}, nil
+}
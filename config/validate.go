@@ -0,0 +1,360 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/cron"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/redact"
+	"github.com/hound-search/hound/strs"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The placeholders the UI expands in the base-url and the anchor of a
+// url-pattern.
+var (
+	baseUrlVars = []string{"url", "hostname", "port", "project", "repo", "path", "dirname", "filename", "rev", "rev-short", "anchor"}
+	anchorVars  = []string{"line", "path", "dirname", "filename"}
+)
+
+var placeholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Check that a url-pattern template only uses the given placeholders.
+func checkPlaceholders(template string, vars []string) error {
+	for _, m := range placeholderRegexp.FindAllStringSubmatch(template, -1) {
+		if !strs.Contains(vars, m[1]) {
+			return fmt.Errorf("unknown placeholder {%s}, expected one of {%s}", m[1], strings.Join(vars, "}, {"))
+		}
+	}
+	return nil
+}
+
+// Check the repo for problems, returning every one found.
+func validateRepo(r *Repo) []error {
+	var errs []error
+
+	if strings.TrimSpace(r.Url) == "" {
+		errs = append(errs, fmt.Errorf("url is empty"))
+	} else if strings.ContainsAny(r.Url, " \t\n") {
+		errs = append(errs, fmt.Errorf("url %q contains whitespace", r.Url))
+	}
+
+	if r.MsBetweenPolls < 0 {
+		errs = append(errs, fmt.Errorf("ms-between-poll is negative"))
+	}
+
+	if r.MaxMsBetweenPolls != 0 && r.MaxMsBetweenPolls < r.MsBetweenPolls {
+		errs = append(errs, fmt.Errorf("max-ms-between-poll is less than ms-between-poll"))
+	}
+
+	if r.BackoffAfterPolls < 0 {
+		errs = append(errs, fmt.Errorf("backoff-after-polls is negative"))
+	}
+
+	if r.MsBetweenRetries < 0 {
+		errs = append(errs, fmt.Errorf("ms-between-retries is negative"))
+	}
+
+	if r.MaxMsBetweenRetries != 0 && r.MaxMsBetweenRetries < r.MsBetweenRetries {
+		errs = append(errs, fmt.Errorf("max-ms-between-retries is less than ms-between-retries"))
+	}
+
+	if r.MaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("max-failures is negative"))
+	}
+
+	if r.PollSchedule != "" {
+		if s, err := cron.Parse(r.PollSchedule); err != nil {
+			errs = append(errs, fmt.Errorf("poll-schedule: %s", err))
+		} else if s.Next(time.Now()).IsZero() {
+			errs = append(errs, fmt.Errorf("poll-schedule %q never happens", r.PollSchedule))
+		}
+
+		if r.MaxMsBetweenPolls != 0 {
+			errs = append(errs, fmt.Errorf("poll-schedule and max-ms-between-poll can't both be given"))
+		}
+	}
+
+	if s := r.Subdir; s != "" {
+		if path.IsAbs(s) || strings.Contains(s, "\\") || strs.Contains(strings.Split(s, "/"), "..") {
+			errs = append(errs, fmt.Errorf("subdir %q is not a slash separated path inside the repo", s))
+		}
+	}
+
+	if r.MaxFileSize < 0 {
+		errs = append(errs, fmt.Errorf("max-file-size is negative"))
+	}
+
+	for _, enc := range r.Encodings {
+		if !index.KnownEncoding(enc) {
+			errs = append(errs, fmt.Errorf("unknown encoding %q, expected one of %s", enc, strings.Join(index.EncodingNames(), ", ")))
+		}
+	}
+
+	if _, ok := linkStyles[r.LinkStyle]; !ok {
+		errs = append(errs, fmt.Errorf("unknown link-style %q, expected one of %s", r.LinkStyle, strings.Join(linkStyleNames(), ", ")))
+	}
+
+	if r.UrlPattern != nil {
+		if err := checkPlaceholders(r.UrlPattern.BaseUrl, baseUrlVars); err != nil {
+			errs = append(errs, fmt.Errorf("url-pattern base-url: %s", err))
+		}
+
+		if err := checkPlaceholders(r.UrlPattern.Anchor, anchorVars); err != nil {
+			errs = append(errs, fmt.Errorf("url-pattern anchor: %s", err))
+		}
+	}
+
+	wd, err := vcs.New(r.Vcs, r.VcsConfig())
+	if err != nil {
+		return append(errs, err)
+	}
+
+	if h := r.History; h != nil && (h.Revisions > 0 || h.Tags > 0) {
+		if _, ok := wd.Driver.(vcs.HistoryDriver); !ok {
+			errs = append(errs, fmt.Errorf("vcs %s does not support index-history", r.Vcs))
+		}
+	}
+
+	if r.IndexCommits > 0 {
+		if _, ok := wd.Driver.(vcs.CommitLogDriver); !ok {
+			errs = append(errs, fmt.Errorf("vcs %s does not support index-commits", r.Vcs))
+		}
+	}
+
+	return errs
+}
+
+// Check a loaded config for problems that would otherwise only show up
+// once houndd is running, returning all of them rather than just the first.
+// Settings that are only known to other packages, like the access control
+// options, are checked by those packages.
+func (c *Config) Validate() []error {
+	var errs []error
+
+	if len(c.Repos) == 0 {
+		errs = append(errs, fmt.Errorf("repos: no repos are configured"))
+	}
+
+	if c.MaxConcurrentIndexers < 0 {
+		errs = append(errs, fmt.Errorf("max-concurrent-indexers is negative"))
+	}
+
+	if c.MaxMappedMB < 0 {
+		errs = append(errs, fmt.Errorf("max-mapped-mb is negative"))
+	}
+
+	if c.MaxLineLength < 0 {
+		errs = append(errs, fmt.Errorf("max-line-length is negative"))
+	}
+
+	if c.SearchHistory != nil && c.SearchHistory.Size < 0 {
+		errs = append(errs, fmt.Errorf("search-history: size is negative"))
+	}
+
+	if b := c.SearchBreaker; b != nil && (b.Failures < 0 || b.TimeoutMs < 0 || b.CooldownMs < 0) {
+		errs = append(errs, fmt.Errorf("search-breaker: failures, timeout-ms and cooldown-ms can't be negative"))
+	}
+
+	if d := c.SearchDefaults; d != nil {
+		if (d.Context != nil && *d.Context < 0) || d.MaxMatches < 0 {
+			errs = append(errs, fmt.Errorf("search-defaults: context and max-matches can't be negative"))
+		}
+
+		for _, glob := range d.ExcludePaths {
+			if strings.TrimSpace(glob) == "" {
+				errs = append(errs, fmt.Errorf("search-defaults: exclude-paths has an empty glob"))
+				break
+			}
+		}
+	}
+
+	if r := c.Redaction; r != nil {
+		if _, err := redact.New(r.Patterns, false); err != nil {
+			errs = append(errs, fmt.Errorf("redaction: %s", err))
+		}
+	}
+
+	if s := c.SecretScanning; s != nil {
+		if s.MaxAlerts < 0 {
+			errs = append(errs, fmt.Errorf("secret-scanning: max-alerts is negative"))
+		}
+
+		if _, err := redact.NewRules(s.Rules()); err != nil {
+			errs = append(errs, fmt.Errorf("secret-scanning: %s", err))
+		}
+
+		if len(c.Notifications) == 0 {
+			errs = append(errs, fmt.Errorf("secret-scanning: no notifications are configured to raise alerts with"))
+		}
+	}
+
+	if !strings.HasPrefix(c.HealthCheckURI, "/") {
+		errs = append(errs, fmt.Errorf("health-check-uri %q does not start with /", c.HealthCheckURI))
+	}
+
+	if h := c.HealthCheck; h != nil && (h.MaxStalenessMs < 0 || h.MinFreeMB < 0) {
+		errs = append(errs, fmt.Errorf("health-check: thresholds are negative"))
+	}
+
+	if d := c.Disk; d != nil && (d.GcIntervalMs < 0 || d.VerifyIntervalMs < 0 || d.MaxSizeMB < 0) {
+		errs = append(errs, fmt.Errorf("disk: an interval or max-size-mb is negative"))
+	}
+
+	if c.AuditLog != nil && c.AuditLog.Url != "" {
+		if u, err := url.Parse(c.AuditLog.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("audit-log: url %q is not an http or https url", c.AuditLog.Url))
+		}
+	}
+
+	names := make([]string, 0, len(c.Repos))
+	for name := range c.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, err := range validateRepo(c.Repos[name]) {
+			errs = append(errs, fmt.Errorf("repos.%s: %s", name, err))
+		}
+
+		if err := c.validateForkOf(name); err != nil {
+			errs = append(errs, fmt.Errorf("repos.%s: %s", name, err))
+		}
+
+		if t := c.Repos[name].Tenant; t != "" && !c.hasTenant(t) {
+			errs = append(errs, fmt.Errorf("repos.%s: unknown tenant %q", name, t))
+		}
+	}
+
+	errs = append(errs, c.validateTenants()...)
+	errs = append(errs, c.validateSearchQuotas()...)
+
+	// repos of the subdirectories of a monorepo share its clone, which is
+	// cloned one way.
+	byUrl := map[string]string{}
+	for _, name := range names {
+		r := c.Repos[name]
+		other, ok := byUrl[r.Url]
+		if !ok {
+			byUrl[r.Url] = name
+			continue
+		}
+
+		o := c.Repos[other]
+		if (r.Subdir != "" || o.Subdir != "") && (r.Vcs != o.Vcs || !bytes.Equal(r.VcsConfig(), o.VcsConfig())) {
+			errs = append(errs, fmt.Errorf("repos.%s: shares the clone of %s but not its vcs and vcs-config", name, other))
+		}
+	}
+
+	return errs
+}
+
+func (q *SearchQuota) negative() bool {
+	return q.SearchesPerHour < 0 || q.SearchesPerDay < 0 || q.FilesOpenedPerHour < 0 || q.FilesOpenedPerDay < 0
+}
+
+func (c *Config) hasTenant(name string) bool {
+	_, ok := c.Tenants[name]
+	return ok
+}
+
+// Check the quotas of the tenants and that the rules that bind users to a
+// tenant name one that exists.
+func (c *Config) validateTenants() []error {
+	var errs []error
+
+	names := make([]string, 0, len(c.Tenants))
+	for name := range c.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if t := c.Tenants[name]; t != nil && (t.MaxSearchesPerMinute < 0 || t.MaxUpdatesPerHour < 0 || t.SearchQuota.negative()) {
+			errs = append(errs, fmt.Errorf("tenants.%s: quotas are negative", name))
+		}
+	}
+
+	check := func(kind, tenant, role string) {
+		if tenant == "" {
+			return
+		}
+
+		if !c.hasTenant(tenant) {
+			errs = append(errs, fmt.Errorf("%s: a rule names an unknown tenant %q", kind, tenant))
+		} else if role == "admin" {
+			errs = append(errs, fmt.Errorf("%s: a rule of tenant %q can't grant the admin role", kind, tenant))
+		}
+	}
+
+	if p := c.ProxyAuth; p != nil {
+		for _, rule := range p.Rules {
+			check("proxy-auth", rule.Tenant, rule.Role)
+		}
+	}
+
+	if j := c.JWTAuth; j != nil {
+		for _, rule := range j.Rules {
+			check("jwt-auth", rule.Tenant, rule.Role)
+		}
+	}
+	return errs
+}
+
+// Check that the search quotas of access keys and users aren't negative.
+func (c *Config) validateSearchQuotas() []error {
+	q := c.SearchQuotas
+	if q == nil {
+		return nil
+	}
+
+	var errs []error
+	if q.Default != nil && q.Default.negative() {
+		errs = append(errs, errors.New("search-quotas.default: quotas are negative"))
+	}
+
+	names := make([]string, 0, len(q.Keys))
+	for name := range q.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if k := q.Keys[name]; k != nil && k.negative() {
+			errs = append(errs, fmt.Errorf("search-quotas.keys.%s: quotas are negative", name))
+		}
+	}
+	return errs
+}
+
+// Check that the repo named by fork-of exists and is not itself a fork, so
+// every fork collapses into a repo that is searched in its own right.
+func (c *Config) validateForkOf(name string) error {
+	of := c.Repos[name].ForkOf
+	if of == "" {
+		return nil
+	}
+
+	if of == name {
+		return fmt.Errorf("fork-of names the repo itself")
+	}
+
+	r, ok := c.Repos[of]
+	if !ok {
+		return fmt.Errorf("fork-of names an unknown repo %q", of)
+	}
+
+	if r.ForkOf != "" {
+		return fmt.Errorf("fork-of names %q, which is itself a fork of %q", of, r.ForkOf)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package cron parses cron expressions and finds the times they name.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The longest a schedule is searched for its next time, so schedules that
+// can never happen, like the 31st of February, don't search forever.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// The expressions that stand for common schedules.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// The names that may be used in place of the numbers of months and days
+// of the week.
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// The range and names of a field of an expression.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []*field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	{"day of week", 0, 7, dayNames},
+}
+
+// A Schedule is a parsed cron expression: minute, hour, day of month,
+// month and day of week.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// As in cron, a day matches either of the day fields when both are
+	// restricted, and the restricted one when only one is.
+	domAny, dowAny bool
+}
+
+// Parse a cron expression of five fields, each of which is *, a number, a
+// range like 1-5 or a list of them, optionally with a step like */15. Months
+// and days of the week may be given by their first three letters and both 0
+// and 7 are Sunday. The macros @yearly, @monthly, @weekly, @daily and
+// @hourly are accepted too.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron: %q has %d fields, expected %d", expr, len(parts), len(fields))
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := f.parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: %s: %s", f.name, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// Parse the field into the set of values it matches.
+func (f *field) parse(s string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if ix := strings.Index(part, "/"); ix >= 0 {
+			n, err := strconv.Atoi(part[ix+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[ix+1:])
+			}
+			step, part = n, part[:ix]
+		}
+
+		lo, hi := f.min, f.max
+		if part != "*" {
+			var err error
+			if ix := strings.Index(part, "-"); ix >= 0 {
+				if lo, err = f.value(part[:ix]); err != nil {
+					return 0, err
+				}
+				if hi, err = f.value(part[ix+1:]); err != nil {
+					return 0, err
+				}
+			} else if lo, err = f.value(part); err != nil {
+				return 0, err
+			} else if step > 1 {
+				// like 5/15, from the value to the end of the range.
+				hi = f.max
+			} else {
+				hi = lo
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Parse a single value of the field, by number or by name.
+func (f *field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, expected %d to %d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that the schedule names, in the
+// location of t. It returns the zero time when there is none within five
+// years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxSearch)
+
+	for t.Before(end) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
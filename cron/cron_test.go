@@ -0,0 +1,63 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@often",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2020, time.January, 15, 10, 30, 45, 0, time.UTC)
+
+	testCases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.January, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 * * * *", time.Date(2020, time.January, 15, 11, 30, 0, 0, time.UTC)},
+		{"5/20 9-17 * * *", time.Date(2020, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2020, time.January, 16, 2, 0, 0, 0, time.UTC)},
+		{"0 0 * * sat,sun", time.Date(2020, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, time.January, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 mar *", time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 1", time.Date(2020, time.January, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 17 * 5", time.Date(2020, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, testCase := range testCases {
+		s, err := Parse(testCase.expr)
+		if err != nil {
+			t.Errorf("%q: %s", testCase.expr, err)
+			continue
+		}
+
+		if next := s.Next(from); !next.Equal(testCase.next) {
+			t.Errorf("%q: expected %s, got %s", testCase.expr, testCase.next, next)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package highlight classifies the tokens of code into keywords, strings,
+// comments and numbers, so that clients can highlight the lines of search
+// results without grammars of their own. It recognizes tokens from the
+// lexical rules of each language rather than parsing it.
+package highlight
+
+import (
+	"path"
+	"strings"
+)
+
+type Kind string
+
+const (
+	Keyword Kind = "keyword"
+	String  Kind = "string"
+	Comment Kind = "comment"
+	Number  Kind = "number"
+)
+
+// A token of a text, from the byte Start up to End. Text that is none of
+// the kinds, like names and operators, has no tokens.
+type Token struct {
+	Start int
+	End   int
+	Kind  Kind
+}
+
+// A comment or string from its opening delimiter to its closing one. An
+// empty close ends it at the end of the line. Those that aren't multiline
+// end at the end of the line too when they aren't closed by then.
+type delim struct {
+	open, close string
+	kind        Kind
+	escapes     bool
+	multiline   bool
+}
+
+type Language struct {
+	Name     string
+	exts     []string
+	keywords map[string]bool
+
+	// tried in order, so longer delimiters come before their prefixes.
+	delims []delim
+}
+
+var (
+	slashComments = []delim{
+		{open: "//", kind: Comment},
+		{open: "/*", close: "*/", kind: Comment, multiline: true},
+	}
+	hashComments = []delim{
+		{open: "#", kind: Comment},
+	}
+	doubleQuotes = delim{open: `"`, close: `"`, kind: String, escapes: true}
+	singleQuotes = delim{open: "'", close: "'", kind: String, escapes: true}
+)
+
+func words(s string) map[string]bool {
+	res := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		res[w] = true
+	}
+	return res
+}
+
+func delims(groups ...[]delim) []delim {
+	var res []delim
+	for _, g := range groups {
+		res = append(res, g...)
+	}
+	return res
+}
+
+var languages = []*Language{
+	{
+		Name: "go",
+		exts: []string{"go"},
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var true false nil iota`),
+		delims: delims(slashComments, []delim{doubleQuotes, singleQuotes,
+			{open: "`", close: "`", kind: String, multiline: true}}),
+	},
+	{
+		Name: "python",
+		exts: []string{"py", "pyi"},
+		keywords: words(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			True False None`),
+		delims: delims(hashComments, []delim{
+			{open: `"""`, close: `"""`, kind: String, escapes: true, multiline: true},
+			{open: "'''", close: "'''", kind: String, escapes: true, multiline: true},
+			doubleQuotes, singleQuotes}),
+	},
+	{
+		Name: "javascript",
+		exts: []string{"js", "jsx", "mjs", "cjs", "ts", "tsx"},
+		keywords: words(`async await break case catch class const continue debugger default delete do else
+			enum export extends finally for function if import in instanceof interface let new of return
+			static super switch this throw try type typeof var void while yield true false null undefined`),
+		delims: delims(slashComments, []delim{doubleQuotes, singleQuotes,
+			{open: "`", close: "`", kind: String, escapes: true, multiline: true}}),
+	},
+	{
+		Name: "java",
+		exts: []string{"java", "kt", "scala", "cs"},
+		keywords: words(`abstract break case catch class const continue default do else enum extends final
+			finally for if implements import instanceof interface new package private protected public
+			return static super switch synchronized this throw throws try void volatile while
+			boolean byte char double float int long short true false null`),
+		delims: delims(slashComments, []delim{doubleQuotes, singleQuotes}),
+	},
+	{
+		Name: "c",
+		exts: []string{"c", "h", "cc", "cpp", "cxx", "hh", "hpp"},
+		keywords: words(`auto break case char class const continue default delete do double else enum
+			extern float for goto if inline int long namespace new private protected public register
+			return short signed sizeof static struct switch template this typedef union unsigned using
+			virtual void volatile while true false nullptr NULL`),
+		delims: delims(slashComments, []delim{doubleQuotes, singleQuotes}),
+	},
+	{
+		Name: "rust",
+		exts: []string{"rs"},
+		keywords: words(`as async await break const continue crate dyn else enum extern fn for if impl in
+			let loop match mod move mut pub ref return self Self static struct super trait type unsafe use
+			where while true false`),
+		// no single quotes, which also start lifetimes.
+		delims: delims(slashComments, []delim{doubleQuotes}),
+	},
+	{
+		Name: "ruby",
+		exts: []string{"rb"},
+		keywords: words(`alias and begin break case class def do else elsif end ensure false for if
+			in module next nil not or redo rescue retry return self super then true undef unless until
+			when while yield`),
+		delims: delims(hashComments, []delim{doubleQuotes, singleQuotes}),
+	},
+	{
+		Name: "shell",
+		exts: []string{"sh", "bash", "zsh"},
+		keywords: words(`case do done elif else esac export fi for function if in local return select then
+			until while`),
+		delims: delims(hashComments, []delim{doubleQuotes,
+			{open: "'", close: "'", kind: String}}),
+	},
+}
+
+// The language of the file from its extension, nil if it isn't known.
+func ForFile(name string) *Language {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, l := range languages {
+		for _, e := range l.exts {
+			if e == ext {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// Classifies the tokens of consecutive texts of a language, carrying the
+// comments and strings that are still open at the end of one text on to
+// the next.
+type Highlighter struct {
+	lang *Language
+	open *delim
+}
+
+func (l *Language) Highlighter() *Highlighter {
+	return &Highlighter{lang: l}
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// The end of the comment or string of d whose text starts at i, and
+// whether it was closed.
+func (d *delim) end(s string, i int) (int, bool) {
+	for i < len(s) {
+		switch {
+		case s[i] == '\n' && (d.close == "" || !d.multiline):
+			return i, d.close == ""
+		case d.escapes && s[i] == '\\':
+			i += 2
+		case d.close != "" && strings.HasPrefix(s[i:], d.close):
+			return i + len(d.close), true
+		default:
+			i++
+		}
+	}
+
+	if i > len(s) {
+		i = len(s)
+	}
+	return i, d.close == ""
+}
+
+// The tokens of the text, which may hold several lines.
+func (h *Highlighter) Tokens(s string) []Token {
+	res := []Token{}
+	i := 0
+	if d := h.open; d != nil {
+		end, closed := d.end(s, 0)
+		if end > 0 {
+			res = append(res, Token{0, end, d.kind})
+		}
+
+		if !closed {
+			return res
+		}
+		h.open = nil
+		i = end
+	}
+
+	for i < len(s) {
+		c := s[i]
+		if d := h.delimAt(s, i); d != nil {
+			end, closed := d.end(s, i+len(d.open))
+			res = append(res, Token{i, end, d.kind})
+			if !closed && d.multiline {
+				h.open = d
+				return res
+			}
+			i = end
+			continue
+		}
+
+		start := i
+		switch {
+		case isLetter(c):
+			for i < len(s) && (isLetter(s[i]) || isDigit(s[i])) {
+				i++
+			}
+			if h.lang.keywords[s[start:i]] {
+				res = append(res, Token{start, i, Keyword})
+			}
+		case isDigit(c):
+			for i < len(s) && (isLetter(s[i]) || isDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			res = append(res, Token{start, i, Number})
+		default:
+			i++
+		}
+	}
+	return res
+}
+
+func (h *Highlighter) delimAt(s string, i int) *delim {
+	for j := range h.lang.delims {
+		if d := &h.lang.delims[j]; strings.HasPrefix(s[i:], d.open) {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package highlight
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Write the tokens of the text as the kinds and the text they cover.
+func show(s string, tokens []Token) string {
+	var parts []string
+	for _, t := range tokens {
+		parts = append(parts, fmt.Sprintf("%s:%s", t.Kind, s[t.Start:t.End]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTokens(t *testing.T) {
+	testCases := []struct {
+		file, text, tokens string
+	}{
+		{"a.go", `if x := f("a\"b", 42); x != nil { // done`, `keyword:if string:"a\"b" number:42 keyword:nil comment:// done`},
+		{"a.go", "return `raw\\`, 'c', x1, 0x1F", "keyword:return string:`raw\\` string:'c' number:0x1F"},
+		{"a.py", `def f(x): return "#" if x else None  # a comment`, `keyword:def keyword:return string:"#" keyword:if keyword:else keyword:None comment:# a comment`},
+		{"a.rs", "fn f<'a>(s: &'a str) /* a */ -> u8 { 1 }", "keyword:fn comment:/* a */ number:1"},
+		{"A.JS", "const s = `a ${b}` // x\nlet y", "keyword:const string:`a ${b}` comment:// x keyword:let"},
+		{"a.go", `s := "unterminated`, `string:"unterminated`},
+	}
+	for _, testCase := range testCases {
+		lang := ForFile(testCase.file)
+		if lang == nil {
+			t.Fatalf("%s: expected a language", testCase.file)
+		}
+
+		if got := show(testCase.text, lang.Highlighter().Tokens(testCase.text)); got != testCase.tokens {
+			t.Errorf("%q: expected %s, got %s", testCase.text, testCase.tokens, got)
+		}
+	}
+
+	if ForFile("README.md") != nil || ForFile("Makefile") != nil {
+		t.Error("expected no language for files that aren't code")
+	}
+}
+
+// Tests that comments and strings that span lines carry on to the next.
+func TestOpenAcrossLines(t *testing.T) {
+	h := ForFile("a.c").Highlighter()
+	var got []string
+	for _, line := range []string{"int x; /* starts", "still a comment", "ends */ return 0;", `"a" /* and`} {
+		got = append(got, show(line, h.Tokens(line)))
+	}
+
+	expected := []string{
+		"keyword:int comment:/* starts",
+		"comment:still a comment",
+		"comment:ends */ keyword:return number:0",
+		`string:"a" comment:/* and`,
+	}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	h = ForFile("a.py").Highlighter()
+	h.Tokens(`doc = """first`)
+	if got := show(`last""" + x`, h.Tokens(`last""" + x`)); got != `string:last"""` {
+		t.Errorf("expected the docstring to end, got %s", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Package httpqueue posts JSON bodies to a URL in the background, so a slow
+// endpoint doesn't hold up the requests and updates that send them. It is
+// how audit events and notifications reach their endpoints.
+package httpqueue
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Posts the bodies it is sent to a URL, one at a time and in order. The
+// queue holds the bodies while the endpoint is unable to keep up, beyond
+// that bodies are dropped.
+type Queue struct {
+	name   string
+	url    string
+	client *http.Client
+	ch     chan []byte
+}
+
+// A queue of size bodies that posts to the url, each with the timeout.
+// Failed posts are logged under the name.
+func New(name, url string, size int, timeout time.Duration) *Queue {
+	q := &Queue{
+		name:   name,
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		ch:     make(chan []byte, size),
+	}
+	go q.run()
+	return q
+}
+
+func (q *Queue) run() {
+	for b := range q.ch {
+		if err := q.post(b); err != nil {
+			log.Printf("%s: %s", q.name, err)
+		}
+	}
+}
+
+func (q *Queue) post(b []byte) error {
+	res, err := q.client.Post(q.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", q.url, res.Status)
+	}
+	return nil
+}
+
+// Queue the JSON body to be posted, failing when the queue is full.
+func (q *Queue) Send(b []byte) error {
+	select {
+	case q.ch <- b:
+		return nil
+	default:
+		return fmt.Errorf("%s is not keeping up, dropping the post", q.url)
+	}
+}
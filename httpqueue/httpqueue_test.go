@@ -0,0 +1,58 @@
+package httpqueue
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	bodies := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer srv.Close()
+
+	q := New("test", srv.URL, 2, time.Second)
+	for _, b := range []string{`{"n":1}`, `{"n":2}`} {
+		if err := q.Send([]byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{`{"n":1}`, `{"n":2}`} {
+		select {
+		case got := <-bodies:
+			if got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s to be posted", want)
+		}
+	}
+}
+
+func TestQueueDrops(t *testing.T) {
+	release := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// the first post holds up the rest, which fill the queue.
+	q := New("test", srv.URL, 1, time.Second)
+	var dropped bool
+	for i := 0; i < 3; i++ {
+		if err := q.Send([]byte(`{}`)); err != nil {
+			dropped = true
+		}
+	}
+
+	if !dropped {
+		t.Fatal("expected a body to be dropped once the queue is full")
+	}
+}
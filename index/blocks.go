@@ -0,0 +1,196 @@
+package index
+
+import (
+	"bytes"
+	pathpkg "path"
+	"strings"
+
+	"github.com/hound-search/hound/redact"
+)
+
+// The most lines of context a block gives on each side of a match. The
+// context of a match in a longer block is cut to them.
+const maxBlockContext = 50
+
+// How the blocks of the code of a language are delimited.
+type blockStyle int
+
+const (
+	noBlocks blockStyle = iota
+	braceBlocks
+	indentBlocks
+)
+
+// The block styles of the languages whose blocks are recognized, by the
+// extension of their files.
+var blockStyles = map[string]blockStyle{
+	".c":     braceBlocks,
+	".cc":    braceBlocks,
+	".cpp":   braceBlocks,
+	".cs":    braceBlocks,
+	".cxx":   braceBlocks,
+	".go":    braceBlocks,
+	".h":     braceBlocks,
+	".hh":    braceBlocks,
+	".hpp":   braceBlocks,
+	".java":  braceBlocks,
+	".js":    braceBlocks,
+	".jsx":   braceBlocks,
+	".kt":    braceBlocks,
+	".mjs":   braceBlocks,
+	".php":   braceBlocks,
+	".rs":    braceBlocks,
+	".scala": braceBlocks,
+	".swift": braceBlocks,
+	".ts":    braceBlocks,
+	".tsx":   braceBlocks,
+	".py":    indentBlocks,
+	".pyi":   indentBlocks,
+}
+
+func blockStyleOf(name string) blockStyle {
+	return blockStyles[strings.ToLower(pathpkg.Ext(name))]
+}
+
+// The lines of the block around the match on line i, counting from 0, as
+// the first line of the block and the last. Blocks are found from their
+// braces or their indentation, without parsing, so braces in strings and
+// comments can throw them off. False when the line isn't in a block, or
+// its start is further than maxBlockContext lines before it.
+func findBlock(lines [][]byte, i int, style blockStyle) (int, int, bool) {
+	switch style {
+	case braceBlocks:
+		return findBraceBlock(lines, i)
+	case indentBlocks:
+		return findIndentBlock(lines, i)
+	}
+	return 0, 0, false
+}
+
+// The block that the line opens, or else the innermost one it is in. A
+// block whose opening brace is on a line of its own starts at the line
+// before, which has its signature.
+func findBraceBlock(lines [][]byte, i int) (int, int, bool) {
+	start := -1
+	if bytes.Count(lines[i], []byte("{")) > bytes.Count(lines[i], []byte("}")) {
+		start = i
+	}
+
+	depth := 0
+	for j := i - 1; start < 0 && j >= 0 && j >= i-maxBlockContext; j-- {
+		line := lines[j]
+		for k := len(line) - 1; k >= 0; k-- {
+			if line[k] == '}' {
+				depth++
+			} else if line[k] == '{' {
+				if depth == 0 {
+					start = j
+					break
+				}
+				depth--
+			}
+		}
+	}
+
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	// a block that isn't closed goes on to the end of the file.
+	end := len(lines) - 1
+	depth = 0
+scan:
+	for j := start; j < len(lines); j++ {
+		for _, c := range lines[j] {
+			if c == '{' {
+				depth++
+			} else if c == '}' && depth > 0 {
+				depth--
+				if depth == 0 && j >= i {
+					end = j
+					break scan
+				}
+			}
+		}
+	}
+
+	if start > 0 && string(bytes.TrimSpace(lines[start])) == "{" {
+		start--
+	}
+	return start, end, true
+}
+
+// The indentation of the line, or -1 for a blank line.
+func indentOf(line []byte) int {
+	rest := bytes.TrimLeft(line, " \t")
+	if len(bytes.TrimSpace(rest)) == 0 {
+		return -1
+	}
+	return len(line) - len(rest)
+}
+
+// The block that the line is the header of, or else the innermost one it
+// is in, along with the decorators of its header.
+func findIndentBlock(lines [][]byte, i int) (int, int, bool) {
+	start := -1
+	if bytes.HasSuffix(bytes.TrimSpace(lines[i]), []byte(":")) {
+		start = i
+	} else if ind := indentOf(lines[i]); ind > 0 {
+		for j := i - 1; j >= 0 && j >= i-maxBlockContext; j-- {
+			if in := indentOf(lines[j]); in >= 0 && in < ind {
+				start = j
+				break
+			}
+		}
+	}
+
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	ind := indentOf(lines[start])
+	end := start
+	for j := start + 1; j < len(lines); j++ {
+		in := indentOf(lines[j])
+		if in >= 0 && in <= ind {
+			break
+		}
+
+		if in >= 0 {
+			end = j
+		}
+	}
+
+	for start > 0 && indentOf(lines[start-1]) == ind && bytes.HasPrefix(bytes.TrimSpace(lines[start-1]), []byte("@")) {
+		start--
+	}
+	return start, end, true
+}
+
+// Set the context of the matches of the file to the blocks they are in,
+// keeping the lines of context they have when they aren't in one.
+func setBlockContext(src []byte, matches []*Match, style blockStyle, maxLineLength int, redactor *redact.Redactor) {
+	lines := bytes.Split(src, []byte("\n"))
+	for _, m := range matches {
+		i := m.LineNumber - 1
+		if i < 0 || i >= len(lines) {
+			continue
+		}
+
+		start, end, ok := findBlock(lines, i, style)
+		if !ok {
+			continue
+		}
+
+		if start < i-maxBlockContext {
+			start = i - maxBlockContext
+		}
+
+		if end > i+maxBlockContext {
+			end = i + maxBlockContext
+		}
+
+		m.Before = trimLines(redactor.Lines(lines[start:i]), maxLineLength)
+		m.After = trimLines(redactor.Lines(lines[i+1:end+1]), maxLineLength)
+	}
+}
@@ -0,0 +1,99 @@
+package index
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const braceSrc = `package main
+
+import "fmt"
+
+func main() {
+	for i := 0; i < 3; i++ {
+		fmt.Println(i)
+	}
+	if done() {
+		return
+	} else {
+		fmt.Println("more")
+	}
+}
+
+int compare(int a, int b)
+{
+	return a - b;
+}
+`
+
+const indentSrc = `import os
+
+class Tree:
+
+    @property
+    def size(self):
+        total = 0
+        for leaf in self.leaves:
+            total += leaf
+
+        return total
+
+    def empty(self):
+        return not self.leaves
+`
+
+func TestFindBlock(t *testing.T) {
+	testCases := []struct {
+		src   string
+		style blockStyle
+		line  string
+		block string
+	}{
+		{braceSrc, braceBlocks, "fmt.Println(i)", "for i := 0; i < 3; i++ {|}"},
+		{braceSrc, braceBlocks, "for i := 0", "for i := 0; i < 3; i++ {|}"},
+		{braceSrc, braceBlocks, "if done()", "if done() {|} else {"},
+		{braceSrc, braceBlocks, `"more"`, "} else {|}"},
+		{braceSrc, braceBlocks, "return a - b", "int compare(int a, int b)|}"},
+		{braceSrc, braceBlocks, "import", ""},
+		{indentSrc, indentBlocks, "total = 0", "@property|return total"},
+		{indentSrc, indentBlocks, "total += leaf", "for leaf in self.leaves:|total += leaf"},
+		{indentSrc, indentBlocks, "def empty", "def empty(self):|return not self.leaves"},
+		{indentSrc, indentBlocks, "import", ""},
+	}
+	for _, testCase := range testCases {
+		lines := bytes.Split([]byte(testCase.src), []byte("\n"))
+		i := 0
+		for !bytes.Contains(lines[i], []byte(testCase.line)) {
+			i++
+		}
+
+		var got string
+		if start, end, ok := findBlock(lines, i, testCase.style); ok {
+			got = string(bytes.TrimSpace(lines[start])) + "|" + string(bytes.TrimSpace(lines[end]))
+		}
+
+		if got != testCase.block {
+			t.Errorf("%q: expected the block %q, got %q", testCase.line, testCase.block, got)
+		}
+	}
+}
+
+func TestSetBlockContext(t *testing.T) {
+	m := &Match{Line: "\t\tfmt.Println(i)", LineNumber: 7, Before: []string{"x"}}
+	setBlockContext([]byte(braceSrc), []*Match{m}, braceBlocks, 0, nil)
+	if strings.Join(m.Before, "|") != "\tfor i := 0; i < 3; i++ {" || strings.Join(m.After, "|") != "\t}" {
+		t.Errorf("expected the for block as context, got %q and %q", m.Before, m.After)
+	}
+
+	// a match outside of a block keeps its context.
+	m = &Match{Line: `import "fmt"`, LineNumber: 3, Before: []string{"x"}}
+	setBlockContext([]byte(braceSrc), []*Match{m}, braceBlocks, 0, nil)
+	if strings.Join(m.Before, "|") != "x" {
+		t.Errorf("expected the context to be kept, got %q", m.Before)
+	}
+
+	if blockStyleOf("lib/Tree.PY") != indentBlocks || blockStyleOf("README.md") != noBlocks {
+		t.Error("expected the block style from the extension")
+	}
+}
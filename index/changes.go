@@ -0,0 +1,41 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The files whose contents differ from those in the index of prev,
+// including the files prev doesn't have, in order. Nil when either index
+// was built before checksums were recorded, as they can't be compared.
+func (r *IndexRef) ChangedFiles(prev *IndexRef) ([]string, error) {
+	sums, err := r.readChecksums()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	prevSums, err := prev.readChecksums()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for name, sum := range sums {
+		if strings.HasPrefix(name, "raw/") && prevSums[name] != sum {
+			res = append(res, strings.TrimPrefix(name, "raw/"))
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// The contents of a file of the index.
+func (n *Index) ReadFile(name string) ([]byte, error) {
+	return readRawFile(filepath.Join(n.Ref.dir, "raw", filepath.FromSlash(name)))
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangedFiles(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	write := func(name, text string) {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	build := func(rev string) *IndexRef {
+		dir, err := ioutil.TempDir(os.TempDir(), "hound")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref, err := Build(&IndexOptions{}, dir, src, url, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+
+	write("a.txt", "unchanged\n")
+	write("b.txt", "before\n")
+	prev := build("r1")
+	defer prev.Remove() //nolint
+
+	write("b.txt", "after\n")
+	write("c.txt", "added\n")
+	ref := build("r2")
+	defer ref.Remove() //nolint
+
+	changed, err := ref.ChangedFiles(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(changed, ","); got != "b.txt,c.txt" {
+		t.Fatalf("expected b.txt and c.txt to have changed, got %s", got)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if b, err := idx.ReadFile("b.txt"); err != nil || string(b) != "after\n" {
+		t.Fatalf("expected the new contents of b.txt, got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,201 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const depsJsonFilename = "deps.json"
+
+// A package the repo depends on, as its go.mod or package.json names it.
+// Registry is go or npm, as in the urls of the package vcs.
+type Dependency struct {
+	Registry string
+	Name     string
+	Version  string
+}
+
+// Parse the modules required by a go.mod file, along with the indirect
+// ones.
+func parseGoMod(r io.Reader) ([]*Dependency, error) {
+	var deps []*Dependency
+
+	s := bufio.NewScanner(r)
+	inRequire := false
+	for s.Scan() {
+		line := s.Text()
+		if ix := strings.Index(line, "//"); ix >= 0 {
+			line = line[:ix]
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inRequire && fields[0] == ")":
+			inRequire = false
+			continue
+		case inRequire:
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		default:
+			continue
+		}
+
+		if len(fields) == 2 {
+			deps = append(deps, &Dependency{
+				Registry: "go",
+				Name:     strings.Trim(fields[0], `"`),
+				Version:  fields[1],
+			})
+		}
+	}
+	return deps, s.Err()
+}
+
+// Parse the packages installed by a package-lock.json file, which are
+// listed under packages since version 2 and under dependencies before.
+func parsePackageLock(r io.Reader) ([]*Dependency, error) {
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return nil, err
+	}
+
+	var deps []*Dependency
+	for key, p := range lock.Packages {
+		// the repo itself is listed with an empty key.
+		ix := strings.LastIndex(key, "node_modules/")
+		if ix < 0 || p.Version == "" {
+			continue
+		}
+		deps = append(deps, &Dependency{
+			Registry: "npm",
+			Name:     key[ix+len("node_modules/"):],
+			Version:  p.Version,
+		})
+	}
+
+	if len(lock.Packages) == 0 {
+		for name, p := range lock.Dependencies {
+			deps = append(deps, &Dependency{Registry: "npm", Name: name, Version: p.Version})
+		}
+	}
+	return deps, nil
+}
+
+// Parse the packages a package.json file depends on. Versions are given as
+// they are written, which is often a range rather than a version.
+func parsePackageJson(r io.Reader) ([]*Dependency, error) {
+	var pkg struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.NewDecoder(r).Decode(&pkg); err != nil {
+		return nil, err
+	}
+
+	var deps []*Dependency
+	for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.OptionalDependencies} {
+		for name, version := range m {
+			deps = append(deps, &Dependency{Registry: "npm", Name: name, Version: version})
+		}
+	}
+	return deps, nil
+}
+
+// Read the dependencies of the repo in src from the go.mod and the
+// package.json at its root, preferring the exact versions of
+// package-lock.json when there is one. There are none when it has no such
+// files.
+func readDependencies(src string) ([]*Dependency, error) {
+	var deps []*Dependency
+	for _, files := range [][]string{
+		{"go.mod"},
+		{"package-lock.json", "package.json"},
+	} {
+		for _, name := range files {
+			r, err := os.Open(filepath.Join(src, name))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			var found []*Dependency
+			switch name {
+			case "go.mod":
+				found, err = parseGoMod(r)
+			case "package-lock.json":
+				found, err = parsePackageLock(r)
+			case "package.json":
+				found, err = parsePackageJson(r)
+			}
+			r.Close()
+
+			// a file that can't be parsed leaves the repo without those
+			// dependencies rather than without an index.
+			if err == nil {
+				deps = append(deps, found...)
+				break
+			}
+		}
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Registry != deps[j].Registry {
+			return deps[i].Registry < deps[j].Registry
+		}
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].Version < deps[j].Version
+	})
+	return deps, nil
+}
+
+// Keep the dependencies of the repo in src with the index in dst, so they
+// are known for the revision that was indexed.
+func writeDepsJson(dst, src string) error {
+	deps, err := readDependencies(src)
+	if err != nil || len(deps) == 0 {
+		return err
+	}
+
+	b, err := json.Marshal(deps)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, depsJsonFilename), b, 0644)
+}
+
+// The dependencies of the indexed revision, read once.
+func (n *Index) Dependencies() ([]*Dependency, error) {
+	n.depsOnce.Do(func() {
+		b, err := ioutil.ReadFile(filepath.Join(n.Ref.dir, depsJsonFilename))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			n.depsErr = err
+			return
+		}
+		n.depsErr = json.Unmarshal(b, &n.deps)
+	})
+	return n.deps, n.depsErr
+}
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const goMod = `module example.com/app
+
+go 1.13
+
+require github.com/pkg/errors v0.9.1
+
+require (
+	golang.org/x/text v0.3.0 // indirect
+	// a comment
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+replace example.com/old => ../old
+`
+
+const packageLock = `{
+	"lockfileVersion": 3,
+	"packages": {
+		"": {"name": "app"},
+		"node_modules/left-pad": {"version": "1.3.0"},
+		"node_modules/@babel/core": {"version": "7.24.0"},
+		"node_modules/@babel/core/node_modules/semver": {"version": "6.3.1"}
+	}
+}`
+
+func depsString(deps []*Dependency) string {
+	var s []string
+	for _, d := range deps {
+		s = append(s, fmt.Sprintf("%s:%s@%s", d.Registry, d.Name, d.Version))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestReadDependencies(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"go.mod":       goMod,
+		"package.json": `{"dependencies": {"left-pad": "^1.0.0"}}`,
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps, err := readDependencies(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "go:github.com/pkg/errors@v0.9.1 go:golang.org/x/text@v0.3.0 go:gopkg.in/yaml.v2@v2.4.0 npm:left-pad@^1.0.0"
+	if got := depsString(deps); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	// the lock file gives the installed versions instead.
+	if err := ioutil.WriteFile(filepath.Join(src, "package-lock.json"), []byte(packageLock), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(src, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err = readDependencies(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = "npm:@babel/core@7.24.0 npm:left-pad@1.3.0 npm:semver@6.3.1"
+	if got := depsString(deps); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	ref, err := buildIndexOf(&IndexOptions{}, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	deps, err = idx.Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := depsString(deps); got != want {
+		t.Fatalf("expected the index to keep %s, got %s", want, got)
+	}
+}
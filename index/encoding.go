@@ -0,0 +1,191 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const encodingsJsonFilename = "encodings.json"
+
+// The encodings, other than UTF-8, that files can be transcoded from. Each
+// decoder returns the contents in UTF-8 and whether they are valid in the
+// encoding.
+var decoders = map[string]func([]byte) ([]byte, bool){
+	"utf-16":    decodeUTF16,
+	"shift-jis": decodeShiftJIS,
+	"latin-1":   decodeLatin1,
+}
+
+// The names of the encodings files can be transcoded from.
+func EncodingNames() []string {
+	var names []string
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Determine whether files can be transcoded from the named encoding.
+func KnownEncoding(name string) bool {
+	_, ok := decoders[name]
+	return ok
+}
+
+// Read the file and, unless it is UTF-8, transcode it from the first of
+// the encodings it is valid in. Returns the contents in UTF-8 and the name
+// of the encoding, or nil contents when the file is UTF-8 or in none of the
+// encodings.
+func decodeFile(path string, encodings []string) ([]byte, string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if utf8.Valid(b) && bytes.IndexByte(b, 0) < 0 {
+		return nil, "", nil
+	}
+
+	for _, name := range encodings {
+		if dec, ok := decoders[name]; ok {
+			if d, ok := dec(b); ok {
+				return d, name, nil
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// Decode UTF-16 that starts with a byte order mark, which is how it is
+// told apart from binary files.
+func decodeUTF16(b []byte) ([]byte, bool) {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return nil, false
+	}
+
+	var order func([]byte) uint16
+	switch {
+	case b[0] == 0xff && b[1] == 0xfe:
+		order = func(p []byte) uint16 { return uint16(p[0]) | uint16(p[1])<<8 }
+	case b[0] == 0xfe && b[1] == 0xff:
+		order = func(p []byte) uint16 { return uint16(p[0])<<8 | uint16(p[1]) }
+	default:
+		return nil, false
+	}
+
+	u := make([]uint16, 0, len(b)/2-1)
+	for i := 2; i < len(b); i += 2 {
+		c := order(b[i:])
+		if c == 0 {
+			return nil, false
+		}
+		u = append(u, c)
+	}
+	return []byte(string(utf16.Decode(u))), true
+}
+
+// Shift_JIS encodes ASCII and half-width katakana in a byte and the other
+// characters in two, a lead byte then a trail byte.
+const sjisTrailBytes = 188
+
+func sjisLead(c byte) int {
+	switch {
+	case c >= 0x81 && c <= 0x9f:
+		return int(c - 0x81)
+	case c >= 0xe0 && c <= 0xfc:
+		return int(c-0xe0) + 0x9f - 0x81 + 1
+	}
+	return -1
+}
+
+func sjisTrail(c byte) int {
+	switch {
+	case c >= 0x40 && c <= 0x7e:
+		return int(c - 0x40)
+	case c >= 0x80 && c <= 0xfc:
+		return int(c-0x80) + 0x7e - 0x40 + 1
+	}
+	return -1
+}
+
+// Decode Shift_JIS, as extended by Windows. Contents with a byte that isn't
+// part of a character, or with NUL bytes, aren't Shift_JIS.
+func decodeShiftJIS(b []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.Grow(len(b) + len(b)/2)
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == 0:
+			return nil, false
+		case c < 0x80:
+			buf.WriteByte(c)
+		case c >= 0xa1 && c <= 0xdf:
+			buf.WriteRune(0xff61 + rune(c-0xa1))
+		default:
+			lead := sjisLead(c)
+			if lead < 0 || i+1 >= len(b) {
+				return nil, false
+			}
+
+			trail := sjisTrail(b[i+1])
+			if trail < 0 {
+				return nil, false
+			}
+
+			r := sjisTable[lead*sjisTrailBytes+trail]
+			if r == 0 {
+				return nil, false
+			}
+			buf.WriteRune(rune(r))
+			i++
+		}
+	}
+	return buf.Bytes(), true
+}
+
+// Decode ISO 8859-1, in which every byte is a character, so only contents
+// with NUL bytes, which are binary, aren't Latin-1.
+func decodeLatin1(b []byte) ([]byte, bool) {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(b) + len(b)/4)
+	for _, c := range b {
+		buf.WriteRune(rune(c))
+	}
+	return buf.Bytes(), true
+}
+
+// write the encodings of the files that were transcoded, by name.
+func writeEncodingsJson(dst string, encodings map[string]string) error {
+	b, err := json.Marshal(encodings)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, encodingsJsonFilename), b, 0644)
+}
+
+// The encodings of the files of the index that were transcoded, by name.
+// Indexes without any have no file. The encodings are read once.
+func (n *Index) encodings() (map[string]string, error) {
+	n.encodingsOnce.Do(func() {
+		b, err := ioutil.ReadFile(filepath.Join(n.Ref.dir, encodingsJsonFilename))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			n.encodingsErr = err
+			return
+		}
+		n.encodingsErr = json.Unmarshal(b, &n.encodingsByName)
+	})
+	return n.encodingsByName, n.encodingsErr
+}
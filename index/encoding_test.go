@@ -0,0 +1,109 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		enc  string
+		in   []byte
+		want string
+		ok   bool
+	}{
+		{"utf-16", []byte{0xff, 0xfe, 'h', 0, 0xe9, 0}, "hé", true},
+		{"utf-16", []byte{0xfe, 0xff, 0, 'h', 0x30, 0x42}, "hあ", true},
+		{"utf-16", []byte{'h', 0, 'i', 0}, "", false},
+		{"utf-16", []byte{0xff, 0xfe, 'h'}, "", false},
+		{"shift-jis", []byte{'a', 0x82, 0xa0, 0xb1, 0x88, 0x9f}, "aあｱ亜", true},
+		{"shift-jis", []byte{'a', 0x82}, "", false},
+		{"shift-jis", []byte{0x82, 0x20}, "", false},
+		{"shift-jis", []byte{'a', 0, 'b'}, "", false},
+		{"latin-1", []byte{'c', 'a', 'f', 0xe9}, "café", true},
+		{"latin-1", []byte{'a', 0, 'b'}, "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := decoders[test.enc](test.in)
+		if ok != test.ok || (ok && string(got) != test.want) {
+			t.Errorf("%s of %q = %q, %t, want %q, %t", test.enc, test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string][]byte{
+		"utf8.txt":  []byte("plain caf\xc3\xa9\n"),
+		"latin.txt": []byte("latin caf\xe9\n"),
+		"sjis.txt":  []byte("sjis \x82\xa0\n"),
+		"wide.txt":  {0xff, 0xfe, 'w', 0, 'i', 0, 'd', 0, 'e', 0, ' ', 0, 0x42, 0x30, '\n', 0},
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opt := &IndexOptions{Encodings: []string{"utf-16", "shift-jis", "latin-1"}}
+	ref, err := buildIndexOf(opt, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	for pat, want := range map[string]string{
+		"plain café": "",
+		"latin café": "latin-1",
+		"sjis あ":     "shift-jis",
+		"wide あ":     "utf-16",
+	} {
+		res, err := idx.Search(pat, &SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Matches) != 1 || res.Matches[0].Encoding != want {
+			t.Errorf("expected one match of %q transcoded from %q, got %+v", pat, want, res.Matches)
+		}
+	}
+
+	// without encodings only the UTF-8 file is indexed.
+	ref, err = buildIndexOf(&IndexOptions{}, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err = ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if n := idx.NumFiles(); n != 1 {
+		t.Errorf("expected 1 file without encodings, got %d", n)
+	}
+}
+
+func buildIndexOf(opt *IndexOptions, src string) (*IndexRef, error) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		return nil, err
+	}
+	return Build(opt, dir, src, url, rev)
+}
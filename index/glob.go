@@ -0,0 +1,106 @@
+package index
+
+import (
+	"path"
+	"strings"
+)
+
+// Match a slash separated path against a glob pattern. Each path segment is
+// matched as in path.Match and a "**" segment matches zero or more segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(
+		strings.Split(pattern, "/"),
+		strings.Split(name, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			pat = pat[1:]
+			if len(pat) == 0 {
+				return true
+			}
+
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+
+		pat, name = pat[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// Determine whether the pattern matches the directory dir as a whole, that
+// is, either the directory itself or everything beneath it.
+func matchGlobDir(pattern, dir string) bool {
+	if matchGlob(pattern, dir) {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/**") &&
+		matchGlob(strings.TrimSuffix(pattern, "/**"), dir)
+}
+
+// Determine whether the pattern could match any path beneath the
+// directory dir. This allows whole directories to be skipped.
+func globMayMatchUnder(pattern, dir string) bool {
+	pat := strings.Split(pattern, "/")
+	for _, seg := range strings.Split(dir, "/") {
+		if len(pat) == 0 {
+			return false
+		}
+
+		if pat[0] == "**" {
+			return true
+		}
+
+		if ok, _ := path.Match(pat[0], seg); !ok {
+			return false
+		}
+		pat = pat[1:]
+	}
+	return len(pat) > 0
+}
+
+// A set of include and exclude patterns for the paths of a repo.
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+// Returns the reason the path is filtered or "" if it is not.
+func (f *pathFilter) reasonFor(rel string, isDir bool) string {
+	for _, pat := range f.exclude {
+		if (isDir && matchGlobDir(pat, rel)) || (!isDir && matchGlob(pat, rel)) {
+			return reasonExcludedPath
+		}
+	}
+
+	if len(f.include) == 0 {
+		return ""
+	}
+
+	for _, pat := range f.include {
+		if isDir && (matchGlobDir(pat, rel) || globMayMatchUnder(pat, rel)) {
+			return ""
+		}
+
+		if !isDir && matchGlob(pat, rel) {
+			return ""
+		}
+	}
+
+	return reasonNotIncluded
+}
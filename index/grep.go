@@ -247,6 +247,4 @@ func (g *grepper) grep(r io.Reader, re *regexp.Regexp, fn func(line []byte, line
 			return nil
 		}
 	}
-
-	return nil  //nolint
 }
@@ -0,0 +1,184 @@
+package index
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The files, in any directory of a repo, that list paths to leave out of
+// the index when ExcludeIgnoredFiles is set.
+var ignoreFilenames = []string{
+	".gitignore",
+	".houndignore",
+}
+
+// The paths left out of the index when ExcludeVendoredFiles is set and the
+// repo does not declare its own.
+var DefaultVendoredPaths = []string{
+	"vendor/",
+	"node_modules/",
+	"third_party/",
+	"bower_components/",
+}
+
+// A single pattern in the format of a .gitignore file.
+type ignoreRule struct {
+	segs    []string
+	negate  bool
+	dirOnly bool
+}
+
+// Parse a line of a .gitignore file. Returns nil for blank lines and
+// comments.
+func parseIgnoreRule(line string) *ignoreRule {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+
+	r := &ignoreRule{}
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	// A pattern without a slash matches at any depth, otherwise it is
+	// relative to the directory holding the ignore file.
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+
+	r.segs = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return r
+}
+
+func parseIgnoreRules(lines []string) []*ignoreRule {
+	var rules []*ignoreRule
+	for _, line := range lines {
+		if r := parseIgnoreRule(line); r != nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func (r *ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(r.segs, strings.Split(rel, "/"))
+}
+
+// Decides which paths of a repo are ignored, either by the ignore files
+// found in the repo or by the vendored path rules. Paths are slash separated
+// and relative to the root of the repo.
+type ignorer struct {
+	root     string
+	useFiles bool
+	vendored []*ignoreRule
+	dirRules map[string][]*ignoreRule
+}
+
+func newIgnorer(root string, opt *IndexOptions) *ignorer {
+	g := &ignorer{
+		root:     root,
+		useFiles: opt.ExcludeIgnoredFiles,
+		dirRules: map[string][]*ignoreRule{},
+	}
+
+	if opt.ExcludeVendoredFiles {
+		paths := opt.VendoredPaths
+		if len(paths) == 0 {
+			paths = DefaultVendoredPaths
+		}
+		g.vendored = parseIgnoreRules(paths)
+	}
+
+	return g
+}
+
+// Read the rules of the ignore files in the directory rel. This must be
+// called for a directory before any paths inside it are checked.
+func (g *ignorer) loadDir(rel string) error {
+	if !g.useFiles {
+		return nil
+	}
+
+	var rules []*ignoreRule
+	for _, name := range ignoreFilenames {
+		r, err := os.Open(filepath.Join(g.root, filepath.FromSlash(rel), name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			if rule := parseIgnoreRule(s.Text()); rule != nil {
+				rules = append(rules, rule)
+			}
+		}
+		r.Close()
+
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+
+	if len(rules) > 0 {
+		g.dirRules[rel] = rules
+	}
+
+	return nil
+}
+
+// Determine whether the path is matched by an ignore file. Rules in deeper
+// directories and later lines take precedence.
+func (g *ignorer) isIgnored(rel string, isDir bool) bool {
+	if !g.useFiles {
+		return false
+	}
+
+	ignored := false
+	dirs := strings.Split(rel, "/")
+	for i := 0; i < len(dirs); i++ {
+		base := path.Join(dirs[:i]...)
+		if base == "" {
+			base = "."
+		}
+
+		sub := path.Join(dirs[i:]...)
+		for _, r := range g.dirRules[base] {
+			if r.matches(sub, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// Determine whether the path is matched by the vendored path rules.
+func (g *ignorer) isVendored(rel string, isDir bool) bool {
+	vendored := false
+	for _, r := range g.vendored {
+		if r.matches(rel, isDir) {
+			vendored = !r.negate
+		}
+	}
+	return vendored
+}
@@ -0,0 +1,176 @@
+package index
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "cmd/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"services/**", "services/a/b.go", true},
+		{"services/**", "other/a/b.go", false},
+		{"**/generated/**", "a/generated/b/c.go", true},
+		{"**/generated/**", "a/generate/b.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/?.txt", "a/1.txt", true},
+	}
+	for _, testCase := range testCases {
+		if actual := matchGlob(testCase.pattern, testCase.name); actual != testCase.expected {
+			t.Errorf("matchGlob(%q, %q): expected %t", testCase.pattern, testCase.name, testCase.expected)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	g := &ignorer{
+		useFiles: true,
+		dirRules: map[string][]*ignoreRule{
+			".":   parseIgnoreRules([]string{"# comment", "*.log", "build/", "/root.txt", "!keep.log"}),
+			"sub": parseIgnoreRules([]string{"local.txt", "!build/"}),
+		},
+	}
+
+	testCases := []struct {
+		rel      string
+		isDir    bool
+		expected bool
+	}{
+		{"a.log", false, true},
+		{"deep/er/a.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"root.txt", false, true},
+		{"sub/root.txt", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/build", true, false},
+		{"src/main.go", false, false},
+	}
+	for _, testCase := range testCases {
+		if actual := g.isIgnored(testCase.rel, testCase.isDir); actual != testCase.expected {
+			t.Errorf("isIgnored(%q, %t): expected %t", testCase.rel, testCase.isDir, testCase.expected)
+		}
+	}
+}
+
+// Tests that ignored and vendored paths are left out of an index and
+// are reported as excluded.
+func TestIndexIgnoredAndVendoredFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		".houndignore":            "*.min.js\n",
+		"app.js":                  "needle\n",
+		"app.min.js":              "needle\n",
+		"vendor/lib/lib.go":       "needle\n",
+		"node_modules/x/index.js": "needle\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	opt := &IndexOptions{
+		ExcludeIgnoredFiles:  true,
+		ExcludeVendoredFiles: true,
+		VendoredPaths:        []string{"vendor/"},
+	}
+	ref, err := Build(opt, filepath.Join(dst, "idx"), src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("needle", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, m := range res.Matches {
+		found[filepath.ToSlash(m.Filename)] = true
+	}
+
+	if !found["app.js"] || !found["node_modules/x/index.js"] || len(found) != 2 {
+		t.Fatalf("unexpected matches: %v", found)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(ref.Dir(), excludedFileJsonFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var excluded []*ExcludedFile
+	if err := json.Unmarshal(b, &excluded); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]string{}
+	for _, e := range excluded {
+		reasons[filepath.ToSlash(e.Filename)] = e.Reason
+	}
+
+	if reasons["app.min.js"] != reasonIgnored || reasons["vendor"] != reasonVendored {
+		t.Fatalf("unexpected excluded files: %v", reasons)
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	f := &pathFilter{
+		include: []string{"services/**", "*.md"},
+		exclude: []string{"**/generated/**", "**/*_test.go"},
+	}
+
+	testCases := []struct {
+		rel      string
+		isDir    bool
+		expected string
+	}{
+		{"services", true, ""},
+		{"services/api/main.go", false, ""},
+		{"services/api/main_test.go", false, reasonExcludedPath},
+		{"services/api/generated", true, reasonExcludedPath},
+		{"README.md", false, ""},
+		{"docs", true, reasonNotIncluded},
+		{"docs/README.md", false, reasonNotIncluded},
+		{"main.go", false, reasonNotIncluded},
+	}
+	for _, testCase := range testCases {
+		if actual := f.reasonFor(testCase.rel, testCase.isDir); actual != testCase.expected {
+			t.Errorf("reasonFor(%q, %t): expected %q, got %q", testCase.rel, testCase.isDir, testCase.expected, actual)
+		}
+	}
+}
@@ -1,24 +1,34 @@
 package index
 
 import (
+	"bytes"
 	"compress/gzip"
+	"container/list"
+	"crypto/sha1"
 	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	goregexp "regexp"
+	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
 
 	"github.com/hound-search/hound/codesearch/index"
 	"github.com/hound-search/hound/codesearch/regexp"
+	"github.com/hound-search/hound/highlight"
+	"github.com/hound-search/hound/redact"
 )
 
 const (
 	matchLimit               = 5000
-	manifestFilename         = "metadata.gob"
+	ManifestFilename         = "metadata.gob"
 	excludedFileJsonFilename = "excluded_files.json"
 	filePeekSize             = 2048
 )
@@ -27,27 +37,158 @@ const (
 	reasonDotFile     = "Dot files are excluded."
 	reasonInvalidMode = "Invalid file mode."
 	reasonNotText     = "Not a text file."
+	reasonIgnored     = "Matched by an ignore file."
+	reasonVendored    = "Vendored path."
+
+	reasonExcludedPath = "Matched by exclude-paths."
+	reasonNotIncluded  = "Not matched by include-paths."
+	reasonTooLarge     = "File is larger than max-file-size."
+	reasonMinified     = "Minified file."
 )
 
+// Filename suffixes of files that are minified by convention.
+var minifiedSuffixes = []string{
+	".min.js",
+	".min.css",
+	".js.map",
+	".css.map",
+}
+
 type Index struct {
 	Ref *IndexRef
-	idx *index.Index
 	lck sync.RWMutex
+
+	// the trigram table, which is nil while it isn't mapped among the
+	// tables. See mapped.go.
+	tables   *MappedTables
+	idx      *index.Index
+	triSize  int64
+	elem     *list.Element
+	users    int
+	numFiles int
+
+	size     int64
+	sizeErr  error
+	sizeOnce sync.Once
+
+	owners     []*ownerRule
+	ownersErr  error
+	ownersOnce sync.Once
+
+	encodingsByName map[string]string
+	encodingsErr    error
+	encodingsOnce   sync.Once
+
+	deps     []*Dependency
+	depsErr  error
+	depsOnce sync.Once
+
+	licenses     []*DirLicenses
+	licensesErr  error
+	licensesOnce sync.Once
 }
 
 type IndexOptions struct {
-	ExcludeDotFiles bool
-	SpecialFiles    []string
+	ExcludeDotFiles      bool
+	ExcludeIgnoredFiles  bool
+	ExcludeVendoredFiles bool
+	VendoredPaths        []string
+	IncludePaths         []string
+	ExcludePaths         []string
+	MaxFileSize          int64
+	ExcludeMinifiedFiles bool
+	SpecialFiles         []string
+
+	// The encodings that files which aren't UTF-8 are transcoded from, the
+	// first one a file is valid in is used. See EncodingNames.
+	Encodings []string `json:",omitempty"`
+
+	// The slash separated directory of the source that is indexed, as the
+	// root of the index, when only part of it is.
+	Subdir string `json:",omitempty"`
+
+	// The time each file last changed, by slash separated path, when the
+	// vcs can tell. Other files use the time they changed in the working
+	// copy. They don't change what is indexed, so aren't part of the hash.
+	ModTimes map[string]time.Time `json:"-"`
+}
+
+// A hash of the options, indexes built with options that hash differently
+// may differ in content and are never reused for one another.
+func (o *IndexOptions) Hash() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		panic(err)
+	}
+
+	h := sha1.Sum(b)
+	return hex.EncodeToString(h[:])
 }
 
 type SearchOptions struct {
 	IgnoreCase        bool
 	LiteralSearch     bool
+	WholeWord         bool
 	LinesOfContext    uint
 	FileRegexp        string
 	ExcludeFileRegexp string
 	Offset            int
 	Limit             int
+
+	// Further patterns that file paths must all match, along with
+	// FileRegexp.
+	FileRegexps []string
+
+	// Count the matching lines of each file rather than collecting them,
+	// counts aren't subject to the limit on matches.
+	CountOnly bool
+
+	// Stop collecting the matches of a file once it has MaxPerFile of
+	// them, and stop searching altogether once MaxMatches are collected.
+	// Zero is no limit.
+	MaxPerFile int
+	MaxMatches int
+
+	// Treat the pattern as a structural template rather than a regular
+	// expression, see parseTemplate. The case, literal and whole word
+	// options don't apply to templates.
+	Structural bool
+
+	// Only search the files that last changed after this time, unless it
+	// is zero.
+	ModifiedAfter time.Time
+
+	// Only search the files the CODEOWNERS file of the repo gives to this
+	// user or team, unless it is empty.
+	Owner string
+
+	// Give the hash of the contents of each matching file, so identical
+	// files in different repos can be recognized.
+	Hash bool
+
+	// The revision to search, which must be the head or a revision
+	// indexed from the history of the repo. Empty means the head.
+	Rev string
+
+	// The longest line, in bytes, to return when it is not 0. Longer
+	// matching lines are cut down to it around their first match, and
+	// longer lines of context from their start. The matches of structural
+	// templates are not cut.
+	MaxLineLength int
+
+	// Extend the context of each match to the function or block it is in,
+	// in the files of languages whose blocks are recognized, up to
+	// maxBlockContext lines on each side. Other matches keep the
+	// LinesOfContext.
+	BlockContext bool
+
+	// Classify the tokens of the lines of the matches, in the files of
+	// languages the highlight package knows.
+	Highlight bool
+
+	// Masks the secrets in the lines that are returned, nil to mask none.
+	// Lines whose matches are all in secrets are left out.
+	Redactor *redact.Redactor `json:"-"`
 }
 
 type Match struct {
@@ -55,6 +196,25 @@ type Match struct {
 	LineNumber int
 	Before     []string
 	After      []string
+
+	// The text each named hole of a structural template matched. The
+	// Line of a structural match holds every line the match spans.
+	Holes map[string]string `json:",omitempty"`
+
+	// When the Line was cut down to MaxLineLength, the byte offset of the
+	// part that was kept in the line and the length of the whole line.
+	LineStart  int `json:",omitempty"`
+	LineLength int `json:",omitempty"`
+
+	// The tokens of the lines of the match, when they were highlighted.
+	Tokens *MatchTokens `json:",omitempty"`
+}
+
+// The tokens of the lines of a match, whose offsets are into each line.
+type MatchTokens struct {
+	Before [][]highlight.Token
+	Line   []highlight.Token
+	After  [][]highlight.Token
 }
 
 type SearchResponse struct {
@@ -63,23 +223,100 @@ type SearchResponse struct {
 	FilesOpened    int           `json:"-"`
 	Duration       time.Duration `json:"-"`
 	Revision       string
+
+	// Whether the search stopped at MaxMatches, in which case there may be
+	// more files with matches than FilesWithMatch.
+	Truncated bool `json:",omitempty"`
 }
 
 type FileMatch struct {
 	Filename string
 	Matches  []*Match
+
+	// The number of matching lines when only counting.
+	Count int `json:",omitempty"`
+
+	// The SHA-1 of the file's contents, when asked for.
+	Hash string `json:",omitempty"`
+
+	// The forks of the repo with an identical file whose match was
+	// collapsed into this one.
+	Forks []string `json:",omitempty"`
+
+	// When the file last changed, going by the vcs when it can tell and by
+	// the working copy it was indexed from otherwise.
+	ModTime time.Time
+
+	// The owners of the file by the CODEOWNERS file of the repo.
+	Owners []string `json:",omitempty"`
+
+	// The encoding the file was transcoded to UTF-8 from, if it wasn't
+	// UTF-8.
+	Encoding string `json:",omitempty"`
+
+	// The language the tokens of the matches were classified in, when
+	// they were highlighted.
+	Language string `json:",omitempty"`
 }
 
 type ExcludedFile struct {
 	Filename string
 	Reason   string
+
+	// The kind of reason, one of the Exclude kinds. It is derived from the
+	// reason when the files are read, so indexes built before kinds were
+	// added have them too.
+	Kind string `json:",omitempty"`
+}
+
+// The kinds of reasons for leaving a file out of the index.
+const (
+	ExcludeDotFile  = "dotfile"
+	ExcludeSpecial  = "special"
+	ExcludeBinary   = "binary"
+	ExcludeSize     = "size"
+	ExcludeMinified = "minified"
+	ExcludeIgnored  = "ignored"
+	ExcludeVendored = "vendored"
+	ExcludePath     = "path"
+	ExcludeOther    = "other"
+)
+
+// The kind of each reason, reasons given by the codesearch index are
+// matched by prefix.
+var excludeKinds = map[string]string{
+	reasonDotFile:      ExcludeDotFile,
+	reasonInvalidMode:  ExcludeSpecial,
+	reasonNotText:      ExcludeBinary,
+	"Invalid UTF-8":    ExcludeBinary,
+	"Trigram ratio":    ExcludeBinary,
+	reasonTooLarge:     ExcludeSize,
+	"Too long":         ExcludeSize,
+	reasonMinified:     ExcludeMinified,
+	reasonIgnored:      ExcludeIgnored,
+	reasonVendored:     ExcludeVendored,
+	reasonExcludedPath: ExcludePath,
+	reasonNotIncluded:  ExcludePath,
+}
+
+func excludeKind(reason string) string {
+	for prefix, kind := range excludeKinds {
+		if strings.HasPrefix(reason, prefix) {
+			return kind
+		}
+	}
+	return ExcludeOther
 }
 
 type IndexRef struct {
 	Url  string
 	Rev  string
 	Time time.Time
-	dir  string
+
+	// The hash of the IndexOptions the index was built with.
+	OptionsHash string
+
+	dir string
 }
 
 func (r *IndexRef) Dir() string {
@@ -87,7 +324,7 @@ func (r *IndexRef) Dir() string {
 }
 
 func (r *IndexRef) writeManifest() error {
-	w, err := os.Create(filepath.Join(r.dir, manifestFilename))
+	w, err := os.Create(filepath.Join(r.dir, ManifestFilename))
 	if err != nil {
 		return err
 	}
@@ -96,11 +333,43 @@ func (r *IndexRef) writeManifest() error {
 	return gob.NewEncoder(w).Encode(r)
 }
 
+// Determine whether the index data is present in the directory of the ref.
+// Only the manifest is present when it was fetched from a Store ahead of
+// the rest of the index.
+func (r *IndexRef) HasData() bool {
+	_, err := os.Stat(filepath.Join(r.dir, "tri"))
+	return err == nil
+}
+
+// Open the index with trigram tables of its own, which stay mapped until
+// it is closed.
 func (r *IndexRef) Open() (*Index, error) {
-	return &Index{
-		Ref: r,
-		idx: index.Open(filepath.Join(r.dir, "tri")),
-	}, nil
+	return r.OpenWith(nil)
+}
+
+// Open the index with its trigram table among the tables, those of its own
+// when they are nil.
+func (r *IndexRef) OpenWith(tables *MappedTables) (*Index, error) {
+	fi, err := os.Stat(filepath.Join(r.dir, "tri"))
+	if err != nil {
+		return nil, err
+	}
+
+	if tables == nil {
+		tables = NewMappedTables(0)
+	}
+
+	n := &Index{
+		Ref:     r,
+		tables:  tables,
+		triSize: fi.Size(),
+	}
+
+	// the table stays mapped until others are searched in its place.
+	tables.acquire(n)
+	n.numFiles = n.idx.NumNames()
+	tables.release(n)
+	return n, nil
 }
 
 func (r *IndexRef) Remove() error {
@@ -110,13 +379,13 @@ func (r *IndexRef) Remove() error {
 func (n *Index) Close() error {
 	n.lck.Lock()
 	defer n.lck.Unlock()
-	return n.idx.Close()
+	return n.tables.close(n)
 }
 
 func (n *Index) Destroy() error {
 	n.lck.Lock()
 	defer n.lck.Unlock()
-	if err := n.idx.Close(); err != nil {
+	if err := n.tables.close(n); err != nil {
 		return err
 	}
 	return n.Ref.Remove()
@@ -126,14 +395,138 @@ func (n *Index) GetDir() string {
 	return n.Ref.dir
 }
 
-func toStrings(lines [][]byte) []string {
+// The files that were left out of the index, and why, in the order they
+// were found.
+func (n *Index) ExcludedFiles() ([]*ExcludedFile, error) {
+	b, err := ioutil.ReadFile(filepath.Join(n.Ref.dir, excludedFileJsonFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ExcludedFile
+	if err := json.Unmarshal(b, &files); err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		f.Kind = excludeKind(f.Reason)
+	}
+	return files, nil
+}
+
+// The number of files in the index.
+func (n *Index) NumFiles() int {
+	return n.numFiles
+}
+
+// The total size of the files in the index directory. The directory does
+// not change once built so the size is only computed once.
+func (n *Index) Size() (int64, error) {
+	n.sizeOnce.Do(func() {
+		n.sizeErr = filepath.Walk(n.Ref.dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.Mode().IsRegular() {
+				n.size += info.Size()
+			}
+			return nil
+		})
+	})
+	return n.size, n.sizeErr
+}
+
+// The lines as strings, each cut down to max bytes from its start when it
+// is longer and max is not 0. The cut falls between runes, so a line may be
+// a few bytes shorter than max.
+func trimLines(lines [][]byte, max int) []string {
 	strs := make([]string, len(lines))
 	for i, n := 0, len(lines); i < n; i++ {
-		strs[i] = string(lines[i])
+		line := lines[i]
+		if max > 0 && len(line) > max {
+			line = line[:runeEnd(line, max)]
+		}
+		strs[i] = string(line)
 	}
 	return strs
 }
 
+// Classify the tokens of the lines of the matches of the file, from the
+// first line of the context of each match on, returning the language of
+// the file. Empty if the language isn't known.
+func highlightMatches(name string, matches []*Match) string {
+	lang := highlight.ForFile(name)
+	if lang == nil || len(matches) == 0 {
+		return ""
+	}
+
+	for _, m := range matches {
+		h := lang.Highlighter()
+		t := &MatchTokens{
+			Before: make([][]highlight.Token, len(m.Before)),
+			After:  make([][]highlight.Token, len(m.After)),
+		}
+
+		for i, line := range m.Before {
+			t.Before[i] = h.Tokens(line)
+		}
+
+		t.Line = h.Tokens(m.Line)
+		for i, line := range m.After {
+			t.After[i] = h.Tokens(line)
+		}
+		m.Tokens = t
+	}
+	return lang.Name
+}
+
+// The offset of the start of the rune at i in b, or the next one when i
+// is in the middle of a rune.
+func runeStart(b []byte, i int) int {
+	for i < len(b) && !utf8.RuneStart(b[i]) {
+		i++
+	}
+	return i
+}
+
+// The offset of the start of the rune at i in b, or the previous one when i
+// is in the middle of a rune, so that b[:i] doesn't end in a split rune.
+func runeEnd(b []byte, i int) int {
+	for i > 0 && i < len(b) && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	return i
+}
+
+// Cut the line down to max bytes around the first match of re, which is
+// kept in the middle, or from its start if the match is longer. Returns
+// the part that is kept and its offset in the line. The cuts fall between
+// runes, so the part may be a few bytes shorter than max.
+func trimLine(line []byte, re *goregexp.Regexp, max int) ([]byte, int) {
+	start := 0
+	if loc := re.FindIndex(line); loc != nil {
+		start = loc[0] - (max-(loc[1]-loc[0]))/2
+		if start > loc[0] {
+			start = loc[0]
+		}
+	}
+
+	if start > len(line)-max {
+		start = len(line) - max
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	end := runeEnd(line, start+max)
+	start = runeStart(line, start)
+	if end < start {
+		end = start
+	}
+	return line[start:end], start
+}
+
 func GetRegexpPattern(pat string, ignoreCase bool) string {
 	if ignoreCase {
 		return "(?i)(?m)" + pat
@@ -141,22 +534,96 @@ func GetRegexpPattern(pat string, ignoreCase bool) string {
 	return "(?m)" + pat
 }
 
+// Compile the patterns the paths of the files to search must all match and
+// the one they must not match, which is nil when there is none.
+func compileFileRegexps(opt *SearchOptions) ([]*regexp.Regexp, *regexp.Regexp, error) {
+	var fres []*regexp.Regexp
+	for _, pat := range append([]string{opt.FileRegexp}, opt.FileRegexps...) {
+		if pat == "" {
+			continue
+		}
+
+		fre, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, nil, err
+		}
+		fres = append(fres, fre)
+	}
+
+	if opt.ExcludeFileRegexp == "" {
+		return fres, nil, nil
+	}
+
+	excludeFre, err := regexp.Compile(opt.ExcludeFileRegexp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fres, excludeFre, nil
+}
+
+// Determine whether the file with the given name is to be searched, which
+// it is when it matches every file pattern and not the exclude pattern.
+func searchesFile(fres []*regexp.Regexp, excludeFre *regexp.Regexp, name string) bool {
+	if !matchesAll(fres, name) {
+		return false
+	}
+	return excludeFre == nil || excludeFre.MatchString(name, true, true) <= 0
+}
+
+// Determine whether the name matches all of the patterns.
+func matchesAll(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name, true, true) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error) {
 	startedAt := time.Now()
 
 	n.lck.RLock()
 	defer n.lck.RUnlock()
 
-	patForRe := pat
-	if opt.LiteralSearch {
-		patForRe = regexp.QuoteMeta(pat)
+	n.tables.acquire(n)
+	defer n.tables.release(n)
+
+	fres, excludeFre, err := compileFileRegexps(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	owners, err := n.ownerRules()
+	if err != nil {
+		return nil, err
+	}
+
+	encodings, err := n.encodings()
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.Structural {
+		return n.searchStructural(pat, opt, fres, excludeFre, owners, encodings, startedAt)
 	}
 
-	re, err := regexp.Compile(GetRegexpPattern(patForRe, opt.IgnoreCase))
+	re, err := regexp.Compile(GetRegexpPattern(searchRegexp(pat, opt), opt.IgnoreCase))
 	if err != nil {
 		return nil, err
 	}
 
+	// the lines that are cut down are cut around where their match starts,
+	// and those whose matches are all in secrets are left out, which only
+	// the regexp package tells.
+	redactor := opt.Redactor
+	var lineRe *goregexp.Regexp
+	if opt.MaxLineLength > 0 || redactor != nil {
+		if lineRe, err = goregexp.Compile(re.String()); err != nil {
+			return nil, err
+		}
+	}
+
 	var (
 		g                grepper
 		results          []*FileMatch
@@ -164,62 +631,90 @@ func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error)
 		filesFound       int
 		filesCollected   int
 		matchesCollected int
+		truncated        bool
 	)
 
-	var fre *regexp.Regexp
-	if opt.FileRegexp != "" {
-		fre, err = regexp.Compile(opt.FileRegexp)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	var excludeFre *regexp.Regexp
-	if opt.ExcludeFileRegexp != "" {
-		excludeFre, err = regexp.Compile(opt.ExcludeFileRegexp)
-		if err != nil {
-			return nil, err
-		}
+	mt, err := n.openModTimes()
+	if err != nil {
+		return nil, err
 	}
+	defer mt.Close()
 
 	files := n.idx.PostingQuery(index.RegexpQuery(re.Syntax))
 	for _, file := range files {
+		if truncated {
+			break
+		}
+
 		var matches []*Match
+		var count int
 		name := n.idx.Name(file)
 		hasMatch := false
 
-		// reject files that do not match the file pattern
-		if fre != nil && fre.MatchString(name, true, true) < 0 {
+		if !searchesFile(fres, excludeFre, name) {
 			continue
 		}
 
-		// reject files that match the exclude file pattern
-		if excludeFre != nil && excludeFre.MatchString(name, true, true) > 0 {
+		fileOwners := ownersOf(owners, name)
+		if !ownedBy(fileOwners, opt.Owner) {
+			continue
+		}
+
+		raw := filepath.Join(n.Ref.dir, "raw", name)
+		mtime, err := mt.of(file, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if !opt.ModifiedAfter.IsZero() && !mtime.After(opt.ModifiedAfter) {
 			continue
 		}
 
 		filesOpened++
-		if err := g.grep2File(filepath.Join(n.Ref.dir, "raw", name), re, int(opt.LinesOfContext),
+		if err := g.grep2File(raw, re, int(opt.LinesOfContext),
 			func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error) {
+				if redactor.Hides(line, lineRe) {
+					return true, nil
+				}
 
 				hasMatch = true
 				if filesFound < opt.Offset || (opt.Limit > 0 && filesCollected >= opt.Limit) {
 					return false, nil
 				}
 
+				if opt.CountOnly {
+					count++
+					return true, nil
+				}
+
 				matchesCollected++
-				matches = append(matches, &Match{
-					Line:       string(line),
+				m := &Match{
 					LineNumber: lineno,
-					Before:     toStrings(before),
-					After:      toStrings(after),
-				})
+					Before:     trimLines(redactor.Lines(before), opt.MaxLineLength),
+					After:      trimLines(redactor.Lines(after), opt.MaxLineLength),
+				}
+
+				// secrets are masked before the line is cut, so none is
+				// cut in two and left partly unmasked.
+				line = redactor.Bytes(line)
+
+				if max := opt.MaxLineLength; max > 0 && len(line) > max {
+					m.LineLength = len(line)
+					line, m.LineStart = trimLine(line, lineRe, max)
+				}
+				m.Line = string(line)
+				matches = append(matches, m)
 
 				if matchesCollected > matchLimit {
 					return false, fmt.Errorf("search exceeds limit on matches: %d", matchLimit)
 				}
 
-				return true, nil
+				if opt.MaxMatches > 0 && matchesCollected >= opt.MaxMatches {
+					truncated = true
+					return false, nil
+				}
+
+				return opt.MaxPerFile <= 0 || len(matches) < opt.MaxPerFile, nil
 			}); err != nil {
 			return nil, err
 		}
@@ -228,12 +723,38 @@ func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error)
 			continue
 		}
 
+		if style := blockStyleOf(name); opt.BlockContext && style != noBlocks && len(matches) > 0 {
+			src, err := readRawFile(raw)
+			if err != nil {
+				return nil, err
+			}
+			setBlockContext(src, matches, style, opt.MaxLineLength, redactor)
+		}
+
+		var lang string
+		if opt.Highlight {
+			lang = highlightMatches(name, matches)
+		}
+
 		filesFound++
-		if len(matches) > 0 {
+		if len(matches) > 0 || count > 0 {
+			var hash string
+			if opt.Hash {
+				if hash, err = hashFile(raw); err != nil {
+					return nil, err
+				}
+			}
+
 			filesCollected++
 			results = append(results, &FileMatch{
 				Filename: name,
 				Matches:  matches,
+				Count:    count,
+				Hash:     hash,
+				ModTime:  mtime,
+				Owners:   fileOwners,
+				Encoding: encodings[name],
+				Language: lang,
 			})
 		}
 	}
@@ -244,32 +765,70 @@ func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error)
 		FilesOpened:    filesOpened,
 		Duration:       time.Now().Sub(startedAt), //nolint
 		Revision:       n.Ref.Rev,
+		Truncated:      truncated,
 	}, nil
 }
 
-func isTextFile(filename string) (bool, error) {
+// The hex encoded SHA-1 of the contents of a gzipped raw file.
+func hashFile(filename string) (string, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	defer gr.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, gr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Read the start of a file to determine whether it is a text file and
+// whether it appears to be minified. Files with NUL bytes or invalid
+// UTF-8 are not text. A text file whose first filePeekSize bytes hold no
+// line break is assumed to be minified.
+func peekFile(filename string) (txt bool, minified bool, err error) {
 	buf := make([]byte, filePeekSize)
 	r, err := os.Open(filename)
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
 	defer r.Close()
 
 	n, err := io.ReadFull(r, buf)
 	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
-		return false, err
+		return false, false, err
 	}
 
 	buf = buf[:n]
 
+	if bytes.IndexByte(buf, 0) >= 0 {
+		return false, false, nil
+	}
+
 	if n < filePeekSize {
 		// read the whole file, must be valid.
-		return utf8.Valid(buf), nil
+		return utf8.Valid(buf), false, nil
 	}
 
 	// read a prefix, allow trailing partial runes.
-	return validUTF8IgnoringPartialTrailingRune(buf), nil
+	return validUTF8IgnoringPartialTrailingRune(buf), bytes.IndexByte(buf, '\n') < 0, nil
+}
 
+func hasMinifiedSuffix(name string) bool {
+	for _, suffix := range minifiedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
 }
 
 // Determines if the buffer contains valid UTF8 encoded string data. The buffer is assumed
@@ -298,17 +857,23 @@ func validUTF8IgnoringPartialTrailingRune(p []byte) bool {
 	return true
 }
 
-func addFileToIndex(ix *index.IndexWriter, dst, src, path string) (string, error) {
+// Add the file at path to the index and keep a copy of it. When content
+// is given the file is indexed, and kept, with it instead.
+func addFileToIndex(ix *index.IndexWriter, dst, src, path string, content []byte) (string, error) {
 	rel, err := filepath.Rel(src, path)
 	if err != nil {
 		return "", err
 	}
 
-	r, err := os.Open(path)
-	if err != nil {
-		return "", err
+	var r io.Reader = bytes.NewReader(content)
+	if content == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
 	}
-	defer r.Close()
 
 	dup := filepath.Join(dst, "raw", rel)
 	w, err := os.Create(dup)
@@ -358,10 +923,25 @@ func containsString(haystack []string, needle string) bool {
 }
 
 func indexAllFiles(opt *IndexOptions, dst, src string) error {
+	// The source may be a link to a directory (i.e. the local vcs), which
+	// filepath.Walk would not descend into.
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+
 	ix := index.Create(filepath.Join(dst, "tri"))
 	defer ix.Close()
 
 	excluded := []*ExcludedFile{}
+	var times []time.Time
+	encodings := map[string]string{}
+	licenses := newLicenseCollector()
+	ign := newIgnorer(src, opt)
+	paths := &pathFilter{
+		include: opt.IncludePaths,
+		exclude: opt.ExcludePaths,
+	}
 
 	// Make a file to store the excluded files for this repo
 	fileHandle, err := os.Create(filepath.Join(dst, "excluded_files.json"))
@@ -392,43 +972,117 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 			}
 
 			excluded = append(excluded, &ExcludedFile{
-				rel,
-				reasonDotFile,
+				Filename: rel,
+				Reason:   reasonDotFile,
 			})
 			return nil
 		}
 
+		// Ignore rules are matched against slash separated paths.
+		slashRel := filepath.ToSlash(rel)
+		if rel != "." {
+			reason := ""
+			if ign.isIgnored(slashRel, info.IsDir()) {
+				reason = reasonIgnored
+			} else if ign.isVendored(slashRel, info.IsDir()) {
+				reason = reasonVendored
+			} else {
+				reason = paths.reasonFor(slashRel, info.IsDir())
+			}
+
+			if reason != "" {
+				excluded = append(excluded, &ExcludedFile{
+					Filename: rel,
+					Reason:   reason,
+				})
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
 		if info.IsDir() {
+			if err := ign.loadDir(slashRel); err != nil {
+				return err
+			}
 			return addDirToIndex(dst, src, path)
 		}
 
 		if info.Mode()&os.ModeType != 0 {
 			excluded = append(excluded, &ExcludedFile{
-				rel,
-				reasonInvalidMode,
+				Filename: rel,
+				Reason:   reasonInvalidMode,
 			})
 			return nil
 		}
 
-		txt, err := isTextFile(path)
-		if err != nil {
+		if opt.MaxFileSize > 0 && info.Size() > opt.MaxFileSize {
+			excluded = append(excluded, &ExcludedFile{
+				Filename: rel,
+				Reason:   reasonTooLarge,
+			})
+			return nil
+		}
+
+		// files that aren't UTF-8 are indexed transcoded.
+		var content []byte
+		var enc string
+		if len(opt.Encodings) > 0 {
+			if content, enc, err = decodeFile(path, opt.Encodings); err != nil {
+				return err
+			}
+		}
+
+		txt, minified := true, false
+		if content != nil {
+			minified = len(content) >= filePeekSize && bytes.IndexByte(content[:filePeekSize], '\n') < 0
+		} else if txt, minified, err = peekFile(path); err != nil {
 			return err
 		}
 
 		if !txt {
 			excluded = append(excluded, &ExcludedFile{
-				rel,
-				reasonNotText,
+				Filename: rel,
+				Reason:   reasonNotText,
+			})
+			return nil
+		}
+
+		if opt.ExcludeMinifiedFiles && (minified || hasMinifiedSuffix(name)) {
+			excluded = append(excluded, &ExcludedFile{
+				Filename: rel,
+				Reason:   reasonMinified,
 			})
 			return nil
 		}
 
-		reasonForExclusion, err := addFileToIndex(ix, dst, src, path)
+		fileid := ix.NumNames()
+		reasonForExclusion, err := addFileToIndex(ix, dst, src, path, content)
 		if err != nil {
 			return err
 		}
+
+		if enc != "" && ix.NumNames() > fileid {
+			encodings[rel] = enc
+		}
+
+		// the time the file last changed is kept by file id, so results
+		// can be ordered and filtered by it.
+		if ix.NumNames() > fileid {
+			mtime, ok := opt.ModTimes[pathpkg.Join(opt.Subdir, filepath.ToSlash(rel))]
+			if !ok {
+				mtime = info.ModTime()
+			}
+			times = append(times, mtime)
+
+			if err := licenses.add(rel, path, content); err != nil {
+				return err
+			}
+		}
+
 		if reasonForExclusion != "" {
-			excluded = append(excluded, &ExcludedFile{rel, reasonForExclusion})
+			excluded = append(excluded, &ExcludedFile{Filename: rel, Reason: reasonForExclusion})
 		}
 
 		return nil
@@ -444,7 +1098,17 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 
 	ix.Flush()
 
-	return nil
+	if len(encodings) > 0 {
+		if err := writeEncodingsJson(dst, encodings); err != nil {
+			return err
+		}
+	}
+
+	if err := licenses.write(dst); err != nil {
+		return err
+	}
+
+	return writeModTimes(dst, times)
 }
 
 // Read the metadata for the index directory. Note that even if this
@@ -456,7 +1120,7 @@ func Read(dir string) (*IndexRef, error) {
 		dir: dir,
 	}
 
-	r, err := os.Open(filepath.Join(dir, manifestFilename))
+	r, err := os.Open(filepath.Join(dir, ManifestFilename))
 	if err != nil {
 		return m, err
 	}
@@ -469,7 +1133,37 @@ func Read(dir string) (*IndexRef, error) {
 	return m, nil
 }
 
+// The directory of src that is indexed, which has to be inside of it even
+// when a link leads there.
+func sourceRoot(opt *IndexOptions, src string) (string, error) {
+	if opt.Subdir == "" {
+		return src, nil
+	}
+
+	base, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(filepath.Join(base, filepath.FromSlash(opt.Subdir)))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("subdir %s does not exist", opt.Subdir)
+	} else if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(base, root); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("subdir %s is outside of the repo", opt.Subdir)
+	}
+	return root, nil
+}
+
 func Build(opt *IndexOptions, dst, src, url, rev string) (*IndexRef, error) {
+	src, err := sourceRoot(opt, src)
+	if err != nil {
+		return nil, err
+	}
+
 	if _, err := os.Stat(dst); err != nil {
 		if err := os.MkdirAll(dst, os.ModePerm); err != nil {
 			return nil, err
@@ -484,11 +1178,24 @@ func Build(opt *IndexOptions, dst, src, url, rev string) (*IndexRef, error) {
 		return nil, err
 	}
 
+	if err := writeOwnersJson(dst, src); err != nil {
+		return nil, err
+	}
+
+	if err := writeDepsJson(dst, src); err != nil {
+		return nil, err
+	}
+
+	if err := writeChecksums(dst); err != nil {
+		return nil, err
+	}
+
 	r := &IndexRef{
-		Url:  url,
-		Rev:  rev,
-		Time: time.Now(),
-		dir:  dst,
+		Url:         url,
+		Rev:         rev,
+		Time:        time.Now(),
+		OptionsHash: opt.Hash(),
+		dir:         dst,
 	}
 
 	if err := r.writeManifest(); err != nil {
@@ -498,12 +1205,13 @@ func Build(opt *IndexOptions, dst, src, url, rev string) (*IndexRef, error) {
 	return r, nil
 }
 
-// Open the index in dir for searching.
-func Open(dir string) (*Index, error) {
+// Open the index in dir for searching, with its trigram table among the
+// tables.
+func Open(dir string, tables *MappedTables) (*Index, error) {
 	r, err := Read(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	return r.Open()
+	return r.OpenWith(tables)
 }
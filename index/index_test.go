@@ -1,11 +1,19 @@
 package index
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hound-search/hound/highlight"
+	"github.com/hound-search/hound/redact"
 )
 
 const (
@@ -59,6 +67,313 @@ func TestSearch(t *testing.T) {
 	}
 }
 
+func TestSearchCountOnly(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	opt := &SearchOptions{FileRegexps: []string{`\.go$`, `^index`}}
+	res, err := idx.Search("func ", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt.CountOnly = true
+	counts, err := idx.Search("func ", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) == 0 || len(counts.Matches) != len(res.Matches) {
+		t.Fatalf("expected %d files, got %d", len(res.Matches), len(counts.Matches))
+	}
+
+	for i, fm := range counts.Matches {
+		if fm.Matches != nil || fm.Count != len(res.Matches[i].Matches) {
+			t.Fatalf("expected a count of %d for %s, got %+v", len(res.Matches[i].Matches), fm.Filename, fm)
+		}
+	}
+}
+
+func TestSearchMaxMatches(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("func ", &SearchOptions{MaxPerFile: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fm := range res.Matches {
+		if len(fm.Matches) > 2 {
+			t.Fatalf("expected at most 2 matches in %s, got %d", fm.Filename, len(fm.Matches))
+		}
+	}
+
+	if res.Truncated {
+		t.Fatal("expected a search without MaxMatches not to be truncated")
+	}
+
+	res, err = idx.Search("func ", &SearchOptions{MaxMatches: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for _, fm := range res.Matches {
+		n += len(fm.Matches)
+	}
+
+	if n != 3 || !res.Truncated {
+		t.Fatalf("expected 3 matches and a truncated search, got %d, %v", n, res.Truncated)
+	}
+}
+
+func TestSearchWholeWord(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	for _, test := range []struct {
+		pat     string
+		literal bool
+		matches bool
+	}{
+		// split so this file doesn't match it as a whole word.
+		{"SearchOptio" + "n", false, false},
+		{"SearchOptions", false, true},
+		{"Search(", true, true},
+		{"Sea.ch", false, true},
+	} {
+		res, err := idx.Search(test.pat, &SearchOptions{WholeWord: true, LiteralSearch: test.literal})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := len(res.Matches) > 0; got != test.matches {
+			t.Errorf("expected matches for %q to be %v, got %v", test.pat, test.matches, got)
+		}
+	}
+}
+
+func TestSearchHash(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("package index", &SearchOptions{Hash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) == 0 {
+		t.Fatal("expected matches")
+	}
+
+	for _, fm := range res.Matches {
+		b, err := ioutil.ReadFile(filepath.Join(thisDir(), fm.Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := fmt.Sprintf("%x", sha1.Sum(b)); fm.Hash != want {
+			t.Fatalf("expected a hash of %s for %s, got %s", want, fm.Filename, fm.Hash)
+		}
+
+		fi, err := os.Stat(filepath.Join(thisDir(), fm.Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !fm.ModTime.Equal(fi.ModTime()) {
+			t.Fatalf("expected %s to have been modified at %s, got %s", fm.Filename, fi.ModTime(), fm.ModTime)
+		}
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("^package index$", &SearchOptions{Highlight: true, LinesOfContext: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) == 0 {
+		t.Fatal("expected matches")
+	}
+
+	for _, fm := range res.Matches {
+		m := fm.Matches[0]
+		if fm.Language != "go" || m.Tokens == nil || len(m.Tokens.Line) != 1 || m.Tokens.Line[0].Kind != highlight.Keyword {
+			t.Fatalf("expected package to be a go keyword in %s, got %+v", fm.Filename, m.Tokens)
+		}
+
+		if len(m.Tokens.After) != len(m.After) {
+			t.Fatalf("expected the tokens of every line of context in %s", fm.Filename)
+		}
+	}
+}
+
+// Tests that secrets are masked in the lines searches return and that lines
+// whose matches are all in secrets are left out.
+func TestSearchRedacted(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	r, err := redact.New([]string{`^package (index)$`}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := idx.Search("^package", &SearchOptions{Redactor: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var masked int
+	for _, fm := range res.Matches {
+		switch fm.Matches[0].Line {
+		case "package index":
+			t.Fatalf("expected the package name to be masked in %s", fm.Filename)
+		case "package *****":
+			masked++
+		}
+	}
+
+	if masked == 0 {
+		t.Fatal("expected masked package names")
+	}
+
+	if res, err = idx.Search("^package ind", &SearchOptions{Redactor: r}); err != nil {
+		t.Fatal(err)
+	} else if len(res.Matches) != 0 {
+		t.Fatalf("expected no matches in a secret, got %d", len(res.Matches))
+	}
+
+	if res, err = idx.Search("package index\n\nimport", &SearchOptions{Structural: true, Redactor: r}); err != nil {
+		t.Fatal(err)
+	} else if len(res.Matches) != 0 {
+		t.Fatalf("expected no structural matches in a secret, got %d", len(res.Matches))
+	}
+}
+
+// Tests that long lines are cut down around their match and between runes.
+func TestTrimLine(t *testing.T) {
+	long := strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100)
+	for _, test := range []struct {
+		line, pat string
+		max       int
+		part      string
+		start     int
+	}{
+		{long, "needle", 16, "aaaaaneedlebbbbb", 95},
+		{long, "aaa", 10, "aaaaaaaaaa", 0},
+		{long, "bbb$", 10, "bbbbbbbbbb", 196},
+		{long, "a+needle", 10, long[0:10], 0},
+		{long, "nothing", 4, "aaaa", 0},
+		// the cuts move inside the limit rather than split a rune.
+		{"ééééé x ééééé", "x", 6, " x é", 10},
+		{"ééééé x ééééé", "x", 4, " x ", 10},
+	} {
+		part, start := trimLine([]byte(test.line), regexp.MustCompile(test.pat), test.max)
+		if string(part) != test.part || start != test.start {
+			t.Errorf("%q in %d bytes: expected %q at %d, got %q at %d", test.pat, test.max, test.part, test.start, part, start)
+		}
+	}
+
+	lines := trimLines([][]byte{[]byte("short"), []byte("a longer line")}, 6)
+	if lines[0] != "short" || lines[1] != "a long" {
+		t.Errorf("expected the context to be cut from its start, got %q", lines)
+	}
+
+	lines = trimLines([][]byte{[]byte("abéé")}, 5)
+	if lines[0] != "abé" {
+		t.Errorf("expected the cut to move inside the limit rather than split a rune, got %q", lines)
+	}
+}
+
+func TestModTimes(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	opt := &IndexOptions{ModTimes: map[string]time.Time{"index.go": changed}}
+	ref, err := Build(opt, dir, thisDir(), url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("package index", &SearchOptions{ModifiedAfter: changed.Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) != 1 || res.Matches[0].Filename != "index.go" || !res.Matches[0].ModTime.Equal(changed) {
+		t.Fatalf("expected only index.go to have changed at %s, got %+v", changed, res.Matches)
+	}
+}
+
 func TestRemove(t *testing.T) {
 	ref, err := buildIndex(url, rev)
 	if err != nil {
@@ -94,9 +409,169 @@ func TestRead(t *testing.T) {
 		t.Fatalf("expected rev of %s, got %s", rev, r.Rev)
 	}
 
+	var opt IndexOptions
+	if r.OptionsHash != opt.Hash() {
+		t.Fatalf("expected options hash of %s, got %s", opt.Hash(), r.OptionsHash)
+	}
+
 	idx, err := r.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer idx.Close()
 }
+
+func TestOptionsHash(t *testing.T) {
+	a := &IndexOptions{ExcludeDotFiles: true, SpecialFiles: []string{".git"}}
+	b := &IndexOptions{ExcludeDotFiles: true, SpecialFiles: []string{".git"}}
+	if a.Hash() != b.Hash() {
+		t.Fatal("expected equal options to hash the same")
+	}
+
+	b.ExcludePaths = []string{"docs/**"}
+	if a.Hash() == b.Hash() {
+		t.Fatal("expected different options to hash differently")
+	}
+}
+
+// Tests that large, binary and minified files are left out of the index.
+func TestExcludeLargeBinaryAndMinifiedFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string][]byte{
+		"small.txt":     []byte("needle\n"),
+		"large.txt":     []byte("needle\n" + strings.Repeat("x\n", 4096)),
+		"binary.dat":    []byte("needle\n\x00\x01"),
+		"bundle.min.js": []byte("needle\n"),
+		"bundle.js":     []byte("needle " + strings.Repeat("x", filePeekSize)),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	opt := &IndexOptions{
+		MaxFileSize:          4096,
+		ExcludeMinifiedFiles: true,
+	}
+	ref, err := Build(opt, filepath.Join(dst, "idx"), src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	excluded, err := idx.ExcludedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]string{}
+	kinds := map[string]string{}
+	for _, e := range excluded {
+		reasons[e.Filename] = e.Reason
+		kinds[e.Filename] = e.Kind
+	}
+
+	expected := map[string]string{
+		"large.txt":     reasonTooLarge,
+		"binary.dat":    reasonNotText,
+		"bundle.min.js": reasonMinified,
+		"bundle.js":     reasonMinified,
+	}
+	for name, reason := range expected {
+		if reasons[name] != reason {
+			t.Errorf("expected %s to be excluded with %q, got %q", name, reason, reasons[name])
+		}
+	}
+
+	if kinds["large.txt"] != ExcludeSize || kinds["binary.dat"] != ExcludeBinary || kinds["bundle.js"] != ExcludeMinified {
+		t.Errorf("unexpected kinds: %v", kinds)
+	}
+
+	if _, ok := reasons["small.txt"]; ok {
+		t.Error("small.txt should not be excluded")
+	}
+}
+
+// Tests that only the subdir of the source is indexed, with paths relative
+// to it, and that it has to be inside of the source.
+func TestSubdir(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.MkdirAll(filepath.Join(src, "services", "payments"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"services/payments/pay.go": "needle\n",
+		"services/ledger.go":       "needle\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	changed := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	opt := &IndexOptions{
+		Subdir:   "services/payments",
+		ModTimes: map[string]time.Time{"services/payments/pay.go": changed},
+	}
+	ref, err := Build(opt, filepath.Join(dst, "idx"), src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("needle", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) != 1 || res.Matches[0].Filename != "pay.go" || !res.Matches[0].ModTime.Equal(changed) {
+		t.Fatalf("expected only pay.go, changed at %s, got %+v", changed, res.Matches)
+	}
+
+	if _, err := Build(&IndexOptions{Subdir: "missing"}, filepath.Join(dst, "missing"), src, url, rev); err == nil {
+		t.Error("expected an error for a missing subdir")
+	}
+
+	if err := os.Symlink(dst, filepath.Join(src, "out")); err != nil {
+		t.Skip(err)
+	}
+
+	if _, err := Build(&IndexOptions{Subdir: "out"}, filepath.Join(dst, "out"), src, url, rev); err == nil {
+		t.Error("expected an error for a subdir outside of the source")
+	}
+}
@@ -0,0 +1,247 @@
+package index
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	goregexp "regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	licensesJsonFilename = "licenses.json"
+
+	// The bytes at the start of a file its SPDX tags are looked for in, and
+	// the most of a license file that is read.
+	licenseHeaderSize = 4096
+	maxLicenseSize    = 256 << 10
+
+	// The license of a license file whose text isn't recognized, as SPDX
+	// documents write it.
+	unknownLicense = "NOASSERTION"
+)
+
+// The licenses and copyrights found in a directory of the repo, "." for its
+// root. The license files in it cover it and the directories below, the
+// SPDX tags only the files that have them.
+type DirLicenses struct {
+	Dir string
+
+	// The license files in the directory, by name, with the SPDX
+	// identifier of the license each is recognized as.
+	Files map[string]string `json:",omitempty"`
+
+	// The SPDX license expressions in the headers of the files in the
+	// directory, with the number of files that have each.
+	Headers map[string]int `json:",omitempty"`
+
+	// The copyright notices of the license files and the
+	// SPDX-FileCopyrightText of the files, each once.
+	Copyrights []string `json:",omitempty"`
+}
+
+var (
+	licenseFileRegexp   = goregexp.MustCompile(`(?i)^(?:(?:un)?licen[cs]e|copying|copyright)(?:$|[-._])`)
+	spdxLicenseRegexp   = goregexp.MustCompile(`SPDX-License-Identifier:[ \t]*([^\r\n]+)`)
+	spdxCopyrightRegexp = goregexp.MustCompile(`SPDX-FileCopyrightText:[ \t]*([^\r\n]+)`)
+	copyrightRegexp     = goregexp.MustCompile(`(?im)^[ \t]*(copyright[ \t]+(?:\(c\)|©)?[ \t]*\d{4}[^\r\n]*)`)
+)
+
+// The phrases that recognize the text of a license, all of which it must
+// have. They are tried in order, so licenses whose texts contain the
+// phrases of others come first.
+var licenseTexts = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+// The SPDX identifier of the license of a license file, from its SPDX tag
+// or else from its text.
+func recognizeLicense(text []byte) string {
+	if m := spdxLicenseRegexp.FindSubmatch(text); m != nil {
+		return spdxValue(m[1])
+	}
+
+	// the phrases may be wrapped anywhere.
+	norm := strings.ToLower(strings.Join(strings.Fields(string(text)), " "))
+	for _, l := range licenseTexts {
+		found := true
+		for _, p := range l.phrases {
+			if !strings.Contains(norm, p) {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return l.id
+		}
+	}
+	return unknownLicense
+}
+
+// The value of an SPDX tag without the end of the comment it is in.
+func spdxValue(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	for _, end := range []string{"*/", "-->", "*)", "#}"} {
+		s = strings.TrimSpace(strings.TrimSuffix(s, end))
+	}
+	return s
+}
+
+// Read up to n bytes from the start of the file at path, or of content
+// when it is given.
+func readHead(path string, content []byte, n int) ([]byte, error) {
+	if content != nil {
+		if len(content) > n {
+			content = content[:n]
+		}
+		return content, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(io.LimitReader(f, int64(n)))
+}
+
+// Collects the licenses of the files as they are indexed.
+type licenseCollector struct {
+	dirs       map[string]*DirLicenses
+	copyrights map[string]bool
+}
+
+func newLicenseCollector() *licenseCollector {
+	return &licenseCollector{
+		dirs:       map[string]*DirLicenses{},
+		copyrights: map[string]bool{},
+	}
+}
+
+func (c *licenseCollector) dir(name string) *DirLicenses {
+	d := c.dirs[name]
+	if d == nil {
+		d = &DirLicenses{Dir: name}
+		c.dirs[name] = d
+	}
+	return d
+}
+
+func (c *licenseCollector) addCopyright(d *DirLicenses, notice string) {
+	key := d.Dir + "\x00" + notice
+	if !c.copyrights[key] {
+		c.copyrights[key] = true
+		d.Copyrights = append(d.Copyrights, notice)
+	}
+}
+
+// Find the license of the file at rel when it is a license file and the
+// SPDX tags at its start, from the file at path or from content when it is
+// given.
+func (c *licenseCollector) add(rel, path string, content []byte) error {
+	slashRel := filepath.ToSlash(rel)
+	name := pathpkg.Base(slashRel)
+	isLicense := licenseFileRegexp.MatchString(name)
+
+	size := licenseHeaderSize
+	if isLicense {
+		size = maxLicenseSize
+	}
+
+	text, err := readHead(path, content, size)
+	if err != nil {
+		return err
+	}
+
+	d := c.dir(pathpkg.Dir(slashRel))
+	if isLicense {
+		if d.Files == nil {
+			d.Files = map[string]string{}
+		}
+		d.Files[name] = recognizeLicense(text)
+
+		// the GNU licenses carry a notice of their own.
+		for _, m := range copyrightRegexp.FindAllSubmatch(text, -1) {
+			if notice := strings.TrimSpace(string(m[1])); !strings.Contains(notice, "Free Software Foundation") {
+				c.addCopyright(d, notice)
+			}
+		}
+	}
+
+	if len(text) > licenseHeaderSize {
+		text = text[:licenseHeaderSize]
+	}
+
+	if m := spdxLicenseRegexp.FindSubmatch(text); m != nil && !isLicense {
+		if d.Headers == nil {
+			d.Headers = map[string]int{}
+		}
+		d.Headers[spdxValue(m[1])]++
+	}
+
+	for _, m := range spdxCopyrightRegexp.FindAllSubmatch(text, -1) {
+		c.addCopyright(d, spdxValue(m[1]))
+	}
+	return nil
+}
+
+// Keep what was found with the index in dst, in the order of the
+// directories.
+func (c *licenseCollector) write(dst string) error {
+	var dirs []*DirLicenses
+	for _, d := range c.dirs {
+		if len(d.Files) > 0 || len(d.Headers) > 0 || len(d.Copyrights) > 0 {
+			dirs = append(dirs, d)
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Dir < dirs[j].Dir
+	})
+
+	b, err := json.Marshal(dirs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, licensesJsonFilename), b, 0644)
+}
+
+// The licenses and copyrights found in the directories of the indexed
+// revision. Indexes built before licenses were collected have none.
+func (n *Index) Licenses() ([]*DirLicenses, error) {
+	n.licensesOnce.Do(func() {
+		b, err := ioutil.ReadFile(filepath.Join(n.Ref.dir, licensesJsonFilename))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			n.licensesErr = err
+			return
+		}
+		n.licensesErr = json.Unmarshal(b, &n.licenses)
+	})
+	return n.licenses, n.licensesErr
+}
@@ -0,0 +1,112 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const mitLicense = `MIT License
+
+Copyright (c) 2019 Example Authors
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction.
+`
+
+const bsdLicense = `Copyright 2009 The Example Authors.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+   * Neither the name of Example nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+`
+
+func TestRecognizeLicense(t *testing.T) {
+	testCases := []struct {
+		text, id string
+	}{
+		{mitLicense, "MIT"},
+		{bsdLicense, "BSD-3-Clause"},
+		{"Apache License\n  Version 2.0, January 2004", "Apache-2.0"},
+		{"GNU GENERAL PUBLIC LICENSE\n   Version 3, 29 June 2007", "GPL-3.0"},
+		{"GNU LESSER GENERAL PUBLIC\nLICENSE Version 2.1", "LGPL-2.1"},
+		{"SPDX-License-Identifier: MPL-2.0 OR MIT", "MPL-2.0 OR MIT"},
+		{"All rights reserved.", unknownLicense},
+	}
+	for _, testCase := range testCases {
+		if got := recognizeLicense([]byte(testCase.text)); got != testCase.id {
+			t.Errorf("%.30q: expected %s, got %s", testCase.text, testCase.id, got)
+		}
+	}
+}
+
+func TestLicenses(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"LICENSE":               mitLicense,
+		"main.go":               "// SPDX-License-Identifier: MIT\n\npackage main\n",
+		"third_party/x/COPYING": bsdLicense,
+		"third_party/x/a.c":     "/* SPDX-License-Identifier: BSD-3-Clause */\n/* SPDX-FileCopyrightText: 2020 X Inc. */\n",
+		"third_party/x/b.c":     "/* SPDX-License-Identifier: BSD-3-Clause */\n",
+		"third_party/x/c.c":     "int c;\n",
+	}
+	for name, body := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ref, err := buildIndexOf(&IndexOptions{}, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	dirs, err := idx.Licenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*DirLicenses{
+		{
+			Dir:        ".",
+			Files:      map[string]string{"LICENSE": "MIT"},
+			Headers:    map[string]int{"MIT": 1},
+			Copyrights: []string{"Copyright (c) 2019 Example Authors"},
+		},
+		{
+			Dir:        "third_party/x",
+			Files:      map[string]string{"COPYING": "BSD-3-Clause"},
+			Headers:    map[string]int{"BSD-3-Clause": 2},
+			Copyrights: []string{"Copyright 2009 The Example Authors.", "2020 X Inc."},
+		},
+	}
+	if !reflect.DeepEqual(dirs, want) {
+		for _, d := range dirs {
+			t.Logf("%+v", *d)
+		}
+		t.Fatal("expected the licenses of . and third_party/x")
+	}
+}
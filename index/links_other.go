@@ -0,0 +1,10 @@
+// +build !linux,!darwin,!freebsd
+
+package index
+
+import "os"
+
+// The number of links to a file is only known where stat reports it.
+func LinkCount(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
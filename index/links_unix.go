@@ -0,0 +1,17 @@
+// +build linux darwin freebsd
+
+package index
+
+import (
+	"os"
+	"syscall"
+)
+
+// The number of links to the file, and whether it is known.
+func LinkCount(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Nlink), true
+}
@@ -0,0 +1,225 @@
+package index
+
+import (
+	"fmt"
+	goregexp "regexp"
+	"regexp/syntax"
+
+	"github.com/hound-search/hound/codesearch/index"
+	"github.com/hound-search/hound/codesearch/regexp"
+)
+
+// Limits past which patterns are refused before they are searched for.
+const (
+	// the instructions of the compiled pattern.
+	maxPatternInsts = 10000
+
+	// the branches of an alternation that repeats without bound in them,
+	// which the matcher tries at every character of every line.
+	maxRepeatedAlternates = 64
+
+	// the repetitions of any character past which a pattern is warned
+	// about.
+	maxAnyRepeats = 3
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// A problem with a pattern. Searches refuse patterns with errors, warnings
+// tell why a search may be slow or match more than was meant.
+type PatternProblem struct {
+	Severity string
+	Message  string
+}
+
+// The regular expression a search matches lines with, before it is made
+// to ignore case.
+func searchRegexp(pat string, opt *SearchOptions) string {
+	if opt.LiteralSearch {
+		pat = regexp.QuoteMeta(pat)
+	}
+
+	// like grep -w, the match must be at the start of the line or after a
+	// non-word character and at the end or before one. Unlike \b this also
+	// holds for patterns that start or end with a non-word character.
+	if opt.WholeWord {
+		pat = `(?:^|[^\w\n])(?:` + pat + `)(?:[^\w\n]|$)`
+	}
+	return pat
+}
+
+// Whether the regexp repeats any character without bound, like .* and .+
+// do.
+func repeatsAny(re *syntax.Regexp) bool {
+	if re.Op != syntax.OpStar && re.Op != syntax.OpPlus && (re.Op != syntax.OpRepeat || re.Max != -1) {
+		return false
+	}
+
+	sub := re.Sub[0]
+	return sub.Op == syntax.OpAnyChar || sub.Op == syntax.OpAnyCharNotNL
+}
+
+// Whether the regexp repeats anything without bound.
+func repeatsUnbounded(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpStar || re.Op == syntax.OpPlus || (re.Op == syntax.OpRepeat && re.Max == -1) {
+		return true
+	}
+
+	for _, sub := range re.Sub {
+		if repeatsUnbounded(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the problems of the parsed pattern that are in its structure.
+func lintRegexp(re *syntax.Regexp, problems []*PatternProblem, anyRepeats *int) []*PatternProblem {
+	if repeatsAny(re) {
+		*anyRepeats++
+	}
+
+	if re.Op == syntax.OpAlternate && len(re.Sub) > maxRepeatedAlternates && repeatsUnbounded(re) {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityError,
+			Message: fmt.Sprintf("an alternation of %d branches that repeat without bound, like .* does, is too slow to search for, use at most %d",
+				len(re.Sub), maxRepeatedAlternates),
+		})
+	}
+
+	for _, sub := range re.Sub {
+		problems = lintRegexp(sub, problems, anyRepeats)
+	}
+	return problems
+}
+
+// Find the problems of a pattern before it is searched for, with the
+// options of the search. A pattern that doesn't parse is an error rather
+// than a problem.
+func LintPattern(pat string, opt *SearchOptions) ([]*PatternProblem, error) {
+	if opt.Structural {
+		_, err := parseTemplate(pat)
+		return nil, err
+	}
+
+	// the problems are those of the pattern as it was given, which a whole
+	// word search only wraps.
+	expr := GetRegexpPattern(searchRegexp(pat, &SearchOptions{LiteralSearch: opt.LiteralSearch}), opt.IgnoreCase)
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	sre, err := goregexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	// a pattern that matches an empty string in any line, like a* does,
+	// rather than only in empty lines, like ^$ does, matches every line.
+	var problems []*PatternProblem
+	if sre.MatchString("") && sre.MatchString("\x00") {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityError,
+			Message:  "the pattern matches an empty string in any line, so it matches every line",
+		})
+	}
+
+	var anyRepeats int
+	problems = lintRegexp(re, problems, &anyRepeats)
+
+	if anyRepeats > maxAnyRepeats {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("the pattern repeats any character %d times, like .* does, which makes searching for it slow", anyRepeats),
+		})
+	}
+
+	if re.Op == syntax.OpConcat && len(re.Sub) > 1 && (repeatsAny(re.Sub[0]) || repeatsAny(re.Sub[len(re.Sub)-1])) {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityWarning,
+			Message:  "a .* at the start or end of the pattern matches no more lines and makes searching for it slower",
+		})
+	}
+
+	full, err := syntax.Parse(GetRegexpPattern(searchRegexp(pat, opt), opt.IgnoreCase), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	if prog, err := syntax.Compile(full.Simplify()); err != nil {
+		return nil, err
+	} else if len(prog.Inst) > maxPatternInsts {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("the pattern compiles to %d instructions, which is too complex to search for, use at most %d", len(prog.Inst), maxPatternInsts),
+		})
+	}
+
+	if index.RegexpQuery(full).Op == index.QAll {
+		problems = append(problems, &PatternProblem{
+			Severity: SeverityWarning,
+			Message:  "the pattern has no three characters in a row that every match must contain, so every file has to be searched",
+		})
+	}
+	return problems, nil
+}
+
+// How a search matches lines and picks the files it reads.
+type PatternExplanation struct {
+	// The regular expression lines are matched with, once a literal
+	// pattern is quoted, a whole word one wrapped and case is folded. For
+	// a structural template, the one files must match to be read.
+	Regexp string
+
+	// The trigrams a file must contain to be read, as a query of trigrams
+	// that are all needed, and alternatives in parentheses, of which one
+	// is. Empty when every file is read.
+	Prefilter string `json:",omitempty"`
+	EveryFile bool   `json:",omitempty"`
+}
+
+// Explain how a search for the pattern matches lines and which files it
+// reads.
+func ExplainPattern(pat string, opt *SearchOptions) (*PatternExplanation, error) {
+	expr := GetRegexpPattern(searchRegexp(pat, opt), opt.IgnoreCase)
+	if opt.Structural {
+		t, err := parseTemplate(pat)
+		if err != nil {
+			return nil, err
+		}
+		expr = t.prefilter()
+	}
+
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &PatternExplanation{Regexp: expr}
+	if q := index.RegexpQuery(re); q.Op == index.QAll {
+		res.EveryFile = true
+	} else {
+		res.Prefilter = q.String()
+	}
+	return res, nil
+}
+
+// Check a pattern before it is searched for, returning its first problem
+// that is an error.
+func CheckPattern(pat string, opt *SearchOptions) error {
+	problems, err := LintPattern(pat, opt)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return fmt.Errorf("invalid pattern: %s", p.Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintPattern(t *testing.T) {
+	alternates := make([]string, maxRepeatedAlternates+1)
+	for i := range alternates {
+		// branches that start alike would be factored into fewer.
+		alternates[i] = string(rune(0x100+i)) + ".*v"
+	}
+
+	testCases := []struct {
+		pat      string
+		opt      SearchOptions
+		problems string
+	}{
+		{"func main", SearchOptions{}, ""},
+		{"a*", SearchOptions{}, "error,warning"},
+		{"x?|foo", SearchOptions{}, "error,warning"},
+		{"a*", SearchOptions{LiteralSearch: true}, "warning"},
+		{"^$", SearchOptions{}, "warning"},
+		{"^", SearchOptions{WholeWord: true}, "error,warning"},
+		{"foo.*bar.*baz.*qux.*quux", SearchOptions{}, "warning"},
+		{".*needle", SearchOptions{}, "warning"},
+		{"[a-z]+", SearchOptions{}, "warning"},
+		{"(" + strings.Join(alternates, "|") + ")", SearchOptions{}, "error,warning,warning"},
+		{"(" + strings.Repeat("abcdefghij", 100) + "){12}", SearchOptions{}, "error"},
+		{"foo(:[args])", SearchOptions{Structural: true}, ""},
+	}
+	for _, testCase := range testCases {
+		problems, err := LintPattern(testCase.pat, &testCase.opt)
+		if err != nil {
+			t.Fatalf("%q: %s", testCase.pat, err)
+		}
+
+		var severities []string
+		for _, p := range problems {
+			severities = append(severities, p.Severity)
+		}
+
+		if got := strings.Join(severities, ","); got != testCase.problems {
+			t.Errorf("%.40q: expected the problems %q, got %q: %v", testCase.pat, testCase.problems, got, problems)
+		}
+	}
+
+	if _, err := LintPattern("(", &SearchOptions{}); err == nil {
+		t.Error("expected an error for a pattern that doesn't parse")
+	}
+
+	if err := CheckPattern("a*", &SearchOptions{}); err == nil || !strings.Contains(err.Error(), "empty string") {
+		t.Errorf("expected the error of the problem, got %v", err)
+	}
+
+	if err := CheckPattern(".*needle", &SearchOptions{}); err != nil {
+		t.Errorf("expected warnings not to be errors, got %s", err)
+	}
+}
+
+func TestExplainPattern(t *testing.T) {
+	testCases := []struct {
+		pat       string
+		opt       SearchOptions
+		regexp    string
+		prefilter string
+	}{
+		{"hello", SearchOptions{}, "(?m)hello", `"ell" "hel" "llo"`},
+		{"a.b", SearchOptions{LiteralSearch: true, IgnoreCase: true}, `(?i)(?m)a\.b`, `("A.B"|"A.b"|"a.B"|"a.b")`},
+		{"foo|ba", SearchOptions{}, "(?m)foo|ba", ""},
+		{"foo(:[args])", SearchOptions{Structural: true}, `(?s)foo\(.*\)`, `"foo" "oo("`},
+	}
+	for _, testCase := range testCases {
+		ex, err := ExplainPattern(testCase.pat, &testCase.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ex.Regexp != testCase.regexp || ex.Prefilter != testCase.prefilter || ex.EveryFile != (testCase.prefilter == "") {
+			t.Errorf("%q: expected %s and %s, got %+v", testCase.pat, testCase.regexp, testCase.prefilter, ex)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package index
+
+import (
+	"container/list"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/hound-search/hound/codesearch/index"
+)
+
+// The trigram tables of the indexes opened with it that are mapped into
+// memory, most recently searched first. A table is mapped when its index is
+// searched and stays mapped until the tables take more than the limit in
+// total, when the least recently searched ones that aren't being searched
+// are unmapped. So the memory a server needs grows with the indexes that
+// are searched often rather than with every index it has.
+type MappedTables struct {
+	lck   sync.Mutex
+	limit int64
+	size  int64
+	lru   *list.List
+}
+
+// Tables that keep at most limit bytes mapped at once, 0 is no limit. A
+// table being searched stays mapped even when it alone is larger.
+func NewMappedTables(limit int64) *MappedTables {
+	return &MappedTables{limit: limit, lru: list.New()}
+}
+
+// The number of bytes of trigram tables that are mapped.
+func (m *MappedTables) Size() int64 {
+	m.lck.Lock()
+	defer m.lck.Unlock()
+	return m.size
+}
+
+// Map the trigram table of the index, unless it already is, and keep it
+// mapped until it is released.
+func (m *MappedTables) acquire(n *Index) {
+	m.lck.Lock()
+	defer m.lck.Unlock()
+	if n.idx == nil {
+		n.idx = index.Open(filepath.Join(n.Ref.dir, "tri"))
+		n.elem = m.lru.PushFront(n)
+		m.size += n.triSize
+	} else {
+		m.lru.MoveToFront(n.elem)
+	}
+	n.users++
+	m.evict()
+}
+
+func (m *MappedTables) release(n *Index) {
+	m.lck.Lock()
+	defer m.lck.Unlock()
+	n.users--
+	m.evict()
+}
+
+// Unmap the least recently searched tables that are not in use until the
+// tables take no more than the limit.
+func (m *MappedTables) evict() {
+	if m.limit <= 0 {
+		return
+	}
+
+	for e := m.lru.Back(); e != nil && m.size > m.limit; {
+		prev := e.Prev()
+		if n := e.Value.(*Index); n.users == 0 {
+			if err := m.unmap(n); err != nil {
+				log.Printf("failed to unmap %s: %s", n.Ref.dir, err)
+			}
+		}
+		e = prev
+	}
+}
+
+func (m *MappedTables) unmap(n *Index) error {
+	if n.idx == nil {
+		return nil
+	}
+
+	err := n.idx.Close()
+	m.lru.Remove(n.elem)
+	m.size -= n.triSize
+	n.idx, n.elem = nil, nil
+	return err
+}
+
+// Unmap the trigram table of an index that is closed.
+func (m *MappedTables) close(n *Index) error {
+	m.lck.Lock()
+	defer m.lck.Unlock()
+	return m.unmap(n)
+}
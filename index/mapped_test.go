@@ -0,0 +1,57 @@
+package index
+
+import "testing"
+
+func TestMappedLimit(t *testing.T) {
+	var idxs []*Index
+	tables := NewMappedTables(0)
+	for _, r := range []string{"r1", "r2", "r3"} {
+		ref, err := buildIndex(url, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ref.Remove() //nolint
+
+		idx, err := ref.OpenWith(tables)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer idx.Close()
+		idxs = append(idxs, idx)
+	}
+
+	// room for two of the tables.
+	tables.limit = idxs[0].triSize*2 + idxs[0].triSize/2
+
+	for _, idx := range idxs {
+		if _, err := idx.Search("func ", &SearchOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if idxs[0].idx != nil {
+		t.Errorf("the least recently searched table is still mapped")
+	}
+
+	if idxs[1].idx == nil || idxs[2].idx == nil {
+		t.Errorf("the most recently searched tables are not mapped")
+	}
+
+	if got, want := tables.Size(), idxs[1].triSize+idxs[2].triSize; got != want {
+		t.Errorf("Size() = %d, want %d", got, want)
+	}
+
+	// an unmapped table is mapped again when it is searched.
+	res, err := idxs[0].Search("func ", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) == 0 {
+		t.Errorf("no matches in a table that was mapped again")
+	}
+
+	if idxs[0].NumFiles() == 0 {
+		t.Errorf("NumFiles() = 0")
+	}
+}
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The times the files of an index last changed, in the order of their
+// file ids, are kept in this file rather than on the raw copies, which may
+// be shared with other indexes.
+const modTimesFilename = "modtimes"
+
+func writeModTimes(dst string, times []time.Time) error {
+	b := make([]byte, 8*len(times))
+	for i, t := range times {
+		binary.BigEndian.PutUint64(b[8*i:], uint64(t.UnixNano()))
+	}
+	return ioutil.WriteFile(filepath.Join(dst, modTimesFilename), b, 0644)
+}
+
+// Reads the times the files of an index last changed. Indexes built
+// before the times were kept apart have them on their raw copies.
+type modTimes struct {
+	f *os.File
+}
+
+func (n *Index) openModTimes() (*modTimes, error) {
+	f, err := os.Open(filepath.Join(n.Ref.dir, modTimesFilename))
+	if os.IsNotExist(err) {
+		return &modTimes{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &modTimes{f: f}, nil
+}
+
+// The time the file with the id and raw copy last changed.
+func (m *modTimes) of(fileid uint32, raw string) (time.Time, error) {
+	if m.f == nil {
+		fi, err := os.Stat(raw)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return fi.ModTime(), nil
+	}
+
+	var b [8]byte
+	if _, err := m.f.ReadAt(b[:], 8*int64(fileid)); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[:]))), nil
+}
+
+func (m *modTimes) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	return m.f.Close()
+}
@@ -0,0 +1,171 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ownersJsonFilename = "owners.json"
+
+// The places a CODEOWNERS file is looked for, in the order GitHub looks for
+// them. Only the first one found is used.
+var codeownersPaths = []string{
+	".github/CODEOWNERS",
+	"CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+// A line of a CODEOWNERS file, the owners of the paths matching Pattern.
+// A pattern without owners leaves the paths it matches unowned.
+type ownerRule struct {
+	Pattern string
+	Owners  []string
+
+	rule *ignoreRule
+}
+
+func newOwnerRule(pattern string, owners []string) *ownerRule {
+	r := parseIgnoreRule(pattern)
+	if r == nil || r.negate {
+		return nil
+	}
+	return &ownerRule{Pattern: pattern, Owners: owners, rule: r}
+}
+
+// Parse the rules of a CODEOWNERS file. Patterns are those of a .gitignore
+// file, without negation, and are followed by the owners.
+func parseCodeowners(r io.Reader) ([]*ownerRule, error) {
+	var rules []*ownerRule
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if ix := strings.Index(line, "#"); ix >= 0 {
+			line = line[:ix]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if rule := newOwnerRule(fields[0], fields[1:]); rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, s.Err()
+}
+
+// Read the rules of the CODEOWNERS file of the repo in src, there are none
+// when it has no such file.
+func readCodeowners(src string) ([]*ownerRule, error) {
+	for _, name := range codeownersPaths {
+		r, err := os.Open(filepath.Join(src, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return parseCodeowners(r)
+	}
+	return nil, nil
+}
+
+// Keep the CODEOWNERS rules of the repo in src with the index in dst, so
+// they are known for the revision that was indexed.
+func writeOwnersJson(dst, src string) error {
+	rules, err := readCodeowners(src)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, ownersJsonFilename), b, 0644)
+}
+
+func readOwnersJson(filename string) ([]*ownerRule, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var saved []*ownerRule
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, err
+	}
+
+	var rules []*ownerRule
+	for _, r := range saved {
+		if rule := newOwnerRule(r.Pattern, r.Owners); rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Determine whether the rule matches the file, either by its path or by a
+// directory it is in. As with GitHub, a pattern ending in /* only matches
+// the files directly in the directory.
+func (r *ownerRule) matches(name string) bool {
+	if r.rule.matches(name, false) {
+		return true
+	}
+
+	if r.rule.segs[len(r.rule.segs)-1] == "*" {
+		return false
+	}
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if r.rule.matches(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// The owners of the file, given by the last rule that matches it.
+func ownersOf(rules []*ownerRule, name string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(name) {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// Determine whether owner is one of the owners, ignoring case and the
+// leading @ of users and teams. Every file is owned by the empty owner.
+func ownedBy(owners []string, owner string) bool {
+	if owner == "" {
+		return true
+	}
+
+	owner = strings.TrimPrefix(owner, "@")
+	for _, o := range owners {
+		if strings.EqualFold(strings.TrimPrefix(o, "@"), owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// The CODEOWNERS rules of the indexed revision, read once.
+func (n *Index) ownerRules() ([]*ownerRule, error) {
+	n.ownersOnce.Do(func() {
+		n.owners, n.ownersErr = readOwnersJson(filepath.Join(n.Ref.dir, ownersJsonFilename))
+	})
+	return n.owners, n.ownersErr
+}
@@ -0,0 +1,58 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+const codeowners = `# The default owners
+*       @org/core
+
+*.js    @org/web # inline comment
+/docs/  docs@example.com
+apps/   @org/apps @octocat
+/build/logs/*
+`
+
+func TestOwnersOf(t *testing.T) {
+	rules, err := parseCodeowners(strings.NewReader(codeowners))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		owners []string
+	}{
+		{"main.go", []string{"@org/core"}},
+		{"ui/app.js", []string{"@org/web"}},
+		{"docs/index.md", []string{"docs@example.com"}},
+		{"docs/a/b.js", []string{"docs@example.com"}},
+		{"src/docs/index.md", []string{"@org/core"}},
+		{"apps/x/main.go", []string{"@org/apps", "@octocat"}},
+		{"src/apps/main.go", []string{"@org/apps", "@octocat"}},
+		{"build/logs/out.log", nil},
+		{"build/logs/old/out.log", []string{"@org/core"}},
+	}
+	for _, testCase := range testCases {
+		owners := ownersOf(rules, testCase.name)
+		if strings.Join(owners, " ") != strings.Join(testCase.owners, " ") {
+			t.Errorf("%s: expected %q, got %q", testCase.name, testCase.owners, owners)
+		}
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	owners := []string{"@org/Apps", "@octocat"}
+	for _, owner := range []string{"", "org/apps", "@ORG/apps", "octocat"} {
+		if !ownedBy(owners, owner) {
+			t.Errorf("expected %q to be an owner", owner)
+		}
+	}
+
+	for _, owner := range []string{"org", "@org/web"} {
+		if ownedBy(owners, owner) {
+			t.Errorf("expected %q not to be an owner", owner)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Replace the raw copies of the files of the index with links to the
+// copies of the same contents in dir, and add the contents dir doesn't
+// have yet, so the files that indexes of forks, release branches and
+// vendored code have in common are stored once. Copies in dir are named by
+// their checksum, so an index built before checksums were recorded is left
+// as it is.
+func (r *IndexRef) ShareFiles(dir string) error {
+	sums, err := r.readChecksums()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for name, sum := range sums {
+		if !strings.HasPrefix(name, "raw/") || len(sum) < 2 {
+			continue
+		}
+
+		path := filepath.Join(r.dir, filepath.FromSlash(name))
+		if err := shareFile(path, filepath.Join(dir, sum[:2], sum), sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make path a link to the shared copy of its contents, or make it the
+// shared copy when there is none. Only a copy that has the checksum is
+// shared, so a damaged file never takes the place of good ones. Removing a
+// shared copy, as another build may, leaves the indexes that link to it as
+// they are, so builds that race at worst store the contents twice.
+func shareFile(path, shared, sum string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if si, err := os.Stat(shared); err == nil && os.SameFile(fi, si) {
+		return nil
+	}
+
+	if got, err := checksumOf(shared); err == nil && got == sum {
+		tmp := path + ".shared"
+		if err := os.Link(shared, tmp); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+
+	if got, err := checksumOf(path); err != nil || got != sum {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(shared), os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := os.Remove(shared); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Link(path, shared); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Remove the copies in dir that no index links to anymore. Returns the
+// number of copies removed and the bytes that freed. Nothing is removed on
+// platforms that can't tell the number of links to a file.
+func CollectShared(dir string) (int, int64, error) {
+	var removed int
+	var freed int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if n, ok := LinkCount(info); !ok || n > 1 {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
@@ -0,0 +1,93 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShareFiles(t *testing.T) {
+	shared, err := ioutil.TempDir(os.TempDir(), "hound-shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(shared)
+
+	var refs []*IndexRef
+	for _, r := range []string{"r1", "r2"} {
+		ref, err := buildIndex(url, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ref.Remove() //nolint
+
+		if err := ref.ShareFiles(shared); err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	a, err := os.Stat(filepath.Join(refs[0].Dir(), "raw", "share.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.Stat(filepath.Join(refs[1].Dir(), "raw", "share.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(a, b) {
+		t.Fatal("expected the indexes to share the copy of share.go")
+	}
+
+	// sharing again changes nothing.
+	if err := refs[0].ShareFiles(shared); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range refs {
+		if err := ref.Verify(); err != nil {
+			t.Fatalf("expected an index with shared files to verify, got %s", err)
+		}
+
+		idx, err := ref.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer idx.Close()
+
+		res, err := idx.Search("func TestShareFiles", &SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Matches) != 1 || res.Matches[0].ModTime.IsZero() {
+			t.Fatalf("expected a match with a time in share_test.go, got %+v", res.Matches)
+		}
+	}
+
+	if _, ok := LinkCount(a); !ok {
+		t.Skip("the number of links to a file is unknown on this platform")
+	}
+
+	if n, _, err := CollectShared(shared); err != nil || n != 0 {
+		t.Fatalf("expected no copies to be collected while they are used, got %d, %v", n, err)
+	}
+
+	for _, ref := range refs {
+		if err := ref.Remove(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, freed, err := CollectShared(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n == 0 || freed == 0 {
+		t.Fatalf("expected the unused copies to be collected, got %d copies of %d bytes", n, freed)
+	}
+}
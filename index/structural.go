@@ -0,0 +1,562 @@
+package index
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/codesearch/index"
+	"github.com/hound-search/hound/codesearch/regexp"
+)
+
+// The most steps matching a template may take in a single file, so a
+// template with many holes gives up on a large file rather than taking
+// forever.
+const maxStructuralSteps = 1 << 22
+
+type tokenKind int
+
+const (
+	// Text to match, where whitespace matches any whitespace.
+	tokenText tokenKind = iota
+
+	// :[name], which matches any text with balanced brackets.
+	tokenHole
+
+	// :[[name]], which matches an identifier.
+	tokenIdent
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	name string
+}
+
+// A structural search template, in the style of comby. Text in the template
+// is matched as it is, except that whitespace matches any amount of
+// whitespace, including none between punctuation. A hole, :[name], matches
+// the shortest text that lets the rest of the template match and in which
+// (), [] and {} are balanced, across lines and skipping over string
+// literals. :[[name]] matches an identifier. A name used twice must match
+// the same text both times, unless it is empty or _.
+//
+// So foo(:[args], nil) matches calls of foo whose last argument is nil,
+// however the arguments before it are nested or split across lines.
+type template struct {
+	tokens []*token
+
+	// whether a match must end at a word boundary, as the template ends
+	// with a word character.
+	endsWithWord bool
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isHoleName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isWordByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse a structural search template, see template.
+func parseTemplate(tmpl string) (*template, error) {
+	tmpl = strings.TrimSpace(tmpl)
+	if tmpl == "" {
+		return nil, errors.New("empty template")
+	}
+
+	t := &template{}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			t.tokens = append(t.tokens, &token{kind: tokenText, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(tmpl); {
+		if strings.HasPrefix(tmpl[i:], ":[") {
+			kind, open, close := tokenHole, ":[", "]"
+			if strings.HasPrefix(tmpl[i:], ":[[") {
+				kind, open, close = tokenIdent, ":[[", "]]"
+			}
+
+			start := i + len(open)
+			if end := strings.Index(tmpl[start:], close); end >= 0 && isHoleName(tmpl[start:start+end]) {
+				flush()
+				t.tokens = append(t.tokens, &token{kind: kind, name: tmpl[start : start+end]})
+				i = start + end + len(close)
+				continue
+			}
+		}
+
+		text.WriteByte(tmpl[i])
+		i++
+	}
+	flush()
+
+	for i, tok := range t.tokens {
+		if tok.kind == tokenText {
+			continue
+		}
+
+		if i > 0 && t.tokens[i-1].kind != tokenText {
+			return nil, errors.New("holes in a template must be separated by text")
+		}
+
+		if tok.kind == tokenHole && (i == 0 || i == len(t.tokens)-1) {
+			return nil, errors.New("a template can't start or end with a :[hole], use :[[hole]] for an identifier")
+		}
+	}
+
+	if last := t.tokens[len(t.tokens)-1]; last.kind == tokenText {
+		t.endsWithWord = isWordByte(last.text[len(last.text)-1])
+	}
+
+	return t, nil
+}
+
+// A regular expression that matches, in any file the template matches, the
+// words of its text in order. It is used to find the files worth reading.
+func (t *template) prefilter() string {
+	var words []string
+	for _, tok := range t.tokens {
+		if tok.kind != tokenText {
+			continue
+		}
+
+		for _, word := range strings.Fields(tok.text) {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	return "(?s)" + strings.Join(words, ".*")
+}
+
+// Match text at i in src, returning where the match ends.
+func matchText(text string, src []byte, i int) (int, bool) {
+	for t := 0; t < len(text); {
+		if !isSpaceByte(text[t]) {
+			if i >= len(src) || src[i] != text[t] {
+				return 0, false
+			}
+			i++
+			t++
+			continue
+		}
+
+		start := t
+		for t < len(text) && isSpaceByte(text[t]) {
+			t++
+		}
+
+		j := i
+		for j < len(src) && isSpaceByte(src[j]) {
+			j++
+		}
+
+		// whitespace can only be left out next to punctuation, the edges
+		// of the text count as words as they may be next to a hole.
+		prevWord := start == 0 || isWordByte(text[start-1])
+		nextWord := t == len(text) || isWordByte(text[t])
+		if j == i && prevWord && nextWord {
+			return 0, false
+		}
+		i = j
+	}
+	return i, true
+}
+
+// The end of the string literal that starts at i in src. Strings other
+// than raw ones end at the end of the line if they aren't closed.
+func skipString(src []byte, i int) int {
+	q := src[i]
+	for i++; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == q:
+			return i + 1
+		case c == '\\' && q != '`':
+			i++
+		case c == '\n' && q != '`':
+			return i
+		}
+	}
+	return len(src)
+}
+
+var closers = map[byte]byte{'(': ')', '[': ']', '{': '}'}
+
+// Matches the tokens of a template against the contents of a file.
+type matcher struct {
+	t     *template
+	src   []byte
+	holes map[string]string
+	steps int
+}
+
+func (m *matcher) exhausted() bool {
+	return m.steps > maxStructuralSteps
+}
+
+// Match the tokens from the k-th on at i, returning where the match ends.
+func (m *matcher) match(k, i int) (int, bool) {
+	m.steps++
+	if m.exhausted() {
+		return 0, false
+	}
+
+	if k == len(m.t.tokens) {
+		if m.t.endsWithWord && i < len(m.src) && isWordByte(m.src[i]) {
+			return 0, false
+		}
+		return i, true
+	}
+
+	switch tok := m.t.tokens[k]; tok.kind {
+	case tokenText:
+		j, ok := matchText(tok.text, m.src, i)
+		if !ok {
+			return 0, false
+		}
+		return m.match(k+1, j)
+	case tokenIdent:
+		j := i
+		for j < len(m.src) && isWordByte(m.src[j]) {
+			j++
+		}
+
+		if j == i {
+			return 0, false
+		}
+		return m.bind(k, i, j)
+	}
+
+	// a hole that is already bound must match the same text again.
+	name := m.t.tokens[k].name
+	if v, ok := m.holes[name]; ok {
+		if !bytes.HasPrefix(m.src[i:], []byte(v)) {
+			return 0, false
+		}
+		return m.match(k+1, i+len(v))
+	}
+
+	// try the ends of the hole in turn, so it matches the shortest text,
+	// but only where its brackets are balanced.
+	var stack []byte
+	for j := i; ; {
+		if len(stack) == 0 {
+			if end, ok := m.bind(k, i, j); ok {
+				return end, true
+			}
+		}
+
+		if j == len(m.src) || m.exhausted() {
+			return 0, false
+		}
+
+		switch c := m.src[j]; c {
+		case '(', '[', '{':
+			stack = append(stack, closers[c])
+			j++
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return 0, false
+			}
+			stack = stack[:len(stack)-1]
+			j++
+		case '"', '\'', '`':
+			j = skipString(m.src, j)
+		default:
+			j++
+		}
+	}
+}
+
+// Bind the name of the k-th token to src[i:j] and match the rest of the
+// template after it.
+func (m *matcher) bind(k, i, j int) (int, bool) {
+	name := m.t.tokens[k].name
+	if name == "" || name == "_" {
+		return m.match(k+1, j)
+	}
+
+	v := string(m.src[i:j])
+	prev, bound := m.holes[name]
+	if bound && prev != v {
+		return 0, false
+	}
+
+	m.holes[name] = v
+	end, ok := m.match(k+1, j)
+	if !ok && !bound {
+		delete(m.holes, name)
+	}
+	return end, ok
+}
+
+// A match of a template, from start to end in the contents of a file.
+type structuralMatch struct {
+	start int
+	end   int
+	holes map[string]string
+}
+
+// The next position from i on where a match of the template could start,
+// -1 if there is none.
+func (t *template) nextStart(src []byte, i int) int {
+	first := t.tokens[0]
+	if first.kind == tokenIdent {
+		for ; i < len(src); i++ {
+			if isWordByte(src[i]) && (i == 0 || !isWordByte(src[i-1])) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	prefix := []byte(strings.Fields(first.text)[0])
+	for i < len(src) {
+		ix := bytes.Index(src[i:], prefix)
+		if ix < 0 {
+			return -1
+		}
+		i += ix
+
+		// text starting with a word starts a word.
+		if !isWordByte(prefix[0]) || i == 0 || !isWordByte(src[i-1]) {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// Find the matches of the template in src, none of which overlap.
+func (t *template) find(src []byte) []*structuralMatch {
+	m := &matcher{t: t, src: src}
+
+	var res []*structuralMatch
+	for i := t.nextStart(src, 0); i >= 0; i = t.nextStart(src, i) {
+		m.holes = map[string]string{}
+		end, ok := m.match(0, i)
+		if m.exhausted() {
+			break
+		}
+
+		if !ok || end == i {
+			i++
+			continue
+		}
+
+		res = append(res, &structuralMatch{start: i, end: end, holes: m.holes})
+		i = end
+	}
+	return res
+}
+
+// Split the lines of b, without their line breaks.
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(b), "\n")
+}
+
+// The match as the lines it spans, with n lines of context before and after.
+func (sm *structuralMatch) toMatch(src []byte, n int) *Match {
+	from := bytes.LastIndexByte(src[:sm.start], '\n') + 1
+
+	// a match that ends with a line break ends on that line.
+	end := sm.end
+	if end > sm.start && src[end-1] == '\n' {
+		end--
+	}
+
+	to := len(src)
+	if ix := bytes.IndexByte(src[end:], '\n'); ix >= 0 {
+		to = end + ix
+	}
+
+	before := splitLines(src[:from])
+	if len(before) > 0 && before[len(before)-1] == "" {
+		before = before[:len(before)-1]
+	}
+	if len(before) > n {
+		before = before[len(before)-n:]
+	}
+
+	var after []string
+	if to < len(src) {
+		after = splitLines(src[to+1:])
+		if len(after) > 0 && after[len(after)-1] == "" {
+			after = after[:len(after)-1]
+		}
+	}
+	if len(after) > n {
+		after = after[:n]
+	}
+
+	m := &Match{
+		Line:       string(src[from:to]),
+		LineNumber: bytes.Count(src[:sm.start], nl) + 1,
+		Before:     before,
+		After:      after,
+	}
+	if len(sm.holes) > 0 {
+		m.Holes = sm.holes
+	}
+	return m
+}
+
+// Read the contents of a gzipped raw file.
+func readRawFile(filename string) ([]byte, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	return ioutil.ReadAll(gr)
+}
+
+// Search for a structural template, with the same options as a regular
+// search apart from those that only apply to regular expressions.
+func (n *Index) searchStructural(pat string, opt *SearchOptions, fres []*regexp.Regexp,
+	excludeFre *regexp.Regexp, owners []*ownerRule, encodings map[string]string,
+	startedAt time.Time) (*SearchResponse, error) {
+	t, err := parseTemplate(pat)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(t.prefilter())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results          []*FileMatch
+		filesOpened      int
+		filesFound       int
+		filesCollected   int
+		matchesCollected int
+		truncated        bool
+	)
+
+	mt, err := n.openModTimes()
+	if err != nil {
+		return nil, err
+	}
+	defer mt.Close()
+
+	for _, file := range n.idx.PostingQuery(index.RegexpQuery(re.Syntax)) {
+		if truncated {
+			break
+		}
+
+		name := n.idx.Name(file)
+		if !searchesFile(fres, excludeFre, name) {
+			continue
+		}
+
+		fileOwners := ownersOf(owners, name)
+		if !ownedBy(fileOwners, opt.Owner) {
+			continue
+		}
+
+		raw := filepath.Join(n.Ref.dir, "raw", name)
+		mtime, err := mt.of(file, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if !opt.ModifiedAfter.IsZero() && !mtime.After(opt.ModifiedAfter) {
+			continue
+		}
+
+		filesOpened++
+		src, err := readRawFile(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		// the template is matched against the file with its secrets masked,
+		// so it can't find them and its holes don't hold them.
+		text := opt.Redactor.Bytes(src)
+		found := t.find(text)
+		if len(found) == 0 {
+			continue
+		}
+
+		filesFound++
+		if filesFound <= opt.Offset || (opt.Limit > 0 && filesCollected >= opt.Limit) {
+			continue
+		}
+
+		fm := &FileMatch{Filename: name, ModTime: mtime, Owners: fileOwners, Encoding: encodings[name]}
+		if opt.CountOnly {
+			fm.Count = len(found)
+		} else {
+			for _, sm := range found {
+				if opt.MaxPerFile > 0 && len(fm.Matches) >= opt.MaxPerFile {
+					break
+				}
+
+				fm.Matches = append(fm.Matches, sm.toMatch(text, int(opt.LinesOfContext)))
+				matchesCollected++
+				if matchesCollected > matchLimit {
+					return nil, fmt.Errorf("search exceeds limit on matches: %d", matchLimit)
+				}
+
+				if opt.MaxMatches > 0 && matchesCollected >= opt.MaxMatches {
+					truncated = true
+					break
+				}
+			}
+		}
+
+		if opt.Highlight {
+			fm.Language = highlightMatches(name, fm.Matches)
+		}
+
+		if opt.Hash {
+			h := sha1.Sum(src)
+			fm.Hash = hex.EncodeToString(h[:])
+		}
+
+		filesCollected++
+		results = append(results, fm)
+	}
+
+	return &SearchResponse{
+		Matches:        results,
+		FilesWithMatch: filesFound,
+		FilesOpened:    filesOpened,
+		Duration:       time.Since(startedAt),
+		Revision:       n.Ref.Rev,
+		Truncated:      truncated,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+const structuralSrc = `package main
+
+func main() {
+	foo(a, nil)
+	foo(bar(1, 2),
+		nil)
+	foo(a,nil)
+	foo(")", nil)
+	foo(x, y)
+	myfoo(a, nil)
+	if err != nil { return err }
+	x := x + 1
+	x := y + 1
+}
+`
+
+func TestStructuralTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		matches  []string
+	}{
+		{"foo(:[args], nil)", []string{"foo(a, nil)", "foo(bar(1, 2),\n\t\tnil)", "foo(a,nil)", `foo(")", nil)`}},
+		{"if err != nil { :[body] }", []string{"if err != nil { return err }"}},
+		{":[[v]] := :[[v]] + 1", []string{"x := x + 1"}},
+		{"return :[[e]]", []string{"return err"}},
+		{"func :[[name]]()", []string{"func main()"}},
+	}
+	for _, testCase := range testCases {
+		tmpl, err := parseTemplate(testCase.template)
+		if err != nil {
+			t.Fatalf("parseTemplate(%q): %s", testCase.template, err)
+		}
+
+		var got []string
+		for _, m := range tmpl.find([]byte(structuralSrc)) {
+			got = append(got, structuralSrc[m.start:m.end])
+		}
+
+		if strings.Join(got, "|") != strings.Join(testCase.matches, "|") {
+			t.Errorf("%q: expected %q, got %q", testCase.template, testCase.matches, got)
+		}
+	}
+}
+
+func TestStructuralMatchLines(t *testing.T) {
+	tmpl, err := parseTemplate("foo(:[first], :[[last]])")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := tmpl.find([]byte(structuralSrc))
+	if len(found) != 5 {
+		t.Fatalf("expected 5 matches, got %d", len(found))
+	}
+
+	m := found[1].toMatch([]byte(structuralSrc), 1)
+	if m.LineNumber != 5 || m.Line != "\tfoo(bar(1, 2),\n\t\tnil)" {
+		t.Fatalf("unexpected match at line %d: %q", m.LineNumber, m.Line)
+	}
+
+	if m.Holes["first"] != "bar(1, 2)" || m.Holes["last"] != "nil" {
+		t.Fatalf("unexpected holes: %v", m.Holes)
+	}
+
+	if len(m.Before) != 1 || m.Before[0] != "\tfoo(a, nil)" || len(m.After) != 1 || m.After[0] != "\tfoo(a,nil)" {
+		t.Fatalf("unexpected context: %q, %q", m.Before, m.After)
+	}
+}
+
+func TestInvalidStructuralTemplates(t *testing.T) {
+	for _, template := range []string{"", "  ", ":[x].Close()", "foo(:[x]", "foo :[a]:[b] bar"} {
+		if _, err := parseTemplate(template); err == nil {
+			t.Errorf("expected an error for %q", template)
+		}
+	}
+}
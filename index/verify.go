@@ -0,0 +1,119 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hound-search/hound/codesearch/index"
+)
+
+const checksumsFilename = "checksums.json"
+
+// Compute the checksum of a file.
+func checksumOf(path string) (string, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Record the checksum of every file of the index in dst, by its path
+// relative to dst, so the index can be verified later.
+func writeChecksums(dst string) error {
+	sums := map[string]string{}
+	if err := filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == checksumsFilename || rel == ManifestFilename {
+			return nil
+		}
+
+		sum, err := checksumOf(path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(sums)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, checksumsFilename), b, 0644)
+}
+
+// Read the checksums recorded by writeChecksums.
+func (r *IndexRef) readChecksums() (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.dir, checksumsFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	var sums map[string]string
+	if err := json.Unmarshal(b, &sums); err != nil {
+		return nil, fmt.Errorf("%s: %s", checksumsFilename, err)
+	}
+	return sums, nil
+}
+
+// Check that the trigram table of the index can be read, which is cheap
+// enough to do before an index found at startup is opened, as a corrupt
+// table would otherwise bring the server down on the first search.
+func (r *IndexRef) CheckTrigrams() error {
+	return index.Check(filepath.Join(r.dir, "tri"))
+}
+
+// Verify the index: its trigram table can be read and every file has the
+// checksum it had when the index was built. Indexes built before checksums
+// were recorded only have their trigram table checked.
+func (r *IndexRef) Verify() error {
+	if err := r.CheckTrigrams(); err != nil {
+		return err
+	}
+
+	sums, err := r.readChecksums()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for name, want := range sums {
+		got, err := checksumOf(filepath.Join(r.dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+
+		if got != want {
+			return fmt.Errorf("%s: checksum mismatch", name)
+		}
+	}
+	return nil
+}
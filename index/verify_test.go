@@ -0,0 +1,47 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove() //nolint
+
+	if err := ref.Verify(); err != nil {
+		t.Fatalf("expected a new index to verify, got %s", err)
+	}
+
+	// a damaged file is caught by its checksum.
+	raw := filepath.Join(ref.Dir(), "raw", "verify_test.go")
+	if err := ioutil.WriteFile(raw, []byte("package index\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ref.Verify(); err == nil {
+		t.Fatal("expected a changed file to fail verification")
+	}
+
+	// without checksums only the trigram table is checked.
+	if err := os.Remove(filepath.Join(ref.Dir(), checksumsFilename)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ref.Verify(); err != nil {
+		t.Fatalf("expected an index without checksums to verify, got %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(ref.Dir(), "tri"), []byte("csearch index 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ref.CheckTrigrams(); err == nil {
+		t.Fatal("expected a truncated trigram table to fail the check")
+	}
+}
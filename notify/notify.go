@@ -0,0 +1,209 @@
+// Package notify tells webhooks when repos are indexed or fail to update,
+// so operators learn about stale repos without watching the logs.
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/httpqueue"
+	"github.com/hound-search/hound/strs"
+)
+
+const (
+	queueSize      = 256
+	webhookTimeout = 10 * time.Second
+)
+
+// The kinds of events that are notified.
+const (
+	// A new revision of the repo was indexed.
+	EventIndexed = "indexed"
+
+	// The index of a new revision could not be built.
+	EventIndexFailed = "index-failed"
+
+	// The repo could not be cloned or pulled, which includes failing to
+	// authenticate with the remote.
+	EventCloneFailed = "clone-failed"
+
+	// The repo failed to update max-failures times in a row.
+	EventUnhealthy = "unhealthy"
+
+	// An unhealthy repo updated again.
+	EventRecovered = "recovered"
+
+	// Secret scanning found what looks like a secret in a file that changed
+	// in a new revision.
+	EventSecretFound = "secret-found"
+)
+
+var events = []string{EventIndexed, EventIndexFailed, EventCloneFailed, EventUnhealthy, EventRecovered, EventSecretFound}
+
+// Something that happened to a repo. A secret that was found is in the file
+// at Path, first on Line, and Rule is the kind of secret it is.
+type Event struct {
+	Time  time.Time
+	Type  string
+	Repo  string
+	Rev   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	Path  string `json:",omitempty"`
+	Line  int    `json:",omitempty"`
+	Rule  string `json:",omitempty"`
+}
+
+// A one line description of the event for chat formats.
+func (e *Event) summary() string {
+	switch e.Type {
+	case EventIndexed:
+		return fmt.Sprintf("Hound indexed %s at %s", e.Repo, e.Rev)
+	case EventIndexFailed:
+		return fmt.Sprintf("Hound failed to index %s: %s", e.Repo, e.Error)
+	case EventCloneFailed:
+		return fmt.Sprintf("Hound failed to clone or pull %s: %s", e.Repo, e.Error)
+	case EventUnhealthy:
+		return fmt.Sprintf("Hound keeps failing to update %s: %s", e.Repo, e.Error)
+	case EventRecovered:
+		return fmt.Sprintf("Hound updated %s again", e.Repo)
+	case EventSecretFound:
+		return fmt.Sprintf("Hound found a possible %s in %s at %s:%d (%s)", e.Rule, e.Repo, e.Path, e.Line, e.Rev)
+	}
+	return fmt.Sprintf("Hound %s for %s", e.Type, e.Repo)
+}
+
+// Encodes an event as the body of a request to a webhook.
+type formatter func(e *Event) interface{}
+
+var formats = map[string]formatter{
+	"json": func(e *Event) interface{} {
+		return e
+	},
+	"slack": func(e *Event) interface{} {
+		return map[string]string{"text": e.summary()}
+	},
+	"teams": func(e *Event) interface{} {
+		return map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  e.summary(),
+			"text":     e.summary(),
+		}
+	},
+}
+
+// Sends events to every webhook that wants them. A nil Notifier discards
+// events.
+type Notifier struct {
+	hooks []*webhook
+}
+
+// Create a Notifier for the configured webhooks, which returns nil when
+// there are none.
+func New(cfgs []*config.NotificationConfig) (*Notifier, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	n := &Notifier{}
+	for i, cfg := range cfgs {
+		h, err := newWebhook(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("notifications[%d]: %s", i, err)
+		}
+		n.hooks = append(n.hooks, h)
+	}
+
+	for _, h := range n.hooks {
+		h.q = httpqueue.New("notify", h.url, queueSize, webhookTimeout)
+	}
+
+	return n, nil
+}
+
+// Check the configured webhooks without starting them.
+func Validate(cfgs []*config.NotificationConfig) []error {
+	var errs []error
+	for i, cfg := range cfgs {
+		if _, err := newWebhook(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("notifications[%d]: %s", i, err))
+		}
+	}
+	return errs
+}
+
+// Send the event to the webhooks that want it, setting its time if it has
+// none. Events are sent in the background.
+func (n *Notifier) Notify(e *Event) {
+	if n == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for _, h := range n.hooks {
+		if err := h.send(e); err != nil {
+			log.Printf("notify: failed to send %s for %s: %s", e.Type, e.Repo, err)
+		}
+	}
+}
+
+// Posts the events it wants to a URL, once the Notifier starts its queue.
+type webhook struct {
+	url    string
+	format formatter
+	events map[string]bool
+	q      *httpqueue.Queue
+}
+
+func newWebhook(cfg *config.NotificationConfig) (*webhook, error) {
+	if u, err := url.Parse(cfg.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("url %q is not an http or https url", cfg.Url)
+	}
+
+	name := cfg.Format
+	if name == "" {
+		name = "json"
+	}
+
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+
+	var want map[string]bool
+	if len(cfg.Events) > 0 {
+		want = map[string]bool{}
+		for _, e := range cfg.Events {
+			if !strs.Contains(events, e) {
+				return nil, fmt.Errorf("unknown event %q", e)
+			}
+			want[e] = true
+		}
+	}
+
+	return &webhook{
+		url:    cfg.Url,
+		format: f,
+		events: want,
+	}, nil
+}
+
+func (h *webhook) send(e *Event) error {
+	if h.events != nil && !h.events[e.Type] {
+		return nil
+	}
+
+	b, err := json.Marshal(h.format(e))
+	if err != nil {
+		return err
+	}
+
+	return h.q.Send(b)
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestNotify(t *testing.T) {
+	ch := make(chan map[string]interface{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		body["path"] = r.URL.Path
+		ch <- body
+	}))
+	defer srv.Close()
+
+	n, err := New([]*config.NotificationConfig{
+		{Url: srv.URL + "/json"},
+		{Url: srv.URL + "/slack", Format: "slack", Events: []string{EventCloneFailed}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(&Event{Type: EventIndexed, Repo: "a", Rev: "abc"})
+	n.Notify(&Event{Type: EventCloneFailed, Repo: "b", Error: "authentication failed"})
+
+	got := map[string]map[string]interface{}{}
+	for len(got) < 3 {
+		select {
+		case b := <-ch:
+			key := b["path"].(string)
+			if key == "/json" {
+				key += "/" + b["Type"].(string)
+			}
+			got[key] = b
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for notifications, got %v", got)
+		}
+	}
+
+	if b := got["/json/indexed"]; b["Repo"] != "a" || b["Rev"] != "abc" {
+		t.Fatalf("unexpected notification: %v", b)
+	}
+
+	if b := got["/json/clone-failed"]; b["Error"] != "authentication failed" {
+		t.Fatalf("unexpected notification: %v", b)
+	}
+
+	if b := got["/slack"]; b["text"] != "Hound failed to clone or pull b: authentication failed" {
+		t.Fatalf("unexpected notification: %v", b)
+	}
+
+	select {
+	case b := <-ch:
+		t.Fatalf("unexpected notification: %v", b)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := Validate([]*config.NotificationConfig{
+		{Url: "https://example.com", Format: "teams"},
+		{Url: "example.com"},
+		{Url: "https://example.com", Format: "irc"},
+		{Url: "https://example.com", Events: []string{"pushed"}},
+	})
+
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+}
+
+func TestSecretFoundSummary(t *testing.T) {
+	e := &Event{Type: EventSecretFound, Repo: "a", Rev: "abc", Path: "conf/prod.env", Line: 3, Rule: "aws-access-key"}
+	if got := e.summary(); got != "Hound found a possible aws-access-key in a at conf/prod.env:3 (abc)" {
+		t.Fatalf("unexpected summary: %s", got)
+	}
+}
@@ -0,0 +1,176 @@
+// Package redact hides secrets, such as access keys and private keys that
+// were committed by mistake, in the lines that searches return. The text
+// of a secret is masked byte for byte, so offsets into the lines still
+// hold.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The mask of each byte of a secret.
+const mask = '*'
+
+// A rule for a kind of secret, whose name tells what was found. A rule
+// with a group masks only the text of its first group, like the value
+// assigned to a password. Patterns match within single lines.
+type Rule struct {
+	Name    string
+	Pattern string
+}
+
+// The rules for common secrets.
+var Builtin = []Rule{
+	{"aws-access-key", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"github-token", `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+	{"slack-token", `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+
+	// the header of a private key and the full lines of its body.
+	{"private-key", `-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----`},
+	{"private-key-body", `^[A-Za-z0-9+/]{64}$`},
+
+	// quoted values assigned to passwords, secrets, tokens and keys, and
+	// those of environment variables named for them.
+	{"password", `(?i)(?:password|passwd|pwd|secret|token|api_?key|access_?key)\w*["']?\s*[:=]+\s*["']([^"'\s]{6,})["']`},
+	{"env-secret", `^\s*(?:export\s+)?[A-Z_]*(?:PASSWORD|SECRET|TOKEN|API_KEY)[A-Z_]*\s*=\s*([^\s"'$]{6,})\s*$`},
+}
+
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Masks the secrets that any of its rules match.
+type Redactor struct {
+	rules []*rule
+}
+
+// A redactor with rules of the patterns, along with the built in rules when
+// builtin is set.
+func New(patterns []string, builtin bool) (*Redactor, error) {
+	var rules []Rule
+	if builtin {
+		rules = append(rules, Builtin...)
+	}
+
+	for _, pat := range patterns {
+		rules = append(rules, Rule{Pattern: pat})
+	}
+	return NewRules(rules)
+}
+
+// A redactor with the rules.
+func NewRules(rules []Rule) (*Redactor, error) {
+	r := &Redactor{}
+	for _, ru := range rules {
+		re, err := regexp.Compile("(?m)" + ru.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %s", ru.Pattern, err)
+		}
+		r.rules = append(r.rules, &rule{ru.Name, re})
+	}
+	return r, nil
+}
+
+// The names of the rules that match secrets in the text, in the order of
+// the rules.
+func (r *Redactor) Match(b []byte) []string {
+	if r == nil {
+		return nil
+	}
+
+	var res []string
+	for _, ru := range r.rules {
+		if ru.re.Match(b) {
+			res = append(res, ru.name)
+		}
+	}
+	return res
+}
+
+// The spans of the secrets in the text, which may overlap.
+func (r *Redactor) spans(b []byte) [][]int {
+	var res [][]int
+	for _, ru := range r.rules {
+		for _, loc := range ru.re.FindAllSubmatchIndex(b, -1) {
+			if len(loc) > 2 && loc[2] >= 0 {
+				loc = loc[2:4]
+			}
+			res = append(res, loc[:2])
+		}
+	}
+	return res
+}
+
+// The text with its secrets masked. It is only copied when it has some. A
+// nil redactor masks nothing.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+
+	spans := r.spans(b)
+	if len(spans) == 0 {
+		return b
+	}
+
+	res := append([]byte{}, b...)
+	for _, s := range spans {
+		for i := s[0]; i < s[1]; i++ {
+			res[i] = mask
+		}
+	}
+	return res
+}
+
+// The lines with their secrets masked.
+func (r *Redactor) Lines(lines [][]byte) [][]byte {
+	if r == nil {
+		return lines
+	}
+
+	res := make([][]byte, len(lines))
+	for i, line := range lines {
+		res[i] = r.Bytes(line)
+	}
+	return res
+}
+
+// The text with its secrets masked.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	return string(r.Bytes([]byte(s)))
+}
+
+// Whether every match of re in the line overlaps a secret, so that the line
+// would only be found for the secret it holds. Returning such lines would
+// let a pattern find a secret a character at a time, even masked.
+func (r *Redactor) Hides(line []byte, re *regexp.Regexp) bool {
+	if r == nil {
+		return false
+	}
+
+	matches := re.FindAllIndex(line, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	spans := r.spans(line)
+	for _, m := range matches {
+		overlaps := false
+		for _, s := range spans {
+			if m[0] < s[1] && s[0] < m[1] {
+				overlaps = true
+				break
+			}
+		}
+
+		if !overlaps {
+			return false
+		}
+	}
+	return true
+}
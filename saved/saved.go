@@ -0,0 +1,242 @@
+// Package saved keeps named searches, with their options, under short ids
+// that can be shared as links.
+package saved
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The number of random bytes in an id, which is 8 characters once encoded.
+const idBytes = 6
+
+// The options of a search that are saved along with its query, by the names
+// the UI uses for them.
+var Options = []string{"q", "i", "literal", "w", "mode", "modifiedAfter", "owner", "files", "excludeFiles", "repos"}
+
+// A named search. Owner is the name of the access key or user that saved
+// it, empty when it was saved without one, and Tenant the tenant it was
+// bound to.
+type Search struct {
+	ID      string
+	Name    string
+	Options map[string]string
+	Owner   string `json:",omitempty"`
+	Tenant  string `json:",omitempty"`
+	Created time.Time
+	Updated time.Time
+}
+
+// The saved searches, persisted to a file as they change.
+type Store struct {
+	path string
+	byID map[string]*Search
+	lck  sync.RWMutex
+}
+
+// Open the searches kept in the file at path, a missing file holds no
+// searches.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		byID: map[string]*Search{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stored []*Search
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	for _, search := range stored {
+		s.byID[search.ID] = search
+	}
+
+	return s, nil
+}
+
+// Write the searches to a temporary file that is renamed into place, so
+// the file is never left partially written.
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".searches-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Keep only the known options that are set.
+func cleanOptions(opts map[string]string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, name := range Options {
+		if v := opts[name]; v != "" {
+			res[name] = v
+		}
+	}
+
+	if res["q"] == "" {
+		return nil, errors.New("a saved search needs a query")
+	}
+	return res, nil
+}
+
+// Save a search under a new id.
+func (s *Store) Create(name, owner, tenant string, opts map[string]string) (*Search, error) {
+	if name == "" {
+		return nil, errors.New("a saved search needs a name")
+	}
+
+	opts, err := cleanOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	// ids are random, but make sure.
+	var id string
+	for id == "" || s.byID[id] != nil {
+		if id, err = newID(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	search := &Search{
+		ID:      id,
+		Name:    name,
+		Options: opts,
+		Owner:   owner,
+		Tenant:  tenant,
+		Created: now,
+		Updated: now,
+	}
+
+	s.byID[id] = search
+	if err := s.save(); err != nil {
+		delete(s.byID, id)
+		return nil, err
+	}
+
+	return search, nil
+}
+
+// Replace the name and options of the search with the given id, keeping
+// the name when it is empty. Returns nil if there is no such search.
+func (s *Store) Update(id, name string, opts map[string]string) (*Search, error) {
+	opts, err := cleanOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	prev := s.byID[id]
+	if prev == nil {
+		return nil, nil
+	}
+
+	search := *prev
+	if name != "" {
+		search.Name = name
+	}
+	search.Options = opts
+	search.Updated = time.Now().UTC()
+
+	s.byID[id] = &search
+	if err := s.save(); err != nil {
+		s.byID[id] = prev
+		return nil, err
+	}
+
+	return &search, nil
+}
+
+// Delete the search with the given id. Returns false if there is no such
+// search.
+func (s *Store) Delete(id string) (bool, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	search, ok := s.byID[id]
+	if !ok {
+		return false, nil
+	}
+
+	delete(s.byID, id)
+	if err := s.save(); err != nil {
+		s.byID[id] = search
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Find the search with the given id, nil if there is none.
+func (s *Store) Get(id string) *Search {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.byID[id]
+}
+
+// All of the searches, ordered by name.
+func (s *Store) List() []*Search {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.list()
+}
+
+func (s *Store) list() []*Search {
+	searches := make([]*Search, 0, len(s.byID))
+	for _, search := range s.byID {
+		searches = append(searches, search)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		if searches[i].Name != searches[j].Name {
+			return searches[i].Name < searches[j].Name
+		}
+		return searches[i].ID < searches[j].ID
+	})
+	return searches
+}
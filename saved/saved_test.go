@@ -0,0 +1,62 @@
+package saved
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound-saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "searches.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := s.Create("todos", "ci", "", map[string]string{"q": "TODO", "repos": "*", "unknown": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(search.ID) != 8 || search.Owner != "ci" || len(search.Options) != 2 {
+		t.Fatalf("unexpected search: %+v", search)
+	}
+
+	if _, err := s.Create("empty", "", "", map[string]string{"repos": "*"}); err == nil {
+		t.Fatal("expected an error for a search without a query")
+	}
+
+	if _, err := s.Update(search.ID, "", map[string]string{"q": "FIXME", "i": "fosho"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the searches are read back from the file.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.Get(search.ID)
+	if got == nil || got.Name != "todos" || got.Options["q"] != "FIXME" || got.Options["repos"] != "" {
+		t.Fatalf("unexpected search: %+v", got)
+	}
+
+	if got, err := s.Update("missing", "", map[string]string{"q": "x"}); got != nil || err != nil {
+		t.Fatalf("expected no search to update, got %v, %v", got, err)
+	}
+
+	if ok, err := s.Delete(search.ID); !ok || err != nil {
+		t.Fatalf("expected the search to be deleted, got %v, %v", ok, err)
+	}
+
+	if len(s.List()) != 0 {
+		t.Fatalf("expected no searches, got %d", len(s.List()))
+	}
+}
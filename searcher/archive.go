@@ -0,0 +1,87 @@
+package searcher
+
+import (
+	"errors"
+	"log"
+
+	"github.com/hound-search/hound/index"
+)
+
+// Returned by searches of a repo that was deleted upstream once its index
+// was removed.
+var ErrRemoved = errors.New("the repo was deleted and its index removed")
+
+// Marks the repository as archived upstream. Archived repos are read-only,
+// so updates stop while their index can still be searched. Returns false if
+// it was already archived.
+func (s *Searcher) Archive() bool {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.archived {
+		return false
+	}
+	s.archived = true
+	return true
+}
+
+// Lets a repository that is no longer archived be pulled again, pulling it
+// right away. Returns false if it wasn't archived or was deleted.
+func (s *Searcher) Unarchive() bool {
+	s.lck.Lock()
+	if !s.archived || s.deleted {
+		s.lck.Unlock()
+		return false
+	}
+	s.archived = false
+	s.lck.Unlock()
+
+	s.requestUpdate()
+	return true
+}
+
+// Marks the repository as deleted upstream, which stops its updates for
+// good. With remove, its indexes and clone are also given up, to be removed
+// from the dbpath, and it can no longer be searched.
+func (s *Searcher) MarkDeleted(remove bool) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	s.archived = true
+	s.deleted = true
+	if !remove || s.removed {
+		return
+	}
+	s.removed = true
+
+	// the indexes are unmapped before the dbpath is collected, which is
+	// when their files are removed.
+	closeIndex(s.idx)
+	for _, idx := range s.history.byCommit {
+		closeIndex(idx)
+	}
+
+	if s.disk != nil {
+		log.Printf("Removing the indexes of %s, which was deleted", s.Repo.Url)
+		go s.disk.collect(false)
+	}
+}
+
+func closeIndex(idx *index.Index) {
+	if err := idx.Close(); err != nil {
+		log.Printf("failed to close %s: %s", idx.GetDir(), err)
+	}
+}
+
+func (s *Searcher) isArchived() bool {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.archived
+}
+
+// Determine whether the repository gave up its clone, which is then
+// removed from the dbpath.
+func (s *Searcher) isRemoved() bool {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.removed
+}
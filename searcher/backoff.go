@@ -0,0 +1,58 @@
+package searcher
+
+import "time"
+
+// Lengthens the delay between the polls of a repo that doesn't change. The
+// delay doubles after every after polls in a row that found no change, up
+// to max, and is back to base once a poll finds a change or an update is
+// asked for.
+type backoff struct {
+	base  time.Duration
+	max   time.Duration
+	after int
+
+	idle  int
+	delay time.Duration
+}
+
+func newBackoff(base, max time.Duration, after int) *backoff {
+	return &backoff{
+		base:  base,
+		max:   max,
+		after: after,
+		delay: base,
+	}
+}
+
+// Record the outcome of an update and return the delay until the next
+// poll.
+func (b *backoff) next(changed, requested bool) time.Duration {
+	if changed || requested || b.max <= b.base || b.after <= 0 {
+		b.idle = 0
+		b.delay = b.base
+		return b.delay
+	}
+
+	b.idle++
+	if b.idle%b.after == 0 {
+		b.delay *= 2
+		if b.delay > b.max {
+			b.delay = b.max
+		}
+	}
+	return b.delay
+}
+
+// The delay before retrying an update that failed failures times in a row,
+// which doubles with each failure from base up to max.
+func retryAfter(base, max time.Duration, failures int) time.Duration {
+	d := base
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,25 @@
+package searcher
+
+import "sync"
+
+// Repos with the same url share a clone, like the virtual repos of the
+// subdirectories of a monorepo, so only one of them may pull it or build
+// from it at a time.
+var clones = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: map[string]*sync.Mutex{}}
+
+// Lock the clone in vcsDir, returning the func that unlocks it.
+func lockClone(vcsDir string) func() {
+	clones.Lock()
+	l, ok := clones.locks[vcsDir]
+	if !ok {
+		l = &sync.Mutex{}
+		clones.locks[vcsDir] = l
+	}
+	clones.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
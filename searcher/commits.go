@@ -0,0 +1,163 @@
+package searcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hound-search/hound/vcs"
+)
+
+// The file, in the index directory of the head, that holds the commit
+// metadata for the repo.
+const commitsFile = "commits.json"
+
+// The contents of commitsFile. Count records the index-commits option the
+// log was read with so that changing it causes the log to be read again.
+type commitLog struct {
+	Count   int
+	Commits []*vcs.Commit
+}
+
+// The criteria for a search of the commit metadata. A nil pattern matches
+// every commit.
+type CommitQuery struct {
+	Message *regexp.Regexp
+	Author  *regexp.Regexp
+	Path    *regexp.Regexp
+	Limit   int
+}
+
+func (q *CommitQuery) matches(c *vcs.Commit) bool {
+	if q.Message != nil && !q.Message.MatchString(c.Message) {
+		return false
+	}
+
+	if q.Author != nil && !q.Author.MatchString(c.Author) && !q.Author.MatchString(c.Email) {
+		return false
+	}
+
+	if q.Path == nil {
+		return true
+	}
+
+	for _, p := range c.Paths {
+		if q.Path.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search the commit metadata of the repo, newest first.
+func (s *Searcher) SearchCommits(q *CommitQuery) []*vcs.Commit {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	var res []*vcs.Commit
+	for _, c := range s.commits {
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+
+		if q.matches(c) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func readCommitLog(filename string) (*commitLog, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var l commitLog
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func writeCommitLog(filename string, l *commitLog) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(w).Encode(l); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Load the commit metadata for the current head, either from the index
+// directory when it was stored there before or from the vcs.
+func (s *Searcher) updateCommits(vcsDir string, wd *vcs.WorkDir) error {
+	n := s.Repo.IndexCommits
+	if n <= 0 {
+		return nil
+	}
+
+	s.lck.RLock()
+	filename := filepath.Join(s.idx.GetDir(), commitsFile)
+	s.lck.RUnlock()
+
+	l, err := readCommitLog(filename)
+	if err != nil || l.Count != n {
+		cd, ok := wd.Driver.(vcs.CommitLogDriver)
+		if !ok {
+			return fmt.Errorf("vcs %s does not support index-commits", s.Repo.Vcs)
+		}
+
+		commits, err := cd.Log(vcsDir, n)
+		if err != nil {
+			return err
+		}
+
+		l = &commitLog{Count: n, Commits: commitsIn(commits, s.Repo.Subdir)}
+		if err := writeCommitLog(filename, l); err != nil {
+			return err
+		}
+	}
+
+	s.lck.Lock()
+	s.commits = l.Commits
+	s.lck.Unlock()
+
+	return nil
+}
+
+// The commits that touch the slash separated subdir, with their paths
+// relative to it, as the files of a repo of a subdir are.
+func commitsIn(commits []*vcs.Commit, subdir string) []*vcs.Commit {
+	if subdir == "" {
+		return commits
+	}
+
+	prefix := path.Clean(subdir) + "/"
+	var in []*vcs.Commit
+	for _, c := range commits {
+		var paths []string
+		for _, p := range c.Paths {
+			if strings.HasPrefix(p, prefix) {
+				paths = append(paths, strings.TrimPrefix(p, prefix))
+			}
+		}
+
+		if len(paths) > 0 {
+			cc := *c
+			cc.Paths = paths
+			in = append(in, &cc)
+		}
+	}
+	return in
+}
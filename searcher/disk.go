@@ -0,0 +1,284 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+const defaultGcInterval = time.Hour
+
+// The space the dbpath takes, as reported by the API.
+type DiskUsage struct {
+	Path string
+
+	// The bytes taken by the indexes, head and history, by the clones of
+	// the repos and by everything else, like the access keys. The files
+	// indexes share are counted once, under Shared, rather than in each.
+	Indexes int64
+	Clones  int64
+	Shared  int64
+	Other   int64
+	Total   int64
+
+	// The max-size-mb of the config in bytes, and whether the dbpath takes
+	// more than that.
+	MaxSize    int64 `json:",omitempty"`
+	OverBudget bool  `json:",omitempty"`
+
+	// When the dbpath was last collected, and the directories that were
+	// removed and the bytes that freed.
+	LastGc  time.Time
+	Removed []string `json:",omitempty"`
+	Freed   int64
+}
+
+// Keeps the dbpath tidy, removing the index directories no searcher uses,
+// the temporary directories left by builds that didn't finish and the
+// clones of repos that are no longer in the config, and keeps track of the
+// space it takes.
+type disk struct {
+	dbpath         string
+	maxSize        int64
+	interval       time.Duration
+	verifyInterval time.Duration
+
+	// The names of the clones of the repos in the config.
+	clones map[string]bool
+
+	lck       sync.RWMutex
+	searchers map[string]*Searcher
+	usage     *DiskUsage
+}
+
+func newDisk(cfg *config.Config) *disk {
+	d := &disk{
+		dbpath:         cfg.DbPath,
+		interval:       defaultGcInterval,
+		verifyInterval: defaultVerifyInterval,
+		clones:         map[string]bool{},
+	}
+
+	if c := cfg.Disk; c != nil {
+		d.maxSize = c.MaxSizeMB << 20
+		if c.GcIntervalMs > 0 {
+			d.interval = time.Duration(c.GcIntervalMs) * time.Millisecond
+		}
+
+		if c.VerifyIntervalMs > 0 {
+			d.verifyInterval = time.Duration(c.VerifyIntervalMs) * time.Millisecond
+		}
+	}
+
+	for _, repo := range cfg.Repos {
+		d.clones[vcsDirFor(repo)] = true
+	}
+	return d
+}
+
+// Determine whether the searcher uses the index directory, or may be about
+// to because it is updating.
+func (s *Searcher) mayUse(dir string) bool {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	if s.removed {
+		return false
+	}
+
+	if s.indexing || s.idx.GetDir() == dir {
+		return true
+	}
+
+	for _, idx := range s.history.byCommit {
+		if idx.GetDir() == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// Determine whether the entry of the dbpath can be removed. An index
+// directory is garbage once none of the searchers of its repo use it, and
+// aren't updating either, as they may be about to. Temporary directories,
+// and index directories that are incomplete, are only removed when now is
+// set, which is only safe while no searcher is updating.
+func (d *disk) isGarbage(name string, now bool) bool {
+	path := filepath.Join(d.dbpath, name)
+	switch {
+	case strings.HasPrefix(name, "vcs-"):
+		return !d.clones[name] || d.removedClone(name)
+	case strings.HasPrefix(name, "tmp-"):
+		return now
+	case indexDirPattern.MatchString(name):
+		ref, err := index.Read(path)
+		if err != nil {
+			return now
+		}
+
+		d.lck.RLock()
+		defer d.lck.RUnlock()
+		for _, s := range d.searchers {
+			if s.Repo.Url == ref.Url && s.mayUse(path) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Determine whether the clone belongs only to repos whose indexes were
+// removed.
+func (d *disk) removedClone(name string) bool {
+	d.lck.RLock()
+	defer d.lck.RUnlock()
+
+	removed := false
+	for _, s := range d.searchers {
+		if vcsDirFor(s.Repo) != name {
+			continue
+		}
+
+		if !s.isRemoved() {
+			return false
+		}
+		removed = true
+	}
+	return removed
+}
+
+// Remove what no searcher uses from the dbpath, along with the shared files
+// no index links to anymore, and measure the rest. When now is set, the
+// leftovers of builds that didn't finish are removed too.
+func (d *disk) collect(now bool) {
+	entries, err := ioutil.ReadDir(d.dbpath)
+	if err != nil {
+		log.Printf("failed to collect dbpath: %s", err)
+		return
+	}
+
+	usage := &DiskUsage{
+		Path:    d.dbpath,
+		MaxSize: d.maxSize,
+		LastGc:  time.Now(),
+	}
+
+	sizes := map[string]int64{}
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(d.dbpath, name)
+		if name == sharedDirName {
+			continue
+		}
+
+		size := sizeOf(path, false)
+
+		if e.IsDir() && d.isGarbage(name, now) {
+			if err := os.RemoveAll(path); err != nil {
+				log.Printf("failed to remove %s: %s", path, err)
+			} else {
+				log.Printf("Removed %s, which no repo uses", name)
+				usage.Removed = append(usage.Removed, name)
+				usage.Freed += size
+				continue
+			}
+		}
+
+		sizes[name] = size
+		switch {
+		case indexDirPattern.MatchString(name):
+			usage.Indexes += size
+		case strings.HasPrefix(name, "vcs-"):
+			usage.Clones += size
+		default:
+			usage.Other += size
+		}
+	}
+
+	// the shared files are collected once the indexes that link to them
+	// are gone.
+	shared := filepath.Join(d.dbpath, sharedDirName)
+	if n, freed, err := index.CollectShared(shared); err != nil {
+		log.Printf("failed to collect %s: %s", shared, err)
+	} else if n > 0 {
+		log.Printf("Removed %d shared files, which no index uses", n)
+		usage.Freed += freed
+	}
+	usage.Shared = sizeOf(shared, true)
+
+	usage.Total = usage.Indexes + usage.Clones + usage.Shared + usage.Other
+	usage.OverBudget = d.maxSize > 0 && usage.Total > d.maxSize
+	if usage.OverBudget {
+		log.Printf("dbpath takes %d MB, more than max-size-mb of %d", usage.Total>>20, d.maxSize>>20)
+	}
+
+	d.lck.Lock()
+	d.usage = usage
+	searchers := d.searchers
+	d.lck.Unlock()
+
+	for _, s := range searchers {
+		s.setDiskUsage(sizes)
+	}
+}
+
+// Collect the dbpath every interval, for as long as the server runs.
+func (d *disk) run() {
+	for {
+		time.Sleep(d.interval)
+		d.collect(false)
+	}
+}
+
+// Whether the dbpath took more than max-size-mb when it was last measured.
+// A nil disk has no limit.
+func (d *disk) overBudget() bool {
+	if d == nil {
+		return false
+	}
+
+	d.lck.RLock()
+	defer d.lck.RUnlock()
+	return d.usage != nil && d.usage.OverBudget
+}
+
+// The space the dbpath of the searchers took when it was last measured, nil
+// if it is unknown.
+func DiskUsageOf(idx map[string]*Searcher) *DiskUsage {
+	for _, s := range idx {
+		if s.disk == nil {
+			continue
+		}
+
+		s.disk.lck.RLock()
+		defer s.disk.lck.RUnlock()
+		return s.disk.usage
+	}
+	return nil
+}
+
+// The bytes taken by the files under path. Files that are linked to from
+// elsewhere are only counted when shared is set, so the files indexes
+// share are only counted in the shared directory.
+func sizeOf(path string, shared bool) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error { //nolint
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if n, ok := index.LinkCount(info); shared || !ok || n <= 1 {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,216 @@
+package searcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/storage"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The minimum length of a commit id prefix that is accepted in place of
+// the full commit id.
+const minRevPrefixLen = 7
+
+// The indexes for revisions from the history of a repo. Each commit is
+// indexed once no matter how many names (tags) refer to it.
+type history struct {
+	names    map[string]string
+	byCommit map[string]*index.Index
+}
+
+func newHistory() *history {
+	return &history{
+		names:    map[string]string{},
+		byCommit: map[string]*index.Index{},
+	}
+}
+
+// Resolve a revision name, commit id or commit id prefix to a commit id.
+// Returns "" if the revision is unknown.
+func (h *history) resolve(rev string) string {
+	if commit, ok := h.names[rev]; ok {
+		return commit
+	}
+
+	if len(rev) < minRevPrefixLen {
+		return ""
+	}
+
+	for commit := range h.byCommit {
+		if strings.HasPrefix(commit, rev) {
+			return commit
+		}
+	}
+	return ""
+}
+
+// Find the index to search for the given revision. An empty revision, or
+// one that refers to the head, selects the current index.
+func (s *Searcher) indexFor(rev string) (*index.Index, error) {
+	if rev == "" || rev == s.idx.Ref.Rev {
+		return s.idx, nil
+	}
+
+	commit := s.history.resolve(rev)
+	if commit == "" && len(rev) >= minRevPrefixLen && strings.HasPrefix(s.idx.Ref.Rev, rev) {
+		commit = s.idx.Ref.Rev
+	}
+
+	if commit == s.idx.Ref.Rev && commit != "" {
+		return s.idx, nil
+	}
+
+	if idx := s.history.byCommit[commit]; idx != nil {
+		return idx, nil
+	}
+
+	return nil, fmt.Errorf("revision %s is not indexed", rev)
+}
+
+// Determine whether a search for the given revision can be served.
+func (s *Searcher) HasRevision(rev string) bool {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	_, err := s.indexFor(rev)
+	return err == nil
+}
+
+// The names of all the revisions that have been indexed from the history
+// of the repo, not including the head.
+func (s *Searcher) Revisions() []string {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	names := make([]string, 0, len(s.history.names))
+	for name := range s.history.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export a revision into a temporary directory and build an index for it.
+func buildHistoryIndex(
+	store storage.Store,
+	tables *index.MappedTables,
+	hd vcs.HistoryDriver,
+	opt *index.IndexOptions,
+	dbpath,
+	vcsDir,
+	url,
+	rev string) (*index.Index, error) {
+	tmpDir := filepath.Join(dbpath, fmt.Sprintf("tmp-%s", hashFor(url+rev)))
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	if err := hd.Export(vcsDir, rev, tmpDir); err != nil {
+		return nil, err
+	}
+
+	return buildAndOpenIndex(store, tables, nil, opt, dbpath, tmpDir, nextIndexDir(dbpath), url, rev)
+}
+
+// Bring the history indexes in line with the index-history options of the
+// repo. Indexes for commits that are still wanted are kept, unless rebuild
+// is set, indexes found in the dbpath at startup are reused and everything
+// else is built. The existing indexes serve searches until the new set is
+// complete, after which the ones that were replaced are destroyed.
+func (s *Searcher) updateHistory(
+	dbpath,
+	vcsDir,
+	name string,
+	wd *vcs.WorkDir,
+	opt *index.IndexOptions,
+	refs *foundRefs,
+	rebuild bool) error {
+	cfg := s.Repo.History
+	if cfg == nil || (cfg.Revisions <= 0 && cfg.Tags <= 0) {
+		return nil
+	}
+
+	// the history is what gives way when the dbpath takes too much space.
+	if s.disk.overBudget() {
+		log.Printf("Not indexing the history of %s, the dbpath is over max-size-mb", name)
+		return nil
+	}
+
+	hd, ok := wd.Driver.(vcs.HistoryDriver)
+	if !ok {
+		return fmt.Errorf("vcs %s does not support index-history", s.Repo.Vcs)
+	}
+
+	revs, err := hd.History(vcsDir, cfg.Revisions, cfg.Tags, cfg.TagPattern)
+	if err != nil {
+		return err
+	}
+
+	s.lck.RLock()
+	old := s.history
+	head := s.idx.Ref.Rev
+	s.lck.RUnlock()
+
+	h := newHistory()
+	for _, r := range revs {
+		h.names[r.Name] = r.Rev
+		if r.Rev == head || h.byCommit[r.Rev] != nil {
+			continue
+		}
+
+		if idx := old.byCommit[r.Rev]; idx != nil && !rebuild {
+			h.byCommit[r.Rev] = idx
+			continue
+		}
+
+		if ref := refs.find(s.Repo.Url, r.Rev, opt.Hash()); ref != nil {
+			if err := refs.claim(ref); err == nil {
+				idx, err := ref.OpenWith(s.tables)
+				if err != nil {
+					return err
+				}
+				h.byCommit[r.Rev] = idx
+				continue
+			}
+		}
+
+		log.Printf("Building %s for %s (%s)", name, r.Name, r.Rev)
+		idx, err := buildHistoryIndex(s.store, s.tables, hd, opt, dbpath, vcsDir, s.Repo.Url, r.Rev)
+		if err != nil {
+			log.Printf("failed history index build (%s - %s): %s", name, r.Name, err)
+			if idx := old.byCommit[r.Rev]; idx != nil {
+				h.byCommit[r.Rev] = idx
+			} else {
+				delete(h.names, r.Name)
+			}
+			continue
+		}
+		h.byCommit[r.Rev] = idx
+	}
+
+	s.lck.Lock()
+	s.history = h
+	s.lck.Unlock()
+
+	for commit, idx := range old.byCommit {
+		if h.byCommit[commit] == idx {
+			continue
+		}
+
+		if err := s.destroyIndex(idx); err != nil {
+			log.Printf("failed to destroy history index (%s - %s): %s", name, commit, err)
+		}
+	}
+
+	return nil
+}
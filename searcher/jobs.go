@@ -0,0 +1,203 @@
+package searcher
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// The states of a job and of the update of each of its repos.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+const (
+	// The most jobs that are kept, beyond that the oldest is forgotten.
+	maxJobs = 1000
+
+	jobIdBytes = 12
+)
+
+// The error of the updates of repos that aren't pulled because they are
+// paused or archived.
+var errNotPulled = errors.New("the repo is paused or archived and isn't pulled")
+
+// The update of one repo of a job, and the revision that is indexed once
+// it is done.
+type JobRepo struct {
+	State string
+	Rev   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// Updates of repos asked for at once, which can be waited for. A job is
+// done when every repo was pulled and, if it changed, indexed again, and
+// failed when any of them failed.
+type Job struct {
+	Id       string
+	State    string
+	Created  time.Time
+	Finished *time.Time `json:",omitempty"`
+	Repos    map[string]*JobRepo
+}
+
+// The jobs asked for since the server started, kept in memory.
+type Jobs struct {
+	lck  sync.Mutex
+	jobs map[string]*Job
+
+	// the ids of the jobs, oldest first.
+	ids []string
+}
+
+// The update of a repo that a searcher owes a job.
+type jobUpdate struct {
+	jobs *Jobs
+	job  *Job
+	repo string
+}
+
+func NewJobs() *Jobs {
+	return &Jobs{jobs: map[string]*Job{}}
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, jobIdBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Ask for updates of the searchers, by the names of their repos, returning
+// the job that tracks them. The searchers have to accept updates.
+func (j *Jobs) Update(searchers map[string]*Searcher) (*Job, error) {
+	id, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Id:      id,
+		State:   JobQueued,
+		Created: time.Now(),
+		Repos:   map[string]*JobRepo{},
+	}
+	for name := range searchers {
+		job.Repos[name] = &JobRepo{State: JobQueued}
+	}
+
+	// there is nothing to wait for without repos.
+	if len(searchers) == 0 {
+		job.State = JobDone
+		job.Finished = &job.Created
+	}
+
+	j.lck.Lock()
+	if len(j.ids) >= maxJobs {
+		delete(j.jobs, j.ids[0])
+		j.ids = j.ids[1:]
+	}
+	j.jobs[id] = job
+	j.ids = append(j.ids, id)
+	j.lck.Unlock()
+
+	for name, s := range searchers {
+		s.lck.Lock()
+		s.jobs = append(s.jobs, &jobUpdate{jobs: j, job: job, repo: name})
+		s.lck.Unlock()
+		s.requestUpdate()
+	}
+
+	return j.Get(id), nil
+}
+
+// A copy of the job with the id, or nil if there is none.
+func (j *Jobs) Get(id string) *Job {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	c := *job
+	c.Repos = make(map[string]*JobRepo, len(job.Repos))
+	for name, r := range job.Repos {
+		rc := *r
+		c.Repos[name] = &rc
+	}
+	return &c
+}
+
+// Record the state of the update of the repo, and the job's along with it.
+func (u *jobUpdate) set(state, rev string, err error) {
+	u.jobs.lck.Lock()
+	defer u.jobs.lck.Unlock()
+
+	r := u.job.Repos[u.repo]
+	r.State = state
+	r.Rev = rev
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	var queued, running, failed bool
+	for _, r := range u.job.Repos {
+		switch r.State {
+		case JobQueued:
+			queued = true
+		case JobRunning:
+			running = true
+		case JobFailed:
+			failed = true
+		}
+	}
+
+	switch {
+	case running || (queued && u.job.State != JobQueued):
+		u.job.State = JobRunning
+	case queued:
+	case failed:
+		u.job.State = JobFailed
+	default:
+		u.job.State = JobDone
+	}
+
+	if u.job.Finished == nil && !queued && !running {
+		now := time.Now()
+		u.job.Finished = &now
+	}
+}
+
+// Take the updates owed to jobs, which the update that is starting does,
+// marking them running.
+func (s *Searcher) takeJobs() []*jobUpdate {
+	s.lck.Lock()
+	jobs := s.jobs
+	s.jobs = nil
+	s.lck.Unlock()
+
+	for _, u := range jobs {
+		u.set(JobRunning, "", nil)
+	}
+	return jobs
+}
+
+// Finish the updates owed to jobs with the revision that is indexed, or
+// the error of the update.
+func finishJobs(jobs []*jobUpdate, rev string, err error) {
+	for _, u := range jobs {
+		if err != nil {
+			u.set(JobFailed, "", err)
+		} else {
+			u.set(JobDone, rev, nil)
+		}
+	}
+}
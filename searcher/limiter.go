@@ -0,0 +1,99 @@
+package searcher
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// A request to pull and index a repo, which decides its place in the queue
+// of a limiter.
+type ticket struct {
+	// Whether the update was asked for, by a webhook or the API, rather
+	// than being a periodic poll.
+	requested bool
+
+	// The priority of the repo, higher goes first.
+	priority int
+
+	// The size of the index of the repo, if it has one. Smaller repos go
+	// first since they hold the others up for less time.
+	size int64
+
+	seq uint64
+	ch  chan empty
+}
+
+// Determine whether a is let in before b.
+func (a *ticket) before(b *ticket) bool {
+	if a.requested != b.requested {
+		return a.requested
+	}
+
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+
+	if a.size != b.size {
+		return a.size < b.size
+	}
+	return a.seq < b.seq
+}
+
+type ticketQueue []*ticket
+
+func (q ticketQueue) Len() int            { return len(q) }
+func (q ticketQueue) Less(i, j int) bool  { return q[i].before(q[j]) }
+func (q ticketQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *ticketQueue) Push(x interface{}) { *q = append(*q, x.(*ticket)) }
+
+func (q *ticketQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// Limits how many repos are pulled and indexed at once. Rather than in the
+// order they arrive, waiting repos are let in by their tickets: updates that
+// were asked for first, then repos of higher priority, then smaller ones.
+type limiter struct {
+	lck   sync.Mutex
+	free  int
+	seq   uint64
+	queue ticketQueue
+}
+
+func makeLimiter(n int) *limiter {
+	return &limiter{free: n}
+}
+
+// Wait for a turn to pull and index a repo.
+func (l *limiter) Acquire(t ticket) {
+	l.lck.Lock()
+	if l.free > 0 && len(l.queue) == 0 {
+		l.free--
+		l.lck.Unlock()
+		return
+	}
+
+	l.seq++
+	t.seq = l.seq
+	t.ch = make(chan empty)
+	heap.Push(&l.queue, &t)
+	l.lck.Unlock()
+
+	<-t.ch
+}
+
+// Give up a turn, letting in the first waiting repo if there is one.
+func (l *limiter) Release() {
+	l.lck.Lock()
+	defer l.lck.Unlock()
+
+	if len(l.queue) == 0 {
+		l.free++
+		return
+	}
+
+	close(heap.Pop(&l.queue).(*ticket).ch)
+}
@@ -0,0 +1,121 @@
+package searcher
+
+import (
+	"sync"
+	"time"
+)
+
+// The states of a repo while the searchers are first made.
+const (
+	StatePending  = "pending"
+	StateUpdating = "updating"
+	StateIndexing = "indexing"
+	StateReady    = "ready"
+	StateFailed   = "failed"
+)
+
+// Tracks the state of each repo while the searchers are first made, so
+// that how far along they are can be reported before they can be searched.
+// A nil Progress tracks nothing.
+type Progress struct {
+	lck     sync.RWMutex
+	started time.Time
+	states  map[string]string
+}
+
+// The progress of making the searchers as reported by the API.
+type ProgressReport struct {
+	Total    int
+	Pending  int
+	Updating int
+	Indexing int
+	Ready    int
+	Failed   int
+
+	// Whether every repo is either ready or failed.
+	Done bool
+
+	// When the searchers started to be made and the estimated time left,
+	// which is only known once a repo is done.
+	Started time.Time
+	EtaMs   int64 `json:",omitempty"`
+
+	// The state of each repo.
+	Repos map[string]string `json:",omitempty"`
+}
+
+// Create a Progress in which every repo is pending.
+func NewProgress(names []string) *Progress {
+	p := &Progress{
+		started: time.Now(),
+		states:  map[string]string{},
+	}
+
+	for _, name := range names {
+		p.states[name] = StatePending
+	}
+	return p
+}
+
+// Create a Progress in which every repo is ready, for searchers that were
+// made without tracking their progress.
+func ReadyProgress(names []string) *Progress {
+	p := NewProgress(names)
+	for _, name := range names {
+		p.states[name] = StateReady
+	}
+	return p
+}
+
+func (p *Progress) set(name, state string) {
+	if p == nil {
+		return
+	}
+
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	p.states[name] = state
+}
+
+// Report the progress at the given time of the repos that keep accepts, or
+// of every repo when it is nil. The time left is estimated from the average
+// time each of the repos that are done took, taking into account that
+// repos are indexed concurrently.
+func (p *Progress) Report(now time.Time, keep func(name string) bool) *ProgressReport {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	r := &ProgressReport{
+		Started: p.started,
+		Repos:   map[string]string{},
+	}
+
+	for name, state := range p.states {
+		if keep != nil && !keep(name) {
+			continue
+		}
+
+		r.Total++
+		switch state {
+		case StatePending:
+			r.Pending++
+		case StateUpdating:
+			r.Updating++
+		case StateIndexing:
+			r.Indexing++
+		case StateReady:
+			r.Ready++
+		case StateFailed:
+			r.Failed++
+		}
+		r.Repos[name] = state
+	}
+
+	done := r.Ready + r.Failed
+	r.Done = done == r.Total
+	if done > 0 && !r.Done {
+		elapsed := now.Sub(p.started)
+		r.EtaMs = int64(elapsed*time.Duration(r.Total-done)/time.Duration(done)) / int64(time.Millisecond)
+	}
+	return r
+}
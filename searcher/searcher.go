@@ -1,27 +1,87 @@
 package searcher
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/cron"
 	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/notify"
+	"github.com/hound-search/hound/redact"
+	"github.com/hound-search/hound/storage"
 	"github.com/hound-search/hound/vcs"
 )
 
 type Searcher struct {
-	idx  *index.Index
-	lck  sync.RWMutex
-	Repo *config.Repo
+	idx     *index.Index
+	history *history
+	commits []*vcs.Commit
+	lck     sync.RWMutex
+	Repo    *config.Repo
+
+	// Where indexes are copied after they are built, nil if they are only
+	// kept in the dbpath.
+	store storage.Store
+
+	// The trigram tables the indexes of the repo are mapped among.
+	tables *index.MappedTables
+
+	// Set when the next update must rebuild from a fresh clone.
+	reindexRequested bool
+
+	// The updates owed to jobs, which the next update does.
+	jobs []*jobUpdate
+
+	// The progress of updates, see Status.
+	indexing    bool
+	lastErr     error
+	lastErrAt   time.Time
+	lastUpdated time.Time
+	pollDelay   time.Duration
+
+	// Set while an operator has paused updates of the repo.
+	paused bool
+
+	// Set by webhooks when the repo is archived or deleted upstream, which
+	// stops its updates, and when the index of a deleted repo was removed.
+	archived bool
+	deleted  bool
+	removed  bool
+
+	// The number of updates in a row that failed.
+	failures int
+
+	// Set when verification found the head index to be corrupt, until it
+	// is rebuilt.
+	corrupt error
+
+	// Keeps the dbpath tidy, nil for searchers made on their own. The space
+	// the clone and the history indexes of the repo take is measured by it.
+	disk        *disk
+	cloneSize   int64
+	historySize int64
+
+	// Told when the repo is indexed or fails to update, may be nil.
+	notifier *notify.Notifier
+
+	// Scans the files that change in new indexes for secrets, nil when
+	// scanning is off.
+	secrets *secretScanner
+
+	// Masks the secrets in the lines searches return, nil when none are
+	// hidden.
+	redactor *redact.Redactor
 
 	// The channel is used to request updates from the API and
 	// to signal that it is ok for searchers to begin polling.
@@ -44,52 +104,89 @@ type searcherResult struct {
 }
 
 type empty struct{}
-type limiter chan bool
 
 /**
  * Holds a set of IndexRefs that were found in the dbpath at startup,
  * these indexes can be 'claimed' and re-used by newly created searchers.
+ * Refs that were found in the store only have their manifest in the dbpath
+ * until they are claimed.
  */
 type foundRefs struct {
 	refs    []*index.IndexRef
 	claimed map[*index.IndexRef]bool
+	store   storage.Store
+	tables  *index.MappedTables
 	lock    sync.Mutex
 }
 
-func makeLimiter(n int) limiter {
-	return limiter(make(chan bool, n))
-}
-
-func (l limiter) Acquire() {
-	l <- true
-}
-
-func (l limiter) Release() {
-	<-l
-}
-
 /**
- * Find an Index ref for the repo url and rev, returns nil if no such
- * ref exists.
+ * Find an Index ref for the repo url and rev that was built with options
+ * of the given hash, returns nil if no such ref exists.
  */
-func (r *foundRefs) find(url, rev string) *index.IndexRef {
+func (r *foundRefs) find(url, rev, optHash string) *index.IndexRef {
 	for _, ref := range r.refs {
-		if ref.Url == url && ref.Rev == rev {
+		if ref.Url == url && ref.Rev == rev && ref.OptionsHash == optHash {
 			return ref
 		}
 	}
 	return nil
 }
 
+/**
+ * Find the most recently built Index ref for the repo url that was built
+ * with options of the given hash, returns nil if no such ref exists.
+ */
+func (r *foundRefs) findLatest(url, optHash string) *index.IndexRef {
+	var latest *index.IndexRef
+	for _, ref := range r.refs {
+		if ref.Url != url || ref.OptionsHash != optHash {
+			continue
+		}
+
+		if latest == nil || ref.Time.After(latest.Time) {
+			latest = ref
+		}
+	}
+	return latest
+}
+
 /**
  * Claim a ref for reuse. This ensures they ref will not be garbage
- * collected at the end of startup.
+ * collected at the end of startup. A ref found in the store is fetched
+ * into the dbpath, if that fails, or its trigram table is corrupt, it is
+ * left unclaimed.
  */
-func (r *foundRefs) claim(ref *index.IndexRef) {
+func (r *foundRefs) claim(ref *index.IndexRef) error {
 	r.lock.Lock()
-	defer r.lock.Unlock()
-
 	r.claimed[ref] = true
+	r.lock.Unlock()
+
+	if err := r.fetch(ref); err != nil {
+		r.lock.Lock()
+		delete(r.claimed, ref)
+		r.lock.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Fetch the data of the ref from the store if it only has its manifest in
+// the dbpath, and check its trigram table.
+func (r *foundRefs) fetch(ref *index.IndexRef) error {
+	if r.store != nil && !ref.HasData() {
+		name := filepath.Base(ref.Dir())
+		log.Printf("Fetching %s from storage", name)
+		if err := storage.GetIndex(r.store, name, ref.Dir()); err != nil {
+			return err
+		}
+		shareFiles(filepath.Dir(ref.Dir()), ref)
+	}
+
+	if err := ref.CheckTrigrams(); err != nil {
+		return fmt.Errorf("corrupt index: %s", err)
+	}
+	return nil
 }
 
 /**
@@ -113,15 +210,29 @@ func (r *foundRefs) removeUnclaimed() error {
 }
 
 // Perform atomic swap of index in the searcher so that the new
-// index is made "live".
+// index is made "live". Searches hold the read lock for their duration so
+// once the swap is made no search can reach the old index, which is then
+// destroyed without holding up the searches on the new one.
 func (s *Searcher) swapIndexes(idx *index.Index) error {
 	s.lck.Lock()
-	defer s.lck.Unlock()
-
 	oldIdx := s.idx
 	s.idx = idx
+	s.corrupt = nil
+	s.lck.Unlock()
 
-	return oldIdx.Destroy()
+	return s.destroyIndex(oldIdx)
+}
+
+// Destroy an index that is no longer used, along with its copy in the store.
+func (s *Searcher) destroyIndex(idx *index.Index) error {
+	if err := idx.Destroy(); err != nil {
+		return err
+	}
+
+	if s.store == nil {
+		return nil
+	}
+	return storage.DeleteIndex(s.store, filepath.Base(idx.GetDir()))
 }
 
 // Perform a basic search on the current index using the supplied pattern
@@ -131,18 +242,50 @@ func (s *Searcher) swapIndexes(idx *index.Index) error {
 func (s *Searcher) Search(pat string, opt *index.SearchOptions) (*index.SearchResponse, error) {
 	s.lck.RLock()
 	defer s.lck.RUnlock()
-	return s.idx.Search(pat, opt)
-}
 
-// Get the excluded files as a JSON string. This is only used for returning
-// the data directly to clients (thus JSON).
-func (s *Searcher) GetExcludedFiles() string {
-	path := filepath.Join(s.idx.GetDir(), "excluded_files.json")
-	dat, err := ioutil.ReadFile(path)
+	if s.removed {
+		return nil, ErrRemoved
+	}
+
+	idx, err := s.indexFor(opt.Rev)
 	if err != nil {
-		log.Printf("Couldn't read excluded_files.json %v\n", err)
+		return nil, err
+	}
+
+	// searching a corrupt index would bring the server down.
+	if idx == s.idx && s.corrupt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, s.corrupt)
+	}
+
+	// the options are shared by the searches of every repo.
+	if s.redactor != nil {
+		o := *opt
+		o.Redactor = s.redactor
+		opt = &o
 	}
-	return string(dat)
+
+	return idx.Search(pat, opt)
+}
+
+// The files that were left out of the index of the head, and why.
+func (s *Searcher) ExcludedFiles() ([]*index.ExcludedFile, error) {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.idx.ExcludedFiles()
+}
+
+// The packages the head of the repo depends on.
+func (s *Searcher) Dependencies() ([]*index.Dependency, error) {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.idx.Dependencies()
+}
+
+// The licenses and copyrights found in the directories of the head.
+func (s *Searcher) Licenses() ([]*index.DirLicenses, error) {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.idx.Licenses()
 }
 
 // Triggers an immediate poll of the repository.
@@ -151,16 +294,77 @@ func (s *Searcher) Update() bool {
 		return false
 	}
 
-	// schedule an update if one is not already scheduled
+	s.requestUpdate()
+	return true
+}
+
+// Stops the repository from being pulled, by polls and requested updates
+// alike, until it is resumed. Returns false if it was already paused.
+func (s *Searcher) Pause() bool {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.paused {
+		return false
+	}
+	s.paused = true
+	return true
+}
+
+// Lets a paused repository be pulled again, pulling it right away to catch
+// up on the updates it missed. Returns false if it wasn't paused.
+func (s *Searcher) Resume() bool {
+	s.lck.Lock()
+	if !s.paused {
+		s.lck.Unlock()
+		return false
+	}
+	s.paused = false
+	s.lck.Unlock()
+
+	s.requestUpdate()
+	return true
+}
+
+func (s *Searcher) isPaused() bool {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.paused
+}
+
+// Schedule an update if one is not already scheduled.
+func (s *Searcher) requestUpdate() {
 	select {
 	case s.updateCh <- time.Now():
 	default:
 		// don't wait to enqueue another update
 	}
+}
+
+// Triggers an immediate rebuild of the index from a fresh clone of the
+// repository, discarding the existing index and vcs directory. Returns
+// false if the searcher is not accepting updates.
+func (s *Searcher) Reindex() bool {
+	if !s.Repo.PollUpdatesEnabled() && !s.Repo.PushUpdatesEnabled() {
+		return false
+	}
+
+	s.lck.Lock()
+	s.reindexRequested = true
+	s.lck.Unlock()
 
+	s.requestUpdate()
 	return true
 }
 
+// Consume a pending reindex request.
+func (s *Searcher) takeReindex() bool {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	force := s.reindexRequested
+	s.reindexRequested = false
+	return force
+}
+
 // Shut down the searcher cleanly, waiting for any indexing operations to complete.
 func (s *Searcher) Stop() {
 	select {
@@ -180,8 +384,9 @@ func (s *Searcher) completeShutdown() {
 }
 
 // Wait for either the delay period to expire or an update request to
-// arrive. Note that an empty delay will result in an infinite timeout.
-func (s *Searcher) waitForUpdate(delay time.Duration) {
+// arrive, returning true for a request. Note that an empty delay will
+// result in an infinite timeout.
+func (s *Searcher) waitForUpdate(delay time.Duration) bool {
 	var tch <-chan time.Time
 	if delay.Nanoseconds() > 0 {
 		tch = time.After(delay)
@@ -190,9 +395,51 @@ func (s *Searcher) waitForUpdate(delay time.Duration) {
 	// wait for a timeout, the update channel signal, or a shutdown request
 	select {
 	case <-s.updateCh:
+		return true
 	case <-tch:
 	case <-s.shutdownCh:
 	}
+	return false
+}
+
+// A random duration of up to d, which is never zero unless d is, since
+// waiting for no time waits forever.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+// The time from now until the schedule next says to poll, which is zero,
+// and so forever, when it never does.
+func untilNext(sched *cron.Schedule, now time.Time) time.Duration {
+	next := sched.Next(now)
+	if next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// The ticket with which the searcher waits for its turn to update, which
+// puts requested updates ahead of polls.
+func (s *Searcher) ticket(requested bool) ticket {
+	t := ticket{
+		requested: requested,
+		priority:  s.Repo.Priority,
+	}
+
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	if size, err := s.idx.Size(); err == nil {
+		t.size = size
+	}
+	return t
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 // Signal the searcher that it is ok to begin polling the repository.
@@ -207,9 +454,56 @@ func nextIndexDir(dbpath string) string {
 	return filepath.Join(dbpath, fmt.Sprintf("idx-%08x", r))
 }
 
+// Matches the names of the directories made by nextIndexDir.
+var indexDirPattern = regexp.MustCompile(`^idx-[0-9a-f]+$`)
+
+// The directory of the dbpath holding the contents of the files the indexes
+// share, see index.ShareFiles.
+const sharedDirName = "shared"
+
+// Share the files of the index in the dbpath with the other indexes. It
+// isn't fatal when that fails, the index then keeps its own copies.
+func shareFiles(dbpath string, r *index.IndexRef) {
+	if err := r.ShareFiles(filepath.Join(dbpath, sharedDirName)); err != nil {
+		log.Printf("failed to share the files of %s: %s", filepath.Base(r.Dir()), err)
+	}
+}
+
+// Fetch the manifests of the indexes in the store that are not already in
+// the dbpath so they are found along with the local ones.
+func fetchStoredManifests(dbpath string, store storage.Store) error {
+	names, err := storage.ListIndexes(store)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !indexDirPattern.MatchString(name) {
+			continue
+		}
+
+		dir := filepath.Join(dbpath, name)
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+
+		if err := storage.GetManifest(store, name, dir); err != nil {
+			log.Printf("failed to fetch stored manifest (%s): %s", name, err)
+			os.RemoveAll(dir) //nolint
+		}
+	}
+	return nil
+}
+
 // Read the refs associated with each of the index dirs
-// in the given dbpath.
-func findExistingRefs(dbpath string) (*foundRefs, error) {
+// in the given dbpath, and in the store if there is one.
+func findExistingRefs(dbpath string, store storage.Store, tables *index.MappedTables) (*foundRefs, error) {
+	if store != nil {
+		if err := fetchStoredManifests(dbpath, store); err != nil {
+			return nil, err
+		}
+	}
+
 	dirs, err := filepath.Glob(filepath.Join(dbpath, "idx-*"))
 	if err != nil {
 		return nil, err
@@ -224,13 +518,20 @@ func findExistingRefs(dbpath string) (*foundRefs, error) {
 	return &foundRefs{
 		refs:    refs,
 		claimed: map[*index.IndexRef]bool{},
+		store:   store,
+		tables:  tables,
 	}, nil
 }
 
 // Open an index at the given path. If the idxDir is already present, it will
 // simply open and use that index. If, however, the idxDir does not exist a new
-// one will be built.
+// one will be built and copied to the store, if there is one. A new index of
+// the working directory of wd, when it is given, has the times the files last
+// changed if the vcs can tell. The index is mapped among the tables.
 func buildAndOpenIndex(
+	store storage.Store,
+	tables *index.MappedTables,
+	wd *vcs.WorkDir,
 	opt *index.IndexOptions,
 	dbpath,
 	vcsDir,
@@ -238,15 +539,48 @@ func buildAndOpenIndex(
 	url,
 	rev string) (*index.Index, error) {
 	if _, err := os.Stat(idxDir); err != nil {
-		r, err := index.Build(opt, idxDir, vcsDir, url, rev)
+		r, err := index.Build(withModTimes(wd, opt, vcsDir), idxDir, vcsDir, url, rev)
 		if err != nil {
+			// don't leave a partial index behind in the dbpath.
+			os.RemoveAll(idxDir) //nolint
 			return nil, err
 		}
+		shareFiles(dbpath, r)
+
+		if store != nil {
+			if err := storage.PutIndex(store, idxDir); err != nil {
+				log.Printf("failed to store index (%s): %s", url, err)
+			}
+		}
 
-		return r.Open()
+		return r.OpenWith(tables)
 	}
 
-	return index.Open(idxDir)
+	return index.Open(idxDir, tables)
+}
+
+// The options with the times the files in vcsDir last changed, when wd is
+// given and its vcs can tell. Failing to read the times isn't fatal, the
+// index then goes by the working copy.
+func withModTimes(wd *vcs.WorkDir, opt *index.IndexOptions, vcsDir string) *index.IndexOptions {
+	if wd == nil {
+		return opt
+	}
+
+	fd, ok := wd.Driver.(vcs.FileTimesDriver)
+	if !ok {
+		return opt
+	}
+
+	times, err := fd.FileTimes(vcsDir)
+	if err != nil {
+		log.Printf("failed to read file times (%s): %s", vcsDir, err)
+		return opt
+	}
+
+	o := *opt
+	o.ModTimes = times
+	return &o
 }
 
 // Simply prints out statistics about the heap. When hound rebuilds a new
@@ -281,16 +615,39 @@ func init() {
 // of partial errors. First, if the error returned is non-nil then a fatal error has
 // occurred and no other return values are valid. If an error occurs that is specific
 // to a particular searcher, that searcher will not be present in the searcher map and
-// will have an error entry in the error map.
-func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error) {
+// will have an error entry in the error map. The state of each repo is tracked in
+// progress, which may be nil.
+func MakeAll(cfg *config.Config, progress *Progress) (map[string]*Searcher, map[string]error, error) {
 	errs := map[string]error{}
 	searchers := map[string]*Searcher{}
 
-	refs, err := findExistingRefs(cfg.DbPath)
+	store, err := storage.New(cfg.StorageConfig())
 	if err != nil {
 		return nil, nil, err
 	}
 
+	refs, err := findExistingRefs(cfg.DbPath, store, index.NewMappedTables(cfg.MaxMappedMB<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notifier, err := notify.New(cfg.Notifications)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets, err := newSecretScanner(cfg.SecretScanning)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var redactor *redact.Redactor
+	if r := cfg.Redaction; r != nil {
+		if redactor, err = redact.New(r.Patterns, r.BuiltinRulesEnabled()); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	lim := makeLimiter(cfg.MaxConcurrentIndexers)
 
 	n := len(cfg.Repos)
@@ -300,7 +657,7 @@ func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error)
 	// Start new searchers for all repos in different go routines while
 	// respecting cfg.MaxConcurrentIndexers.
 	for name, repo := range cfg.Repos {
-		go newSearcherConcurrent(cfg.DbPath, name, repo, refs, lim, resultCh)
+		go newSearcherConcurrent(cfg.DbPath, name, repo, refs, lim, notifier, progress, resultCh)
 	}
 
 	// Collect the results on resultCh channel for all repos.
@@ -309,15 +666,30 @@ func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error)
 		if r.err != nil {
 			log.Print(r.err)
 			errs[r.name] = r.err
+			progress.set(r.name, StateFailed)
 			continue
 		}
 		searchers[r.name] = r.searcher
+		progress.set(r.name, StateReady)
 	}
 
 	if err := refs.removeUnclaimed(); err != nil {
 		return nil, nil, err
 	}
 
+	// nothing is updating yet, so even the leftovers of builds that didn't
+	// finish can be removed.
+	disk := newDisk(cfg)
+	disk.searchers = searchers
+	for _, s := range searchers {
+		s.disk = disk
+		s.secrets = secrets
+		s.redactor = redactor
+	}
+	disk.collect(true)
+	go disk.run()
+	go disk.runVerify()
+
 	// after all the repos are in good shape, we start their polling
 	for _, s := range searchers {
 		s.begin()
@@ -329,7 +701,7 @@ func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error)
 // Creates a new Searcher that is available for searches as soon as this returns.
 // This will pull or clone the target repo and start watching the repo for changes.
 func New(dbpath, name string, repo *config.Repo) (*Searcher, error) {
-	s, err := newSearcher(dbpath, name, repo, &foundRefs{}, makeLimiter(1))
+	s, err := newSearcher(dbpath, name, repo, &foundRefs{}, makeLimiter(1), nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -339,35 +711,57 @@ func New(dbpath, name string, repo *config.Repo) (*Searcher, error) {
 	return s, nil
 }
 
-// Update the vcs and reindex the given repo.
+// Update the vcs and reindex the given repo, returning the revision that is
+// indexed, whether it changed and the error of a failed update.
 func updateAndReindex(
 	s *Searcher,
 	dbpath,
 	vcsDir,
 	name,
 	rev string,
+	force bool,
 	wd *vcs.WorkDir,
 	opt *index.IndexOptions,
-	lim limiter) (string, bool) {
+	lim *limiter,
+	requested bool) (string, bool, error) {
 
 	// acquire a token from the rate limiter
-	lim.Acquire()
+	lim.Acquire(s.ticket(requested))
 	defer lim.Release()
 
+	s.setIndexing(true)
+	defer s.setIndexing(false)
+
+	defer lockClone(vcsDir)()
+
 	repo := s.Repo
-	newRev, err := wd.PullOrClone(vcsDir, repo.Url)
+	if force {
+		log.Printf("Discarding %s for a fresh clone", name)
+		if err := os.RemoveAll(vcsDir); err != nil {
+			log.Printf("failed to remove vcs dir (%s): %s", name, err)
+			s.fail(name, notify.EventIndexFailed, err)
+			return rev, false, err
+		}
+	}
+
+	newRev, err := wd.PullOrClone(vcsDir, repo.CloneUrl())
 
 	if err != nil {
 		log.Printf("vcs pull error (%s - %s): %s", name, repo.Url, err)
-		return rev, false
+		s.fail(name, notify.EventCloneFailed, err)
+		return rev, false, err
 	}
 
-	if newRev == rev {
-		return rev, false
+	if newRev == rev && !force {
+		s.succeed(name)
+		return rev, false, nil
 	}
 
 	log.Printf("Rebuilding %s for %s", name, newRev)
 	idx, err := buildAndOpenIndex(
+		s.store,
+		s.tables,
+		wd,
 		opt,
 		dbpath,
 		vcsDir,
@@ -376,18 +770,65 @@ func updateAndReindex(
 		newRev)
 	if err != nil {
 		log.Printf("failed index build (%s): %s", name, err)
-		return rev, false
+		s.fail(name, notify.EventIndexFailed, err)
+		return rev, false, err
 	}
 
+	// the files that changed are found before the old index is removed,
+	// and read from the new one, which stays until the next update.
+	s.lck.RLock()
+	changed := s.secrets.changedFiles(name, idx, s.idx.Ref)
+	s.lck.RUnlock()
+
+	// the new index is live even if the old one could not be removed.
 	if err := s.swapIndexes(idx); err != nil {
-		log.Printf("failed index swap (%s): %s", name, err)
-		if err := idx.Destroy(); err != nil {
-			log.Printf("failed to destroy index (%s): %s\n", name, err)
+		log.Printf("failed to destroy old index (%s): %s", name, err)
+	}
+
+	s.succeed(name)
+	s.notifier.Notify(&notify.Event{Type: notify.EventIndexed, Repo: name, Rev: newRev})
+	s.secrets.scan(name, newRev, idx, changed, s.notifier)
+	return newRev, true, nil
+}
+
+// Find an index left by a previous run for the revision already checked out
+// in vcsDir, or in the store when there is no checkout. This is only possible
+// for repos that receive updates, as the repo is not pulled before the index
+// is served.
+func warmStart(
+	wd *vcs.WorkDir,
+	vcsDir string,
+	repo *config.Repo,
+	refs *foundRefs,
+	optHash string) (string, *index.IndexRef) {
+	if !repo.PollUpdatesEnabled() && !repo.PushUpdatesEnabled() {
+		return "", nil
+	}
+
+	// without a checkout, the latest index in the store is served until the
+	// first update clones the repo.
+	if _, err := os.Stat(vcsDir); err != nil {
+		if refs.store == nil {
+			return "", nil
 		}
-		return rev, false
+
+		ref := refs.findLatest(repo.Url, optHash)
+		if ref == nil {
+			return "", nil
+		}
+		return ref.Rev, ref
+	}
+
+	rev, err := wd.HeadRev(vcsDir)
+	if err != nil {
+		return "", nil
 	}
 
-	return newRev, true
+	ref := refs.find(repo.Url, rev, optHash)
+	if ref == nil {
+		return "", nil
+	}
+	return rev, ref
 }
 
 // Creates a new Searcher that is capable of re-claiming an existing index directory
@@ -396,37 +837,81 @@ func newSearcher(
 	dbpath, name string,
 	repo *config.Repo,
 	refs *foundRefs,
-	lim limiter) (*Searcher, error) {
+	lim *limiter,
+	notifier *notify.Notifier,
+	progress *Progress) (*Searcher, error) {
 
 	vcsDir := filepath.Join(dbpath, vcsDirFor(repo))
 
 	log.Printf("Searcher started for %s", name)
 
-	wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+	vcsConfig := repo.VcsConfig()
+	wd, err := vcs.New(repo.Vcs, vcsConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	opt := &index.IndexOptions{
-		ExcludeDotFiles: repo.ExcludeDotFiles,
-		SpecialFiles:    wd.SpecialFiles(),
+		ExcludeDotFiles:      repo.ExcludeDotFiles,
+		ExcludeIgnoredFiles:  repo.ExcludeIgnored,
+		ExcludeVendoredFiles: repo.ExcludeVendored,
+		VendoredPaths:        repo.VendoredPaths,
+		IncludePaths:         repo.IncludePaths,
+		ExcludePaths:         repo.ExcludePaths,
+		MaxFileSize:          repo.MaxFileSize,
+		ExcludeMinifiedFiles: repo.ExcludeMinified,
+		SpecialFiles:         wd.SpecialFiles(),
+		Encodings:            repo.Encodings,
+		Subdir:               repo.Subdir,
 	}
 
-	rev, err := wd.PullOrClone(vcsDir, repo.Url)
-	if err != nil {
-		return nil, err
+	// the clone may be shared with other repos of the same url, which wait
+	// until this one is built from it.
+	defer lockClone(vcsDir)()
+
+	// When the checked out revision was indexed by a previous run with the
+	// same options, serve that index right away and leave the pull to the
+	// first update.
+	optHash := opt.Hash()
+	hasCheckout := exists(vcsDir)
+	rev, ref := warmStart(wd, vcsDir, repo, refs, optHash)
+	warm := ref != nil
+
+	// history and commits need a checkout, so they wait for the first pull.
+	catchUp := warm && !hasCheckout
+	var updated time.Time
+	if warm {
+		log.Printf("Reusing index of %s for %s", rev, name)
+	} else {
+		progress.set(name, StateUpdating)
+		rev, err = wd.PullOrClone(vcsDir, repo.CloneUrl())
+		if err != nil {
+			notifier.Notify(&notify.Event{Type: notify.EventCloneFailed, Repo: name, Error: err.Error()})
+			return nil, err
+		}
+		ref = refs.find(repo.Url, rev, optHash)
+		updated = time.Now()
+	}
+
+	if ref != nil {
+		if err := refs.claim(ref); err != nil {
+			log.Printf("failed to reuse index (%s): %s", name, err)
+			ref = nil
+		}
 	}
 
 	var idxDir string
-	ref := refs.find(repo.Url, rev)
 	if ref == nil {
 		idxDir = nextIndexDir(dbpath)
 	} else {
 		idxDir = ref.Dir()
-		refs.claim(ref)
 	}
 
+	progress.set(name, StateIndexing)
 	idx, err := buildAndOpenIndex(
+		refs.store,
+		refs.tables,
+		wd,
 		opt,
 		dbpath,
 		vcsDir,
@@ -434,15 +919,41 @@ func newSearcher(
 		repo.Url,
 		rev)
 	if err != nil {
+		notifier.Notify(&notify.Event{Type: notify.EventIndexFailed, Repo: name, Rev: rev, Error: err.Error()})
 		return nil, err
 	}
 
+	// a reused index isn't news, only those built now are notified.
+	if ref == nil {
+		notifier.Notify(&notify.Event{Type: notify.EventIndexed, Repo: name, Rev: rev})
+	}
+
+	// a reused index is only as recent as the pull it was built from.
+	if updated.IsZero() {
+		updated = idx.Ref.Time
+	}
+
 	s := &Searcher{
-		idx:        idx,
-		updateCh:   make(chan time.Time, 1),
-		Repo:       repo,
-		doneCh:     make(chan empty),
-		shutdownCh: make(chan empty, 1),
+		idx:         idx,
+		lastUpdated: updated,
+		history:     newHistory(),
+		updateCh:    make(chan time.Time, 1),
+		Repo:        repo,
+		store:       refs.store,
+		tables:      refs.tables,
+		doneCh:      make(chan empty),
+		shutdownCh:  make(chan empty, 1),
+		notifier:    notifier,
+	}
+
+	if !catchUp {
+		if err := s.updateHistory(dbpath, vcsDir, name, wd, opt, refs, false); err != nil {
+			log.Printf("history index error (%s): %s", name, err)
+		}
+
+		if err := s.updateCommits(vcsDir, wd); err != nil {
+			log.Printf("commit log error (%s): %s", name, err)
+		}
 	}
 
 	go func() {
@@ -456,27 +967,102 @@ func newSearcher(
 			return
 		}
 
-		var delay time.Duration
+		// a warm started repo that doesn't poll, or has no checkout, needs
+		// its first pull right away.
+		if warm && (!repo.PollUpdatesEnabled() || catchUp) {
+			s.requestUpdate()
+		}
+
+		var delay, maxDelay time.Duration
 		if repo.PollUpdatesEnabled() {
 			delay = time.Duration(repo.MsBetweenPolls) * time.Millisecond
+			maxDelay = time.Duration(repo.MaxMsBetweenPolls) * time.Millisecond
+		}
+		bo := newBackoff(delay, maxDelay, repo.BackoffAfterPolls)
+		s.setPollInterval(delay)
+
+		// repos polled on a schedule poll when it says, the rest first poll
+		// at a random point within their interval so that repos with the
+		// same interval don't all poll at once.
+		var sched *cron.Schedule
+		if repo.PollUpdatesEnabled() && repo.PollSchedule != "" {
+			sc, err := cron.Parse(repo.PollSchedule)
+			if err != nil {
+				log.Printf("poll-schedule error (%s): %s", name, err)
+			}
+			sched = sc
 		}
+		wait := jitter(delay)
+
+		// failed updates are retried sooner than the next poll, and less
+		// often the longer they keep failing.
+		retryDelay := time.Duration(repo.MsBetweenRetries) * time.Millisecond
+		maxRetryDelay := time.Duration(repo.MaxMsBetweenRetries) * time.Millisecond
+		var failed bool
 
 		for {
+			if sched != nil && !failed {
+				wait = untilNext(sched, time.Now())
+				s.setPollInterval(wait)
+			}
+
 			// Wait for a signal to proceed
-			s.waitForUpdate(delay)
+			requested := s.waitForUpdate(wait)
 
 			if s.shutdownRequested {
 				s.completeShutdown()
 				return
 			}
 
+			jobs := s.takeJobs()
+			if s.isPaused() || s.isArchived() {
+				finishJobs(jobs, "", errNotPulled)
+				continue
+			}
+
+			// the vcs-config changes when refreshed secrets were rotated.
+			if b := repo.VcsConfig(); !bytes.Equal(b, vcsConfig) {
+				nwd, err := vcs.New(repo.Vcs, b)
+				if err != nil {
+					log.Printf("vcs config error (%s): %s", name, err)
+				} else {
+					wd, vcsConfig = nwd, b
+				}
+			}
+
 			// attempt to update and reindex this searcher
-			newRev, ok := updateAndReindex(s, dbpath, vcsDir, name, rev, wd, opt, lim)
-			if !ok {
+			force := s.takeReindex()
+			newRev, ok, err := updateAndReindex(s, dbpath, vcsDir, name, rev, force, wd, opt, lim, requested)
+			finishJobs(jobs, newRev, err)
+			failed = err != nil && retryDelay > 0
+			if failed {
+				wait = retryAfter(retryDelay, maxRetryDelay, s.failureCount())
+				log.Printf("Retrying %s in %s", name, wait)
+			} else {
+				delay = bo.next(ok, requested)
+				wait = delay
+			}
+			s.setPollInterval(wait)
+			if !ok && !(catchUp && exists(vcsDir)) {
 				continue
 			}
 
 			rev = newRev
+			catchUp = false
+
+			lim.Acquire(s.ticket(requested))
+			s.setIndexing(true)
+			unlock := lockClone(vcsDir)
+			if err := s.updateHistory(dbpath, vcsDir, name, wd, opt, &foundRefs{}, force); err != nil {
+				log.Printf("history index error (%s): %s", name, err)
+			}
+
+			if err := s.updateCommits(vcsDir, wd); err != nil {
+				log.Printf("commit log error (%s): %s", name, err)
+			}
+			unlock()
+			s.setIndexing(false)
+			lim.Release()
 
 			// This is just a good time to GC since we know there will be a
 			// whole set of dead posting lists on the heap. Ensuring these
@@ -498,14 +1084,16 @@ func newSearcherConcurrent(
 	dbpath, name string,
 	repo *config.Repo,
 	refs *foundRefs,
-	lim limiter,
+	lim *limiter,
+	notifier *notify.Notifier,
+	progress *Progress,
 	resultCh chan searcherResult) {
 
 	// acquire a token from the rate limiter
-	lim.Acquire()
+	lim.Acquire(ticket{priority: repo.Priority})
 	defer lim.Release()
 
-	s, err := newSearcher(dbpath, name, repo, refs, lim)
+	s, err := newSearcher(dbpath, name, repo, refs, lim, notifier, progress)
 	if err != nil {
 		resultCh <- searcherResult{
 			name: name,
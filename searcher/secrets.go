@@ -0,0 +1,104 @@
+package searcher
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/notify"
+	"github.com/hound-search/hound/redact"
+)
+
+// Scans the files that changed in each new index of a repo for secrets and
+// raises a secret-found notification for each file and kind of secret. The
+// first index of a repo is the baseline rather than scanned, so turning
+// scanning on doesn't raise an alert for every secret already committed.
+type secretScanner struct {
+	rules     *redact.Redactor
+	maxAlerts int
+}
+
+// A scanner with the rules of the config, nil when scanning is off.
+func newSecretScanner(cfg *config.SecretScanningConfig) (*secretScanner, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	rules, err := redact.NewRules(cfg.Rules())
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretScanner{
+		rules:     rules,
+		maxAlerts: cfg.MaxAlerts,
+	}, nil
+}
+
+// A kind of secret found in a file, first on the line.
+type secret struct {
+	rule string
+	line int
+}
+
+// The kinds of secrets found in a file, in the order they are first found.
+func (sc *secretScanner) scanFile(src []byte) []*secret {
+	var res []*secret
+	seen := map[string]bool{}
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		for _, rule := range sc.rules.Match(line) {
+			if !seen[rule] {
+				seen[rule] = true
+				res = append(res, &secret{rule, i + 1})
+			}
+		}
+	}
+	return res
+}
+
+// The files of idx that changed since the index of prev, which was built
+// for the previous revision of the repo. Nil when scanning is off.
+func (sc *secretScanner) changedFiles(name string, idx *index.Index, prev *index.IndexRef) []string {
+	if sc == nil {
+		return nil
+	}
+
+	changed, err := idx.Ref.ChangedFiles(prev)
+	if err != nil {
+		log.Printf("secret scanning (%s): %s", name, err)
+	}
+	return changed
+}
+
+// Scan the files of idx that changed and notify the secrets that are
+// found. Only the kind of secret and where it is are notified, never the
+// secret.
+func (sc *secretScanner) scan(name, rev string, idx *index.Index, changed []string, n *notify.Notifier) {
+	var alerts int
+	for _, path := range changed {
+		src, err := idx.ReadFile(path)
+		if err != nil {
+			log.Printf("secret scanning (%s): %s", name, err)
+			continue
+		}
+
+		for _, s := range sc.scanFile(src) {
+			if alerts == sc.maxAlerts {
+				log.Printf("secret scanning (%s): stopped at %d alerts for %s", name, alerts, rev)
+				return
+			}
+			alerts++
+
+			log.Printf("Found a possible %s in %s at %s:%d", s.rule, name, path, s.line)
+			n.Notify(&notify.Event{
+				Type: notify.EventSecretFound,
+				Repo: name,
+				Rev:  rev,
+				Path: path,
+				Line: s.line,
+				Rule: s.rule,
+			})
+		}
+	}
+}
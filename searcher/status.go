@@ -0,0 +1,177 @@
+package searcher
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/hound-search/hound/notify"
+)
+
+// The state of the index of a repo as reported to operators.
+type Status struct {
+	// The revision that is currently searchable.
+	Rev string
+
+	// When the searchable index was built.
+	LastIndexed time.Time
+
+	// When the repo was last pulled, or found to be up to date, without
+	// error.
+	LastUpdated time.Time
+
+	// The size, in bytes, of the index on disk.
+	IndexSize int64
+
+	// The size, in bytes, of the clone and of the history indexes of the
+	// repo when the dbpath was last measured.
+	CloneSize   int64 `json:",omitempty"`
+	HistorySize int64 `json:",omitempty"`
+
+	// The number of files in the index.
+	Files int
+
+	// The time between polls of the repo, which is longer than its
+	// ms-between-poll while it backs off.
+	PollIntervalMs int64 `json:",omitempty"`
+
+	// Whether the repo is being pulled or reindexed right now.
+	Indexing bool
+
+	// Whether updates of the repo are paused.
+	Paused bool
+
+	// Whether the repo was archived or deleted upstream, which stops its
+	// updates, and whether the index of a deleted repo was removed.
+	Archived bool `json:",omitempty"`
+	Deleted  bool `json:",omitempty"`
+	Removed  bool `json:",omitempty"`
+
+	// The number of updates in a row that failed, and whether there were
+	// at least max-failures of them.
+	Failures  int  `json:",omitempty"`
+	Unhealthy bool `json:",omitempty"`
+
+	// The error of the most recent failed update, which is cleared by the
+	// next successful one.
+	LastError   string     `json:",omitempty"`
+	LastErrorAt *time.Time `json:",omitempty"`
+}
+
+// Report the state of the index for the repo.
+func (s *Searcher) Status() *Status {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	st := &Status{
+		Rev:            s.idx.Ref.Rev,
+		LastIndexed:    s.idx.Ref.Time,
+		LastUpdated:    s.lastUpdated,
+		PollIntervalMs: int64(s.pollDelay / time.Millisecond),
+		Paused:         s.paused,
+		Archived:       s.archived,
+		Deleted:        s.deleted,
+		Removed:        s.removed,
+		Failures:       s.failures,
+		Unhealthy:      s.unhealthy(),
+		CloneSize:      s.cloneSize,
+		HistorySize:    s.historySize,
+		Files:          s.idx.NumFiles(),
+		Indexing:       s.indexing,
+	}
+
+	if size, err := s.idx.Size(); err == nil {
+		st.IndexSize = size
+	}
+
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+		at := s.lastErrAt
+		st.LastErrorAt = &at
+	}
+
+	return st
+}
+
+func (s *Searcher) setPollInterval(d time.Duration) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.pollDelay = d
+}
+
+// Record the space the clone and the history indexes of the repo take, from
+// the sizes of the entries of the dbpath.
+func (s *Searcher) setDiskUsage(sizes map[string]int64) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	s.cloneSize = sizes[vcsDirFor(s.Repo)]
+	s.historySize = 0
+	for _, idx := range s.history.byCommit {
+		s.historySize += sizes[filepath.Base(idx.GetDir())]
+	}
+}
+
+func (s *Searcher) setIndexing(indexing bool) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.indexing = indexing
+}
+
+// Record the outcome of an update, a nil error clears the last error.
+func (s *Searcher) setLastError(err error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.lastErr = err
+	s.lastErrAt = time.Now()
+	if err == nil {
+		s.lastUpdated = s.lastErrAt
+	}
+}
+
+// Record a failed update, notifying the webhooks unless the previous update
+// failed the same way, so a broken repo isn't notified on every poll. The
+// webhooks are also told when the repo becomes unhealthy.
+func (s *Searcher) fail(name, event string, err error) {
+	s.lck.Lock()
+	repeated := s.lastErr != nil && s.lastErr.Error() == err.Error()
+	s.failures++
+	unhealthy := s.failures == s.Repo.MaxFailures
+	s.lck.Unlock()
+
+	s.setLastError(err)
+	if !repeated {
+		s.notifier.Notify(&notify.Event{Type: event, Repo: name, Error: err.Error()})
+	}
+
+	if unhealthy {
+		log.Printf("%s has failed to update %d times in a row", name, s.Repo.MaxFailures)
+		s.notifier.Notify(&notify.Event{Type: notify.EventUnhealthy, Repo: name, Error: err.Error()})
+	}
+}
+
+// Record a successful update, telling the webhooks when the repo was
+// unhealthy.
+func (s *Searcher) succeed(name string) {
+	s.lck.Lock()
+	recovered := s.unhealthy()
+	s.failures = 0
+	s.lck.Unlock()
+
+	s.setLastError(nil)
+	if recovered {
+		s.notifier.Notify(&notify.Event{Type: notify.EventRecovered, Repo: name})
+	}
+}
+
+// Whether the repo has failed to update at least max-failures times in a
+// row. The caller must hold the lock.
+func (s *Searcher) unhealthy() bool {
+	return s.Repo.MaxFailures > 0 && s.failures >= s.Repo.MaxFailures
+}
+
+func (s *Searcher) failureCount() int {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.failures
+}
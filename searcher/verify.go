@@ -0,0 +1,110 @@
+package searcher
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/notify"
+)
+
+const defaultVerifyInterval = 24 * time.Hour
+
+// Returned by searches of a repo whose index was found to be corrupt, until
+// it is rebuilt.
+var ErrCorrupt = errors.New("the index is corrupt and is being rebuilt")
+
+// Verify the indexes of the searcher. A corrupt head index is no longer
+// searched and corrupt history indexes are dropped, then the repo is
+// reindexed from a fresh clone. Searchers that are updating are left for
+// the next time, as their indexes are about to change.
+func (s *Searcher) verify(name string) {
+	s.lck.RLock()
+	if s.indexing || s.removed {
+		s.lck.RUnlock()
+		return
+	}
+
+	head := s.idx
+	old := s.history
+	s.lck.RUnlock()
+
+	headErr := head.Ref.Verify()
+	if headErr != nil {
+		log.Printf("corrupt index (%s): %s", name, headErr)
+	}
+
+	corrupt := headErr
+
+	bad := map[string]bool{}
+	for commit, idx := range old.byCommit {
+		if err := idx.Ref.Verify(); err != nil {
+			log.Printf("corrupt history index (%s - %s): %s", name, commit, err)
+			bad[commit] = true
+			if corrupt == nil {
+				corrupt = err
+			}
+		}
+	}
+
+	if corrupt == nil {
+		return
+	}
+
+	// the indexes may have been replaced while they were verified.
+	s.lck.Lock()
+	if s.indexing || s.idx != head || s.history != old {
+		s.lck.Unlock()
+		return
+	}
+
+	if headErr != nil {
+		s.corrupt = headErr
+	}
+
+	h := newHistory()
+	var dropped []*index.Index
+	for commit, idx := range old.byCommit {
+		if bad[commit] {
+			dropped = append(dropped, idx)
+		} else {
+			h.byCommit[commit] = idx
+		}
+	}
+
+	for rev, commit := range old.names {
+		if !bad[commit] {
+			h.names[rev] = commit
+		}
+	}
+	s.history = h
+	s.lck.Unlock()
+
+	for _, idx := range dropped {
+		if err := s.destroyIndex(idx); err != nil {
+			log.Printf("failed to destroy history index (%s): %s", name, err)
+		}
+	}
+
+	s.fail(name, notify.EventIndexFailed, corrupt)
+	if !s.Reindex() {
+		log.Printf("%s can't be reindexed as its updates are turned off", name)
+	}
+}
+
+// Verify the indexes of every searcher every interval, for as long as the
+// server runs.
+func (d *disk) runVerify() {
+	for {
+		time.Sleep(d.verifyInterval)
+
+		d.lck.RLock()
+		searchers := d.searchers
+		d.lck.RUnlock()
+
+		for name, s := range searchers {
+			s.verify(name)
+		}
+	}
+}
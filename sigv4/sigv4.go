@@ -0,0 +1,173 @@
+// Package sigv4 signs requests to AWS, and services compatible with it,
+// using AWS Signature Version 4.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The payload hash used for requests whose body is not part of the
+// signature. Only S3 accepts it.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Credentials for signing requests. Empty fields default to the standard
+// AWS environment variables.
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Return the value of the option or, if it is empty, the first
+// environment variable that is set.
+func OptionOrEnv(val string, envs ...string) string {
+	if val != "" {
+		return val
+	}
+	for _, env := range envs {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// The region from the option or the environment.
+func Region(val string) string {
+	return OptionOrEnv(val, "AWS_REGION", "AWS_DEFAULT_REGION")
+}
+
+func (c *Credentials) resolve() *Credentials {
+	return &Credentials{
+		AccessKeyId:     OptionOrEnv(c.AccessKeyId, "AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: OptionOrEnv(c.SecretAccessKey, "AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    OptionOrEnv(c.SessionToken, "AWS_SESSION_TOKEN"),
+	}
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data)) //nolint
+	return h.Sum(nil)
+}
+
+// The hex encoded SHA-256 of a request body.
+func HashPayload(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// Sign the request for the service in the region. The payloadHash is
+// either the HashPayload of the body or UnsignedPayload.
+func Sign(req *http.Request, payloadHash, region, service string, creds *Credentials, now time.Time) {
+	c := creds.resolve()
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(req.Header.Get(key))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		HashPayload([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyId,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// The query of the request with its parameters sorted and encoded as
+// required by the signature.
+func canonicalQuery(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return ""
+	}
+
+	q := req.URL.Query()
+	keys := make([]string, 0, len(q))
+	for key := range q {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := q[key]
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, escape(key)+"="+escape(val))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Percent encode everything but the unreserved characters of RFC 3986.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
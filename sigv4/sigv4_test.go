@@ -0,0 +1,42 @@
+package sigv4
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The example request from the AWS Signature Version 4 documentation.
+func TestSign(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Version=2010-05-08&Action=ListUsers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	Sign(req,
+		HashPayload(nil),
+		"us-east-1",
+		"iam",
+		&Credentials{
+			AccessKeyId:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		},
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, ") {
+		t.Fatalf("unexpected authorization: %s", auth)
+	}
+
+	if !strings.HasSuffix(auth, "Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7") {
+		t.Fatalf("unexpected signature: %s", auth)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := escape("a b/c~d"); got != "a%20b%2Fc~d" {
+		t.Fatalf("unexpected escape: %s", got)
+	}
+}
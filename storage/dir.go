@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	Register(newDir, "dir")
+}
+
+// A Store in a directory, typically a mount of a network filesystem that
+// is shared between replicas.
+type DirStore struct {
+	Path string `json:"path"`
+}
+
+func newDir(b []byte) (Store, error) {
+	var d DirStore
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+
+	if d.Path == "" {
+		return nil, errors.New("storage: dir requires a path")
+	}
+
+	return &d, nil
+}
+
+func (d *DirStore) filename(key string) string {
+	return filepath.Join(d.Path, filepath.FromSlash(key))
+}
+
+func (d *DirStore) Get(key string, w io.Writer) error {
+	r, err := os.Open(d.filename(key))
+	if os.IsNotExist(err) {
+		return ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Objects are written to a temporary file and renamed into place so that
+// readers never see a partial object.
+func (d *DirStore) Put(key string, r io.Reader, size int64) error {
+	name := d.filename(key)
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (d *DirStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.Walk(d.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.Path, p)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// The directory holding the object is removed once it is empty.
+func (d *DirStore) Delete(key string) error {
+	name := d.filename(key)
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if dir := filepath.Dir(name); dir != filepath.Clean(d.Path) {
+		os.Remove(dir) //nolint
+	}
+	return nil
+}
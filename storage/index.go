@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+// Each index is stored as two objects beneath its name, the manifest on
+// its own so that indexes can be matched to repos without fetching them
+// and an archive of the whole index directory.
+const archiveName = "index.tar.gz"
+
+func manifestKey(name string) string {
+	return path.Join(name, index.ManifestFilename)
+}
+
+func archiveKey(name string) string {
+	return path.Join(name, archiveName)
+}
+
+// Return the names of the indexes in the store.
+func ListIndexes(s Store) ([]string, error) {
+	keys, err := s.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, key := range keys {
+		name, file := path.Split(key)
+		if file == index.ManifestFilename && name != "" {
+			names = append(names, strings.TrimSuffix(name, "/"))
+		}
+	}
+	return names, nil
+}
+
+// Store the index directory dir under its base name. The archive is stored
+// before the manifest so a listed index is always complete.
+func PutIndex(s Store, dir string) error {
+	name := filepath.Base(dir)
+
+	tmp, err := ioutil.TempFile("", "hound-index-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeArchive(tmp, dir); err != nil {
+		return err
+	}
+
+	if err := putFile(s, archiveKey(name), tmp); err != nil {
+		return err
+	}
+
+	m, err := os.Open(filepath.Join(dir, index.ManifestFilename))
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	return putFile(s, manifestKey(name), m)
+}
+
+func putFile(s Store, key string, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return s.Put(key, f, fi.Size())
+}
+
+// Fetch only the manifest of the named index into the directory dir.
+func GetManifest(s Store, name, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	w, err := os.Create(filepath.Join(dir, index.ManifestFilename))
+	if err != nil {
+		return err
+	}
+
+	if err := s.Get(manifestKey(name), w); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Fetch the named index into the directory dir.
+func GetIndex(s Store, name, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(s.Get(archiveKey(name), w))
+	}()
+	defer r.Close()
+
+	return readArchive(r, dir)
+}
+
+// Remove the named index from the store.
+func DeleteIndex(s Store, name string) error {
+	if err := s.Delete(manifestKey(name)); err != nil {
+		return err
+	}
+	return s.Delete(archiveKey(name))
+}
+
+// Write a gzipped tar of the regular files beneath dir.
+func writeArchive(w io.Writer, dir string) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		r, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Extract an archive written by writeArchive into dst. No entry may
+// escape dst.
+func readArchive(r io.Reader, dst string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(name, dst+string(filepath.Separator)) {
+			return fmt.Errorf("storage: archive entry %s is outside of the destination", hdr.Name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
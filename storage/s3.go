@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/sigv4"
+)
+
+const (
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+	s3RequestTimeout   = 10 * time.Minute
+)
+
+func init() {
+	Register(newS3, "s3")
+	Register(newGCS, "gcs")
+}
+
+// A Store in an S3 bucket or in any service with an S3 compatible API.
+// Credentials default to the standard AWS environment variables. Without
+// an endpoint the bucket is addressed as a virtual host of AWS S3,
+// otherwise it is addressed by path beneath the endpoint.
+type S3Store struct {
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyId     string `json:"access-key-id"`
+	SecretAccessKey string `json:"secret-access-key"`
+	SessionToken    string `json:"session-token"`
+
+	client *http.Client
+}
+
+func newS3(b []byte) (Store, error) {
+	s := &S3Store{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+
+	if s.Bucket == "" {
+		return nil, errors.New("storage: s3 requires a bucket")
+	}
+
+	s.Region = sigv4.Region(s.Region)
+	if s.Region == "" {
+		return nil, errors.New("storage: s3 region is not set")
+	}
+
+	s.client = &http.Client{Timeout: s3RequestTimeout}
+	return s, nil
+}
+
+// Google Cloud Storage through its S3 compatible API, which requires HMAC
+// keys for a service account as the access key id and secret.
+func newGCS(b []byte) (Store, error) {
+	var opts map[string]interface{}
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return nil, err
+	}
+
+	if _, ok := opts["endpoint"]; !ok {
+		opts["endpoint"] = defaultGCSEndpoint
+	}
+
+	if _, ok := opts["region"]; !ok {
+		opts["region"] = "auto"
+	}
+
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newS3(b)
+}
+
+// The URL of the bucket, without a trailing slash.
+func (s *S3Store) bucketURL() string {
+	if s.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.Bucket, s.Region)
+	}
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + url.PathEscape(s.Bucket)
+}
+
+// The URL of the object stored under the key.
+func (s *S3Store) urlFor(key string) string {
+	var segs []string
+	for _, seg := range strings.Split(s.Prefix+key, "/") {
+		segs = append(segs, url.PathEscape(seg))
+	}
+	return s.bucketURL() + "/" + strings.Join(segs, "/")
+}
+
+func (s *S3Store) do(method, u string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	sigv4.Sign(req,
+		sigv4.UnsignedPayload,
+		s.Region,
+		"s3",
+		&sigv4.Credentials{
+			AccessKeyId:     s.AccessKeyId,
+			SecretAccessKey: s.SecretAccessKey,
+			SessionToken:    s.SessionToken,
+		},
+		time.Now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNotFound && (method == "GET" || method == "DELETE") {
+			return nil, ErrNotExist
+		}
+
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("storage: s3 %s %s: %s: %s", method, u, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return res, nil
+}
+
+func (s *S3Store) Get(key string, w io.Writer) error {
+	res, err := s.do("GET", s.urlFor(key), nil, 0)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+func (s *S3Store) Put(key string, r io.Reader, size int64) error {
+	res, err := s.do("PUT", s.urlFor(key), r, size)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// S3 answers the delete of a missing key with a 204, but GCS answers it with
+// a 404, which is no more an error.
+func (s *S3Store) Delete(key string) error {
+	res, err := s.do("DELETE", s.urlFor(key), nil, 0)
+	if err == ErrNotExist {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key string
+	}
+}
+
+func (s *S3Store) List(prefix string) ([]string, error) {
+	var keys []string
+	var token string
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", s.Prefix+prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		u := s.bucketURL()
+		if s.Endpoint == "" {
+			u += "/"
+		}
+
+		res, err := s.do("GET", u+"?"+q.Encode(), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var l listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&l)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range l.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, s.Prefix))
+		}
+
+		if !l.IsTruncated || l.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = l.NextContinuationToken
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// An in memory server for the parts of the S3 API used by S3Store. Lists
+// are paged one key at a time to exercise continuation. Like GCS, it can
+// answer deletes of missing keys with a 404.
+type fakeS3 struct {
+	bucket  string
+	objects map[string][]byte
+	lck     sync.Mutex
+
+	missingDeleteNotFound bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lck.Lock()
+	defer f.lck.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/"+f.bucket && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+	switch r.Method {
+	case "GET":
+		b, ok := f.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b) //nolint
+	case "PUT":
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = b
+	case "DELETE":
+		if _, ok := f.objects[key]; !ok && f.missingDeleteNotFound {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var res listBucketResult
+	if len(keys) > 0 {
+		res.Contents = append(res.Contents, struct{ Key string }{keys[0]})
+	}
+
+	if len(keys) > 1 {
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[0]
+	}
+
+	xml.NewEncoder(w).Encode(&res) //nolint
+}
+
+func TestS3Store(t *testing.T) {
+	f := &fakeS3{bucket: "indexes", objects: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	s, err := New([]byte(`{
+		"type": "s3",
+		"bucket": "indexes",
+		"prefix": "hound/",
+		"region": "us-east-1",
+		"endpoint": "` + srv.URL + `",
+		"access-key-id": "key",
+		"secret-access-key": "secret"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testIndexRoundTrip(t, s)
+
+	f.objects["elsewhere/idx-1/metadata.gob"] = []byte("not ours")
+	names, err := ListIndexes(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 0 {
+		t.Fatalf("expected objects outside the prefix to be ignored, got %v", names)
+	}
+
+	f.missingDeleteNotFound = true
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("expected deleting a missing object to succeed, got %s", err)
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	s := &S3Store{Bucket: "b", Region: "eu-west-1", Prefix: "p/"}
+	if u := s.urlFor("idx-1/index.tar.gz"); u != "https://b.s3.eu-west-1.amazonaws.com/p/idx-1/index.tar.gz" {
+		t.Fatalf("unexpected url: %s", u)
+	}
+
+	s.Endpoint = "https://storage.googleapis.com/"
+	if u := s.urlFor("a b"); u != "https://storage.googleapis.com/b/p/a%20b" {
+		t.Fatalf("unexpected url: %s", u)
+	}
+}
@@ -0,0 +1,68 @@
+// Package storage keeps copies of index directories outside of the dbpath
+// so that a houndd without a persistent disk, or a replica of another one,
+// can start from indexes that were already built.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Returned by Get when there is no object stored under the key.
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// A flat store of objects addressed by slash separated keys.
+type Store interface {
+	// Write the object stored under key to w.
+	Get(key string, w io.Writer) error
+
+	// Store the size bytes read from r under key, replacing any existing
+	// object.
+	Put(key string, r io.Reader, size int64) error
+
+	// Return the keys of all objects that begin with prefix.
+	List(prefix string) ([]string, error)
+
+	// Remove the object stored under key. Removing an object that does
+	// not exist is not an error.
+	Delete(key string) error
+}
+
+var drivers = map[string]func(c []byte) (Store, error){}
+
+// Register a new store under 1 or more names.
+func Register(fn func(c []byte) (Store, error), names ...string) {
+	if fn == nil {
+		log.Panic("storage: cannot register nil factory")
+	}
+
+	for _, name := range names {
+		drivers[name] = fn
+	}
+}
+
+// Create the Store declared by the JSON config, which names the store in
+// its type field. A nil config means that indexes are only kept in the
+// dbpath and no Store is returned.
+func New(c []byte) (Store, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	var t struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(c, &t); err != nil {
+		return nil, err
+	}
+
+	f, ok := drivers[t.Type]
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown type: %q", t.Type)
+	}
+
+	return f(c)
+}
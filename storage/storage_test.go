@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hound-search/hound/index"
+)
+
+// Make an index directory with a manifest and some data.
+func makeIndexDir(t *testing.T, root, name string) string {
+	dir := filepath.Join(root, name)
+	files := map[string]string{
+		index.ManifestFilename: "manifest",
+		"tri":                  "trigrams",
+		"raw/a/b.go":           "package b",
+	}
+
+	for file, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Store an index, fetch it back and remove it.
+func testIndexRoundTrip(t *testing.T, s Store) {
+	tmp, err := ioutil.TempDir("", "hound-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := makeIndexDir(t, tmp, "idx-1234")
+	if err := PutIndex(s, src); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := ListIndexes(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 1 || names[0] != "idx-1234" {
+		t.Fatalf("expected [idx-1234], got %v", names)
+	}
+
+	dst := filepath.Join(tmp, "fetched", "idx-1234")
+	if err := GetManifest(s, "idx-1234", dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dst, index.ManifestFilename)); got != "manifest" {
+		t.Fatalf("unexpected manifest: %q", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "tri")); err == nil {
+		t.Fatal("expected only the manifest to be fetched")
+	}
+
+	if err := GetIndex(s, "idx-1234", dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dst, "raw", "a", "b.go")); got != "package b" {
+		t.Fatalf("unexpected file contents: %q", got)
+	}
+
+	if err := DeleteIndex(s, "idx-1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = ListIndexes(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 0 {
+		t.Fatalf("expected no indexes, got %v", names)
+	}
+
+	if err := GetIndex(s, "idx-1234", filepath.Join(tmp, "missing")); err == nil {
+		t.Fatal("expected an error for a missing index")
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "hound-dir-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	s, err := New([]byte(`{"type": "dir", "path": "` + root + `"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testIndexRoundTrip(t, s)
+}
+
+func TestNew(t *testing.T) {
+	if s, err := New(nil); s != nil || err != nil {
+		t.Fatalf("expected no store, got %v, %v", s, err)
+	}
+
+	if _, err := New([]byte(`{"type": "floppy"}`)); err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+
+	if _, err := New([]byte(`{"type": "dir"}`)); err == nil {
+		t.Fatal("expected an error for a dir store without a path")
+	}
+}
@@ -0,0 +1,13 @@
+// Package strs has the helpers for lists of strings that several packages
+// share.
+package strs
+
+// Whether the list has the value.
+func Contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
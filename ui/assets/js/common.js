@@ -9,6 +9,12 @@ export function ExpandVars(template, values) {
     return template;
 };
 
+// Abbreviate a commit hash to seven digits, as git does. Branches and tags
+// are left as they are.
+export function ShortRev(rev) {
+    return /^([0-9a-f]{40}|[0-9a-f]{64})$/.test(rev || '') ? rev.substring(0, 7) : rev;
+}
+
 export function UrlParts(repo, path, line, rev) {
     var url = repo.url.replace(/\.git$/, ''),
         pattern = repo['url-pattern'],
@@ -18,7 +24,8 @@ export function UrlParts(repo, path, line, rev) {
         path = path || '',
         port = '',
         filename = path.substring(path.lastIndexOf('/') + 1),
-        anchor = line ? ExpandVars(pattern.anchor, { line : line, filename : filename }) : '';
+        dirname = path.substring(0, Math.max(path.lastIndexOf('/'), 0)),
+        anchor = line ? ExpandVars(pattern.anchor, { line : line, path : path, dirname : dirname, filename : filename }) : '';
 
     // Determine if the URL passed is a GitHub wiki
     var wikiUrl = /\.wiki$/.exec(url);
@@ -56,7 +63,10 @@ export function UrlParts(repo, path, line, rev) {
         project: project,
         'repo': repoName,
         path: path,
+        dirname: dirname,
+        filename: filename,
         rev: rev,
+        'rev-short': ShortRev(rev),
         anchor: anchor
     };
 }
@@ -163,6 +163,29 @@ describe("UrlParts", () => {
     });
 })
 
+describe("UrlParts placeholders", () => {
+    test("Generate the dirname, filename and short revision", () => {
+        const repo = {
+            url: "https://www.github.com/YourOrganization/RepoOne.git",
+            "url-pattern":
+            {
+                anchor: "#{filename}-L{line}"
+            }
+        };
+        const rev = "0123456789abcdef0123456789abcdef01234567"
+        expect(UrlParts(repo, "dir/sub/test.txt", 3, rev)).toEqual(expect.objectContaining({
+            dirname: "dir/sub",
+            filename: "test.txt",
+            "rev-short": "0123456",
+            anchor: "#test.txt-L3",
+        }));
+        expect(UrlParts(repo, "test.txt", null, "main")).toEqual(expect.objectContaining({
+            dirname: "",
+            "rev-short": "main",
+        }));
+    });
+});
+
 describe("UrlToRepo", () => {
     test("Generate url from repo with default values", () => {
         const repo = {
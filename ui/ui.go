@@ -28,6 +28,9 @@ type devHandler struct {
 
 	// the config we are running on
 	cfg *config.Config
+
+	// narrows the repos to those the request may see
+	visible RepoFilter
 }
 
 // An http.Handler for the prd-mode case.
@@ -35,11 +38,28 @@ type prdHandler struct {
 	// The collection of templated assets w/ their templates pre-parsed
 	content map[string]*content
 
-	// The config object as a json string
-	cfgJson string
-
 	// the config we are running on
 	cfg *config.Config
+
+	// narrows the repos to those the request may see
+	visible RepoFilter
+}
+
+// A RepoFilter narrows the repos to those a request may see.
+type RepoFilter func(r *http.Request, repos []string) []string
+
+// The repos the request may see as a json string. Every repo is seen when
+// there is no filter.
+func reposAsJson(cfg *config.Config, visible RepoFilter, r *http.Request) (string, error) {
+	names := make([]string, 0, len(cfg.Repos))
+	for name := range cfg.Repos {
+		names = append(names, name)
+	}
+
+	if visible != nil {
+		names = visible(r, names)
+	}
+	return cfg.ReposJsonString(names)
 }
 
 func (h *devHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -55,14 +75,14 @@ func (h *devHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// If so, render the HTML
 	w.Header().Set("Content-Type", "text/html;charset=utf-8")
-	if err := renderForDev(w, h.root, cr, h.cfg, r); err != nil {
+	if err := renderForDev(w, h.root, cr, h.cfg, h.visible, r); err != nil {
 		log.Panic(err)
 	}
 }
 
 // Renders a templated asset in dev-mode. This simply embeds external script tags
 // for the source elements.
-func renderForDev(w io.Writer, root string, c *content, cfg *config.Config, r *http.Request) error {
+func renderForDev(w io.Writer, root string, c *content, cfg *config.Config, visible RepoFilter, r *http.Request) error {
 	var err error
 	// For more context, see: https://github.com/etsy/hound/issues/239
 	switch c.tplType {
@@ -84,7 +104,7 @@ func renderForDev(w io.Writer, root string, c *content, cfg *config.Config, r *h
 		return errors.New("invalid tplType for content")
 	}
 
-	json, err := cfg.ToJsonString()
+	json, err := reposAsJson(cfg, visible, r)
 	if err != nil {
 		return err
 	}
@@ -129,7 +149,7 @@ func (h *prdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ct := h.content[p]
 	if ct != nil {
 		// if so, render it
-		if err := renderForPrd(w, ct, h.cfg, h.cfgJson, r); err != nil {
+		if err := renderForPrd(w, ct, h.cfg, h.visible, r); err != nil {
 			log.Panic(err)
 		}
 		return
@@ -143,7 +163,12 @@ func (h *prdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // Renders a templated asset in prd-mode. This strategy will embed
 // the sources directly in a script tag on the templated page.
-func renderForPrd(w io.Writer, c *content, cfg *config.Config, cfgJson string, r *http.Request) error {
+func renderForPrd(w io.Writer, c *content, cfg *config.Config, visible RepoFilter, r *http.Request) error {
+	json, err := reposAsJson(cfg, visible, r)
+	if err != nil {
+		return err
+	}
+
 	var buf bytes.Buffer
 	buf.WriteString("<script>")
 	for _, src := range c.sources {
@@ -158,7 +183,7 @@ func renderForPrd(w io.Writer, c *content, cfg *config.Config, cfgJson string, r
 	return c.tpl.Execute(w, map[string]interface{}{
 		"ReactVersion":  ReactVersion,
 		"jQueryVersion": JQueryVersion,
-		"ReposAsJson":   cfgJson,
+		"ReposAsJson":   json,
 		"Title":         cfg.Title,
 		"Source":        html_template.HTML(buf.String()),
 		"Host":          r.Host,
@@ -178,18 +203,19 @@ func assetDir() string {
 }
 
 // Create an http.Handler for dev-mode.
-func newDevHandler(cfg *config.Config) (http.Handler, error) {
+func newDevHandler(cfg *config.Config, visible RepoFilter) (http.Handler, error) {
 	root := assetDir()
 	return &devHandler{
 		Handler: http.FileServer(http.Dir(root)),
 		content: contents,
 		root:    root,
 		cfg:     cfg,
+		visible: visible,
 	}, nil
 }
 
 // Create an http.Handler for prd-mode.
-func newPrdHandler(cfg *config.Config) (http.Handler, error) {
+func newPrdHandler(cfg *config.Config, visible RepoFilter) (http.Handler, error) {
 	for _, cnt := range contents {
 		a, err := Asset(cnt.template)
 		if err != nil {
@@ -217,15 +243,10 @@ func newPrdHandler(cfg *config.Config) (http.Handler, error) {
 		}
 	}
 
-	json, err := cfg.ToJsonString()
-	if err != nil {
-		return nil, err
-	}
-
 	return &prdHandler{
 		content: contents,
 		cfg:     cfg,
-		cfgJson: json,
+		visible: visible,
 	}, nil
 }
 
@@ -233,11 +254,12 @@ func newPrdHandler(cfg *config.Config) (http.Handler, error) {
 // the http.Handler that is returned will serve assets directly our of
 // the source directories making rapid web development possible. If dev
 // is false, the http.Handler will serve assets out of data embedded
-// in the executable.
-func Content(dev bool, cfg *config.Config) (http.Handler, error) {
+// in the executable. The pages only list the repos visible lets the
+// request see, every repo when it is nil.
+func Content(dev bool, cfg *config.Config, visible RepoFilter) (http.Handler, error) {
 	if dev {
-		return newDevHandler(cfg)
+		return newDevHandler(cfg, visible)
 	}
 
-	return newPrdHandler(cfg)
+	return newPrdHandler(cfg, visible)
 }
@@ -0,0 +1,468 @@
+package vcs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// The state of the working directory, and the directory a new version
+	// of the archive is extracted into before it replaces the old one.
+	archiveStateFile  = ".hound-archive"
+	archiveExtractDir = ".hound-extract"
+
+	archiveTimeout = time.Hour
+)
+
+func init() {
+	Register(newArchive, "archive")
+}
+
+// The archive driver indexes the contents of a tarball or a zip file at an
+// http(s) url or a local path, for code that isn't in any vcs. A poll
+// fetches the archive again, with the ETag and the time it last changed so
+// an unchanged archive isn't downloaded twice, and the revision is the
+// SHA-256 of the archive. Tarballs may be compressed with gzip or bzip2.
+type ArchiveDriver struct {
+	// Leading path components to remove from the names of the files in
+	// the archive, like tar --strip-components, for archives that hold a
+	// single directory.
+	StripComponents int `json:"strip-components"`
+
+	client *http.Client
+}
+
+// What is known of the archive the working directory was extracted from.
+type archiveState struct {
+	Url          string
+	Rev          string
+	ETag         string    `json:",omitempty"`
+	LastModified string    `json:",omitempty"`
+	Size         int64     `json:",omitempty"`
+	ModTime      time.Time `json:",omitempty"`
+}
+
+func newArchive(b []byte) (Driver, error) {
+	d := &ArchiveDriver{
+		client: &http.Client{Timeout: archiveTimeout},
+	}
+
+	if b != nil {
+		if err := json.Unmarshal(b, d); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.StripComponents < 0 {
+		return nil, fmt.Errorf("vcs: archive strip-components is negative")
+	}
+
+	return d, nil
+}
+
+func isHTTP(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+func readArchiveState(dir string) (*archiveState, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, archiveStateFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var st archiveState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func writeArchiveState(dir string, st *archiveState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, archiveStateFile), b, 0644)
+}
+
+func (d *ArchiveDriver) HeadRev(dir string) (string, error) {
+	st, err := readArchiveState(dir)
+	if err != nil {
+		return "", err
+	}
+	return st.Rev, nil
+}
+
+func (d *ArchiveDriver) Pull(dir string) (string, error) {
+	st, err := readArchiveState(dir)
+	if err != nil {
+		return "", err
+	}
+	return d.fetch(dir, st)
+}
+
+func (d *ArchiveDriver) Clone(dir, url string) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	rev, err := d.fetch(dir, &archiveState{Url: url})
+	if err != nil {
+		// without its state the directory can't be pulled.
+		os.RemoveAll(dir) //nolint
+		return "", err
+	}
+	return rev, nil
+}
+
+// The url is kept in the working directory, so a changed url is fetched
+// from on the next pull.
+func (d *ArchiveDriver) UpdateRemote(dir, url string) error {
+	st, err := readArchiveState(dir)
+	if err != nil {
+		return err
+	}
+
+	if st.Url == url {
+		return nil
+	}
+
+	// a different url is always fetched in full.
+	return writeArchiveState(dir, &archiveState{Url: url, Rev: st.Rev})
+}
+
+func (d *ArchiveDriver) CheckRemote(url string) error {
+	if !isHTTP(url) {
+		file, err := localPath(url)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stat(file)
+		return err
+	}
+
+	res, err := d.client.Head(url)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 400 && res.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("HEAD %s: %s", url, res.Status)
+	}
+	return nil
+}
+
+func (d *ArchiveDriver) SpecialFiles() []string {
+	return []string{archiveStateFile, archiveExtractDir}
+}
+
+// Fetch the archive of the state into dir, unless it hasn't changed since
+// it was last fetched. Returns the revision of the archive.
+func (d *ArchiveDriver) fetch(dir string, st *archiveState) (string, error) {
+	file, changed, err := d.download(st)
+	if err != nil {
+		return "", err
+	}
+
+	if !changed {
+		return st.Rev, writeArchiveState(dir, st)
+	}
+
+	if isHTTP(st.Url) {
+		defer os.Remove(file)
+	}
+
+	rev, err := checksumOf(file)
+	if err != nil {
+		return "", err
+	}
+
+	if rev != st.Rev {
+		if err := d.extract(file, dir); err != nil {
+			return "", fmt.Errorf("vcs: %s: %s", st.Url, err)
+		}
+	}
+
+	st.Rev = rev
+	return rev, writeArchiveState(dir, st)
+}
+
+// Get the archive of the state as a file. Returns false when it hasn't
+// changed since the state was recorded, and otherwise updates the state
+// with what tells when it changes next. A downloaded archive is in a
+// temporary file the caller removes.
+func (d *ArchiveDriver) download(st *archiveState) (string, bool, error) {
+	if !isHTTP(st.Url) {
+		file, err := localPath(st.Url)
+		if err != nil {
+			return "", false, err
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return "", false, err
+		}
+
+		if st.Rev != "" && fi.Size() == st.Size && fi.ModTime().Equal(st.ModTime) {
+			return file, false, nil
+		}
+
+		st.Size, st.ModTime = fi.Size(), fi.ModTime()
+		return file, true, nil
+	}
+
+	req, err := http.NewRequest("GET", st.Url, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	if st.Rev != "" && st.ETag != "" {
+		req.Header.Set("If-None-Match", st.ETag)
+	}
+
+	if st.Rev != "" && st.LastModified != "" {
+		req.Header.Set("If-Modified-Since", st.LastModified)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return "", false, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("vcs: GET %s: %s", st.Url, res.Status)
+	}
+
+	tmp, err := ioutil.TempFile("", "hound-archive-")
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", false, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", false, err
+	}
+
+	st.ETag = res.Header.Get("ETag")
+	st.LastModified = res.Header.Get("Last-Modified")
+	return tmp.Name(), true, nil
+}
+
+// The hex encoded SHA-256 of the contents of a file.
+func checksumOf(file string) (string, error) {
+	h := sha256.New()
+	if err := hashFile(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Replace the contents of dir, other than its state, with those of the
+// archive. The archive is extracted aside first so a broken archive leaves
+// dir as it was.
+func (d *ArchiveDriver) extract(file, dir string) error {
+	tmp := filepath.Join(dir, archiveExtractDir)
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+
+	if err := d.extractTo(file, tmp); err != nil {
+		os.RemoveAll(tmp) //nolint
+		return err
+	}
+
+	old, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range old {
+		if name := fi.Name(); name != archiveStateFile && name != archiveExtractDir {
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range entries {
+		if err := os.Rename(filepath.Join(tmp, fi.Name()), filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(tmp)
+}
+
+// Extract the archive into dst, telling the format by its first bytes.
+func (d *ArchiveDriver) extractTo(file, dst string) error {
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return d.extractZip(file, dst)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return d.extractTar(zr, dst)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return d.extractTar(bzip2.NewReader(br), dst)
+	}
+	return d.extractTar(br, dst)
+}
+
+// The path in dst of the archive entry with the name, or false when the
+// entry is to be skipped because it is stripped or would escape dst.
+func (d *ArchiveDriver) entryPath(dst, name string) (string, bool) {
+	name = path.Clean("/" + strings.Replace(name, "\\", "/", -1))
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(parts) <= d.StripComponents {
+		return "", false
+	}
+
+	rel := path.Join(parts[d.StripComponents:]...)
+	if rel == "" || rel == "." {
+		return "", false
+	}
+	return filepath.Join(dst, filepath.FromSlash(rel)), true
+}
+
+func writeEntry(name string, r io.Reader, mtime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(name, mtime, mtime)
+}
+
+// Extract the directories and regular files of a tarball, links and other
+// kinds of entries are left out.
+func (d *ArchiveDriver) extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name, ok := d.entryPath(dst, hdr.Name)
+		if !ok {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeEntry(name, tr, hdr.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Extract the directories and regular files of a zip file.
+func (d *ArchiveDriver) extractZip(file, dst string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		name, ok := d.entryPath(dst, zf.Name)
+		if !ok {
+			continue
+		}
+
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(name, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !mode.IsRegular() {
+			continue
+		}
+
+		r, err := zf.Open()
+		if err != nil {
+			return err
+		}
+
+		err = writeEntry(name, r, zf.Modified)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package vcs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Tests that a tarball is fetched again only when its ETag changes and
+// that its files replace the old ones.
+func TestArchiveHTTP(t *testing.T) {
+	tarball := makeTarball(t, map[string]string{"sdk/a.h": "int a;", "sdk/b.h": "int b;"})
+	etag := `"1"`
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(tarball) //nolint
+	}))
+	defer srv.Close()
+
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	d, err := New("archive", []byte(`{"strip-components": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "vcs-archive")
+	rev1, err := d.PullOrClone(dir, srv.URL+"/sdk.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "a.h")); err != nil || string(b) != "int a;" {
+		t.Fatalf("expected a.h to be extracted without its directory, got %q, %v", b, err)
+	}
+
+	rev2, err := d.PullOrClone(dir, srv.URL+"/sdk.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev1 != rev2 || gets != 2 {
+		t.Fatalf("expected an unchanged tarball to keep its revision, got %s and %s", rev1, rev2)
+	}
+
+	tarball = makeTarball(t, map[string]string{"sdk/a.h": "int a2;"})
+	etag = `"2"`
+	rev3, err := d.PullOrClone(dir, srv.URL+"/sdk.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev3 == rev1 {
+		t.Fatal("expected the revision to change along with the tarball")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "b.h")); !os.IsNotExist(err) {
+		t.Fatalf("expected b.h to be removed along with the old tarball, got %v", err)
+	}
+
+	if head, err := d.HeadRev(dir); err != nil || head != rev3 {
+		t.Fatalf("expected head revision %s, got %s, %v", rev3, head, err)
+	}
+}
+
+// Tests a zip file at a local path, and that no entry escapes the
+// working directory.
+func TestArchiveLocalZip(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"fw/main.c", "../evil.c"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("int main;")) //nolint
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(tmp, "fw.zip")
+	if err := ioutil.WriteFile(src, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New("archive", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "vcs-zip")
+	if _, err := d.PullOrClone(dir, "file://"+src); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "fw", "main.c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, "evil.c")); err == nil {
+		t.Fatal("expected an entry outside of the working directory to stay inside it")
+	}
+
+	if _, err := New("archive", []byte(`{"strip-components": -1}`)); err == nil {
+		t.Fatal("expected an error for a negative strip-components")
+	}
+}
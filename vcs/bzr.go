@@ -77,3 +77,7 @@ func (g *BzrDriver) SpecialFiles() []string {
 		".bzr",
 	}
 }
+
+func (g *BzrDriver) Executable() string {
+	return "bzr"
+}
@@ -0,0 +1,23 @@
+package vcs
+
+import (
+	"time"
+)
+
+// The metadata of a single commit.
+type Commit struct {
+	Rev     string
+	Author  string
+	Email   string
+	Date    time.Time
+	Message string
+	Paths   []string
+}
+
+// Drivers that are able to read the commit log of a working directory
+// implement this in addition to Driver.
+type CommitLogDriver interface {
+
+	// Fetch and return up to n of the most recent commits, newest first.
+	Log(dir string, n int) ([]*Commit, error)
+}
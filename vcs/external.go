@@ -0,0 +1,113 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+func init() {
+	Register(newExternal, "external")
+}
+
+// The external driver delegates every operation to a user provided
+// executable so that systems hound doesn't know about can be indexed.
+//
+// The executable is run as `command [args...] <op>` where op is one of
+// clone, pull or headrev. A JSON request of the form
+//
+//	{"dir": "/path/to/vcs-dir", "url": "repo url"}
+//
+// is written to its stdin and it must write a JSON response of the form
+//
+//	{"rev": "revision"} or {"error": "what went wrong"}
+//
+// to stdout. A non-zero exit status is also treated as an error.
+type ExternalDriver struct {
+	Command      string   `json:"command"`
+	Args         []string `json:"args"`
+	SpecialNames []string `json:"special-files"`
+}
+
+type externalRequest struct {
+	Dir string `json:"dir"`
+	Url string `json:"url,omitempty"`
+}
+
+type externalResponse struct {
+	Rev   string `json:"rev"`
+	Error string `json:"error"`
+}
+
+func newExternal(b []byte) (Driver, error) {
+	var d ExternalDriver
+
+	if b != nil {
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// Run the executable for the given operation and return the revision it
+// reports.
+func (g *ExternalDriver) run(op, dir, url string) (string, error) {
+	if g.Command == "" {
+		return "", errors.New("vcs: external driver requires a command")
+	}
+
+	req, err := json.Marshal(&externalRequest{Dir: dir, Url: url})
+	if err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{}, g.Args...), op)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(g.Command, args...)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %s: %s", g.Command, op, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var res externalResponse
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return "", fmt.Errorf("%s %s: invalid response: %s", g.Command, op, err)
+	}
+
+	if res.Error != "" {
+		return "", fmt.Errorf("%s %s: %s", g.Command, op, res.Error)
+	}
+
+	if res.Rev == "" {
+		return "", fmt.Errorf("%s %s: no revision in response", g.Command, op)
+	}
+
+	return res.Rev, nil
+}
+
+func (g *ExternalDriver) HeadRev(dir string) (string, error) {
+	return g.run("headrev", dir, "")
+}
+
+func (g *ExternalDriver) Pull(dir string) (string, error) {
+	return g.run("pull", dir, "")
+}
+
+func (g *ExternalDriver) Clone(dir, url string) (string, error) {
+	return g.run("clone", dir, url)
+}
+
+func (g *ExternalDriver) SpecialFiles() []string {
+	return g.SpecialNames
+}
+
+func (g *ExternalDriver) Executable() string {
+	return g.Command
+}
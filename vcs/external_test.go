@@ -0,0 +1,66 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Acts as the executable for the external driver when the test binary is
+// run by it.
+func TestExternalHelperProcess(t *testing.T) {
+	if os.Getenv("HOUND_EXTERNAL_HELPER") != "1" {
+		return
+	}
+
+	var req externalRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(2)
+	}
+
+	switch op := os.Args[len(os.Args)-1]; op {
+	case "clone":
+		fmt.Printf(`{"rev": "cloned %s"}`, req.Url)
+	case "pull":
+		fmt.Printf(`{"rev": "pulled %s"}`, req.Dir)
+	default:
+		fmt.Printf(`{"error": "unsupported %s"}`, op)
+	}
+	os.Exit(0)
+}
+
+func TestExternalDriver(t *testing.T) {
+	os.Setenv("HOUND_EXTERNAL_HELPER", "1")
+	defer os.Unsetenv("HOUND_EXTERNAL_HELPER")
+
+	cfg, err := json.Marshal(map[string]interface{}{
+		"command":       os.Args[0],
+		"args":          []string{"-test.run=TestExternalHelperProcess", "--"},
+		"special-files": []string{".fslckout"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New("external", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev, err := d.Clone("dir", "fossil://repo"); err != nil || rev != "cloned fossil://repo" {
+		t.Fatalf("unexpected clone result: %q, %v", rev, err)
+	}
+
+	if rev, err := d.Pull("dir"); err != nil || rev != "pulled dir" {
+		t.Fatalf("unexpected pull result: %q, %v", rev, err)
+	}
+
+	if _, err := d.HeadRev("dir"); err == nil {
+		t.Fatal("expected error from headrev")
+	}
+
+	if sf := d.SpecialFiles(); len(sf) != 1 || sf[0] != ".fslckout" {
+		t.Fatalf("unexpected special files: %v", sf)
+	}
+}
@@ -1,29 +1,46 @@
 package vcs
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
-const defaultRef = "master"
+const (
+	defaultRef            = "master"
+	defaultSubmoduleDepth = 1
+)
 
 var headBranchRegexp = regexp.MustCompile(`HEAD branch: (?P<branch>.+)`)
 
+// The format of each record in the git log output, fields are separated by
+// the ASCII unit separator and records by the record separator.
+const gitLogFormat = "%x1e%H%x1f%an%x1f%ae%x1f%ct%x1f%B%x1f"
+
+// The partial clone filters that are accepted in the filter option.
+var filterRegexp = regexp.MustCompile(`^(blob:none|blob:limit=\d+[kmg]?|tree:\d+)$`)
+
 func init() {
 	Register(newGit, "git")
 }
 
 type GitDriver struct {
-	DetectRef     bool   `json:"detect-ref"`
-	Ref           string `json:"ref"`
-	refDetetector refDetetector
+	DetectRef      bool   `json:"detect-ref"`
+	Ref            string `json:"ref"`
+	Submodules     bool   `json:"submodules"`
+	SubmoduleDepth int    `json:"submodule-depth"`
+	Filter         string `json:"filter"`
+	refDetetector  refDetetector
 }
 
 type refDetetector interface {
@@ -42,6 +59,10 @@ func newGit(b []byte) (Driver, error) {
 		}
 	}
 
+	if d.Filter != "" && !filterRegexp.MatchString(d.Filter) {
+		return nil, fmt.Errorf("vcs: unsupported git filter %s", d.Filter)
+	}
+
 	d.refDetetector = &headBranchDetector{}
 
 	return &d, nil
@@ -72,16 +93,15 @@ func (g *GitDriver) HeadRev(dir string) (string, error) {
 	return strings.TrimSpace(buf.String()), cmd.Wait()
 }
 
+// Run the command in dir and return its combined output. Failures are
+// returned with the output, so the reason for them reaches the status of
+// the repo rather than only the log.
 func run(desc, dir, cmd string, args ...string) (string, error) {
 	c := exec.Command(cmd, args...)
 	c.Dir = dir
 	out, err := c.CombinedOutput()
 	if err != nil {
-		log.Printf(
-			"Failed to %s %s, see output below\n%sContinuing...",
-			desc,
-			dir,
-			out)
+		return string(out), fmt.Errorf("%s: %s: %s", desc, err, bytes.TrimSpace(out))
 	}
 
 	return string(out), nil
@@ -109,9 +129,50 @@ func (g *GitDriver) Pull(dir string) (string, error) {
 		return "", err
 	}
 
+	if g.Submodules {
+		if err := g.updateSubmodules(dir); err != nil {
+			return "", err
+		}
+	}
+
 	return g.HeadRev(dir)
 }
 
+// The history depth used when fetching submodules. A negative depth fetches
+// the full history.
+func (g *GitDriver) submoduleDepth() int {
+	if g.SubmoduleDepth == 0 {
+		return defaultSubmoduleDepth
+	}
+	return g.SubmoduleDepth
+}
+
+// Initialize and update all submodules, recursively, to the commits
+// recorded in the working directory.
+func (g *GitDriver) updateSubmodules(dir string) error {
+	if _, err := run("git submodule sync", dir,
+		"git",
+		"submodule",
+		"sync",
+		"--recursive"); err != nil {
+		return err
+	}
+
+	args := []string{
+		"submodule",
+		"update",
+		"--init",
+		"--recursive",
+		"--force",
+	}
+	if depth := g.submoduleDepth(); depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+
+	_, err := run("git submodule update", dir, "git", args...)
+	return err
+}
+
 func (g *GitDriver) targetRef(dir string) string {
 	var targetRef string
 	if g.Ref != "" {
@@ -129,28 +190,64 @@ func (g *GitDriver) targetRef(dir string) string {
 
 func (g *GitDriver) Clone(dir, url string) (string, error) {
 	par, rep := filepath.Split(dir)
-	cmd := exec.Command(
-		"git",
+	args := []string{
 		"clone",
 		"--depth", "1",
-		url,
-		rep)
+	}
+
+	// A partial clone leaves blobs (or trees) on the server; git fetches
+	// the ones needed for the working tree on demand and the filter is
+	// remembered for subsequent fetches.
+	if g.Filter != "" {
+		args = append(args, "--filter", g.Filter)
+	}
+
+	cmd := exec.Command(
+		"git",
+		append(args, url, rep)...)
 	cmd.Dir = par
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Failed to clone %s, see output below\n%sContinuing...", url, out)
-		return "", err
+		return "", fmt.Errorf("git clone: %s: %s", err, bytes.TrimSpace(out))
 	}
 
 	return g.Pull(dir)
 }
 
+func (g *GitDriver) UpdateRemote(dir, url string) error {
+	cmd := exec.Command(
+		"git",
+		"remote",
+		"set-url",
+		"origin",
+		url)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git remote set-url: %s: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (g *GitDriver) CheckRemote(url string) error {
+	cmd := exec.Command("git", "ls-remote", url, "HEAD")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git ls-remote: %s: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
 func (g *GitDriver) SpecialFiles() []string {
 	return []string{
 		".git",
 	}
 }
 
+func (g *GitDriver) Executable() string {
+	return "git"
+}
+
 func (d *headBranchDetector) detectRef(dir string) string {
 	output, err := run("git show remote info", dir,
 		"git",
@@ -181,3 +278,257 @@ func (d *headBranchDetector) detectRef(dir string) string {
 
 	return matches[1]
 }
+
+// Run git in dir and return its output, without that of stderr.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(out), nil
+}
+
+// Fetch enough of the history of the target ref for the shallow clone in
+// dir to hold depth commits.
+func (g *GitDriver) deepen(dir string, depth int) error {
+	targetRef := g.targetRef(dir)
+	_, err := gitOutput(dir,
+		"fetch",
+		"--no-tags",
+		"--depth", strconv.Itoa(depth),
+		"origin",
+		fmt.Sprintf("+%s:remotes/origin/%s", targetRef, targetRef))
+	return err
+}
+
+func (g *GitDriver) History(dir string, revs, tags int, pattern string) ([]*HistoryRev, error) {
+	var res []*HistoryRev
+
+	if revs > 0 {
+		if err := g.deepen(dir, revs+1); err != nil {
+			return nil, err
+		}
+
+		out, err := gitOutput(dir,
+			"rev-list",
+			"--skip=1",
+			"--max-count", strconv.Itoa(revs),
+			"HEAD")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rev := range strings.Fields(out) {
+			res = append(res, &HistoryRev{Name: rev, Rev: rev})
+		}
+	}
+
+	if tags > 0 {
+		if pattern == "" {
+			pattern = "*"
+		}
+
+		if _, err := gitOutput(dir,
+			"fetch",
+			"--depth", "1",
+			"origin",
+			fmt.Sprintf("+refs/tags/%s:refs/tags/%s", pattern, pattern)); err != nil {
+			return nil, err
+		}
+
+		out, err := gitOutput(dir,
+			"for-each-ref",
+			// the last sort key is the primary one.
+			"--sort=-v:refname",
+			"--sort=-creatordate",
+			"--count", strconv.Itoa(tags),
+			"--format=%(refname:short)",
+			"refs/tags/"+pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range strings.Fields(out) {
+			rev, err := gitOutput(dir, "rev-parse", tag+"^{commit}")
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, &HistoryRev{Name: tag, Rev: strings.TrimSpace(rev)})
+		}
+	}
+
+	return res, nil
+}
+
+func (g *GitDriver) Export(dir, rev, dst string) error {
+	cmd := exec.Command("git", "archive", "--format=tar", rev)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if err := extractTar(r, dst); err != nil {
+		cmd.Process.Kill() //nolint
+		cmd.Wait()         //nolint
+		return err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return nil
+}
+
+// Parse the output of git log with gitLogFormat and --name-only.
+func parseGitLog(out string) ([]*Commit, error) {
+	var commits []*Commit
+	for _, rec := range strings.Split(out, "\x1e") {
+		if strings.TrimSpace(rec) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(rec, "\x1f", 6)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected git log record: %q", rec)
+		}
+
+		ts, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		var paths []string
+		for _, p := range strings.Split(fields[5], "\n") {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
+
+		commits = append(commits, &Commit{
+			Rev:     fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    time.Unix(ts, 0).UTC(),
+			Message: strings.TrimSpace(fields[4]),
+			Paths:   paths,
+		})
+	}
+	return commits, nil
+}
+
+func (g *GitDriver) Log(dir string, n int) ([]*Commit, error) {
+	// The oldest commit of a shallow clone appears to add every file, so
+	// fetch one more than is needed.
+	if err := g.deepen(dir, n+1); err != nil {
+		return nil, err
+	}
+
+	out, err := gitOutput(dir,
+		"-c", "core.quotePath=false",
+		"log",
+		"--max-count", strconv.Itoa(n),
+		"--name-only",
+		"--format="+gitLogFormat,
+		"HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitLog(out)
+}
+
+// The format of the commits in the git log read for file times, each starts
+// with the record separator and the commit time.
+const gitTimesFormat = "%x1e%ct"
+
+// Read the output of git log with gitTimesFormat and --name-only, setting
+// the time of the newest commit that touched each of the wanted paths.
+// Reading stops once every path has a time, in which case done is true.
+func readFileTimes(r io.Reader, want map[string]bool) (times map[string]time.Time, done bool, err error) {
+	times = map[string]time.Time{}
+	var t time.Time
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for len(times) < len(want) && sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "\x1e") {
+			ts, err := strconv.ParseInt(line[1:], 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("unexpected git log record: %q", line)
+			}
+			t = time.Unix(ts, 0)
+			continue
+		}
+
+		if _, seen := times[line]; want[line] && !seen {
+			times[line] = t
+		}
+	}
+
+	return times, len(times) == len(want), sc.Err()
+}
+
+// Find the time of the last commit to change each tracked file by reading
+// the log back from the head until every file has turned up. Shallow clones
+// only hold part of the history, so files that weren't changed within it get
+// the time of its oldest commit, which is the latest they could have
+// changed.
+func (g *GitDriver) FileTimes(dir string) (map[string]time.Time, error) {
+	files, err := gitOutput(dir, "ls-files", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	want := map[string]bool{}
+	for _, name := range strings.Split(files, "\x00") {
+		if name != "" {
+			want[name] = true
+		}
+	}
+
+	cmd := exec.Command("git",
+		"-c", "core.quotePath=false",
+		"log",
+		"--name-only",
+		"--no-renames",
+		"--format="+gitTimesFormat,
+		"HEAD")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// there is no need for the rest of the history once every file is
+	// found, git is stopped rather than left blocked on its output.
+	times, done, err := readFileTimes(out, want)
+	if done || err != nil {
+		cmd.Process.Kill() //nolint
+		cmd.Wait()         //nolint
+		return times, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git log: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return times, nil
+}
@@ -2,6 +2,7 @@ package vcs
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -83,3 +84,111 @@ func TestTargetRef(t *testing.T) {
 		})
 	}
 }
+
+func TestSubmoduleDepth(t *testing.T) {
+	testCases := []struct {
+		cfg      string
+		expected int
+	}{
+		{`{"submodules": true}`, defaultSubmoduleDepth},
+		{`{"submodules": true, "submodule-depth": 10}`, 10},
+		{`{"submodules": true, "submodule-depth": -1}`, -1},
+	}
+	for _, testCase := range testCases {
+		d, err := New("git", []byte(testCase.cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		git := d.Driver.(*GitDriver)
+		if !git.Submodules {
+			t.Errorf("%s: expected submodules to be enabled", testCase.cfg)
+		}
+
+		if depth := git.submoduleDepth(); depth != testCase.expected {
+			t.Errorf("%s: expected depth %d, got %d", testCase.cfg, testCase.expected, depth)
+		}
+	}
+}
+
+func TestFilterConfig(t *testing.T) {
+	for _, filter := range []string{"blob:none", "blob:limit=1m", "blob:limit=1024", "tree:0"} {
+		if _, err := New("git", []byte(`{"filter": "`+filter+`"}`)); err != nil {
+			t.Errorf("expected filter %s to be valid: %s", filter, err)
+		}
+	}
+
+	for _, filter := range []string{"blob", "sparse:oid=abc", "blob:limit=1t"} {
+		if _, err := New("git", []byte(`{"filter": "`+filter+`"}`)); err == nil {
+			t.Errorf("expected filter %s to be rejected", filter)
+		}
+	}
+}
+
+func TestParseGitLog(t *testing.T) {
+	out := "\x1eabc123\x1fJane Doe\x1fjane@example.com\x1f1500000000\x1fFix the frobber\n\nLonger description.\n\x1f\n\nsrc/frob.go\nREAD ME.md\n" +
+		"\x1edef456\x1fJohn Roe\x1fjohn@example.com\x1f1400000000\x1fInitial commit\n\x1f\n"
+
+	commits, err := parseGitLog(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+
+	c := commits[0]
+	if c.Rev != "abc123" || c.Author != "Jane Doe" || c.Email != "jane@example.com" {
+		t.Errorf("unexpected commit: %+v", c)
+	}
+
+	if c.Message != "Fix the frobber\n\nLonger description." {
+		t.Errorf("unexpected message: %q", c.Message)
+	}
+
+	if c.Date.Unix() != 1500000000 {
+		t.Errorf("unexpected date: %s", c.Date)
+	}
+
+	if len(c.Paths) != 2 || c.Paths[0] != "src/frob.go" || c.Paths[1] != "READ ME.md" {
+		t.Errorf("unexpected paths: %v", c.Paths)
+	}
+
+	if len(commits[1].Paths) != 0 {
+		t.Errorf("expected no paths, got %v", commits[1].Paths)
+	}
+
+	if _, err := parseGitLog("\x1eabc123\x1fJane Doe"); err == nil {
+		t.Error("expected an error for a truncated record")
+	}
+}
+
+func TestReadFileTimes(t *testing.T) {
+	out := "\x1e1500000000\n\nsrc/frob.go\nREAD ME.md\n" +
+		"\x1e1400000000\n\nsrc/frob.go\ngone.go\nmain.go\n" +
+		"\x1e1300000000\n\nmain.go\nother.go\n"
+
+	want := map[string]bool{"src/frob.go": true, "READ ME.md": true, "main.go": true}
+	times, done, err := readFileTimes(strings.NewReader(out), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !done || len(times) != 3 {
+		t.Fatalf("expected times for every file, got %v", times)
+	}
+
+	if times["src/frob.go"].Unix() != 1500000000 || times["main.go"].Unix() != 1400000000 {
+		t.Errorf("unexpected times: %v", times)
+	}
+
+	want["never.go"] = true
+	if _, done, _ := readFileTimes(strings.NewReader(out), want); done {
+		t.Error("expected a file missing from the log not to be done")
+	}
+
+	if _, _, err := readFileTimes(strings.NewReader("\x1eyesterday\n"), want); err == nil {
+		t.Error("expected an error for a bad commit time")
+	}
+}
@@ -79,3 +79,7 @@ func (g *MercurialDriver) SpecialFiles() []string {
 		".hg",
 	}
 }
+
+func (g *MercurialDriver) Executable() string {
+	return "hg"
+}
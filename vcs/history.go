@@ -0,0 +1,82 @@
+package vcs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A revision from the history of a repo that can be indexed alongside
+// its head.
+type HistoryRev struct {
+	// The name users search the revision by, either a tag or the
+	// commit id itself.
+	Name string
+
+	// The commit id of the revision.
+	Rev string
+}
+
+// Drivers that are able to index revisions other than the head implement
+// this in addition to Driver.
+type HistoryDriver interface {
+
+	// Fetch and return up to revs commits preceding the head of the working
+	// directory along with up to tags of the most recent tags matching
+	// pattern.
+	History(dir string, revs, tags int, pattern string) ([]*HistoryRev, error)
+
+	// Write the files of the given revision into the directory dst.
+	Export(dir, rev, dst string) error
+}
+
+// Extract a tar stream into the directory dst. Only regular files and
+// directories are extracted and no entry may escape dst.
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if name != dst && !strings.HasPrefix(name, dst+string(filepath.Separator)) {
+			return fmt.Errorf("vcs: archive entry %s is outside of the destination", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+				return err
+			}
+
+			if err := writeFile(name, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(name string, r io.Reader, perm os.FileMode) error {
+	w, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0200)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
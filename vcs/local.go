@@ -0,0 +1,131 @@
+package vcs
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	localRevMtime    = "mtime"
+	localRevChecksum = "checksum"
+)
+
+func init() {
+	Register(newLocal, "local")
+}
+
+// The local driver indexes a directory that already exists on disk without
+// cloning it. The vcs directory is a link to that directory and the revision
+// is a hash of its file listing, which either includes the modification
+// times of files or the full content of every file.
+type LocalDriver struct {
+	Rev string `json:"rev"`
+}
+
+func newLocal(b []byte) (Driver, error) {
+	var d LocalDriver
+
+	if b != nil {
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+	}
+
+	switch d.Rev {
+	case "":
+		d.Rev = localRevMtime
+	case localRevMtime, localRevChecksum:
+	default:
+		return nil, fmt.Errorf("vcs: local rev must be %s or %s, got %s",
+			localRevMtime, localRevChecksum, d.Rev)
+	}
+
+	return &d, nil
+}
+
+// Convert a repo url into a path on disk. Both file:// urls and plain paths
+// are accepted.
+func localPath(url string) (string, error) {
+	return filepath.Abs(filepath.FromSlash(strings.TrimPrefix(url, "file://")))
+}
+
+func hashFile(h hash.Hash, path string) error {
+	r, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(h, r)
+	return err
+}
+
+func (g *LocalDriver) HeadRev(dir string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), info.Mode())
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if g.Rev == localRevChecksum {
+			return hashFile(h, path)
+		}
+
+		return binary.Write(h, binary.LittleEndian, []int64{
+			info.Size(),
+			info.ModTime().UnixNano(),
+		})
+	}); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (g *LocalDriver) Pull(dir string) (string, error) {
+	return g.HeadRev(dir)
+}
+
+func (g *LocalDriver) Clone(dir, url string) (string, error) {
+	path, err := localPath(url)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+
+	if err := os.Symlink(path, dir); err != nil {
+		return "", err
+	}
+
+	return g.HeadRev(dir)
+}
+
+func (g *LocalDriver) SpecialFiles() []string {
+	return []string{}
+}
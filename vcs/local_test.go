@@ -0,0 +1,61 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the local driver links the directory and that the revision
+// changes along with the directory's content.
+func TestLocalRev(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	if err := os.Mkdir(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rev := range []string{localRevMtime, localRevChecksum} {
+		d, err := New("local", []byte(`{"rev": "`+rev+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join(tmp, "vcs-"+rev)
+		rev1, err := d.PullOrClone(dir, "file://"+src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "a.txt")); err != nil {
+			t.Fatalf("%s: directory was not linked: %s", rev, err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(src, "b.txt"), []byte(rev), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		rev2, err := d.PullOrClone(dir, "file://"+src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rev1 == rev2 {
+			t.Fatalf("%s: expected revision to change after adding a file", rev)
+		}
+	}
+
+	if _, err := New("local", []byte(`{"rev": "bogus"}`)); err == nil {
+		t.Fatal("expected error for invalid rev option")
+	}
+}
@@ -0,0 +1,154 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var changeRegexp = regexp.MustCompile(`^Change (\d+) `)
+
+func init() {
+	Register(newP4, "p4", "perforce")
+}
+
+// The perforce driver syncs a client workspace that maps the depot path
+// given as the repo url (i.e. //depot/project) into the vcs directory. The
+// latest changelist in the workspace is used as the revision.
+type P4Driver struct {
+	Port   string `json:"port"`
+	User   string `json:"user"`
+	Ticket string `json:"ticket"`
+	Client string `json:"client"`
+}
+
+func newP4(b []byte) (Driver, error) {
+	var d P4Driver
+
+	if b != nil {
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// The name of the client workspace for the given directory. Unless one is
+// configured, it is derived from the directory so that each repo gets its
+// own workspace.
+func (g *P4Driver) clientFor(dir string) string {
+	if g.Client != "" {
+		return g.Client
+	}
+	return "hound-" + filepath.Base(dir)
+}
+
+// Normalize a depot path to one that includes every file beneath it.
+func depotView(url string) string {
+	url = strings.TrimRight(url, "/")
+	if strings.HasSuffix(url, "/...") {
+		return url
+	}
+	return url + "/..."
+}
+
+// Generate the spec for a client workspace mapping the depot path into root.
+func clientSpec(client, root, url string) string {
+	return fmt.Sprintf("Client: %s\n"+
+		"Root: %s\n"+
+		"Options: allwrite clobber nocompress unlocked nomodtime rmdir\n"+
+		"LineEnd: local\n"+
+		"View:\n"+
+		"\t%s //%s/...\n",
+		client,
+		root,
+		depotView(url),
+		client)
+}
+
+// Run p4 in dir with the connection settings for this driver.
+func (g *P4Driver) p4(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("p4", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "P4CLIENT="+g.clientFor(dir))
+	if g.Port != "" {
+		cmd.Env = append(cmd.Env, "P4PORT="+g.Port)
+	}
+	if g.User != "" {
+		cmd.Env = append(cmd.Env, "P4USER="+g.User)
+	}
+	if g.Ticket != "" {
+		// p4 accepts a ticket anywhere a password is accepted.
+		cmd.Env = append(cmd.Env, "P4PASSWD="+g.Ticket)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	return cmd.CombinedOutput()
+}
+
+// Extract the changelist number from the output of p4 changes.
+func parseChange(out []byte) (string, error) {
+	m := changeRegexp.FindSubmatch(bytes.TrimSpace(out))
+	if m == nil {
+		return "", fmt.Errorf("unexpected output from p4 changes: %s", out)
+	}
+	return string(m[1]), nil
+}
+
+func (g *P4Driver) HeadRev(dir string) (string, error) {
+	out, err := g.p4(dir, nil,
+		"changes",
+		"-m1",
+		fmt.Sprintf("//%s/...#have", g.clientFor(dir)))
+	if err != nil {
+		return "", fmt.Errorf("p4 changes: %s: %s", err, out)
+	}
+
+	return parseChange(out)
+}
+
+func (g *P4Driver) Pull(dir string) (string, error) {
+	out, err := g.p4(dir, nil, "sync", "-q")
+	if err != nil {
+		log.Printf("Failed to p4 sync %s, see output below\n%sContinuing...", dir, out)
+		return "", err
+	}
+
+	return g.HeadRev(dir)
+}
+
+func (g *P4Driver) Clone(dir, url string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	spec := clientSpec(g.clientFor(dir), root, url)
+	out, err := g.p4(root, []byte(spec), "client", "-i")
+	if err != nil {
+		log.Printf("Failed to create p4 client for %s, see output below\n%sContinuing...", url, out)
+		return "", err
+	}
+
+	return g.Pull(dir)
+}
+
+func (g *P4Driver) SpecialFiles() []string {
+	return []string{}
+}
+
+func (g *P4Driver) Executable() string {
+	return "p4"
+}
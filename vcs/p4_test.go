@@ -0,0 +1,54 @@
+package vcs
+
+import (
+	"testing"
+)
+
+// Tests that the p4 driver is able to parse its config.
+func TestP4Config(t *testing.T) {
+	cfg := `{"port" : "ssl:perforce:1666", "user" : "hound", "ticket" : "ABC123"}`
+
+	d, err := New("p4", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p4 := d.Driver.(*P4Driver)
+	if p4.Port != "ssl:perforce:1666" {
+		t.Fatalf("expected port of \"ssl:perforce:1666\", got %s", p4.Port)
+	}
+
+	if p4.clientFor("/data/vcs-abc") != "hound-vcs-abc" {
+		t.Fatalf("unexpected client name %s", p4.clientFor("/data/vcs-abc"))
+	}
+}
+
+func TestP4ClientSpec(t *testing.T) {
+	expected := "Client: hound-x\n" +
+		"Root: /data/vcs-x\n" +
+		"Options: allwrite clobber nocompress unlocked nomodtime rmdir\n" +
+		"LineEnd: local\n" +
+		"View:\n" +
+		"\t//depot/project/... //hound-x/...\n"
+
+	for _, url := range []string{"//depot/project", "//depot/project/", "//depot/project/..."} {
+		if spec := clientSpec("hound-x", "/data/vcs-x", url); spec != expected {
+			t.Errorf("unexpected spec for %s:\n%s", url, spec)
+		}
+	}
+}
+
+func TestP4ParseChange(t *testing.T) {
+	rev, err := parseChange([]byte("Change 12345 on 2020/01/01 by dev@ws 'Fix things'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rev != "12345" {
+		t.Fatalf("expected rev of 12345, got %s", rev)
+	}
+
+	if _, err := parseChange([]byte("")); err == nil {
+		t.Fatal("expected error for empty output")
+	}
+}
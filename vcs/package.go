@@ -0,0 +1,208 @@
+package vcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultGoProxy     = "https://proxy.golang.org"
+	defaultNpmRegistry = "https://registry.npmjs.org"
+	defaultPyPI        = "https://pypi.org"
+)
+
+func init() {
+	Register(newPackage, "package")
+}
+
+// The package driver indexes the source of a version of a third-party
+// package, fetched from its registry, so dependencies can be searched along
+// with the code that uses them. The repo url names the package as
+// go:<module>@<version>, npm:<name>@<version> or pypi:<name>@<version>. Go
+// modules are fetched from the module proxy, npm packages as the tarball
+// the registry serves and PyPI packages as their source distribution. The
+// source is fetched and extracted as by the archive driver.
+type PackageDriver struct {
+	GoProxy     string `json:"go-proxy"`
+	NpmRegistry string `json:"npm-registry"`
+	PyPI        string `json:"pypi"`
+
+	// The package last resolved and its archive, which a pull fetches.
+	url        string
+	archive    *ArchiveDriver
+	archiveUrl string
+}
+
+func newPackage(b []byte) (Driver, error) {
+	d := &PackageDriver{
+		GoProxy:     defaultGoProxy,
+		NpmRegistry: defaultNpmRegistry,
+		PyPI:        defaultPyPI,
+	}
+
+	if b != nil {
+		if err := json.Unmarshal(b, d); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Split the url of a repo of the package vcs into the registry, the name
+// and the version of the package.
+func ParsePackage(url string) (string, string, string, error) {
+	i := strings.Index(url, ":")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("vcs: package %q is not <registry>:<name>@<version>", url)
+	}
+	registry, spec := url[:i], url[i+1:]
+
+	// npm scopes start with an @ too.
+	j := strings.LastIndex(spec, "@")
+	if j <= 0 || j == len(spec)-1 {
+		return "", "", "", fmt.Errorf("vcs: package %q has no version", url)
+	}
+	return registry, spec[:j], spec[j+1:], nil
+}
+
+// Escape a module path or version for the module proxy, which writes upper
+// case letters as ! followed by the letter in lower case.
+func escapeModule(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Resolve a package url to the url of its archive and the driver that
+// extracts it.
+func (d *PackageDriver) resolve(url string) (*ArchiveDriver, string, error) {
+	registry, name, version, err := ParsePackage(url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	a := &ArchiveDriver{client: &http.Client{Timeout: archiveTimeout}}
+	switch registry {
+	case "go":
+		// the files of a module zip are beneath <module>@<version>/.
+		a.StripComponents = strings.Count(name, "/") + 1
+		u := fmt.Sprintf("%s/%s/@v/%s.zip", strings.TrimSuffix(d.GoProxy, "/"), escapeModule(name), escapeModule(version))
+		return a, u, nil
+	case "npm":
+		// the files of a tarball are beneath package/.
+		a.StripComponents = 1
+		u := fmt.Sprintf("%s/%s/-/%s-%s.tgz", strings.TrimSuffix(d.NpmRegistry, "/"), name, path.Base(name), version)
+		return a, u, nil
+	case "pypi":
+		// the files of a source distribution are beneath <name>-<version>/.
+		a.StripComponents = 1
+		u, err := d.sdistUrl(a.client, name, version)
+		return a, u, err
+	}
+	return nil, "", fmt.Errorf("vcs: unknown package registry %q, expected go, npm or pypi", registry)
+}
+
+// Look up the url of the source distribution of a version of a PyPI
+// package.
+func (d *PackageDriver) sdistUrl(client *http.Client, name, version string) (string, error) {
+	u := fmt.Sprintf("%s/pypi/%s/%s/json", strings.TrimSuffix(d.PyPI, "/"), name, version)
+	res, err := client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vcs: GET %s: %s", u, res.Status)
+	}
+
+	var release struct {
+		Urls []struct {
+			PackageType string `json:"packagetype"`
+			Url         string `json:"url"`
+		} `json:"urls"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return "", err
+	}
+
+	for _, f := range release.Urls {
+		if f.PackageType == "sdist" {
+			return f.Url, nil
+		}
+	}
+	return "", fmt.Errorf("vcs: %s %s has no source distribution", name, version)
+}
+
+// Resolve the url unless it was the last one resolved.
+func (d *PackageDriver) archiveFor(url string) (*ArchiveDriver, string, error) {
+	if d.archive != nil && d.url == url {
+		return d.archive, d.archiveUrl, nil
+	}
+
+	a, u, err := d.resolve(url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	d.url, d.archive, d.archiveUrl = url, a, u
+	return a, u, nil
+}
+
+func (d *PackageDriver) HeadRev(dir string) (string, error) {
+	return (&ArchiveDriver{}).HeadRev(dir)
+}
+
+// A pull fetches the archive of the url last given to Clone or
+// UpdateRemote, which PullOrClone always calls first. A version of a
+// package doesn't change once it is published, so it is only fetched again
+// when the url names another one.
+func (d *PackageDriver) Pull(dir string) (string, error) {
+	if d.archive == nil {
+		return "", fmt.Errorf("vcs: the package in %s is unknown", dir)
+	}
+
+	if st, err := readArchiveState(dir); err == nil && st.Url == d.archiveUrl && st.Rev != "" {
+		return st.Rev, nil
+	}
+	return d.archive.Pull(dir)
+}
+
+func (d *PackageDriver) Clone(dir, url string) (string, error) {
+	a, u, err := d.archiveFor(url)
+	if err != nil {
+		return "", err
+	}
+	return a.Clone(dir, u)
+}
+
+func (d *PackageDriver) UpdateRemote(dir, url string) error {
+	a, u, err := d.archiveFor(url)
+	if err != nil {
+		return err
+	}
+	return a.UpdateRemote(dir, u)
+}
+
+func (d *PackageDriver) CheckRemote(url string) error {
+	a, u, err := d.resolve(url)
+	if err != nil {
+		return err
+	}
+	return a.CheckRemote(u)
+}
+
+func (d *PackageDriver) SpecialFiles() []string {
+	return (&ArchiveDriver{}).SpecialFiles()
+}
@@ -0,0 +1,95 @@
+package vcs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that packages of each registry are fetched from where the registry
+// serves them and extracted without their leading directories.
+func TestPackage(t *testing.T) {
+	var modZip bytes.Buffer
+	zw := zip.NewWriter(&modZip)
+	w, err := zw.Create("github.com/Foo/bar@v1.0.0/bar.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("package bar")) //nolint
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var srv *httptest.Server
+	gets := map[string]int{}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets[r.URL.Path]++
+		switch r.URL.Path {
+		case "/github.com/!foo/bar/@v/v1.0.0.zip":
+			w.Write(modZip.Bytes()) //nolint
+		case "/@scope/pkg/-/pkg-1.2.3.tgz":
+			w.Write(makeTarball(t, map[string]string{"package/index.js": "module.exports = 1;"})) //nolint
+		case "/pypi/requests/2.0.0/json":
+			w.Write([]byte(`{"urls": [{"packagetype": "bdist_wheel", "url": "` + srv.URL + `/r.whl"},
+				{"packagetype": "sdist", "url": "` + srv.URL + `/r.tar.gz"}]}`)) //nolint
+		case "/r.tar.gz":
+			w.Write(makeTarball(t, map[string]string{"requests-2.0.0/api.py": "def get(): pass"})) //nolint
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	cfg := []byte(`{"go-proxy": "` + srv.URL + `", "npm-registry": "` + srv.URL + `", "pypi": "` + srv.URL + `"}`)
+	for url, file := range map[string]string{
+		"go:github.com/Foo/bar@v1.0.0": "bar.go",
+		"npm:@scope/pkg@1.2.3":         "index.js",
+		"pypi:requests@2.0.0":          "api.py",
+	} {
+		d, err := New("package", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join(tmp, filepath.Base(file))
+		rev, err := d.PullOrClone(dir, url)
+		if err != nil {
+			t.Fatalf("%s: %s", url, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Fatalf("%s: %s", url, err)
+		}
+
+		// a published version isn't fetched again.
+		if again, err := d.PullOrClone(dir, url); err != nil || again != rev {
+			t.Fatalf("%s: expected the revision to stay %s, got %s, %v", url, rev, again, err)
+		}
+	}
+
+	if n := gets["/github.com/!foo/bar/@v/v1.0.0.zip"]; n != 1 {
+		t.Errorf("expected the module to be fetched once, got %d", n)
+	}
+
+	d, err := New("package", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{"go:github.com/Foo/bar", "cargo:serde@1.0.0", "requests"} {
+		if _, err := d.Clone(filepath.Join(tmp, "bad"), url); err == nil {
+			t.Errorf("expected an error for package %q", url)
+		}
+	}
+}
@@ -31,9 +31,24 @@ func newSvn(b []byte) (Driver, error) {
 	return &d, nil
 }
 
+// The arguments common to all svn commands. Hound never prompts and only
+// passes credentials when they are configured so anonymous access to
+// public repositories still works.
+func (g *SVNDriver) args(args ...string) []string {
+	args = append(args, "--non-interactive")
+	if g.Username != "" {
+		args = append(args, "--username", g.Username)
+	}
+	if g.Password != "" {
+		args = append(args, "--password", g.Password, "--no-auth-cache")
+	}
+	return args
+}
+
 func (g *SVNDriver) HeadRev(dir string) (string, error) {
 	cmd := exec.Command(
-		"svnversion")
+		"svn",
+		g.args("info", "--show-item", "last-changed-revision")...)
 	cmd.Dir = dir
 	r, err := cmd.StdoutPipe()
 	if err != nil {
@@ -57,12 +72,7 @@ func (g *SVNDriver) HeadRev(dir string) (string, error) {
 func (g *SVNDriver) Pull(dir string) (string, error) {
 	cmd := exec.Command(
 		"svn",
-		"update",
-		"--ignore-externals",
-		"--username",
-		g.Username,
-		"--password",
-		g.Password)
+		g.args("update", "--ignore-externals")...)
 	cmd.Dir = dir
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -77,14 +87,7 @@ func (g *SVNDriver) Clone(dir, url string) (string, error) {
 	par, rep := filepath.Split(dir)
 	cmd := exec.Command(
 		"svn",
-		"checkout",
-		"--ignore-externals",
-		"--username",
-		g.Username,
-		"--password",
-		g.Password,
-		url,
-		rep)
+		g.args("checkout", "--ignore-externals", url, rep)...)
 	cmd.Dir = par
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -100,3 +103,7 @@ func (g *SVNDriver) SpecialFiles() []string {
 		".svn",
 	}
 }
+
+func (g *SVNDriver) Executable() string {
+	return "svn"
+}
@@ -1,6 +1,7 @@
 package vcs
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,17 @@ func TestSvnConfig(t *testing.T) {
 		t.Fatalf("expected password of \"svn_password\", got %s", svn.Password)
 	}
 }
+
+// Tests that credentials are only passed to svn when they are configured.
+func TestSvnArgs(t *testing.T) {
+	anon := &SVNDriver{}
+	if args := strings.Join(anon.args("update"), " "); args != "update --non-interactive" {
+		t.Fatalf("unexpected args for anonymous access: %s", args)
+	}
+
+	auth := &SVNDriver{Username: "u", Password: "p"}
+	expected := "update --non-interactive --username u --password p --no-auth-cache"
+	if args := strings.Join(auth.args("update"), " "); args != expected {
+		t.Fatalf("expected args %q, got %q", expected, args)
+	}
+}
@@ -0,0 +1,14 @@
+package vcs
+
+import (
+	"time"
+)
+
+// Drivers that can tell when each file in a working directory last changed
+// implement this in addition to Driver.
+type FileTimesDriver interface {
+
+	// Return the time of the last commit to change each file at the head
+	// of the working directory, by path relative to it.
+	FileTimes(dir string) (map[string]time.Time, error)
+}
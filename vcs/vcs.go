@@ -28,6 +28,30 @@ type Driver interface {
 	SpecialFiles() []string
 }
 
+// Drivers that keep the remote url in the working directory implement this
+// so that changes to the url, like a rotated credential, are picked up.
+type remoteUpdater interface {
+
+	// Point the working directory at the given remote url.
+	UpdateRemote(dir, url string) error
+}
+
+// Drivers that can check that a remote url can be reached, without cloning
+// it, implement this.
+type RemoteChecker interface {
+
+	// Return an error if the repo at the url can't be read.
+	CheckRemote(url string) error
+}
+
+// Drivers that run an executable implement this, so it can be checked that
+// the executable is installed.
+type ExecutableDriver interface {
+
+	// Return the name, or the path, of the executable.
+	Executable() string
+}
+
 // An API to interact with a vcs working directory. This is
 // what clients will interact with.
 type WorkDir struct {
@@ -71,6 +95,11 @@ func exists(path string) bool {
 // if the working directory is absent and pulling otherwise.
 func (w *WorkDir) PullOrClone(dir, url string) (string, error) {
 	if exists(dir) {
+		if u, ok := w.Driver.(remoteUpdater); ok {
+			if err := u.UpdateRemote(dir, url); err != nil {
+				return "", err
+			}
+		}
 		return w.Pull(dir)
 	}
 	return w.Clone(dir, url)
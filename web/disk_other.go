@@ -0,0 +1,10 @@
+// +build !linux,!darwin,!freebsd
+
+package web
+
+import "errors"
+
+// Disk space is only reported where statfs is supported.
+func diskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk space is not supported on this platform")
+}
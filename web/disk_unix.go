@@ -0,0 +1,14 @@
+// +build linux darwin freebsd
+
+package web
+
+import "syscall"
+
+// The free and total bytes of the file system holding path.
+func diskSpace(path string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,189 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The state of the server as reported by the detailed health check. It is
+// healthy when there are no problems. The check needs no access key, so it
+// only gives counts and leaves out the names, revs and errors of repos and
+// the paths on the host, which /api/v1/status gives to those allowed.
+type health struct {
+	Healthy  bool
+	Problems []string `json:",omitempty"`
+	Repos    *repoHealth
+	Vcs      map[string]bool
+	Disk     *diskHealth `json:",omitempty"`
+}
+
+// How many repos there are and how many of them are in each state, along
+// with the longest it has been since one last updated without error.
+type repoHealth struct {
+	Total          int
+	Stale          int `json:",omitempty"`
+	Failing        int `json:",omitempty"`
+	Unhealthy      int `json:",omitempty"`
+	Paused         int `json:",omitempty"`
+	Archived       int `json:",omitempty"`
+	MaxStalenessMs int64
+}
+
+// The space on the file system holding the dbpath.
+type diskHealth struct {
+	FreeBytes  uint64
+	TotalBytes uint64
+	Low        bool `json:",omitempty"`
+
+	// The space the dbpath itself takes, when it has been measured, and
+	// whether that is more than the max-size-mb of the config.
+	UsedBytes  int64 `json:",omitempty"`
+	OverBudget bool  `json:",omitempty"`
+}
+
+// Determine whether the health check should give the detailed state of the
+// server rather than only whether it is up.
+func wantsDetail(r *http.Request) bool {
+	b, _ := strconv.ParseBool(r.FormValue("detail"))
+	return b
+}
+
+// Check the repos, the vcs executables and the disk space against the
+// thresholds of the config.
+func (s *Server) checkHealth(idx map[string]*searcher.Searcher, now time.Time) *health {
+	h := &health{
+		Repos: &repoHealth{Total: len(idx)},
+		Vcs:   map[string]bool{},
+	}
+
+	var maxStaleness time.Duration
+	var minFree uint64
+	if c := s.cfg.HealthCheck; c != nil {
+		maxStaleness = time.Duration(c.MaxStalenessMs) * time.Millisecond
+		minFree = uint64(c.MinFreeMB) << 20
+	}
+
+	if idx == nil {
+		h.Problems = append(h.Problems, "the indexes are not built yet")
+	}
+
+	rh := h.Repos
+	for _, sr := range idx {
+		st := sr.Status()
+		staleness := now.Sub(st.LastUpdated)
+		if ms := int64(staleness / time.Millisecond); ms > rh.MaxStalenessMs {
+			rh.MaxStalenessMs = ms
+		}
+
+		// paused and archived repos are expected to go stale.
+		if maxStaleness > 0 && !st.Paused && !st.Archived && staleness > maxStaleness {
+			rh.Stale++
+		}
+
+		if st.LastError != "" {
+			rh.Failing++
+		}
+
+		if st.Unhealthy {
+			rh.Unhealthy++
+		}
+
+		if st.Paused {
+			rh.Paused++
+		}
+
+		if st.Archived {
+			rh.Archived++
+		}
+	}
+
+	if rh.Stale > 0 {
+		h.Problems = append(h.Problems,
+			fmt.Sprintf("%d repos have not updated for more than %s", rh.Stale, maxStaleness))
+	}
+
+	if rh.Unhealthy > 0 {
+		h.Problems = append(h.Problems,
+			fmt.Sprintf("%d repos have failed to update too many times in a row", rh.Unhealthy))
+	}
+
+	names := make([]string, 0, len(idx))
+	for name := range idx {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := s.cfg.Repos[name]
+		if repo == nil {
+			continue
+		}
+
+		wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+		if err != nil {
+			continue
+		}
+
+		d, ok := wd.Driver.(vcs.ExecutableDriver)
+		if !ok {
+			continue
+		}
+
+		if _, seen := h.Vcs[d.Executable()]; seen {
+			continue
+		}
+
+		_, err = exec.LookPath(d.Executable())
+		h.Vcs[d.Executable()] = err == nil
+		if err != nil {
+			h.Problems = append(h.Problems, fmt.Sprintf("%s is not installed", d.Executable()))
+		}
+	}
+
+	if free, total, err := diskSpace(s.cfg.DbPath); err == nil {
+		h.Disk = &diskHealth{
+			FreeBytes:  free,
+			TotalBytes: total,
+			Low:        free < minFree,
+		}
+
+		if h.Disk.Low {
+			h.Problems = append(h.Problems, fmt.Sprintf("%d MB are free under the dbpath", free>>20))
+		}
+
+		if u := searcher.DiskUsageOf(idx); u != nil {
+			h.Disk.UsedBytes, h.Disk.OverBudget = u.Total, u.OverBudget
+			if u.OverBudget {
+				h.Problems = append(h.Problems,
+					fmt.Sprintf("the dbpath takes %d MB, more than max-size-mb of %d", u.Total>>20, u.MaxSize>>20))
+			}
+		}
+	}
+
+	h.Healthy = len(h.Problems) == 0
+	return h
+}
+
+// Serve the detailed health check, which fails with a 503 when there are
+// problems so it can be used as a readiness probe.
+func (s *Server) serveHealth(w http.ResponseWriter) {
+	s.lck.RLock()
+	idx := s.idx
+	s.lck.RUnlock()
+
+	h := s.checkHealth(idx, time.Now())
+
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	if !h.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h) //nolint
+}
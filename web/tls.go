@@ -0,0 +1,181 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// How often the certificate files are checked for changes.
+const certCheckInterval = 10 * time.Second
+
+// The protocols offered to clients. They must be set on the config served to
+// each client, which otherwise leaves HTTP/2 off.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// Serves the certificate and client CAs from the files in the config and
+// loads them again when the files change, so rotated certificates are
+// picked up without a restart.
+type certReloader struct {
+	cfg        *config.TLSConfig
+	clientAuth tls.ClientAuthType
+
+	lck     sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+func newTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls requires cert-file and key-file")
+	}
+
+	r := &certReloader{
+		cfg:        cfg,
+		clientAuth: tls.NoClientCert,
+	}
+
+	if cfg.ClientCAFile != "" {
+		switch cfg.ClientAuth {
+		case "", "require":
+			r.clientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			r.clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown tls client-auth: %q", cfg.ClientAuth)
+		}
+	}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetCertificate:     r.certificate,
+		GetConfigForClient: r.configForClient,
+		NextProtos:         nextProtos,
+	}, nil
+}
+
+// Check that the tls options of the config can be used to serve HTTPS.
+func ValidateTLS(cfg *config.Config) error {
+	if cfg.TLS == nil {
+		return nil
+	}
+
+	_, err := newTLSConfig(cfg.TLS)
+	return err
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// The most recent modification time of the certificate files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range r.files() {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	return nil
+}
+
+// Load the files again if they have changed since they were last loaded.
+// The current certificate is kept when the new one can't be loaded, i.e.
+// because only one of the files has been replaced so far.
+func (r *certReloader) reload(now time.Time) {
+	if now.Sub(r.checked) < certCheckInterval {
+		return
+	}
+	r.checked = now
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		log.Printf("Failed to check tls certificate: %s", err)
+		return
+	}
+
+	if modTime.Equal(r.modTime) {
+		return
+	}
+
+	if err := r.load(modTime); err != nil {
+		log.Printf("Failed to reload tls certificate: %s", err)
+		return
+	}
+	log.Printf("Reloaded tls certificate from %s", r.cfg.CertFile)
+}
+
+func (r *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	r.reload(time.Now())
+	return r.cert, nil
+}
+
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	r.reload(time.Now())
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*r.cert},
+		ClientCAs:    r.pool,
+		ClientAuth:   r.clientAuth,
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   nextProtos,
+	}, nil
+}
@@ -1,8 +1,10 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/hound-search/hound/api"
@@ -19,13 +21,23 @@ type Server struct {
 	cfg *config.Config
 	dev bool
 	ch  chan error
+	srv *http.Server
 
 	mux *http.ServeMux
+	idx map[string]*searcher.Searcher
 	lck sync.RWMutex
+
+	// The progress of the first indexing of the repos, which is served
+	// before the mux is.
+	progress *searcher.Progress
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == s.cfg.HealthCheckURI {
+		if wantsDetail(r) {
+			s.serveHealth(w)
+			return
+		}
 		fmt.Fprintln(w, "👍")
 		return
 	}
@@ -34,6 +46,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer s.lck.RUnlock()
 	if m := s.mux; m != nil {
 		m.ServeHTTP(w, r)
+	} else if r.URL.Path == "/api/v1/indexing-progress" {
+		api.WithRequestId(api.ProgressHandler(s.progress)).ServeHTTP(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/api/") {
+		api.WithRequestId(api.NotReadyHandler(s.progress)).ServeHTTP(w, r)
 	} else {
 		http.Error(w,
 			"Hound is not ready.",
@@ -41,45 +57,88 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) serveWith(m *http.ServeMux) {
+// The progress of the first indexing of the repos, which is to be given to
+// searcher.MakeAll.
+func (s *Server) Progress() *searcher.Progress {
+	return s.progress
+}
+
+func (s *Server) serveWith(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 	s.lck.Lock()
 	defer s.lck.Unlock()
 	s.mux = m
+	s.idx = idx
 }
 
-// Start creates a new server that will immediately start handling HTTP traffic.
-// The HTTP server will return 200 on the health check, but a 503 on every other
-// request until ServeWithIndex is called to begin serving search traffic with
-// the given searchers.
-func Start(cfg *config.Config, addr string, dev bool) *Server {
+// Start creates a new server that will immediately start handling HTTP traffic,
+// or HTTPS traffic if the config has tls options. The server will return 200 on
+// the health check and the indexing progress, but a 503 on every other request
+// until ServeWithIndex is called to begin serving search traffic with the given
+// searchers.
+func Start(cfg *config.Config, addr string, dev bool) (*Server, error) {
 	ch := make(chan error)
 
+	names := make([]string, 0, len(cfg.Repos))
+	for name := range cfg.Repos {
+		names = append(names, name)
+	}
+
 	s := &Server{
-		cfg: cfg,
-		dev: dev,
-		ch:  ch,
+		cfg:      cfg,
+		dev:      dev,
+		ch:       ch,
+		progress: searcher.NewProgress(names),
 	}
 
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+	s.srv = srv
+
+	if cfg.TLS == nil {
+		go func() {
+			ch <- srv.ListenAndServe()
+		}()
+		return s, nil
+	}
+
+	tc, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = tc
+
 	go func() {
-		ch <- http.ListenAndServe(addr, s)
+		ch <- srv.ListenAndServeTLS("", "")
 	}()
 
-	return s
+	return s, nil
+}
+
+// Shutdown stops the server from accepting connections and waits for the
+// requests in flight, such as searches, to complete or for the context to
+// be done. ServeWithIndex then returns http.ErrServerClosed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
 }
 
 // ServeWithIndex allow the server to start offering the search UI and the
 // search APIs operating on the given indexes.
 func (s *Server) ServeWithIndex(idx map[string]*searcher.Searcher) error {
-	h, err := ui.Content(s.dev, s.cfg)
+	m := http.NewServeMux()
+	visible, err := api.Setup(m, idx, s.cfg, s.progress)
 	if err != nil {
 		return err
 	}
 
-	m := http.NewServeMux()
+	h, err := ui.Content(s.dev, s.cfg, visible)
+	if err != nil {
+		return err
+	}
 	m.Handle("/", h)
-	api.Setup(m, idx)
 
-	s.serveWith(m)
+	s.serveWith(m, idx)
 
 	return <-s.ch
 }